@@ -0,0 +1,131 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+// active response: probes of blocked hosts are answered like closed ports, a tcp probe with
+// a rst and a udp probe with icmp port unreachable, so every port of the host looks closed and
+// scanners finish early instead of waiting on ports the firewall now drops
+// answers are sent from a raw socket, at most active_response_rate per second
+var (
+	activeSend func(dst net.IP, packet []byte) error
+
+	activeRateLock  sync.Mutex
+	activeRateSec   int64
+	activeRateCount int
+)
+
+// false if active_response_rate answers were sent within this second
+func allowActiveResponse() bool {
+	if cfgActiveResponseRate <= 0 {
+		return true
+	}
+	now := time.Now().Unix()
+	activeRateLock.Lock()
+	defer activeRateLock.Unlock()
+	if now != activeRateSec {
+		activeRateSec, activeRateCount = now, 0
+	}
+	if activeRateCount >= cfgActiveResponseRate {
+		return false
+	}
+	activeRateCount++
+	return true
+}
+
+// ipv4 header from src to dst, checksummed
+func replyIPv4Header(b []byte, src net.IP, dst net.IP, proto uint8) {
+	b[0] = 0x45
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)))
+	b[8] = 64
+	b[9] = proto
+	copy(b[12:16], src.To4())
+	copy(b[16:20], dst.To4())
+	var sum uint32
+	for i := 0; i < 20; i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	binary.BigEndian.PutUint16(b[10:], ^uint16(sum))
+}
+
+// rst for a tcp probe without ack to a closed port, rfc 793 page 65:
+// <SEQ=0><ACK=SEG.SEQ+SEG.LEN><CTL=RST,ACK>
+func tcpResetFor(ip *IPv4Header, tcp *TCPHeader, segment []byte) []byte {
+	segLen := uint32(len(segment) - int(tcp.DataOffset)*4)
+	if int(tcp.DataOffset)*4 > len(segment) {
+		segLen = 0
+	}
+	if tcp.HasFlag(SYN) {
+		segLen++
+	}
+	if tcp.HasFlag(FIN) {
+		segLen++
+	}
+
+	b := make([]byte, 40)
+	replyIPv4Header(b, ip.Destination, ip.Source, protoTCP)
+	t := b[20:]
+	binary.BigEndian.PutUint16(t[0:], tcp.Destination)
+	binary.BigEndian.PutUint16(t[2:], tcp.Source)
+	binary.BigEndian.PutUint32(t[8:], tcp.SeqNum+segLen)
+	t[12] = 5 << 4
+	t[13] = RST | ACK
+	reply := IPv4Header{Source: ip.Destination, Destination: ip.Source, Protocol: protoTCP}
+	binary.BigEndian.PutUint16(t[16:], ^reply.transportSum(t))
+	return b
+}
+
+// icmp port unreachable for a udp probe, quoting its ip header and first 8 bytes
+func icmpUnreachableFor(ip *IPv4Header, packet []byte) []byte {
+	quote := packet[:min(len(packet), int(ip.IHL)+8)]
+	b := make([]byte, 28+len(quote))
+	replyIPv4Header(b, ip.Destination, ip.Source, protoICMP)
+	m := b[20:]
+	m[0], m[1] = 3, 3 // destination unreachable, port unreachable
+	copy(m[8:], quote)
+	var sum uint32
+	for i := 0; i+1 < len(m); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(m[i:]))
+	}
+	if len(m)%2 != 0 {
+		sum += uint32(m[len(m)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	binary.BigEndian.PutUint16(m[2:], ^uint16(sum))
+	return b
+}
+
+// answer a probe of a blocked host, packet is what was captured
+func activeRespond(ip *IPv4Header, tcp *TCPHeader, packet []byte) {
+	if activeSend == nil || !isBlockedIP(ip.Source.String()) {
+		return
+	}
+	if !allowActiveResponse() {
+		statsAdd(&stats.activeLimited)
+		return
+	}
+	var reply []byte
+	if tcp != nil {
+		reply = tcpResetFor(ip, tcp, ip.Payload(packet))
+	} else {
+		reply = icmpUnreachableFor(ip, packet)
+	}
+	if err := activeSend(ip.Source, reply); err != nil {
+		logDebug("answer probe of %s failed:%s", ip.Source, err.Error())
+		return
+	}
+	statsAdd(&stats.activeResponses)
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// raw socket writing whole ip packets
+func startActiveResponse() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_RAW, syscall.IPPROTO_RAW)
+	if err != nil {
+		return err
+	}
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_HDRINCL, 1); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	syscall.CloseOnExec(fd)
+	activeSend = func(dst net.IP, packet []byte) error {
+		addr := &syscall.SockaddrInet4{}
+		copy(addr.Addr[:], dst.To4())
+		return syscall.Sendto(fd, packet, 0, addr)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import "errors"
+
+// windows doesn't send tcp over raw sockets
+func startActiveResponse() error {
+	return errors.New("active response is not supported on windows")
+}
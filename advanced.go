@@ -0,0 +1,96 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// advanced mode, like portsentry's atcp and audp
+// with advanced_ports set, the ports up to it not listening at startup are all watched, and a probe
+// to one is an attack without checking the port by binding it; the listening ports are read again
+// every advanced_refresh seconds, so services started or stopped since are taken into account by
+// then; ports above advanced_ports are still checked by smartVerify
+// unlike smartVerify a port is seen as listening on any address, whatever address it's bound to
+
+var (
+	cfgAdvancedPorts   int // 0 means off
+	cfgAdvancedRefresh = 300
+
+	advancedLock    sync.RWMutex
+	advancedInUse   map[int]bool // listening ports up to advanced_ports, nil before the first read
+	advancedFailing bool         // last read failed, logged once
+)
+
+// whether port is in use by the snapshot, ok is false if it's not covered by advanced mode
+func advancedPortInUse(port int) (inUse bool, ok bool) {
+	if cfgAdvancedPorts <= 0 || port > cfgAdvancedPorts {
+		return false, false
+	}
+	advancedLock.RLock()
+	snapshot := advancedInUse
+	advancedLock.RUnlock()
+	if snapshot == nil {
+		return false, false
+	}
+	statsAdd(&stats.snapshotHits)
+	return snapshot[port] || cfgContainerNetworks == containerProtect && isPublishedPort(port), true
+}
+
+// port usage for inspectPacket, by the advanced snapshot or smartVerify
+// the snapshot is of portguard's own network namespace, guards in others always verify
+func portInUse(laddr net.IP, port int, netns string) bool {
+	if netns == "" {
+		if inUse, ok := advancedPortInUse(port); ok {
+			return inUse
+		}
+	}
+	return smartVerify(laddr, port, netns)
+}
+
+// read the listening ports up to advanced_ports again
+func refreshAdvanced() {
+	ls, err := listeningPorts()
+	if err != nil {
+		if !advancedFailing {
+			logMain(false, "read listening ports for advanced mode failed:%s, keeping the last ones", err.Error())
+		}
+		advancedFailing = true
+		return
+	}
+	advancedFailing = false
+	inUse := make(map[int]bool)
+	for _, l := range ls {
+		if l.port > 0 && l.port <= cfgAdvancedPorts {
+			inUse[l.port] = true
+		}
+	}
+	advancedLock.Lock()
+	old := advancedInUse
+	advancedInUse = inUse
+	advancedLock.Unlock()
+	if old == nil {
+		logMain(false, "advanced mode: %d of %d %s ports listening, the others are watched", len(inUse), cfgAdvancedPorts, *mode)
+		return
+	}
+	for port := range inUse {
+		if !old[port] {
+			logMain(false, "advanced mode: %s port %d is listening now", *mode, port)
+		}
+	}
+	for port := range old {
+		if !inUse[port] {
+			logMain(false, "advanced mode: %s port %d is no longer listening, it's watched", *mode, port)
+		}
+	}
+}
+
+func runAdvancedRefresh() {
+	for range time.Tick(time.Duration(cfgAdvancedRefresh) * time.Second) {
+		refreshAdvanced()
+	}
+}
@@ -0,0 +1,100 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// blocklist aggregation
+// with blocklist_aggregate, contiguous blocked addresses are published as the fewest prefixes
+// covering exactly them, e.g. 10.0.0.0 to 10.0.0.3 as 10.0.0.0/30
+// blocklist_max_entries caps the list for routers with small acl limits: prefixes are widened a
+// bit at a time, down to blocklist_min_prefix, until they fit, which blocks the neighbours of
+// blocked hosts too; if they still don't fit, the prefixes with the most blocked hosts are kept
+
+var (
+	cfgBlocklistAggregate  bool
+	cfgBlocklistMaxEntries int // 0 for no cap
+	cfgBlocklistMinPrefix  = 24
+)
+
+type blockPrefix struct {
+	addr  uint32
+	bits  int
+	hosts int // blocked hosts in it
+}
+
+func (c blockPrefix) String() string {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, c.addr)
+	return fmt.Sprintf("%s/%d", ip, c.bits)
+}
+
+func prefixMask(bits int) uint32 {
+	return ^uint32(0) << (32 - bits)
+}
+
+// the fewest prefixes covering addrs, each widened to bits first; addrs must be sorted
+func aggregateAddrs(addrs []uint32, bits int) []blockPrefix {
+	var stack []blockPrefix
+	for _, addr := range addrs {
+		addr &= prefixMask(bits)
+		// already covered by the last prefix, maybe merged from this one
+		if n := len(stack); n > 0 && addr&prefixMask(stack[n-1].bits) == stack[n-1].addr {
+			stack[n-1].hosts++
+			continue
+		}
+		stack = append(stack, blockPrefix{addr, bits, 1})
+		// merge siblings into their parent while possible
+		for n := len(stack); n >= 2; n = len(stack) {
+			a, b := stack[n-2], stack[n-1]
+			if a.bits != b.bits || a.bits == 0 || a.addr&prefixMask(a.bits-1) != a.addr || b.addr != a.addr|1<<(32-a.bits) {
+				break
+			}
+			stack = append(stack[:n-2], blockPrefix{a.addr, a.bits - 1, a.hosts + b.hosts})
+		}
+	}
+	return stack
+}
+
+// the blocklist as prefixes, aggregated and capped as configured
+func blocklistPrefixes() []string {
+	ips := blockedIps()
+	if !cfgBlocklistAggregate && cfgBlocklistMaxEntries <= 0 {
+		prefixes := make([]string, len(ips))
+		for i, ip := range ips {
+			prefixes[i] = ip + "/32"
+		}
+		return prefixes
+	}
+
+	addrs := make([]uint32, 0, len(ips))
+	for _, ip := range ips {
+		if v4 := net.ParseIP(ip).To4(); v4 != nil {
+			addrs = append(addrs, ipToUint32(v4))
+		}
+	}
+	var cidrs []blockPrefix
+	for bits := 32; bits >= cfgBlocklistMinPrefix; bits-- {
+		if cidrs = aggregateAddrs(addrs, bits); cfgBlocklistMaxEntries <= 0 || len(cidrs) <= cfgBlocklistMaxEntries {
+			break
+		}
+	}
+	if cfgBlocklistMaxEntries > 0 && len(cidrs) > cfgBlocklistMaxEntries {
+		logDebug("blocklist has %d prefixes at /%d, keeping %d", len(cidrs), cfgBlocklistMinPrefix, cfgBlocklistMaxEntries)
+		sort.SliceStable(cidrs, func(i, j int) bool { return cidrs[i].hosts > cidrs[j].hosts })
+		cidrs = cidrs[:cfgBlocklistMaxEntries]
+		sort.Slice(cidrs, func(i, j int) bool { return cidrs[i].addr < cidrs[j].addr })
+	}
+	prefixes := make([]string, len(cidrs))
+	for i, c := range cidrs {
+		prefixes[i] = c.String()
+	}
+	return prefixes
+}
@@ -0,0 +1,40 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+// reflection probes
+// a udp probe of a reflection service carrying the query that makes it amplify, e.g. ntp monlist
+// or memcached stats, is reconnaissance for reflection attacks, or the attack itself with a forged
+// source; it's raised as its own scan type, amplification in scan_type_action, scan_type_weight and
+// scan_type_trigger, and only alarms unless set otherwise, the source is often the victim
+
+const udpPacketTypeAmplification = "UDP amplification probe"
+
+// payload class of the amplifying query of a reflection service, by port
+var amplificationPayloads = map[int]string{
+	123:   "ntp-monlist",
+	161:   "snmp",
+	1900:  "ssdp",
+	11211: "memcached",
+}
+
+// chargen answers any datagram
+const chargenPort = 19
+
+func isAmplificationProbe(port int, payload string) bool {
+	if port == chargenPort {
+		return true
+	}
+	class, ok := amplificationPayloads[port]
+	return ok && class == payload
+}
+
+// scan type of a udp probe of port with a payload of class payload
+func udpScanType(port int, payload string) string {
+	if isAmplificationProbe(port, payload) {
+		return udpPacketTypeAmplification
+	}
+	return "UDP scan"
+}
@@ -0,0 +1,144 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// anomaly baseline
+// probes of closed ports are counted per hour, as probes, unique sources and unique ports, and the
+// last anomaly_hours hours make a baseline of each, their mean; when the current hour goes over
+// anomaly_factor times the baseline, or a whole hour stays under 1/anomaly_factor of it, an ops
+// alert "anomaly" says so, once per count and hour; a slow campaign from many hosts probing a few
+// ports each never reaches scan_trigger for any of them but shows as sources over the baseline
+// alerts start after anomaly_learn hours, and need anomaly_min of the count, or of its baseline
+// for a drop, so quiet hosts don't alert on a handful of probes
+
+const opsAnomaly = "anomaly"
+
+// sources counted in an hour at most, more count as this many
+const anomalySourcesMax = 1 << 16
+
+var (
+	cfgAnomalyFactor = 0 // off
+	cfgAnomalyHours  = 168
+	cfgAnomalyLearn  = 24
+	cfgAnomalyMin    = 20
+
+	anomalyLock    sync.Mutex
+	anomalyProbes  int
+	anomalySources = make(map[string]bool)
+	anomalyPorts   = make(map[int]bool)
+	anomalyHistory []anomalyCounts // of the last hours, oldest first
+)
+
+// counts of an hour
+type anomalyCounts [3]int
+
+var anomalyNames = [3]string{"probes", "unique sources", "unique ports"}
+
+// count a probe of a closed port for the baseline
+func noteAnomaly(host string, port int) {
+	if cfgAnomalyFactor <= 0 {
+		return
+	}
+	anomalyLock.Lock()
+	anomalyProbes++
+	if len(anomalySources) < anomalySourcesMax {
+		anomalySources[host] = true
+	}
+	anomalyPorts[port] = true
+	anomalyLock.Unlock()
+}
+
+// counts of the current hour; anomalyLock held
+func currentAnomalyCounts() anomalyCounts {
+	return anomalyCounts{anomalyProbes, len(anomalySources), len(anomalyPorts)}
+}
+
+// mean of the baseline hours, false while still learning; anomalyLock held
+func anomalyBaseline() ([3]float64, bool) {
+	var mean [3]float64
+	if len(anomalyHistory) < cfgAnomalyLearn || len(anomalyHistory) == 0 {
+		return mean, false
+	}
+	for _, h := range anomalyHistory {
+		for i, n := range h {
+			mean[i] += float64(n)
+		}
+	}
+	for i := range mean {
+		mean[i] /= float64(len(anomalyHistory))
+	}
+	return mean, true
+}
+
+// end the current hour: it joins the baseline after being checked for drops
+func rollAnomalyHour() []string {
+	anomalyLock.Lock()
+	defer anomalyLock.Unlock()
+	counts := currentAnomalyCounts()
+	var msgs []string
+	if mean, ok := anomalyBaseline(); ok {
+		for i, n := range counts {
+			if mean[i] >= float64(cfgAnomalyMin) && float64(n)*float64(cfgAnomalyFactor) < mean[i] {
+				msgs = append(msgs, fmt.Sprintf("probe anomaly: %d %s in the last hour, under 1/%d of the baseline of %.1f an hour",
+					n, anomalyNames[i], cfgAnomalyFactor, mean[i]))
+			}
+		}
+	}
+	anomalyHistory = append(anomalyHistory, counts)
+	if len(anomalyHistory) > cfgAnomalyHours {
+		anomalyHistory = anomalyHistory[len(anomalyHistory)-cfgAnomalyHours:]
+	}
+	anomalyProbes = 0
+	anomalySources = make(map[string]bool)
+	anomalyPorts = make(map[int]bool)
+	return msgs
+}
+
+// counts of the current hour over the baseline, skipping those in alerted
+func checkAnomalyRise(alerted *[3]bool) []string {
+	anomalyLock.Lock()
+	defer anomalyLock.Unlock()
+	mean, ok := anomalyBaseline()
+	if !ok {
+		return nil
+	}
+	var msgs []string
+	for i, n := range currentAnomalyCounts() {
+		if alerted[i] || n < cfgAnomalyMin || float64(n) <= mean[i]*float64(cfgAnomalyFactor) {
+			continue
+		}
+		alerted[i] = true
+		ratio := float64(n)
+		if mean[i] > 0 {
+			ratio /= mean[i]
+		}
+		msgs = append(msgs, fmt.Sprintf("probe anomaly: %d %s this hour, %.1fx the baseline of %.1f an hour",
+			n, anomalyNames[i], ratio, mean[i]))
+	}
+	return msgs
+}
+
+func runAnomalyWatch() {
+	hour := time.Now().Truncate(time.Hour)
+	var alerted [3]bool
+	for now := range time.Tick(time.Minute) {
+		var msgs []string
+		if h := now.Truncate(time.Hour); !h.Equal(hour) {
+			hour, alerted = h, [3]bool{}
+			msgs = rollAnomalyHour()
+		}
+		msgs = append(msgs, checkAnomalyRise(&alerted)...)
+		for _, msg := range msgs {
+			statsAdd(&stats.anomalies)
+			opsAlert(opsAnomaly, "ip4:"+*mode, "", serverIp, msg)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+)
+
+// api tokens
+// api_token = <role> <token> lines, repeatable, give control_socket clients and the http
+// endpoints a role:
+//   read      host, health, status and export, and the http endpoints
+//   operator  read, and block, unblock, trust and request
+//   admin     everything, like import, debug, trace, profile and reload
+// once one is set, a control_socket command must start with "auth <token>"; portguard
+// subcommands send the highest token of the config they read
+// "reload" on control_socket, or SIGHUP, reads api_token lines of the config files again, so tokens
+// are rotated without a restart; files must be readable after chroot and dropping privileges
+
+const (
+	roleRead     = "read"
+	roleOperator = "operator"
+	roleAdmin    = "admin"
+)
+
+var (
+	roleRanks = map[string]int{roleRead: 0, roleOperator: 1, roleAdmin: 2}
+
+	// least role of a control command, admin if not listed
+	commandRoles = map[string]string{
+		"host":    roleRead,
+		"health":  roleRead,
+		"status":  roleRead,
+		"export":  roleRead,
+		"block":   roleOperator,
+		"unblock": roleOperator,
+		"trust":   roleOperator,
+		"request": roleOperator,
+	}
+
+	apiTokenLock sync.RWMutex
+	cfgApiTokens []apiToken
+)
+
+type apiToken struct {
+	role  string
+	token string
+}
+
+// api_token = read|operator|admin <token>
+func parseApiToken(lineno int, token string, value string) apiToken {
+	t, ok := readApiToken(value)
+	if !ok {
+		logMain(true, "line %d:%s, invalid value:%s, should be read, operator or admin and a token", lineno, token, value)
+	}
+	return t
+}
+
+func readApiToken(value string) (apiToken, bool) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return apiToken{}, false
+	}
+	_, ok := roleRanks[fields[0]]
+	return apiToken{role: fields[0], token: fields[1]}, ok
+}
+
+func hasApiTokens() bool {
+	apiTokenLock.RLock()
+	defer apiTokenLock.RUnlock()
+	return len(cfgApiTokens) > 0
+}
+
+// role of token, empty if it's unknown
+func tokenRole(token string) string {
+	apiTokenLock.RLock()
+	defer apiTokenLock.RUnlock()
+	role := ""
+	for _, t := range cfgApiTokens {
+		// compare with all of them, so the time taken tells nothing
+		if subtle.ConstantTimeCompare([]byte(t.token), []byte(token)) == 1 {
+			role = t.role
+		}
+	}
+	return role
+}
+
+// least role that may run control command cmd
+func commandRole(cmd string) string {
+	if role, ok := commandRoles[cmd]; ok {
+		return role
+	}
+	return roleAdmin
+}
+
+// take "auth <token>" off a control command, and check its role may run it
+func authorizeControl(fields []string) ([]string, error) {
+	if len(fields) >= 2 && fields[0] == "auth" {
+		role := tokenRole(fields[1])
+		fields = fields[2:]
+		if role == "" {
+			return nil, errors.New("invalid token")
+		}
+		if len(fields) > 0 && roleRanks[role] < roleRanks[commandRole(fields[0])] {
+			return nil, errors.New(fields[0] + " needs role " + commandRole(fields[0]))
+		}
+		return fields, nil
+	}
+	if hasApiTokens() {
+		return nil, errors.New("token required, send auth <token> <command>")
+	}
+	return fields, nil
+}
+
+// token of the highest role, sent by portguard subcommands; empty if none is set
+func controlToken() string {
+	apiTokenLock.RLock()
+	defer apiTokenLock.RUnlock()
+	best := -1
+	token := ""
+	for _, t := range cfgApiTokens {
+		if roleRanks[t.role] > best {
+			best, token = roleRanks[t.role], t.token
+		}
+	}
+	return token
+}
+
+// read api_token lines of the config files and environment again
+func reloadApiTokens() (int, error) {
+	var tokens []apiToken
+	for _, file := range cfgFiles {
+		var values []string
+		var err error
+		if file == configStdin {
+			values, err = apiTokenValues(strings.NewReader(stdinConfig()))
+		} else {
+			var f *os.File
+			if f, err = os.Open(chrootPath(file)); err != nil {
+				return 0, err
+			}
+			values, err = apiTokenValues(f)
+			f.Close()
+		}
+		if err != nil {
+			return 0, err
+		}
+		for _, value := range values {
+			t, ok := readApiToken(value)
+			if !ok {
+				return 0, errors.New("invalid api_token in " + file)
+			}
+			tokens = append(tokens, t)
+		}
+	}
+	// like applyConfigEnv, a line per value
+	for _, value := range strings.Split(os.Getenv(configEnvPrefix+"API_TOKEN"), "\n") {
+		if t, ok := readApiToken(expandConfigEnv(value)); ok {
+			tokens = append(tokens, t)
+		}
+	}
+	apiTokenLock.Lock()
+	cfgApiTokens = tokens
+	apiTokenLock.Unlock()
+	logMain(false, "reloaded %d api tokens", len(tokens))
+	return len(tokens), nil
+}
+
+// values of api_token lines of a config file, includes are read as files of their own
+func apiTokenValues(r io.Reader) ([]string, error) {
+	var values []string
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if isUciConfig(string(data)) {
+		keys, err := uciKeys(string(data))
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			if k.token == "api_token" {
+				values = append(values, k.value)
+			}
+		}
+		return values, nil
+	}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		if line := s.Text(); !strings.HasPrefix(line, "#") {
+			if token, value := parseToken(line); token == "api_token" {
+				values = append(values, expandConfigEnv(value))
+			}
+		}
+	}
+	return values, nil
+}
+
+// reload
+func controlReload(args []string) (interface{}, error) {
+	n, err := reloadApiTokens()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"api_tokens": n}, nil
+}
+
+// SIGHUP reloads api tokens
+func runReloadSignal() {
+	if len(reloadSignals) == 0 {
+		return
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, reloadSignals...)
+	for range sigs {
+		if _, err := reloadApiTokens(); err != nil {
+			logMain(false, "reload api tokens failed:%s", err.Error())
+		}
+	}
+}
+
+// tokens per role, for configEcho
+func apiTokenString() string {
+	counts := make(map[string]int)
+	for _, t := range cfgApiTokens {
+		counts[t.role]++
+	}
+	return fmt.Sprintf("read:%d operator:%d admin:%d", counts[roleRead], counts[roleOperator], counts[roleAdmin])
+}
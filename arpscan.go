@@ -0,0 +1,91 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// arp sweeps
+// on linux, arp requests on the interfaces guarded, all of them if interface isn't set, are read
+// from an af_packet socket; a mac asking for arp_scan_threshold addresses within arp_scan_window
+// seconds sweeps the local segment, like arp-scan or nmap -sn do, and its sender address is raised
+// as an "ARP sweep" alarm through scoring, policy and responders; arp in scan_type_action, it only
+// alarms unless set otherwise, the sender address of an arp request is easily forged
+// gratuitous requests, probes from 0.0.0.0 and macs in ignore_mac are skipped
+
+const (
+	arpPacketTypeSweep = "ARP sweep"
+	protoArp           = "ARP"
+
+	// senders kept before quiet ones are forgotten
+	arpMaxSenders = 4096
+)
+
+var (
+	cfgArpScanThreshold int // addresses asked for by one mac, 0 disables it
+	cfgArpScanWindow    = 10
+
+	arpLock    sync.Mutex
+	arpSenders = make(map[string]*arpSender) // mac -> requests of its window
+)
+
+type arpSender struct {
+	start   int64 // of the window, unix seconds
+	targets map[[4]byte]bool
+	alarmed bool
+}
+
+// note a request of mac from sender for target on iface, and raise an alarm once mac asked for
+// arp_scan_threshold addresses in its window
+func noteArpRequest(mac net.HardwareAddr, sender net.IP, target net.IP, iface string) {
+	if sender.IsUnspecified() || sender.Equal(target) || isIgnoredIP(sender) {
+		return
+	}
+	for _, m := range cfgIgnoreMacs {
+		if bytes.Equal(m, mac) {
+			return
+		}
+	}
+	now := time.Now()
+	key := mac.String()
+
+	arpLock.Lock()
+	s := arpSenders[key]
+	if s == nil || now.Unix()-s.start >= int64(cfgArpScanWindow) {
+		if s == nil && len(arpSenders) >= arpMaxSenders {
+			for m, old := range arpSenders {
+				if now.Unix()-old.start >= int64(cfgArpScanWindow) {
+					delete(arpSenders, m)
+				}
+			}
+		}
+		s = &arpSender{start: now.Unix(), targets: make(map[[4]byte]bool)}
+		arpSenders[key] = s
+	}
+	// the threshold already tells a sweep, more targets needn't be kept
+	if len(s.targets) < cfgArpScanThreshold {
+		var t [4]byte
+		copy(t[:], target.To4())
+		s.targets[t] = true
+	}
+	sweep := !s.alarmed && len(s.targets) >= cfgArpScanThreshold
+	if sweep {
+		s.alarmed = true
+	}
+	arpLock.Unlock()
+
+	if !sweep {
+		return
+	}
+	statsAdd(&stats.arpSweeps)
+	ev := &event{Time: now, Kind: eventAlarm, Host: sender.String(), Proto: protoArp, ScanType: arpPacketTypeSweep, Iface: iface,
+		Message: fmt.Sprintf("mac: %s, %d addresses in %ds", mac, cfgArpScanThreshold, cfgArpScanWindow)}
+	raiseAlarm(sender, nil, ev, profileFor(iface))
+}
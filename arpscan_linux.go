@@ -0,0 +1,82 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+)
+
+const (
+	ethPArp = 0x0806
+
+	arpOpRequest = 1
+	arpLen       = 28 // of an ethernet ipv4 arp packet
+)
+
+// open an af_packet socket for arp on each guarded interface, before dropping privileges
+func startArpScan() error {
+	ifaces := cfgInterfaces
+	if len(ifaces) == 0 {
+		ifaces = []string{""}
+	}
+	for _, iface := range ifaces {
+		fd, err := openArpSocket(iface)
+		if err != nil {
+			return err
+		}
+		go runArpScan(fd, iface)
+	}
+	return nil
+}
+
+func openArpSocket(iface string) (int, error) {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, int(htons(ethPArp)))
+	if err != nil {
+		return -1, err
+	}
+	sa := &syscall.SockaddrLinklayer{Protocol: htons(ethPArp)}
+	if iface != "" {
+		ifi, err := net.InterfaceByName(iface)
+		if err != nil {
+			syscall.Close(fd)
+			return -1, err
+		}
+		sa.Ifindex = ifi.Index
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// read arp packets, link layer removed, and note the requests of other hosts
+func runArpScan(fd int, iface string) {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := syscall.Recvfrom(fd, buf, 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			logMain(false, "read arp on interface %q failed:%s", iface, err.Error())
+			return
+		}
+		sll, ok := from.(*syscall.SockaddrLinklayer)
+		if !ok || sll.Pkttype == syscall.PACKET_OUTGOING || n < arpLen {
+			continue
+		}
+		p := buf[:n]
+		// ethernet, ipv4, 6 byte macs and 4 byte addresses
+		if binary.BigEndian.Uint16(p[0:2]) != arphrdEther || binary.BigEndian.Uint16(p[2:4]) != ethPIp ||
+			p[4] != 6 || p[5] != 4 || binary.BigEndian.Uint16(p[6:8]) != arpOpRequest {
+			continue
+		}
+		mac := net.HardwareAddr(append([]byte{}, p[8:14]...))
+		noteArpRequest(mac, net.IPv4(p[14], p[15], p[16], p[17]).To4(), net.IPv4(p[24], p[25], p[26], p[27]).To4(), iface)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import "errors"
+
+func startArpScan() error {
+	return errors.New("arp sweep detection is only supported on linux")
+}
@@ -0,0 +1,69 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// origin asn of hosts, from a maxmind GeoLite2-ASN-Blocks-IPv4.csv file
+var asnTable ipTable
+
+func loadAsnDb(file string) error {
+	t, err := loadCsvTable(file, func(row map[string]string) (int, string, bool) {
+		asn, err := strconv.Atoi(row["autonomous_system_number"])
+		if err != nil {
+			return 0, "", false
+		}
+		return asn, row["autonomous_system_organization"], true
+	})
+	if err != nil {
+		return err
+	}
+	geoLock.Lock()
+	asnTable = t
+	geoLock.Unlock()
+	atomic.StoreInt64(&asnDbAt, geoipFileTime(file))
+	return nil
+}
+
+// asn and organization of ip, 0 if unknown
+func lookupAsn(ip net.IP) (int, string) {
+	geoLock.RLock()
+	defer geoLock.RUnlock()
+	if r := asnTable.lookup(ip); r != nil {
+		return r.value, r.name
+	}
+	return 0, ""
+}
+
+// asn_block = 14061, AS16509, ...
+func parseAsns(lineno int, token string, value string, asns map[int]bool) {
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(field)), "AS")
+		asn, err := strconv.Atoi(field)
+		if err != nil || asn <= 0 {
+			logMain(true, "line %d:%s, invalid asn:%s", lineno, token, field)
+		}
+		asns[asn] = true
+	}
+}
+
+// decision of asn_never_block and asn_block for ev
+func asnPolicy(ev *event) string {
+	if ev.ASN == 0 {
+		return policyDefault
+	}
+	if cfgAsnNeverBlock[ev.ASN] {
+		return policyAlarm
+	}
+	if cfgAsnBlock[ev.ASN] {
+		return policyBlock
+	}
+	return policyDefault
+}
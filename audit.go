@@ -0,0 +1,100 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// audit_log gets one json object per responder run, appended and never rotated by portguard,
+// so operators can show what was changed on the system and when:
+//
+//	{"start":"...","end":"...","responder":"kill_route","action":"block","target":"1.2.3.4",
+//	 "command":"run /sbin/iptables -I INPUT -s 1.2.3.4 -j DROP","status":"ok","exit_code":0,"output":"..."}
+type auditRecord struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Responder string    `json:"responder"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Command   string    `json:"command"`
+	Attempt   int       `json:"attempt,omitempty"`
+	Status    string    `json:"status"`
+	ExitCode  *int      `json:"exit_code,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Output    string    `json:"output,omitempty"`
+}
+
+var auditLock sync.Mutex
+
+type auditOutputKey struct{}
+
+// ctx whose commands and requests keep the start of their output for the audit log
+func withAuditOutput(ctx context.Context) (context.Context, *capWriter) {
+	if cfgAuditLog == nil {
+		return ctx, nil
+	}
+	w := &capWriter{max: 1024}
+	return context.WithValue(ctx, auditOutputKey{}, w), w
+}
+
+func auditOutputOf(ctx context.Context) *capWriter {
+	w, _ := ctx.Value(auditOutputKey{}).(*capWriter)
+	return w
+}
+
+// append a record of a responder run, err is what it returned
+func auditResponder(r responder, action string, target string, command string, attempt int, start time.Time, err error, output *capWriter) {
+	if cfgAuditLog == nil {
+		return
+	}
+	rec := auditRecord{
+		Start:     start,
+		End:       time.Now(),
+		Responder: r.Name(),
+		Action:    action,
+		Target:    target,
+		Command:   command,
+		Attempt:   attempt,
+		Status:    "ok",
+	}
+	if err != nil {
+		rec.Status = "error"
+		rec.Error = err.Error()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code := exitErr.ExitCode()
+		rec.ExitCode = &code
+	} else if err == nil {
+		switch r.(type) {
+		case *cmdResponder, *undoCmdResponder, *pluginResponder:
+			code := 0
+			rec.ExitCode = &code
+		}
+	}
+	if output != nil {
+		rec.Output = strings.TrimSpace(output.buf.String())
+	}
+	// commands keep their > and & readable
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if enc.Encode(rec) != nil {
+		return
+	}
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	if _, werr := cfgAuditLog.Write(buf.Bytes()); werr != nil {
+		logMain(false, "write audit_log %s failed:%s", cfgAuditLogPath, werr.Error())
+	}
+}
@@ -0,0 +1,429 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// block hosts with deny entries in an ec2 network acl
+// security groups can only allow, so a nacl is used
+// the rule number of each host's entry is only known to the nacl, so the entries in portguard's
+// rule range are read back at start and before the first change: entries of hosts restored from
+// state_file are found again, and those of blocks that expired while portguard was stopped removed
+
+const (
+	ec2ApiVersion = "2016-11-15"
+	imdsEndpoint  = "http://169.254.169.254"
+	awsTimeout    = 10 * time.Second
+)
+
+var (
+	awsClient = &http.Client{Timeout: awsTimeout}
+
+	awsLock       sync.Mutex
+	awsCreds      *awsCredentials
+	awsNaclRules  = make(map[string]int) // ip -> nacl rule number, cidr for entries not added by portguard
+	awsNaclLoaded bool
+	awsRegionName string
+)
+
+type awsCredentials struct {
+	accessKey string
+	secretKey string
+	token     string
+	expires   time.Time // zero if never
+}
+
+// credentials from environment, shared credentials file, or instance metadata, like the sdk does
+func loadAwsCredentials() (*awsCredentials, error) {
+	if ak, sk := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); ak != "" && sk != "" {
+		return &awsCredentials{accessKey: ak, secretKey: sk, token: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+	if creds, err := awsSharedCredentials(); err == nil {
+		return creds, nil
+	}
+	return awsInstanceCredentials()
+}
+
+func awsSharedCredentials() (*awsCredentials, error) {
+	file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		file = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	creds := &awsCredentials{}
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		token, value := parseToken(line)
+		switch token {
+		case "aws_access_key_id":
+			creds.accessKey = value
+		case "aws_secret_access_key":
+			creds.secretKey = value
+		case "aws_session_token":
+			creds.token = value
+		}
+	}
+	if creds.accessKey == "" || creds.secretKey == "" {
+		return nil, fmt.Errorf("no credentials for profile %s in %s", profile, file)
+	}
+	return creds, nil
+}
+
+// imdsv2 request
+func imdsGet(path string) (string, error) {
+	req, _ := http.NewRequest("PUT", imdsEndpoint+"/latest/api/token", nil)
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	resp, err := awsClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	token, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	req, _ = http.NewRequest("GET", imdsEndpoint+path, nil)
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	resp, err = awsClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("instance metadata %s: %s", path, resp.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func awsInstanceCredentials() (*awsCredentials, error) {
+	role, err := imdsGet("/latest/meta-data/iam/security-credentials/")
+	if err != nil {
+		return nil, fmt.Errorf("no aws credentials found:%s", err.Error())
+	}
+	role = strings.SplitN(role, "\n", 2)[0]
+	data, err := imdsGet("/latest/meta-data/iam/security-credentials/" + role)
+	if err != nil {
+		return nil, err
+	}
+	var v struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		return nil, err
+	}
+	return &awsCredentials{accessKey: v.AccessKeyId, secretKey: v.SecretAccessKey, token: v.Token, expires: v.Expiration}, nil
+}
+
+// cached credentials, refreshed 5 minutes before expiration
+func awsCredentialsCached() (*awsCredentials, error) {
+	if awsCreds != nil && (awsCreds.expires.IsZero() || time.Until(awsCreds.expires) > 5*time.Minute) {
+		return awsCreds, nil
+	}
+	creds, err := loadAwsCredentials()
+	if err != nil {
+		return nil, err
+	}
+	awsCreds = creds
+	return creds, nil
+}
+
+func awsRegion() (string, error) {
+	if awsRegionName != "" {
+		return awsRegionName, nil
+	}
+	for _, region := range []string{cfgAwsRegion, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")} {
+		if region != "" {
+			awsRegionName = region
+			return region, nil
+		}
+	}
+	region, err := imdsGet("/latest/meta-data/placement/region")
+	if err != nil {
+		return "", fmt.Errorf("unknown aws region, set aws_region:%s", err.Error())
+	}
+	awsRegionName = region
+	return region, nil
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// sign request with aws signature version 4
+func awsSign(req *http.Request, body string, creds *awsCredentials, region string, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.token != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.token)
+	}
+
+	names := []string{"content-type", "host", "x-amz-date"}
+	if creds.token != "" {
+		names = append(names, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, "/", "", canonicalHeaders.String(), signedHeaders, sha256Hex(body),
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex(canonicalRequest)
+
+	key := hmacSha256([]byte("AWS4"+creds.secretKey), date)
+	key = hmacSha256(key, region)
+	key = hmacSha256(key, service)
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.accessKey, scope, signedHeaders, signature))
+}
+
+// call ec2 query api action
+func ec2Call(action string, params url.Values) error {
+	_, err := ec2Query(action, params)
+	return err
+}
+
+// call ec2 query api action, returns the xml response
+func ec2Query(action string, params url.Values) ([]byte, error) {
+	creds, err := awsCredentialsCached()
+	if err != nil {
+		return nil, err
+	}
+	region, err := awsRegion()
+	if err != nil {
+		return nil, err
+	}
+
+	params.Set("Action", action)
+	params.Set("Version", ec2ApiVersion)
+	body := params.Encode()
+	req, err := http.NewRequest("POST", "https://ec2."+region+".amazonaws.com/", strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	awsSign(req, body, creds, region, "ec2", time.Now())
+
+	resp, err := awsClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusOK {
+		return data, err
+	}
+
+	var v struct {
+		Errors []struct {
+			Code    string
+			Message string
+		} `xml:"Errors>Error"`
+	}
+	if xml.Unmarshal(data, &v) == nil && len(v.Errors) > 0 {
+		return nil, fmt.Errorf("%s %s: %s", action, v.Errors[0].Code, v.Errors[0].Message)
+	}
+	return nil, fmt.Errorf("%s: %s", action, resp.Status)
+}
+
+// read the inbound entries in portguard's rule range back from the nacl, awsLock must be held
+func loadAwsNaclRules() error {
+	if awsNaclLoaded {
+		return nil
+	}
+	params := url.Values{}
+	params.Set("NetworkAclId.1", cfgAwsNaclId)
+	data, err := ec2Query("DescribeNetworkAcls", params)
+	if err != nil {
+		return err
+	}
+	var v struct {
+		Entries []struct {
+			RuleNumber int    `xml:"ruleNumber"`
+			RuleAction string `xml:"ruleAction"`
+			Egress     bool   `xml:"egress"`
+			CidrBlock  string `xml:"cidrBlock"`
+		} `xml:"networkAclSet>item>entrySet>item"`
+	}
+	if err := xml.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("DescribeNetworkAcls: %s", err.Error())
+	}
+	for _, e := range v.Entries {
+		if e.Egress || e.RuleNumber < cfgAwsNaclRuleStart || e.RuleNumber >= cfgAwsNaclRuleStart+cfgAwsNaclRuleCount {
+			continue
+		}
+		key := e.CidrBlock
+		if ip := strings.TrimSuffix(e.CidrBlock, "/32"); e.RuleAction == "deny" && ip != e.CidrBlock {
+			key = ip
+		}
+		awsNaclRules[key] = e.RuleNumber
+	}
+	awsNaclLoaded = true
+	return nil
+}
+
+// find the entries of hosts blocked before a restart and remove those whose block expired meanwhile
+func syncAwsNacl() {
+	blocked := make(map[string]bool)
+	for _, ip := range blockedIps() {
+		blocked[ip] = true
+	}
+	awsLock.Lock()
+	err := loadAwsNaclRules()
+	var stale []string
+	for key := range awsNaclRules {
+		if !blocked[key] && net.ParseIP(key) != nil {
+			stale = append(stale, key)
+		}
+	}
+	awsLock.Unlock()
+	if err != nil {
+		logMain(false, "sync aws nacl %s failed:%s", cfgAwsNaclId, err.Error())
+		return
+	}
+	if len(stale) == 0 {
+		return
+	}
+	if cfgAction == "log_only" {
+		logMain(false, "sync aws nacl would remove %d hosts, action is log_only", len(stale))
+		return
+	}
+	removed := 0
+	for _, ip := range stale {
+		if err := awsNaclUnblock(ip); err != nil {
+			logMain(false, "sync aws nacl, remove %s failed:%s", ip, err.Error())
+			continue
+		}
+		removed++
+	}
+	logMain(false, "synced aws nacl %s, %d removed", cfgAwsNaclId, removed)
+}
+
+// add an inbound deny entry for ip, using a free rule number in the configured range
+func awsNaclBlock(ip string) error {
+	awsLock.Lock()
+	defer awsLock.Unlock()
+	if err := loadAwsNaclRules(); err != nil {
+		return err
+	}
+	if _, ok := awsNaclRules[ip]; ok {
+		return nil
+	}
+
+	used := make(map[int]bool)
+	for _, rule := range awsNaclRules {
+		used[rule] = true
+	}
+	rule := 0
+	for n := cfgAwsNaclRuleStart; n < cfgAwsNaclRuleStart+cfgAwsNaclRuleCount; n++ {
+		if !used[n] {
+			rule = n
+			break
+		}
+	}
+	if rule == 0 {
+		return errors.New("no free nacl rule number, increase aws_nacl_rule_count or lower block_duration")
+	}
+
+	params := url.Values{}
+	params.Set("NetworkAclId", cfgAwsNaclId)
+	params.Set("RuleNumber", strconv.Itoa(rule))
+	params.Set("Protocol", "-1")
+	params.Set("RuleAction", "deny")
+	params.Set("Egress", "false")
+	params.Set("CidrBlock", ip+"/32")
+	if err := ec2Call("CreateNetworkAclEntry", params); err != nil {
+		return err
+	}
+	awsNaclRules[ip] = rule
+	return nil
+}
+
+func awsNaclUnblock(ip string) error {
+	awsLock.Lock()
+	defer awsLock.Unlock()
+	if err := loadAwsNaclRules(); err != nil {
+		return err
+	}
+	rule, ok := awsNaclRules[ip]
+	if !ok {
+		return nil
+	}
+
+	params := url.Values{}
+	params.Set("NetworkAclId", cfgAwsNaclId)
+	params.Set("RuleNumber", strconv.Itoa(rule))
+	params.Set("Egress", "false")
+	if err := ec2Call("DeleteNetworkAclEntry", params); err != nil {
+		return err
+	}
+	delete(awsNaclRules, ip)
+	return nil
+}
@@ -0,0 +1,82 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// listening port baseline
+// ports listening at startup are the baseline; every listen_baseline_interval seconds the
+// listening ports are read again, and one that is new, not in listen_baseline_allow and still
+// listening on the next read raises an ops alert, a cheap check for backdoors and implants
+// alerted ports join the baseline, so each is reported once
+
+const opsNewListener = "new_listener"
+
+// a listening socket of the guarded protocol
+type listener struct {
+	addr  string // local address, 0.0.0.0 for any
+	port  int
+	inode uint64 // of the socket, 0 if unknown
+}
+
+func (l listener) key() string {
+	return fmt.Sprintf("%s:%d", l.addr, l.port)
+}
+
+func runListenBaseline() {
+	baseline := make(map[string]bool)
+	ls, err := listeningPorts()
+	if err != nil {
+		logMain(false, "read listening ports failed:%s, listen baseline is off", err.Error())
+		return
+	}
+	for _, l := range ls {
+		baseline[l.key()] = true
+	}
+	logMain(false, "listen baseline: %d %s ports listening", len(baseline), *mode)
+
+	seen := make(map[string]bool) // new ports of the last read, alerted if they stay
+	for range time.Tick(time.Duration(cfgListenBaselineInterval) * time.Second) {
+		ls, err := listeningPorts()
+		if err != nil {
+			logMain(false, "read listening ports failed:%s", err.Error())
+			continue
+		}
+		fresh := make(map[string]bool)
+		for _, l := range ls {
+			k := l.key()
+			if baseline[k] || cfgListenBaselineAllow.Contains(l.port) {
+				continue
+			}
+			if !seen[k] {
+				fresh[k] = true
+				continue
+			}
+			baseline[k] = true
+			msg := fmt.Sprintf("new %s port %d listening on %s", *mode, l.port, l.addr)
+			if p := socketOwner(l.inode); p != "" {
+				msg += " by " + p
+			}
+			opsAlert(opsNewListener, "ip4:"+*mode, "", net.ParseIP(l.addr), msg)
+		}
+		seen = fresh
+	}
+}
+
+// listeners found by trying to bind every port of min_port to max_port, where the system
+// can't list them; ports held by outgoing connections show up as well, for a read or two
+func bindScanListeners() []listener {
+	var ls []listener
+	for port := cfgMinPort; port <= cfgMaxPort; port++ {
+		if port > 0 && verifier.PortInUse(serverIp, port) {
+			ls = append(ls, listener{addr: serverIp.String(), port: port})
+		}
+	}
+	return ls
+}
@@ -0,0 +1,173 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a firewall operation, add ip to the block list or delete it
+type fwOp struct {
+	ip  string
+	del bool
+}
+
+// operations of a firewall backend are applied in batches: the first one after a quiet time
+// goes out right away, the ones coming while it's applied and firewall_batch_interval ms after
+// are applied together in one transaction, so a botnet sweep of hundreds of hosts takes a few
+// nft or ipset runs instead of one per host
+// Block only queues the host, a failed batch is logged, audited and counted as one failed run,
+// on_failure of the responder doesn't apply
+type fwBatch struct {
+	r     responder
+	apply func(ctx context.Context, ops []fwOp) error
+
+	lock    sync.Mutex
+	pending []fwOp
+	wake    chan struct{}
+}
+
+func newFwBatch(r responder, apply func(ctx context.Context, ops []fwOp) error) *fwBatch {
+	b := &fwBatch{r: r, apply: apply, wake: make(chan struct{}, 1)}
+	go b.run()
+	return b
+}
+
+func (b *fwBatch) add(ip string, del bool) {
+	b.lock.Lock()
+	b.pending = append(b.pending, fwOp{ip: ip, del: del})
+	b.lock.Unlock()
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (b *fwBatch) run() {
+	for range b.wake {
+		for {
+			b.lock.Lock()
+			ops := b.pending
+			if len(ops) > cfgFirewallBatchMax {
+				ops = ops[:cfgFirewallBatchMax:cfgFirewallBatchMax]
+				b.pending = append([]fwOp(nil), b.pending[cfgFirewallBatchMax:]...)
+			} else {
+				b.pending = nil
+			}
+			b.lock.Unlock()
+			if len(ops) == 0 {
+				break
+			}
+			b.flush(ops)
+			time.Sleep(time.Duration(cfgFirewallBatchInterval) * time.Millisecond)
+		}
+	}
+}
+
+func (b *fwBatch) flush(ops []fwOp) {
+	added, deleted := 0, 0
+	for _, op := range ops {
+		if op.del {
+			deleted++
+		} else {
+			added++
+		}
+	}
+	what := fmt.Sprintf("%d add, %d delete", added, deleted)
+
+	begin := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	if cfgCmdTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(cfgCmdTimeout)*time.Second)
+	}
+	ctx, output := withAuditOutput(ctx)
+	err := b.apply(ctx, ops)
+	cancel()
+	auditResponder(b.r, "batch", ops[0].ip, what, 1, begin, err, output)
+	statsdTiming("responder."+b.r.Name(), time.Since(begin))
+	noteResponderResult(err != nil)
+	if err != nil {
+		logMain(false, "responder %s, batch of %s failed:%s", b.r.Name(), what, err.Error())
+		statsAdd(&stats.respFailed)
+		reportError("responder", "", "responder %s, batch failed:%s", b.r.Name(), err.Error())
+		return
+	}
+	logDebug("responder %s, applied batch of %s", b.r.Name(), what)
+}
+
+// run name with input on stdin, output goes to the audit log and into the error
+func runBatchCmd(ctx context.Context, input string, name string, args ...string) error {
+	if err := allowExec(name); err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.CombinedOutput()
+	if w := auditOutputOf(ctx); w != nil {
+		w.Write(out)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// one nft transaction, an element is added before it's deleted so deleting a missing one
+// doesn't fail the whole transaction; the first one sets up the throttle chain too
+func nftApply(ctx context.Context, ops []fwOp) error {
+	var b strings.Builder
+	if isThrottle() && !nftThrottleReady {
+		b.WriteString(nftThrottleSetup())
+	}
+	for _, op := range ops {
+		fmt.Fprintf(&b, "add element %s { %s }\n", cfgNftSet, op.ip)
+		if op.del {
+			fmt.Fprintf(&b, "delete element %s { %s }\n", cfgNftSet, op.ip)
+		}
+	}
+	if err := runBatchCmd(ctx, b.String(), "nft", "-f", "-"); err != nil {
+		return err
+	}
+	nftThrottleReady = isThrottle()
+	return nil
+}
+
+// one ipset restore, -exist ignores hosts already in or missing from the set
+func ipsetApply(ctx context.Context, ops []fwOp) error {
+	if isThrottle() && !ipsetThrottleReady {
+		if err := ipsetThrottleSetup(ctx); err != nil {
+			return err
+		}
+		ipsetThrottleReady = true
+	}
+	var b strings.Builder
+	for _, op := range ops {
+		if op.del {
+			fmt.Fprintf(&b, "del %s %s\n", cfgIpset, op.ip)
+		} else {
+			fmt.Fprintf(&b, "add %s %s\n", cfgIpset, op.ip)
+		}
+	}
+	return runBatchCmd(ctx, b.String(), "ipset", "restore", "-exist")
+}
+
+// hosts added by ops
+func addedIps(ops []fwOp) []string {
+	var ips []string
+	for _, op := range ops {
+		if !op.del {
+			ips = append(ips, op.ip)
+		}
+	}
+	return ips
+}
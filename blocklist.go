@@ -0,0 +1,120 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// the current blocklist for routers and other firewalls to pull, as prefixes, /32 unless aggregated:
+//
+//	plain  one ip, or prefix if it's shorter than /32, per line
+//	cidr   one prefix per line
+//	bird   a bird prefix set named blocklist_name
+//	frr    an frr/quagga prefix-list named blocklist_name, replacing the previous one
+//	rtbh   exabgp announce lines, next hop blocklist_next_hop with community blocklist_community
+var blocklistFormats = map[string]func(prefixes []string) []byte{
+	"plain": func(prefixes []string) []byte {
+		var b bytes.Buffer
+		for _, p := range prefixes {
+			fmt.Fprintf(&b, "%s\n", strings.TrimSuffix(p, "/32"))
+		}
+		return b.Bytes()
+	},
+	"cidr": func(prefixes []string) []byte {
+		var b bytes.Buffer
+		for _, p := range prefixes {
+			fmt.Fprintf(&b, "%s\n", p)
+		}
+		return b.Bytes()
+	},
+	"bird": func(prefixes []string) []byte {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "define %s = [", cfgBlocklistName)
+		for i, p := range prefixes {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, "\n\t%s", p)
+		}
+		b.WriteString("\n];\n")
+		return b.Bytes()
+	},
+	"frr": func(prefixes []string) []byte {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "no ip prefix-list %s\n", cfgBlocklistName)
+		for i, p := range prefixes {
+			fmt.Fprintf(&b, "ip prefix-list %s seq %d permit %s\n", cfgBlocklistName, (i+1)*5, p)
+		}
+		return b.Bytes()
+	},
+	"rtbh": func(prefixes []string) []byte {
+		var b bytes.Buffer
+		for _, p := range prefixes {
+			fmt.Fprintf(&b, "announce route %s next-hop %s community [%s]\n", p, cfgBlocklistNextHop, cfgBlocklistCommunity)
+		}
+		return b.Bytes()
+	},
+}
+
+// blocked ips in order
+func blockedIps() []string {
+	stateLock.Lock()
+	ips := make([]string, 0, len(blockedAt))
+	for ip := range blockedAt {
+		ips = append(ips, ip)
+	}
+	stateLock.Unlock()
+	sort.Slice(ips, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(ips[i]).To16(), net.ParseIP(ips[j]).To16()) < 0
+	})
+	return ips
+}
+
+// GET /blocklist?format=plain|cidr|bird|frr|rtbh, blocklist_format by default
+func serveBlocklist(w http.ResponseWriter, req *http.Request) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = cfgBlocklistFormat
+	}
+	render, ok := blocklistFormats[format]
+	if !ok {
+		http.Error(w, "unknown format "+format, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(render(blocklistPrefixes()))
+}
+
+func startBlocklist() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blocklist", serveBlocklist)
+	return serveHttpApi(cfgBlocklistAddr, mux)
+}
+
+// write blocklist_file every blocklist_interval seconds when the blocklist changed
+func runBlocklistExport() {
+	var last []byte
+	for {
+		data := blocklistFormats[cfgBlocklistFormat](blocklistPrefixes())
+		if last == nil || !bytes.Equal(data, last) {
+			if err := writeFileAtomic(chrootPath(cfgBlocklistFile), data, 0644); err != nil {
+				logMain(false, "write blocklist_file %s failed:%s", cfgBlocklistFile, err.Error())
+			} else {
+				last = data
+			}
+		}
+		if isShutdown() {
+			return
+		}
+		time.Sleep(time.Duration(cfgBlocklistInterval) * time.Second)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// bogon sources
+// no real host sends from reserved ranges, and none from space not yet allocated to anyone, so a
+// probe from there is spoofed; bogon_filter says what to do with them:
+//
+//	flag  the alarm is annotated as spoofed "bogon", block_spoofed decides whether it can block
+//	drop  the probe is dropped before stateEngine, counted as bogons, a flood of them tracks nothing
+//	off   sources aren't checked
+//
+// the reserved ranges are built in; with bogon_url, like the full bogon list of team cymru, the
+// list is fetched at start and every bogon_refresh seconds and replaces them, unallocated space
+// included; private, shared and loopback ranges in it are skipped, the private check of spoofed
+// sources covers them and lans send from them; a list not refreshed for bogonStale is out of date,
+// space allocated since would be dropped, so the built-in ranges are used again until a fetch works
+
+const (
+	bogonFlag = "flag"
+	bogonDrop = "drop"
+	bogonOff  = "off"
+
+	bogonStale = 7 * 24 * time.Hour
+)
+
+var (
+	cfgBogonFilter  = bogonFlag
+	cfgBogonUrl     string
+	cfgBogonRefresh = 86400
+
+	bogonReserved = parseNets("0.0.0.0/8", "192.0.0.0/24", "192.0.2.0/24", "198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/4", "240.0.0.0/4")
+	bogonKeep     = append(parseNets("127.0.0.0/8"), privateNets...)
+
+	bogonLock    sync.RWMutex
+	bogonList    = bogonRanges(bogonReserved)
+	bogonFetched time.Time // of the list of bogon_url in use, zero for the built-in ranges
+	bogonEtag    string
+	bogonClient  = &http.Client{Timeout: ignoreUrlTimeout}
+)
+
+// addresses lo to hi
+type bogonRange struct{ lo, hi uint32 }
+
+// nets as sorted ranges, overlapping ones merged
+func bogonRanges(nets []*net.IPNet) []bogonRange {
+	var ranges []bogonRange
+	for _, n := range nets {
+		lo := binary.BigEndian.Uint32(n.IP.To4())
+		ones, _ := n.Mask.Size()
+		ranges = append(ranges, bogonRange{lo, lo | ^prefixMask(ones)})
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].lo < ranges[j].lo })
+	var merged []bogonRange
+	for _, r := range ranges {
+		if last := len(merged) - 1; last >= 0 && (merged[last].hi == ^uint32(0) || r.lo <= merged[last].hi+1) {
+			if r.hi > merged[last].hi {
+				merged[last].hi = r.hi
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func isBogon(ip net.IP) bool {
+	if cfgBogonFilter == bogonOff {
+		return false
+	}
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return false
+	}
+	addr := binary.BigEndian.Uint32(ip4)
+	bogonLock.RLock()
+	defer bogonLock.RUnlock()
+	i := sort.Search(len(bogonList), func(i int) bool { return bogonList[i].hi >= addr })
+	return i < len(bogonList) && bogonList[i].lo <= addr
+}
+
+func parseBogonFilter(lineno int, token, value string) string {
+	switch value {
+	case bogonFlag, bogonDrop, bogonOff:
+	default:
+		logMain(true, "line %d:%s, invalid value:%s, should be flag, drop or off", lineno, token, value)
+	}
+	return value
+}
+
+func runBogonRefresh() {
+	refreshBogons()
+	for range time.Tick(time.Duration(cfgBogonRefresh) * time.Second) {
+		refreshBogons()
+	}
+}
+
+func refreshBogons() {
+	err := fetchBogons()
+	if err == nil {
+		return
+	}
+	logMain(false, "fetch bogon_url %s failed:%s", cfgBogonUrl, err.Error())
+	bogonLock.Lock()
+	stale := !bogonFetched.IsZero() && time.Since(bogonFetched) > bogonStale
+	if stale {
+		bogonList, bogonFetched, bogonEtag = bogonRanges(bogonReserved), time.Time{}, ""
+	}
+	bogonLock.Unlock()
+	if stale {
+		logMain(false, "bogon list not refreshed for %s, using the built-in reserved ranges", bogonStale)
+	}
+}
+
+// fetch the list if it changed and swap it in
+func fetchBogons() error {
+	req, err := http.NewRequest(http.MethodGet, cfgBogonUrl, nil)
+	if err != nil {
+		return err
+	}
+	bogonLock.RLock()
+	etag := bogonEtag
+	bogonLock.RUnlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	body, resp, err := ignoreUrlGet(bogonClient, req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		bogonLock.Lock()
+		bogonFetched = time.Now()
+		bogonLock.Unlock()
+		return nil
+	}
+	nets, err := parseIgnoreList(body)
+	if err != nil {
+		return err
+	}
+	var kept []*net.IPNet
+	for _, n := range nets {
+		overlap := false
+		for _, k := range bogonKeep {
+			if k.Contains(n.IP) || n.Contains(k.IP) {
+				overlap = true
+				break
+			}
+		}
+		if !overlap {
+			kept = append(kept, n)
+		}
+	}
+	if len(kept) == 0 {
+		return fmt.Errorf("no bogon outside private and loopback ranges in %d entries", len(nets))
+	}
+	ranges := bogonRanges(kept)
+	bogonLock.Lock()
+	bogonList, bogonFetched, bogonEtag = ranges, time.Now(), resp.Header.Get("ETag")
+	bogonLock.Unlock()
+	logMain(false, "bogon_url %s updated, %d prefixes, %d ranges", cfgBogonUrl, len(kept), len(ranges))
+	return nil
+}
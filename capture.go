@@ -0,0 +1,252 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// packets for a guard, ipv4 header first
+type packetConn interface {
+	ReadPacket(b []byte) (int, error)
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
+
+// open capture for network(ip4:tcp or ip4:udp), bound to iface if not empty
+// only packets destined for laddr are received, unless it's 0.0.0.0
+func listenGuard(network string, iface string, laddr net.IP) packetConn {
+	conn, err := openCapture(network, iface, laddr)
+	if err != nil {
+		logMain(true, "listen %s on interface %q failed:%s", network, iface, err.Error())
+	}
+	rc := newRecoveringConn(network, iface, laddr, conn)
+	registerGuard(rc)
+	return rc
+}
+
+// linux captures with an af_packet socket if frames need their link layer, or to fan out
+func usePacketCapture() bool {
+	return len(cfgIgnoreMacs) > 0 || len(cfgGatewayMacs) > 0 || cfgVlanCapture || cfgCaptureFanout > 1
+}
+
+// kernel counters of an af_packet socket, in the health report
+type captureStat struct {
+	Interface string `json:"interface"`
+	Laddr     string `json:"laddr"`
+	Queue     int    `json:"queue"` // socket of a capture_fanout group
+	Packets   int64  `json:"packets"`
+	Drops     int64  `json:"drops"`
+}
+
+var (
+	captureStatLock sync.Mutex
+	captureStats    []*captureStat
+)
+
+func addCaptureStat(iface string, laddr net.IP) *captureStat {
+	captureStatLock.Lock()
+	defer captureStatLock.Unlock()
+	s := &captureStat{Interface: iface, Laddr: laddr.String()}
+	for _, v := range captureStats {
+		if v.Interface == s.Interface && v.Laddr == s.Laddr && v.Queue >= s.Queue {
+			s.Queue = v.Queue + 1
+		}
+	}
+	captureStats = append(captureStats, s)
+	return s
+}
+
+func removeCaptureStat(s *captureStat) {
+	captureStatLock.Lock()
+	defer captureStatLock.Unlock()
+	for i, v := range captureStats {
+		if v == s {
+			captureStats = append(captureStats[:i], captureStats[i+1:]...)
+			return
+		}
+	}
+}
+
+// current counters of open capture sockets
+func captureStatList() []captureStat {
+	updateCaptureStats()
+	captureStatLock.Lock()
+	defer captureStatLock.Unlock()
+	var list []captureStat
+	for _, s := range captureStats {
+		list = append(list, captureStat{s.Interface, s.Laddr, s.Queue, atomic.LoadInt64(&s.Packets), atomic.LoadInt64(&s.Drops)})
+	}
+	return list
+}
+
+// if a frame from mac should be inspected, by ignore_mac and gateway_mac
+// frames without a mac, like on tunnels, only pass if gateway_mac is not set
+func macAllowed(mac net.HardwareAddr) bool {
+	for _, m := range cfgIgnoreMacs {
+		if bytes.Equal(m, mac) {
+			return false
+		}
+	}
+	if len(cfgGatewayMacs) == 0 {
+		return true
+	}
+	for _, m := range cfgGatewayMacs {
+		if bytes.Equal(m, mac) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinMacs(macs []net.HardwareAddr) string {
+	var s []string
+	for _, mac := range macs {
+		s = append(s, mac.String())
+	}
+	return strings.Join(s, ",")
+}
+
+// log the receive buffer a capture got, the kernel may round capture_rcvbuf or cap it
+func logRcvbuf(network string, iface string, laddr net.IP, size int) {
+	logMain(false, "capture %s on interface %q laddr %s, receive buffer:%d bytes", network, iface, laddr.String(), size)
+}
+
+// buffer size for reads of a guard, capture_buffer or the largest mtu of the
+// capture and mirror interfaces, all interfaces if none is configured
+func captureBufferSize() int {
+	if cfgCaptureBuffer > 0 {
+		return cfgCaptureBuffer
+	}
+	mtu := 0
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		wanted := len(cfgInterfaces) == 0 && len(cfgMirrorInterfaces) == 0
+		for _, name := range cfgInterfaces {
+			wanted = wanted || name == iface.Name
+		}
+		wanted = wanted || isMirrorIface(iface.Name)
+		if wanted && iface.MTU > mtu {
+			mtu = iface.MTU
+		}
+	}
+	if mtu <= 0 {
+		mtu = 1500
+	}
+	// one more byte, so a packet of the full mtu doesn't fill it
+	return mtu + 1
+}
+
+// a read that filled the buffer may have lost the rest of the packet
+func isTruncated(n int, b []byte) bool {
+	return n >= len(b)
+}
+
+// count and log reads that were cut by the buffer, the first one and then every 1000th
+func noteTruncated(proto string, n int, b []byte) {
+	if atomic.AddInt64(&stats.truncated, 1)%1000 == 1 {
+		logMain(false, "%s read of %d bytes may be truncated, raise capture_buffer above %d", proto, n, len(b))
+	}
+}
+
+// data link types, see pcap-linktype(7)
+const (
+	dltNull   = 0
+	dltEn10mb = 1
+	dltRaw    = 12
+	dltLoop   = 108
+	linkRaw   = 101
+)
+
+// ip protocol numbers
+const (
+	protoICMP = 1
+	protoTCP  = 6
+	protoUDP  = 17
+)
+
+// protocol number of network, ip4:tcp or ip4:udp
+func networkProto(network string) uint8 {
+	if network == "ip4:udp" {
+		return protoUDP
+	}
+	return protoTCP
+}
+
+// vlan tag protocol ids: 802.1Q, 802.1ad (QinQ) and the old QinQ id
+const (
+	etherTypeIPv4  = 0x0800
+	etherTypeVlan  = 0x8100
+	etherTypeQinQ  = 0x88a8
+	etherTypeQinQ1 = 0x9100
+)
+
+// captures that decode link layers know the vlan of the last packet read, 0 if untagged
+type vlanConn interface {
+	LastVlan() int
+}
+
+func lastVlan(conn packetConn) int {
+	if c, ok := conn.(vlanConn); ok {
+		return c.LastVlan()
+	}
+	return 0
+}
+
+// strip link layer from a captured frame, return the ipv4 packet and its innermost vlan id
+// vlan is a tag the capture already stripped from frame, 0 if none
+// frames of other protocols, of vlans not in vlan, or not destined for laddr unless it's
+// 0.0.0.0, are skipped; tunnels of mirror_decap are taken apart
+func decodeFrame(dlt int, frame []byte, proto uint8, laddr net.IP, vlan int) ([]byte, int, bool) {
+	switch dlt {
+	case dltNull, dltLoop:
+		if len(frame) < 4 {
+			return nil, 0, false
+		}
+		frame = frame[4:]
+	case dltEn10mb:
+		if len(frame) < 14 {
+			return nil, 0, false
+		}
+		etherType := uint16(frame[12])<<8 | uint16(frame[13])
+		frame = frame[14:]
+		// 802.1Q, stacked for QinQ
+		for (etherType == etherTypeVlan || etherType == etherTypeQinQ || etherType == etherTypeQinQ1) && len(frame) >= 4 {
+			vlan = int(frame[0]&0x0f)<<8 | int(frame[1])
+			etherType = uint16(frame[2])<<8 | uint16(frame[3])
+			frame = frame[4:]
+		}
+		if etherType != etherTypeIPv4 {
+			return nil, 0, false
+		}
+	case dltRaw, linkRaw:
+	default:
+		return nil, 0, false
+	}
+
+	// mirrored frames in a tunnel are decoded from the inner frame on, see tunnel decapsulation
+	if cfgMirrorDecap != 0 {
+		if dlt, inner, tunnelVlan, ok := decapTunnel(frame); ok {
+			return decodeFrame(dlt, inner, proto, laddr, tunnelVlan)
+		}
+	}
+	if len(cfgVlans) > 0 && !cfgVlans.Contains(vlan) {
+		statsAdd(&stats.vlanIgnored)
+		return nil, 0, false
+	}
+	// malformed headers are left to the guard to count
+	if len(frame) >= 20 && frame[9] != proto {
+		return nil, 0, false
+	}
+	if len(frame) >= 20 && !laddr.Equal(serverIp) && !laddr.Equal(net.IP(frame[16:20])) {
+		return nil, 0, false
+	}
+	return frame, vlan, true
+}
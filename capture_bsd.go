@@ -0,0 +1,233 @@
+//go:build darwin || freebsd || openbsd
+
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// bsd raw sockets never see tcp/udp, capture from a bpf device instead
+type bpfConn struct {
+	fd       int
+	dlt      int
+	proto    uint8
+	laddr    net.IP
+	vlan     int // of the last packet
+	buf      []byte
+	pending  []byte // packets read but not returned yet
+	mu       sync.Mutex
+	closed   bool
+	deadline time.Time
+}
+
+const (
+	bpfBufferSize  = 1 << 16
+	bpfReadTimeout = 500 * time.Millisecond
+)
+
+func openCapture(network string, iface string, laddr net.IP) (packetConn, error) {
+	var err error
+	if iface == "" {
+		if iface, err = defaultInterface(); err != nil {
+			return nil, err
+		}
+	}
+
+	fd, err := openBpf()
+	if err != nil {
+		return nil, err
+	}
+	c := &bpfConn{fd: fd, proto: networkProto(network), laddr: laddr}
+	if err = c.setup(iface); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("setup bpf on %s:%s", iface, err.Error())
+	}
+	logRcvbuf(network, iface, laddr, len(c.buf))
+	return c, nil
+}
+
+// cloning /dev/bpf, or the first free /dev/bpfN on older systems
+func openBpf() (int, error) {
+	fd, err := syscall.Open("/dev/bpf", syscall.O_RDWR, 0)
+	if err == nil {
+		return fd, nil
+	}
+	for i := 0; i < 256 && (err == syscall.ENOENT || err == syscall.EBUSY); i++ {
+		if fd, err = syscall.Open(fmt.Sprintf("/dev/bpf%d", i), syscall.O_RDWR, 0); err == nil {
+			return fd, nil
+		}
+	}
+	if err == syscall.EACCES {
+		return -1, errors.New("open bpf device: permission denied, run portguard as root")
+	}
+	return -1, fmt.Errorf("open bpf device:%s", err.Error())
+}
+
+func (c *bpfConn) setup(iface string) error {
+	size := bpfBufferSize
+	if cfgCaptureRcvbuf > 0 {
+		size = cfgCaptureRcvbuf
+	}
+	size, err := syscall.SetBpfBuflen(c.fd, size)
+	if err != nil {
+		return err
+	}
+	c.buf = make([]byte, size)
+	if err = syscall.SetBpfInterface(c.fd, iface); err != nil {
+		return err
+	}
+	if err = syscall.SetBpfImmediate(c.fd, 1); err != nil {
+		return err
+	}
+	tv := syscall.NsecToTimeval(bpfReadTimeout.Nanoseconds())
+	if err = syscall.SetBpfTimeout(c.fd, &tv); err != nil {
+		return err
+	}
+	// our own outgoing packets are not probes
+	if err = bpfInboundOnly(c.fd); err != nil {
+		return err
+	}
+	if c.dlt, err = syscall.BpfDatalink(c.fd); err != nil {
+		return err
+	}
+	if c.dlt == dltEn10mb && !cfgVlanCapture {
+		return syscall.SetBpf(c.fd, c.filter())
+	}
+	// other link types and vlan tagged frames are filtered by decodeFrame only
+	return nil
+}
+
+// accept ethernet ipv4 frames of our protocol, to laddr if not 0.0.0.0
+func (c *bpfConn) filter() []syscall.BpfInsn {
+	var insns []syscall.BpfInsn
+	add := func(i *syscall.BpfInsn) {
+		insns = append(insns, *i)
+	}
+	matchDst := !c.laddr.Equal(serverIp)
+	// instructions left to the drop instruction
+	drop := 4
+	if matchDst {
+		drop = 6
+	}
+
+	add(syscall.BpfStmt(syscall.BPF_LD+syscall.BPF_H+syscall.BPF_ABS, 12))
+	add(syscall.BpfJump(syscall.BPF_JMP+syscall.BPF_JEQ+syscall.BPF_K, 0x0800, 0, drop-1))
+	add(syscall.BpfStmt(syscall.BPF_LD+syscall.BPF_B+syscall.BPF_ABS, 23))
+	add(syscall.BpfJump(syscall.BPF_JMP+syscall.BPF_JEQ+syscall.BPF_K, int(c.proto), 0, drop-3))
+	if matchDst {
+		ip := c.laddr.To4()
+		dst := int(ip[0])<<24 | int(ip[1])<<16 | int(ip[2])<<8 | int(ip[3])
+		add(syscall.BpfStmt(syscall.BPF_LD+syscall.BPF_W+syscall.BPF_ABS, 30))
+		add(syscall.BpfJump(syscall.BPF_JMP+syscall.BPF_JEQ+syscall.BPF_K, dst, 0, 1))
+	}
+	add(syscall.BpfStmt(syscall.BPF_RET+syscall.BPF_K, bpfBufferSize))
+	add(syscall.BpfStmt(syscall.BPF_RET+syscall.BPF_K, 0))
+	return insns
+}
+
+func (c *bpfConn) ReadPacket(b []byte) (int, error) {
+	for {
+		// a packet left from the last read
+		for len(c.pending) > 0 {
+			hdr := (*syscall.BpfHdr)(unsafe.Pointer(&c.pending[0]))
+			start := int(hdr.Hdrlen)
+			end := start + int(hdr.Caplen)
+			if end > len(c.pending) {
+				c.pending = nil
+				break
+			}
+			frame := c.pending[start:end]
+			next := bpfWordAlign(end)
+			if next > len(c.pending) {
+				next = len(c.pending)
+			}
+			c.pending = c.pending[next:]
+
+			if packet, vlan, ok := decodeFrame(c.dlt, frame, c.proto, c.laddr, 0); ok {
+				c.vlan = vlan
+				return copy(b, packet), nil
+			}
+		}
+
+		// the fd is closed by its reader, reads return at least every bpfReadTimeout
+		c.mu.Lock()
+		if c.closed {
+			if c.fd >= 0 {
+				syscall.Close(c.fd)
+				c.fd = -1
+			}
+			c.mu.Unlock()
+			return 0, net.ErrClosed
+		}
+		deadline := c.deadline
+		c.mu.Unlock()
+
+		n, err := syscall.Read(c.fd, c.buf)
+		if err != nil && err != syscall.EINTR && err != syscall.EAGAIN {
+			return 0, err
+		}
+		if n > 0 {
+			c.pending = c.buf[:n]
+		} else if !deadline.IsZero() && time.Now().After(deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+func (c *bpfConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *bpfConn) LastVlan() int {
+	return c.vlan
+}
+
+func (c *bpfConn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	return nil
+}
+
+func bpfWordAlign(x int) int {
+	return (x + (syscall.BPF_ALIGNMENT - 1)) &^ (syscall.BPF_ALIGNMENT - 1)
+}
+
+// first up, non loopback interface with an ipv4 address
+func defaultInterface() (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				return iface.Name, nil
+			}
+		}
+	}
+	return "", errors.New("no capture interface found, set interface in config")
+}
+
+func checkInterface(name string) error {
+	_, err := net.InterfaceByName(name)
+	return err
+}
@@ -0,0 +1,19 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// darwin has no direction filter, not seeing sent packets does the same
+func bpfInboundOnly(fd int) error {
+	seeSent := uint32(0)
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.BIOCSSEESENT, uintptr(unsafe.Pointer(&seeSent))); errno != 0 {
+		return errno
+	}
+	return nil
+}
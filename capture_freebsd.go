@@ -0,0 +1,20 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const bpfDirectionIn = 0 // BPF_D_IN
+
+func bpfInboundOnly(fd int) error {
+	dir := int32(bpfDirectionIn)
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.BIOCSDIRECTION, uintptr(unsafe.Pointer(&dir))); errno != 0 {
+		return errno
+	}
+	return nil
+}
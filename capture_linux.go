@@ -0,0 +1,97 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// raw socket, read with recvfrom to keep the ip header *net.IPConn strips
+type rawConn struct {
+	*net.IPConn
+	rc syscall.RawConn
+}
+
+func openCapture(network string, iface string, laddr net.IP) (packetConn, error) {
+	if usePacketCapture() || isMirrorIface(iface) {
+		return openPacketCapture(network, iface, laddr)
+	}
+	conn, err := net.ListenIP(network, &net.IPAddr{IP: laddr})
+	if err != nil {
+		return nil, err
+	}
+	if iface != "" {
+		if err := bindToDevice(conn, iface); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var size int
+	var serr error
+	if err = rc.Control(func(fd uintptr) {
+		size, serr = setRcvbuf(int(fd))
+	}); err == nil {
+		err = serr
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	logRcvbuf(network, iface, laddr, size)
+	return &rawConn{IPConn: conn, rc: rc}, nil
+}
+
+// set the receive buffer of a capture socket to capture_rcvbuf and return what it got;
+// root can go past net.core.rmem_max with SO_RCVBUFFORCE, linux doubles the size asked for
+func setRcvbuf(fd int) (int, error) {
+	if cfgCaptureRcvbuf > 0 {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUFFORCE, cfgCaptureRcvbuf); err != nil {
+			if err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, cfgCaptureRcvbuf); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+}
+
+// read deadlines and close are handled by the runtime poller
+func (c *rawConn) ReadPacket(b []byte) (int, error) {
+	var n int
+	var serr error
+	err := c.rc.Read(func(fd uintptr) bool {
+		n, _, serr = syscall.Recvfrom(int(fd), b, 0)
+		return serr != syscall.EAGAIN
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, serr
+}
+
+// restrict a raw socket to packets received on iface
+func bindToDevice(conn *net.IPConn, iface string) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err = rc.Control(func(fd uintptr) {
+		serr = syscall.BindToDevice(int(fd), iface)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+func checkInterface(name string) error {
+	_, err := net.InterfaceByName(name)
+	return err
+}
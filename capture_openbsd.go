@@ -0,0 +1,18 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func bpfInboundOnly(fd int) error {
+	dir := uint32(syscall.BPF_DIRECTION_OUT)
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.BIOCSDIRFILT, uintptr(unsafe.Pointer(&dir))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+//go:build !linux && !windows && !darwin && !freebsd && !openbsd
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"syscall"
+)
+
+// plain raw socket on systems without af_packet or bpf capture here, packets of every interface
+type rawConn struct {
+	*net.IPConn
+	rc syscall.RawConn
+}
+
+func openCapture(network string, iface string, laddr net.IP) (packetConn, error) {
+	if iface != "" {
+		return nil, errors.New("capture on an interface isn't supported on " + runtime.GOOS)
+	}
+	conn, err := net.ListenIP(network, &net.IPAddr{IP: laddr})
+	if err != nil {
+		return nil, err
+	}
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &rawConn{IPConn: conn, rc: rc}, nil
+}
+
+// read deadlines and close are handled by the runtime poller
+func (c *rawConn) ReadPacket(b []byte) (int, error) {
+	var n int
+	var serr error
+	err := c.rc.Read(func(fd uintptr) bool {
+		n, _, serr = syscall.Recvfrom(int(fd), b, 0)
+		return serr != syscall.EAGAIN
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, serr
+}
+
+func checkInterface(name string) error {
+	_, err := net.InterfaceByName(name)
+	return err
+}
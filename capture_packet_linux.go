@@ -0,0 +1,315 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// af_packet socket, used instead of a raw ip socket when frames need their link layer,
+// e.g. for ignore_mac and gateway_mac, and for mirror interfaces, in promiscuous mode
+type packetSockConn struct {
+	*os.File
+	rc     syscall.RawConn
+	proto  uint8
+	laddr  net.IP
+	mirror bool   // frames to other hosts are read too
+	buf    []byte // frames with their link layer, larger than the packets returned
+	oob    []byte // auxdata with the vlan tag the kernel stripped
+	vlan   int    // of the last packet
+	stat   *captureStat
+}
+
+// room for ethernet and vlan headers, so a packet of the full mtu still fits in the reader's buffer
+const packetLinkRoom = 64
+
+const (
+	ethPAll = 0x0003
+	ethPIp  = 0x0800
+
+	solPacket         = 263
+	packetStatistics  = 6
+	packetAuxdata     = 8
+	packetFanout      = 18
+	tpStatusVlanValid = 0x10
+
+	// spread flows over the sockets of a group by hash, fragments reassembled first
+	packetFanoutHash       = 0
+	packetFanoutFlagDefrag = 0x8000
+
+	// linux bpf extensions, see linux/filter.h
+	skfAdProtocol = -0x1000     // SKF_AD_OFF + SKF_AD_PROTOCOL
+	skfAdPkttype  = -0x1000 + 4 // SKF_AD_OFF + SKF_AD_PKTTYPE
+	skfNetOff     = -0x100000
+)
+
+// link types delivered with an ethernet header, others come as bare ip packets
+const (
+	arphrdEther    = 1
+	arphrdLoopback = 772
+)
+
+// ethernet type the socket is bound to, all of them for vlan tagged frames
+func packetProtocol() uint16 {
+	if cfgVlanCapture {
+		return htons(ethPAll)
+	}
+	return htons(ethPIp)
+}
+
+func openPacketCapture(network string, iface string, laddr net.IP) (packetConn, error) {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, int(packetProtocol()))
+	if err != nil {
+		return nil, err
+	}
+	c := &packetSockConn{proto: networkProto(network), laddr: laddr, mirror: isMirrorIface(iface)}
+	if err = c.setup(fd, iface); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	c.File = os.NewFile(uintptr(fd), "packet:"+iface)
+	if c.rc, err = c.File.SyscallConn(); err != nil {
+		c.File.Close()
+		return nil, err
+	}
+	size, err := setRcvbuf(fd)
+	if err != nil {
+		c.File.Close()
+		return nil, err
+	}
+	logRcvbuf(network, iface, laddr, size)
+	c.stat = addCaptureStat(iface, laddr)
+	packetSockLock.Lock()
+	packetSocks[c] = true
+	packetSockLock.Unlock()
+	return c, nil
+}
+
+func (c *packetSockConn) setup(fd int, iface string) error {
+	if err := syscall.AttachLsf(fd, c.filter()); err != nil {
+		return err
+	}
+	if cfgVlanCapture {
+		// the outer tag is stripped from frames, its id comes with each read
+		if err := syscall.SetsockoptInt(fd, solPacket, packetAuxdata, 1); err != nil {
+			return err
+		}
+		c.oob = make([]byte, syscall.CmsgSpace(20))
+	}
+	sa := &syscall.SockaddrLinklayer{Protocol: packetProtocol()}
+	if iface != "" {
+		ifi, err := net.InterfaceByName(iface)
+		if err != nil {
+			return err
+		}
+		sa.Ifindex = ifi.Index
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		return err
+	}
+	if c.mirror {
+		// promiscuous while the socket is open, the kernel drops the membership on close
+		// packet_mreq is an int ifindex, a u16 type and address length, and the address; it's set
+		// through ipv6_mreq, large enough and the only setsockopt of syscall taking a struct that big
+		var mreq syscall.IPv6Mreq
+		binary.NativeEndian.PutUint32(mreq.Multiaddr[0:4], uint32(sa.Ifindex))
+		binary.NativeEndian.PutUint16(mreq.Multiaddr[4:6], syscall.PACKET_MR_PROMISC)
+		if err := syscall.SetsockoptIPv6Mreq(fd, solPacket, syscall.PACKET_ADD_MEMBERSHIP, &mreq); err != nil {
+			return err
+		}
+	}
+	if cfgCaptureFanout > 1 {
+		arg := uint32(fanoutGroup(iface, c.laddr)) | (packetFanoutHash|packetFanoutFlagDefrag)<<16
+		return syscall.SetsockoptInt(fd, solPacket, packetFanout, int(int32(arg)))
+	}
+	return nil
+}
+
+// fanout group of the sockets of a guard, the same on reopen, different for each
+// interface and listen ip and for other portguard processes
+func fanoutGroup(iface string, laddr net.IP) int {
+	h := crc32.ChecksumIEEE([]byte(iface + "/" + laddr.String()))
+	return int(h+uint32(os.Getpid())) & 0xffff
+}
+
+// packets and drops since the last call, counters reset on read
+func (c *packetSockConn) statistics() (packets, drops uint32) {
+	c.rc.Control(func(fd uintptr) {
+		// tpacket_stats is two uint32s, as large as ip_mreq, and getsockopt fits what it
+		// copies to the length asked for; there's no getsockopt syscall to call on 386
+		m, err := syscall.GetsockoptIPMreq(int(fd), solPacket, packetStatistics)
+		if err == nil {
+			packets = binary.NativeEndian.Uint32(m.Multiaddr[:])
+			drops = binary.NativeEndian.Uint32(m.Interface[:])
+		}
+	})
+	return
+}
+
+func (c *packetSockConn) Close() error {
+	packetSockLock.Lock()
+	delete(packetSocks, c)
+	packetSockLock.Unlock()
+	c.updateStat()
+	removeCaptureStat(c.stat)
+	return c.File.Close()
+}
+
+func (c *packetSockConn) updateStat() {
+	packets, drops := c.statistics()
+	atomic.AddInt64(&c.stat.Packets, int64(packets))
+	atomic.AddInt64(&c.stat.Drops, int64(drops))
+	atomic.AddInt64(&stats.captureDrops, int64(drops))
+}
+
+// open af_packet sockets, to read kernel counters before they are reported
+var (
+	packetSockLock sync.Mutex
+	packetSocks    = map[*packetSockConn]bool{}
+)
+
+func updateCaptureStats() {
+	packetSockLock.Lock()
+	defer packetSockLock.Unlock()
+	for c := range packetSocks {
+		c.updateStat()
+	}
+}
+
+// accept incoming ipv4 packets of our protocol, to laddr if not 0.0.0.0, whatever the link layer,
+// and gre and udp packets that may be tunnels on a mirror interface with mirror_decap
+// with vlan capture, frames that still carry a tag after the kernel stripped the outer one
+// are left to decodeFrame
+func (c *packetSockConn) filter() []syscall.SockFilter {
+	matchDst := !c.laddr.Equal(serverIp)
+	// gre and udp of tunnels too on mirror interfaces, they carry packets to other hosts
+	decap := c.mirror && cfgMirrorDecap != 0
+	ipAt := 2
+	if cfgVlanCapture {
+		ipAt = 7
+	}
+	accept := ipAt + 2
+	if decap {
+		accept += 2
+	}
+	if matchDst {
+		accept += 2
+	}
+	drop := accept + 1
+
+	var insns []syscall.SockFilter
+	ld := func(size int, k int) {
+		insns = append(insns, *syscall.LsfStmt(syscall.BPF_LD|size|syscall.BPF_ABS, k))
+	}
+	// go to instruction jt if A == k, else to jf
+	jeq := func(k int, jt, jf int) {
+		i := len(insns)
+		insns = append(insns, *syscall.LsfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, k, jt-i-1, jf-i-1))
+	}
+	ld(syscall.BPF_W, skfAdPkttype)
+	jeq(syscall.PACKET_OUTGOING, drop, 2)
+	if cfgVlanCapture {
+		ld(syscall.BPF_W, skfAdProtocol)
+		jeq(ethPIp, ipAt, 4)
+		jeq(etherTypeVlan, accept, 5)
+		jeq(etherTypeQinQ, accept, 6)
+		jeq(etherTypeQinQ1, accept, drop)
+	}
+	ld(syscall.BPF_B, skfNetOff+9)
+	if decap {
+		jeq(int(c.proto), ipAt+4, ipAt+2)
+		jeq(protoGRE, accept, ipAt+3)
+		jeq(protoUDP, accept, drop)
+	} else {
+		jeq(int(c.proto), ipAt+2, drop)
+	}
+	if matchDst {
+		ld(syscall.BPF_W, skfNetOff+16)
+		jeq(int(ipToUint32(c.laddr)), accept, drop)
+	}
+	insns = append(insns,
+		*syscall.LsfStmt(syscall.BPF_RET|syscall.BPF_K, 0xffff),
+		*syscall.LsfStmt(syscall.BPF_RET|syscall.BPF_K, 0))
+	return insns
+}
+
+// our own frames and those from unwanted macs are skipped, and frames of other hosts but on a
+// mirror interface
+func (c *packetSockConn) ReadPacket(b []byte) (int, error) {
+	if len(c.buf) < len(b)+packetLinkRoom {
+		c.buf = make([]byte, len(b)+packetLinkRoom)
+	}
+	for {
+		var n, oobn int
+		var from syscall.Sockaddr
+		var serr error
+		err := c.rc.Read(func(fd uintptr) bool {
+			n, oobn, _, from, serr = syscall.Recvmsg(int(fd), c.buf, c.oob, 0)
+			return serr != syscall.EAGAIN
+		})
+		if err != nil {
+			return 0, err
+		}
+		if serr != nil {
+			return n, serr
+		}
+		sll, ok := from.(*syscall.SockaddrLinklayer)
+		if !ok || sll.Pkttype == syscall.PACKET_OUTGOING || sll.Pkttype == syscall.PACKET_OTHERHOST && !c.mirror {
+			continue
+		}
+		dlt := dltRaw
+		var mac net.HardwareAddr
+		if sll.Hatype == arphrdEther || sll.Hatype == arphrdLoopback {
+			dlt = dltEn10mb
+			mac = net.HardwareAddr(sll.Addr[:sll.Halen])
+		}
+		if !macAllowed(mac) {
+			statsAdd(&stats.macIgnored)
+			continue
+		}
+		packet, vlan, ok := decodeFrame(dlt, c.buf[:n], c.proto, c.laddr, auxVlan(c.oob[:oobn]))
+		if !ok {
+			continue
+		}
+		c.vlan = vlan
+		// a frame that filled buf fills b too, so the guard counts it as truncated
+		return copy(b, packet), nil
+	}
+}
+
+func (c *packetSockConn) LastVlan() int {
+	return c.vlan
+}
+
+// vlan id of a tpacket_auxdata control message, 0 if the frame had no tag
+func auxVlan(oob []byte) int {
+	if len(oob) == 0 {
+		return 0
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0
+	}
+	for _, m := range msgs {
+		if m.Header.Level != solPacket || m.Header.Type != packetAuxdata || len(m.Data) < 20 {
+			continue
+		}
+		// tp_status, tp_len, tp_snaplen, tp_mac, tp_net, tp_vlan_tci
+		if binary.NativeEndian.Uint32(m.Data[0:4])&tpStatusVlanValid != 0 {
+			return int(binary.NativeEndian.Uint16(m.Data[16:18]) & 0x0fff)
+		}
+	}
+	return 0
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
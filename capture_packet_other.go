@@ -0,0 +1,10 @@
+//go:build !linux
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+// only linux af_packet sockets have kernel counters
+func updateCaptureStats() {}
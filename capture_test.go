@@ -0,0 +1,53 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+// ethernet frames: plain, vlan tagged, qinq, and a vxlan and an erspan ii tunnel of the plain one
+func frameSeeds() [][]byte {
+	packet := append(append([]byte{}, ipv4Seed...), tcpSeeds[0]...)
+	ether := append(make([]byte, 12), 0x08, 0x00)
+	plain := append(append([]byte{}, ether...), packet...)
+	vlan := append(append(make([]byte, 12), 0x81, 0x00, 0x00, 0x0a, 0x08, 0x00), packet...)
+	qinq := append(append(make([]byte, 12), 0x88, 0xa8, 0x00, 0x14, 0x81, 0x00, 0x00, 0x0a, 0x08, 0x00), packet...)
+
+	udp := []byte{0x30, 0x39, 0x12, 0xb5, 0, 0, 0, 0}
+	vxlan := append(append(udp, 0x08, 0, 0, 0, 0, 0, 1, 0), plain...)
+	outer := append([]byte{}, ipv4Seed...)
+	outer[9] = protoUDP
+	vxlanFrame := append(append(append([]byte{}, ether...), outer...), vxlan...)
+
+	gre := append([]byte{0x10, 0x00, 0x88, 0xbe, 0, 0, 0, 1, 0x10, 0x0a, 0, 0, 0, 0, 0, 0}, plain...)
+	outer = append([]byte{}, ipv4Seed...)
+	outer[9] = protoGRE
+	erspanFrame := append(append(append([]byte{}, ether...), outer...), gre...)
+
+	return [][]byte{plain, vlan, qinq, vxlanFrame, erspanFrame, plain[:20], vlan[:16], erspanFrame[:40]}
+}
+
+func FuzzDecodeFrame(f *testing.F) {
+	for _, seed := range frameSeeds() {
+		f.Add(dltEn10mb, seed)
+	}
+	f.Add(dltRaw, append(append([]byte{}, ipv4Seed...), tcpSeeds[0]...))
+	f.Add(dltNull, []byte{2, 0, 0})
+	serverIp = net.IPv4zero
+	cfgMirrorDecap = decapGre | decapErspan | decapVxlan
+	f.Fuzz(func(t *testing.T, dlt int, frame []byte) {
+		packet, _, ok := decodeFrame(dlt, frame, protoTCP, net.IPv4zero, 0)
+		if !ok {
+			return
+		}
+		var ip IPv4Header
+		if NewIPv4Header(packet, &ip) == nil {
+			var tcp TCPHeader
+			NewTCPHeader(ip.Payload(packet), &tcp)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// windows raw sockets never see tcp/udp, capture with npcap's wpcap.dll instead
+var (
+	wpcap           = syscall.NewLazyDLL(filepath.Join(os.Getenv("SystemRoot"), "System32", "Npcap", "wpcap.dll"))
+	pcapOpenLive    = wpcap.NewProc("pcap_open_live")
+	pcapCompile     = wpcap.NewProc("pcap_compile")
+	pcapSetfilter   = wpcap.NewProc("pcap_setfilter")
+	pcapSetbuff     = wpcap.NewProc("pcap_setbuff")
+	pcapFreecode    = wpcap.NewProc("pcap_freecode")
+	pcapNextEx      = wpcap.NewProc("pcap_next_ex")
+	pcapClose       = wpcap.NewProc("pcap_close")
+	pcapGeterr      = wpcap.NewProc("pcap_geterr")
+	pcapDatalink    = wpcap.NewProc("pcap_datalink")
+	pcapFindalldevs = wpcap.NewProc("pcap_findalldevs")
+	pcapFreealldevs = wpcap.NewProc("pcap_freealldevs")
+)
+
+const (
+	pcapErrbufSize       = 256
+	pcapNetmaskUnknown   = 0xffffffff
+	pcapIfLoopback       = 1
+	pcapReadTimeoutMilli = 500
+)
+
+type pcapPkthdr struct {
+	tsSec  int32
+	tsUsec int32
+	caplen uint32
+	len    uint32
+}
+
+type bpfProgram struct {
+	len   uint32
+	insns uintptr
+}
+
+type pcapIf struct {
+	next        *pcapIf
+	name        *byte
+	description *byte
+	addresses   uintptr
+	flags       uint32
+}
+
+// npcap handle, see packetConn
+type npcapConn struct {
+	handle   uintptr
+	dlt      int
+	proto    uint8
+	laddr    net.IP
+	vlan     int // of the last packet
+	mu       sync.Mutex
+	closed   bool
+	deadline time.Time
+}
+
+func openCapture(network string, iface string, laddr net.IP) (packetConn, error) {
+	if err := wpcap.Load(); err != nil {
+		return nil, fmt.Errorf("npcap is not installed, get it from https://npcap.com: %s", err.Error())
+	}
+
+	var err error
+	if iface == "" {
+		if iface, err = defaultDevice(); err != nil {
+			return nil, err
+		}
+	}
+
+	errbuf := make([]byte, pcapErrbufSize)
+	device := append([]byte(iface), 0)
+	handle, _, _ := pcapOpenLive.Call(uintptr(unsafe.Pointer(&device[0])), 65535, 0, pcapReadTimeoutMilli,
+		uintptr(unsafe.Pointer(&errbuf[0])))
+	if handle == 0 {
+		return nil, errors.New(cString(&errbuf[0]))
+	}
+	c := &npcapConn{handle: handle, proto: networkProto(network), laddr: laddr}
+	if cfgCaptureRcvbuf > 0 {
+		// npcap's kernel buffer, 1MB by default; there is no call to read it back
+		if r, _, _ := pcapSetbuff.Call(handle, uintptr(cfgCaptureRcvbuf)); int32(r) != 0 {
+			err := c.lastError()
+			pcapClose.Call(handle)
+			return nil, err
+		}
+		logRcvbuf(network, iface, laddr, cfgCaptureRcvbuf)
+	}
+
+	// only inbound ipv4 packets of network's protocol; npcap sees outgoing ones too, without a
+	// local address to match they're told apart by their source, one of the host's addresses
+	expr := "ip and " + strings.TrimPrefix(network, "ip4:")
+	if !laddr.Equal(serverIp) {
+		expr += " and dst host " + laddr.String()
+	} else if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.To4() != nil && !n.IP.IsLoopback() {
+				expr += " and not src host " + n.IP.String()
+			}
+		}
+	}
+	if cfgVlanCapture {
+		// each vlan keyword moves the offsets of what follows past one more tag
+		expr = fmt.Sprintf("%s or (vlan and (%s or (vlan and %s)))", expr, expr, expr)
+	}
+	if err := c.setFilter(expr); err != nil {
+		pcapClose.Call(handle)
+		return nil, err
+	}
+
+	dlt, _, _ := pcapDatalink.Call(handle)
+	c.dlt = int(dlt)
+	return c, nil
+}
+
+func (c *npcapConn) setFilter(expr string) error {
+	var prog bpfProgram
+	cexpr := append([]byte(expr), 0)
+	if r, _, _ := pcapCompile.Call(c.handle, uintptr(unsafe.Pointer(&prog)), uintptr(unsafe.Pointer(&cexpr[0])), 1, pcapNetmaskUnknown); int32(r) != 0 {
+		return c.lastError()
+	}
+	defer pcapFreecode.Call(uintptr(unsafe.Pointer(&prog)))
+	if r, _, _ := pcapSetfilter.Call(c.handle, uintptr(unsafe.Pointer(&prog))); int32(r) != 0 {
+		return c.lastError()
+	}
+	return nil
+}
+
+func (c *npcapConn) lastError() error {
+	r, _, _ := pcapGeterr.Call(c.handle)
+	return errors.New(cString(*(**byte)(unsafe.Pointer(&r))))
+}
+
+func (c *npcapConn) ReadPacket(b []byte) (int, error) {
+	for {
+		// the handle is closed by its reader, pcap_next_ex is not safe against pcap_close
+		c.mu.Lock()
+		if c.closed {
+			if c.handle != 0 {
+				pcapClose.Call(c.handle)
+				c.handle = 0
+			}
+			c.mu.Unlock()
+			return 0, net.ErrClosed
+		}
+		deadline := c.deadline
+		c.mu.Unlock()
+
+		var hdr *pcapPkthdr
+		var data *byte
+		r, _, _ := pcapNextEx.Call(c.handle, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data)))
+		switch int32(r) {
+		case 1:
+			packet, vlan, ok := decodeFrame(c.dlt, unsafe.Slice(data, hdr.caplen), c.proto, c.laddr, 0)
+			if !ok {
+				continue
+			}
+			c.vlan = vlan
+			return copy(b, packet), nil
+		case 0:
+			// read timeout
+			if !deadline.IsZero() && time.Now().After(deadline) {
+				return 0, os.ErrDeadlineExceeded
+			}
+		default:
+			return 0, c.lastError()
+		}
+	}
+}
+
+func (c *npcapConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *npcapConn) LastVlan() int {
+	return c.vlan
+}
+
+func (c *npcapConn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	return nil
+}
+
+// npcap device names like \Device\NPF_{...} are checked when opened
+func checkInterface(name string) error {
+	return nil
+}
+
+// first non loopback device with an address
+func defaultDevice() (string, error) {
+	var devs *pcapIf
+	errbuf := make([]byte, pcapErrbufSize)
+	if r, _, _ := pcapFindalldevs.Call(uintptr(unsafe.Pointer(&devs)), uintptr(unsafe.Pointer(&errbuf[0]))); int32(r) != 0 {
+		return "", errors.New(cString(&errbuf[0]))
+	}
+	defer pcapFreealldevs.Call(uintptr(unsafe.Pointer(devs)))
+
+	for dev := devs; dev != nil; dev = dev.next {
+		if dev.flags&pcapIfLoopback == 0 && dev.addresses != 0 {
+			return cString(dev.name), nil
+		}
+	}
+	return "", errors.New("no capture device found, set interface in config")
+}
+
+func cString(p *byte) string {
+	if p == nil {
+		return ""
+	}
+	var b []byte
+	for ptr := unsafe.Pointer(p); *(*byte)(ptr) != 0; ptr = unsafe.Add(ptr, 1) {
+		b = append(b, *(*byte)(ptr))
+	}
+	return string(b)
+}
@@ -0,0 +1,222 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	captureBackoffMin = time.Second
+	captureBackoffMax = time.Minute
+
+	opsCaptureBlind     = "capture_blind"
+	opsCaptureRecovered = "capture_recovered"
+)
+
+var blindGuards int64 // guards without a working capture now
+
+// returned by a recoveringConn while it has no capture, a timeout so guard loops just retry
+type captureBlindError struct{}
+
+func (captureBlindError) Error() string   { return "capture is down" }
+func (captureBlindError) Timeout() bool   { return true }
+func (captureBlindError) Temporary() bool { return true }
+
+// capture of a guard that reopens itself: after capture_error_limit read errors in a row,
+// or no packet for capture_stall_timeout seconds, the socket is closed and reopened with
+// backoff; going blind and recovering raise ops alerts
+type recoveringConn struct {
+	network string
+	iface   string
+	laddr   net.IP
+
+	lock       sync.Mutex
+	conn       packetConn // nil while blind
+	closed     bool
+	deadline   time.Time
+	errors     int // read errors in a row
+	lastPacket time.Time
+	blindSince time.Time
+	backoff    time.Duration
+	nextOpen   time.Time
+}
+
+func newRecoveringConn(network, iface string, laddr net.IP, conn packetConn) *recoveringConn {
+	return &recoveringConn{network: network, iface: iface, laddr: laddr, conn: conn, lastPacket: time.Now()}
+}
+
+func (c *recoveringConn) ReadPacket(b []byte) (int, error) {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return 0, io.EOF
+	}
+	if c.conn == nil && !time.Now().Before(c.nextOpen) {
+		c.reopen()
+	}
+	conn := c.conn
+	if conn == nil {
+		wait := time.Until(c.nextOpen)
+		if !c.deadline.IsZero() && time.Until(c.deadline) < wait {
+			wait = time.Until(c.deadline)
+		}
+		c.lock.Unlock()
+		select {
+		case <-shutdown:
+			return 0, io.EOF
+		case <-time.After(wait):
+		}
+		return 0, captureBlindError{}
+	}
+	stall := time.Duration(cfgCaptureStallTimeout) * time.Second
+	if stall > 0 {
+		// wake up in time to notice the stall even without a watchdog deadline
+		d := c.lastPacket.Add(stall)
+		if !c.deadline.IsZero() && c.deadline.Before(d) {
+			d = c.deadline
+		}
+		conn.SetReadDeadline(d)
+	}
+	c.lock.Unlock()
+
+	n, err := conn.ReadPacket(b)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed || c.conn != conn {
+		return n, err
+	}
+	switch {
+	case err == nil:
+		c.errors = 0
+		c.lastPacket = time.Now()
+	case isTimeout(err):
+		if stall > 0 && time.Since(c.lastPacket) >= stall {
+			c.fail(fmt.Sprintf("no packet for %s", stall))
+		}
+	case err != io.EOF && !isShutdown():
+		c.errors++
+		if cfgCaptureErrorLimit > 0 && c.errors >= cfgCaptureErrorLimit {
+			c.fail(fmt.Sprintf("%d read errors in a row, last:%s", c.errors, err.Error()))
+		}
+	}
+	return n, err
+}
+
+// close the capture and go blind, called with lock held
+func (c *recoveringConn) fail(reason string) {
+	c.conn.Close()
+	c.conn = nil
+	c.errors = 0
+	c.blindSince = time.Now()
+	c.backoff = captureBackoffMin
+	c.nextOpen = c.blindSince.Add(c.backoff)
+	atomic.AddInt64(&blindGuards, 1)
+	statsAdd(&stats.captureFails)
+	opsAlert(opsCaptureBlind, c.network, c.iface, c.laddr,
+		fmt.Sprintf("guard %s on interface %q is blind: %s, reopening", c.network, c.iface, reason))
+}
+
+// try to open the capture again, doubling the backoff on failure, called with lock held
+func (c *recoveringConn) reopen() {
+	conn, err := openCapture(c.network, c.iface, c.laddr)
+	if err != nil {
+		logMain(false, "reopen %s on interface %q failed:%s, retry in %s", c.network, c.iface, err.Error(), c.backoff)
+		c.nextOpen = time.Now().Add(c.backoff)
+		if c.backoff *= 2; c.backoff > captureBackoffMax {
+			c.backoff = captureBackoffMax
+		}
+		return
+	}
+	if !c.deadline.IsZero() {
+		conn.SetReadDeadline(c.deadline)
+	}
+	c.conn = conn
+	c.lastPacket = time.Now()
+	atomic.AddInt64(&blindGuards, -1)
+	statsAdd(&stats.captureReopen)
+	opsAlert(opsCaptureRecovered, c.network, c.iface, c.laddr,
+		fmt.Sprintf("guard %s on interface %q recovered after %s", c.network, c.iface, time.Since(c.blindSince).Truncate(time.Second)))
+}
+
+func (c *recoveringConn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.deadline = t
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *recoveringConn) LastVlan() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.conn == nil {
+		return 0
+	}
+	return lastVlan(c.conn)
+}
+
+func (c *recoveringConn) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// operational alert about portguard itself rather than a host: logged, written to
+// event_log, exported to otlp, posted as json to ops_alert_url and reported to error_report_url
+func opsAlert(kind, network, iface string, laddr net.IP, msg string) {
+	logMain(false, "ops alert: %s", msg)
+	ev := &event{
+		Time:     time.Now(),
+		Kind:     eventOps,
+		Proto:    captureProto(network),
+		ScanType: kind,
+		Iface:    iface,
+		Message:  msg,
+		Laddr:    laddr,
+	}
+	logEvent(ev)
+	otlpEvent(ev)
+	reportError(kind, "", "%s", msg)
+	if cfgOpsAlertUrl != "" {
+		go postOpsAlert(ev)
+	}
+}
+
+func postOpsAlert(ev *event) {
+	data, err := json.Marshal(ev.record())
+	if err != nil {
+		return
+	}
+	resp, err := http.Post(cfgOpsAlertUrl, "application/json", bytes.NewReader(data))
+	if err != nil {
+		logMain(false, "post ops alert to %s failed:%s", cfgOpsAlertUrl, err.Error())
+		return
+	}
+	resp.Body.Close()
+}
+
+// TCP or UDP for ip4:tcp or ip4:udp
+func captureProto(network string) string {
+	if network == "ip4:udp" {
+		return "UDP"
+	}
+	return "TCP"
+}
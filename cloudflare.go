@@ -0,0 +1,156 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// block hosts with cloudflare ip access rules, for services behind cloudflare's edge
+// rule ids are only kept in memory, a host not known is looked up by ip among the rules portguard
+// made, so blocks restored from state_file are still lifted and a repeated block reuses its rule
+
+const (
+	cloudflareApi   = "https://api.cloudflare.com/client/v4"
+	cloudflareNotes = "portguard: port scan"
+)
+
+var (
+	cloudflareClient = &http.Client{Timeout: 10 * time.Second}
+
+	cloudflareLock  sync.Mutex
+	cloudflareRules = make(map[string]string) // ip -> access rule id
+)
+
+// access rules scoped to a zone, or the whole account
+func cloudflareRulesUrl() string {
+	if cfgCloudflareZone != "" {
+		return cloudflareApi + "/zones/" + cfgCloudflareZone + "/firewall/access_rules/rules"
+	}
+	return cloudflareApi + "/accounts/" + cfgCloudflareAccount + "/firewall/access_rules/rules"
+}
+
+func cloudflareCall(method string, url string, body interface{}, result interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+cfgCloudflareToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := cloudflareClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var v struct {
+		Success bool
+		Errors  []struct {
+			Code    int
+			Message string
+		}
+		Result json.RawMessage
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return fmt.Errorf("%s: %s", resp.Status, err.Error())
+	}
+	if !v.Success {
+		if len(v.Errors) > 0 {
+			return fmt.Errorf("cloudflare error %d: %s", v.Errors[0].Code, v.Errors[0].Message)
+		}
+		return fmt.Errorf("cloudflare: %s", resp.Status)
+	}
+	if result != nil {
+		return json.Unmarshal(v.Result, result)
+	}
+	return nil
+}
+
+func cloudflareBlock(ip string) error {
+	cloudflareLock.Lock()
+	defer cloudflareLock.Unlock()
+	if _, ok := cloudflareRules[ip]; ok {
+		return nil
+	}
+	id, err := cloudflareFind(ip)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		cloudflareRules[ip] = id
+		return nil
+	}
+
+	body := map[string]interface{}{
+		"mode": "block",
+		"configuration": map[string]string{
+			"target": "ip",
+			"value":  ip,
+		},
+		"notes": cloudflareNotes,
+	}
+	var rule struct {
+		Id string
+	}
+	if err := cloudflareCall("POST", cloudflareRulesUrl(), body, &rule); err != nil {
+		return err
+	}
+	cloudflareRules[ip] = rule.Id
+	return nil
+}
+
+func cloudflareUnblock(ip string) error {
+	cloudflareLock.Lock()
+	defer cloudflareLock.Unlock()
+	id, ok := cloudflareRules[ip]
+	if !ok {
+		var err error
+		if id, err = cloudflareFind(ip); err != nil || id == "" {
+			return err
+		}
+	}
+	if err := cloudflareCall("DELETE", cloudflareRulesUrl()+"/"+id, nil, nil); err != nil {
+		return err
+	}
+	delete(cloudflareRules, ip)
+	return nil
+}
+
+// id of the block rule portguard made for ip, empty if there's none
+func cloudflareFind(ip string) (string, error) {
+	query := url.Values{}
+	query.Set("mode", "block")
+	query.Set("configuration.target", "ip")
+	query.Set("configuration.value", ip)
+	var rules []struct {
+		Id    string
+		Notes string
+	}
+	if err := cloudflareCall("GET", cloudflareRulesUrl()+"?"+query.Encode(), nil, &rules); err != nil {
+		return "", err
+	}
+	for _, rule := range rules {
+		if rule.Notes == cloudflareNotes {
+			return rule.Id, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,270 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// cluster mode, blocks are shared with cluster_peer nodes over udp
+//
+// a datagram is the hex hmac-sha256 of its body with cluster_key, a newline and the json body:
+//
+//	{"node":"web-1","time":1700000000,"nonce":"...","blocks":[{"host":"1.2.3.4","port":23,"proto":"TCP","scan_type":"...","at":1700000000,"hops":0}]}
+//
+// datagrams with a wrong hmac, older than clusterMaxSkew or seen before are dropped
+//
+// semantics:
+//   - a node announces its own blocks to all peers at once, and every cluster_sync_interval
+//     seconds all hosts it has blocked, so restarted or partitioned peers catch up
+//   - a peer blocks a host it doesn't block yet and runs its responders, unless its ignore_ip,
+//     ignore_host, asn, country or reputation lists say not to; local lists always win
+//   - a block keeps the time it was first made, every node expires it after its own
+//     block_duration from then, and blocks already expired by that are not taken; unblocks
+//     aren't sent
+//   - new blocks taken from a peer are passed on to the other peers, up to clusterMaxHops times,
+//     so a partial mesh of peers works too
+type clusterBlock struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"`
+	Proto    string `json:"proto,omitempty"`
+	ScanType string `json:"scan_type,omitempty"`
+	At       int64  `json:"at"`
+	Hops     int    `json:"hops"`
+}
+
+type clusterMessage struct {
+	Node   string         `json:"node"`
+	Time   int64          `json:"time"`
+	Nonce  string         `json:"nonce"`
+	Blocks []clusterBlock `json:"blocks"`
+}
+
+const (
+	clusterMaxSkew   = 60 // seconds
+	clusterMaxHops   = 3
+	clusterChunkSize = 16 // blocks per datagram
+)
+
+var (
+	clusterConn  *net.UDPConn
+	clusterPeers []*net.UDPAddr
+	clusterNode  string
+
+	clusterLock   sync.Mutex
+	clusterNonces = make(map[string]int64) // nonces seen within clusterMaxSkew
+)
+
+func startCluster() error {
+	if cfgClusterKey == "" {
+		return errors.New("cluster_key is not set")
+	}
+	clusterNode = cfgClusterNode
+	if clusterNode == "" {
+		clusterNode, _ = os.Hostname()
+	}
+	for _, peer := range cfgClusterPeers {
+		addr, err := net.ResolveUDPAddr("udp4", peer)
+		if err != nil {
+			return err
+		}
+		clusterPeers = append(clusterPeers, addr)
+	}
+	laddr, err := net.ResolveUDPAddr("udp4", cfgClusterListen)
+	if err != nil {
+		return err
+	}
+	if clusterConn, err = net.ListenUDP("udp4", laddr); err != nil {
+		return err
+	}
+	go serveCluster()
+	if cfgClusterSyncInterval > 0 {
+		go runClusterSync()
+	}
+	return nil
+}
+
+func sealCluster(msg *clusterMessage) ([]byte, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte(cfgClusterKey))
+	mac.Write(body)
+	sum := hex.EncodeToString(mac.Sum(nil))
+	return append([]byte(sum+"\n"), body...), nil
+}
+
+// check hmac, age and nonce of a datagram
+func openCluster(data []byte) (*clusterMessage, error) {
+	i := 0
+	for i < len(data) && data[i] != '\n' {
+		i++
+	}
+	if i == len(data) {
+		return nil, errors.New("malformed datagram")
+	}
+	sum, body := data[:i], data[i+1:]
+	mac := hmac.New(sha256.New, []byte(cfgClusterKey))
+	mac.Write(body)
+	want := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal(sum, []byte(want)) {
+		return nil, errors.New("bad hmac")
+	}
+	var msg clusterMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	if msg.Time < now-clusterMaxSkew || msg.Time > now+clusterMaxSkew {
+		return nil, errors.New("stale datagram, clocks out of sync?")
+	}
+	clusterLock.Lock()
+	defer clusterLock.Unlock()
+	for nonce, t := range clusterNonces {
+		if t < now-clusterMaxSkew {
+			delete(clusterNonces, nonce)
+		}
+	}
+	if _, seen := clusterNonces[msg.Nonce]; seen {
+		return nil, errors.New("replayed datagram")
+	}
+	clusterNonces[msg.Nonce] = msg.Time
+	return &msg, nil
+}
+
+// send blocks to peers except skip, in datagrams of clusterChunkSize blocks
+func sendCluster(blocks []clusterBlock, skip *net.UDPAddr) {
+	if clusterConn == nil || len(blocks) == 0 {
+		return
+	}
+	for len(blocks) > 0 {
+		n := len(blocks)
+		if n > clusterChunkSize {
+			n = clusterChunkSize
+		}
+		nonce := make([]byte, 12)
+		rand.Read(nonce)
+		data, err := sealCluster(&clusterMessage{Node: clusterNode, Time: time.Now().Unix(), Nonce: hex.EncodeToString(nonce), Blocks: blocks[:n]})
+		if err != nil {
+			return
+		}
+		for _, peer := range clusterPeers {
+			if skip != nil && peer.IP.Equal(skip.IP) && peer.Port == skip.Port {
+				continue
+			}
+			if _, err := clusterConn.WriteToUDP(data, peer); err != nil {
+				logDebug("send to cluster peer %s failed:%s", peer, err.Error())
+			}
+		}
+		blocks = blocks[n:]
+	}
+}
+
+// tell peers about a block made here
+func clusterAnnounce(ev *event) {
+	if clusterConn == nil || ev.Peer != "" {
+		return
+	}
+	stateLock.Lock()
+	at := blockedAt[ev.Host]
+	stateLock.Unlock()
+	sendCluster([]clusterBlock{{Host: ev.Host, Port: ev.Port, Proto: ev.Proto, ScanType: ev.ScanType, At: at}}, nil)
+}
+
+func serveCluster() {
+	b := make([]byte, 65536)
+	for {
+		n, from, err := clusterConn.ReadFromUDP(b)
+		if err != nil {
+			if isShutdown() {
+				return
+			}
+			logMain(false, "read from cluster failed:%s", err.Error())
+			time.Sleep(time.Second)
+			continue
+		}
+		msg, err := openCluster(b[:n])
+		if err != nil {
+			logMain(false, "drop cluster datagram from %s:%s", from, err.Error())
+			continue
+		}
+		var forward []clusterBlock
+		for _, cb := range msg.Blocks {
+			if applyClusterBlock(msg.Node, &cb) && cb.Hops+1 < clusterMaxHops {
+				cb.Hops++
+				forward = append(forward, cb)
+			}
+		}
+		sendCluster(forward, from)
+	}
+}
+
+// block a host reported by a peer, true if it's a new block here
+func applyClusterBlock(node string, cb *clusterBlock) bool {
+	ip := net.ParseIP(cb.Host).To4()
+	if ip == nil || isIgnoredIP(ip) {
+		return false
+	}
+	now := time.Now().Unix()
+	if cb.At > now {
+		cb.At = now
+	}
+	if cfgBlockDuration > 0 && cb.At+blockDuration(1) <= now {
+		return false
+	}
+
+	ev := &event{Time: time.Now(), Kind: eventAlarm, Host: cb.Host, Port: cb.Port, Proto: cb.Proto, ScanType: cb.ScanType, Peer: node}
+	if ev.ScanType == "" {
+		ev.ScanType = "cluster sync"
+	}
+	// it probed another node, not only this one
+	ev.Pattern = patternSweep
+	ev.ASN, ev.ASOrg = lookupAsn(ip)
+	ev.Country = lookupCountry(ip)
+	ev.Reputation = reputationOf(cb.Host)
+	for _, d := range []string{asnPolicy(ev), countryPolicy(ev), reputationPolicy(ev)} {
+		if d == policyIgnore || d == policyAlarm {
+			logDebug("block of %s from cluster peer %s is not taken, %s by local lists", cb.Host, node, d)
+			return false
+		}
+	}
+	if !forceBlock(cb.Host, cb.Port, ev.ScanType) {
+		return false
+	}
+	// expire with the original block
+	stateLock.Lock()
+	blockedAt[cb.Host] = cb.At
+	stateLock.Unlock()
+	reportBlock(ev)
+	return true
+}
+
+// send every block not expired yet to peers
+func syncCluster() {
+	var blocks []clusterBlock
+	stateLock.Lock()
+	for ip, at := range blockedAt {
+		blocks = append(blocks, clusterBlock{Host: ip, At: at})
+	}
+	stateLock.Unlock()
+	sendCluster(blocks, nil)
+}
+
+func runClusterSync() {
+	syncCluster()
+	for range time.Tick(time.Duration(cfgClusterSyncInterval) * time.Second) {
+		syncCluster()
+	}
+}
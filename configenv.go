@@ -0,0 +1,107 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// config for containers
+// the config file may be - to read it from stdin, or left out to take every key from
+// PORTGUARD_<KEY> variables, so an image needs no config mount and the orchestrator injects secrets:
+//   PORTGUARD_EXCLUDE_PORT="80<newline>443"            each line of a value is one more value of a repeated key
+//   PORTGUARD_RESPONDER__CHAT__URL=https://...         __ stands for the dots of responder.<name>.<key> and the like
+
+const (
+	// prefix of environment variables overriding config keys, e.g. PORTGUARD_SCAN_TRIGGER=3
+	configEnvPrefix = "PORTGUARD_"
+
+	configStdin = "-"
+)
+
+// only ${VAR} is expanded, $TARGET$ and friends are left alone
+var configEnvRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+var (
+	// config read from stdin, kept in memory; the daemon and privileged helper, which run portguard
+	// again, get it on their stdin, never in the environment commands inherit
+	stdinConfigData *string
+
+	// variables config values refer to as ${VAR}, likely secrets, see childEnv; reloads add to it
+	// while commands run
+	configEnvLock sync.Mutex
+	configEnvRefs = make(map[string]bool)
+)
+
+// replace ${VAR} in a config value with the environment variable, empty if it's unset
+func expandConfigEnv(value string) string {
+	return configEnvRe.ReplaceAllStringFunc(value, func(s string) string {
+		configEnvLock.Lock()
+		configEnvRefs[s[2:len(s)-1]] = true
+		configEnvLock.Unlock()
+		return os.Getenv(s[2 : len(s)-1])
+	})
+}
+
+// the config on stdin, read once
+func stdinConfig() string {
+	if stdinConfigData == nil {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			logMain(true, "read config from stdin failed:%s", err.Error())
+		}
+		config := string(data)
+		stdinConfigData = &config
+	}
+	return *stdinConfigData
+}
+
+// the environment of commands portguard runs, without PORTGUARD_<KEY> config variables and
+// variables the config refers to, so tokens and keys don't reach responder commands and plugins
+func childEnv() []string {
+	configEnvLock.Lock()
+	defer configEnvLock.Unlock()
+	var env []string
+	for _, kv := range os.Environ() {
+		name := kv
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			name = kv[:i]
+		}
+		if strings.HasPrefix(name, configEnvPrefix) || configEnvRefs[name] {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+// apply PORTGUARD_<KEY> environment variables after the config file
+// keys that can be repeated get one more value per line, unknown keys such as PORTGUARD_DAEMON are ignored
+func applyConfigEnv() {
+	var envs []string
+	for _, env := range os.Environ() {
+		if strings.HasPrefix(env, configEnvPrefix) {
+			envs = append(envs, env)
+		}
+	}
+	sort.Strings(envs)
+	for _, env := range envs {
+		kv := strings.SplitN(env[len(configEnvPrefix):], "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			continue
+		}
+		token := strings.ReplaceAll(strings.ToLower(kv[0]), "__", ".")
+		for _, value := range strings.Split(kv[1], "\n") {
+			if value = strings.TrimSpace(value); value != "" {
+				setConfig(0, token, expandConfigEnv(value))
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// connect scans
+// a scan completing handshakes, like nmap -sT, only probes closed ports the guards see; the open
+// ports it connects to are found with conntrack events: on linux in tcp mode, a host whose
+// connections to connect_scan_ports distinct local ports closed within connect_scan_lifetime seconds
+// of opening, within connect_scan_window seconds, is raised as a "TCP connect scan" alarm; connect in
+// scan_type_action, scan_type_weight and scan_type_trigger
+// only connections that completed their handshake count, the source can't be spoofed
+
+const (
+	tcpPacketTypeConnect = "TCP connect scan"
+
+	// sources kept before quiet ones are forgotten
+	connectMaxSources = 4096
+)
+
+var (
+	cfgConnectScanPorts    int // distinct ports, 0 disables it
+	cfgConnectScanWindow   = 60
+	cfgConnectScanLifetime = 3
+
+	connectLock    sync.Mutex
+	connectSources = make(map[string]*connectSource)
+)
+
+type connectSource struct {
+	start   int64 // of the window, unix seconds
+	ports   map[int]bool
+	alarmed bool
+}
+
+// local addresses, for connections to this host rather than through it
+var (
+	localAddrLock sync.Mutex
+	localAddrs    map[[4]byte]bool
+	localAddrTime time.Time
+)
+
+func isLocalAddr(ip net.IP) bool {
+	localAddrLock.Lock()
+	defer localAddrLock.Unlock()
+	if time.Since(localAddrTime) > time.Minute {
+		if addrs, err := net.InterfaceAddrs(); err == nil {
+			localAddrs = make(map[[4]byte]bool)
+			for _, a := range addrs {
+				if n, ok := a.(*net.IPNet); ok && n.IP.To4() != nil {
+					var k [4]byte
+					copy(k[:], n.IP.To4())
+					localAddrs[k] = true
+				}
+			}
+			localAddrTime = time.Now()
+		}
+	}
+	var k [4]byte
+	copy(k[:], ip.To4())
+	return localAddrs[k]
+}
+
+// if a connection from src to dst should be followed
+func connectWanted(src net.IP, dst net.IP) bool {
+	return isLocalAddr(dst) && !isIgnoredIP(src) && !isBlockedIP(src.String())
+}
+
+// note a short lived connection of src to port on our address dst, and raise an alarm once src
+// connected to connect_scan_ports ports in its window
+func noteConnect(src net.IP, dst net.IP, port int) {
+	now := time.Now()
+	host := src.String()
+
+	connectLock.Lock()
+	s := connectSources[host]
+	if s == nil || now.Unix()-s.start >= int64(cfgConnectScanWindow) {
+		if s == nil && len(connectSources) >= connectMaxSources {
+			for h, old := range connectSources {
+				if now.Unix()-old.start >= int64(cfgConnectScanWindow) {
+					delete(connectSources, h)
+				}
+			}
+		}
+		s = &connectSource{start: now.Unix(), ports: make(map[int]bool)}
+		connectSources[host] = s
+	}
+	if len(s.ports) < cfgConnectScanPorts {
+		s.ports[port] = true
+	}
+	scan := !s.alarmed && len(s.ports) >= cfgConnectScanPorts
+	if scan {
+		s.alarmed = true
+	}
+	connectLock.Unlock()
+
+	if !scan {
+		return
+	}
+	statsAdd(&stats.connectScans)
+	ev := &event{Time: now, Kind: eventAlarm, Host: host, Port: port, Proto: "TCP", ScanType: tcpPacketTypeConnect, Laddr: dst}
+	raiseAlarm(src, dst, ev, profileFor(""))
+}
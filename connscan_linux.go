@@ -0,0 +1,145 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"time"
+)
+
+// ctnetlink events, see linux/netfilter/nfnetlink_compat.h and nf_conntrack_common.h
+const (
+	ipctnlMsgCtNew          = 0
+	nfnlgrpConntrackNew     = 1
+	nfnlgrpConntrackDestroy = 3
+
+	solNetlink           = 270
+	netlinkAddMembership = 1
+
+	ctaTupleProto   = 2
+	ctaStatus       = 3
+	ctaId           = 12
+	ctaProtoNum     = 1
+	ctaProtoDstPort = 3
+
+	ipsAssured = 1 << 2 // tcp handshake completed
+
+	// connections followed before those too old to count are forgotten
+	connectMaxTracked = 65536
+)
+
+// subscribe to conntrack events, before dropping privileges
+func startConnectScan() error {
+	sock, err := netlinkOpen(netlinkNetfilter)
+	if err != nil {
+		return err
+	}
+	for _, group := range []int{nfnlgrpConntrackNew, nfnlgrpConntrackDestroy} {
+		if err := syscall.SetsockoptInt(sock, solNetlink, netlinkAddMembership, group); err != nil {
+			syscall.Close(sock)
+			return err
+		}
+	}
+	if _, err := setRcvbuf(sock); err != nil {
+		syscall.Close(sock)
+		return err
+	}
+	go runConnectScan(sock)
+	return nil
+}
+
+// a conntrack event of a tcp connection
+type ctEvent struct {
+	id     uint32
+	src    net.IP
+	dst    net.IP
+	port   int
+	status uint32
+}
+
+func parseCtEvent(data []byte) (*ctEvent, bool) {
+	if len(data) < len(ctNfgenmsg) || data[0] != syscall.AF_INET {
+		return nil, false
+	}
+	attrs := netlinkAttrs(data[len(ctNfgenmsg):])
+	orig := netlinkAttrs(attrs[ctaTupleOrig])
+	addrs := netlinkAttrs(orig[ctaTupleIp])
+	proto := netlinkAttrs(orig[ctaTupleProto])
+	src, dst, port, id := addrs[ctaIpV4Src], addrs[ctaIpV4Dst], proto[ctaProtoDstPort], attrs[ctaId]
+	if len(src) != 4 || len(dst) != 4 || len(port) != 2 || len(id) != 4 || len(proto[ctaProtoNum]) != 1 || proto[ctaProtoNum][0] != syscall.IPPROTO_TCP {
+		return nil, false
+	}
+	ev := &ctEvent{
+		id:   binary.BigEndian.Uint32(id),
+		src:  net.IPv4(src[0], src[1], src[2], src[3]).To4(),
+		dst:  net.IPv4(dst[0], dst[1], dst[2], dst[3]).To4(),
+		port: int(binary.BigEndian.Uint16(port)),
+	}
+	if status := attrs[ctaStatus]; len(status) == 4 {
+		ev.status = binary.BigEndian.Uint32(status)
+	}
+	return ev, true
+}
+
+// follow new connections to local ports until they're destroyed
+// events lost while the socket was full are counted as capture drops
+func runConnectScan(sock int) {
+	lifetime := time.Duration(cfgConnectScanLifetime) * time.Second
+	started := make(map[uint32]time.Time) // conntrack id -> when the connection was new
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := syscall.Recvfrom(sock, buf, 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.ENOBUFS {
+			statsAdd(&stats.captureDrops)
+			continue
+		}
+		if err != nil {
+			logMain(false, "read conntrack events failed:%s", err.Error())
+			return
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		now := time.Now()
+		for _, m := range msgs {
+			ev, ok := parseCtEvent(m.Data)
+			if !ok {
+				continue
+			}
+			switch m.Header.Type {
+			case nfnlSubsysCtnetlink<<8 | ipctnlMsgCtNew:
+				if m.Header.Flags&syscall.NLM_F_CREATE == 0 || !connectWanted(ev.src, ev.dst) {
+					continue
+				}
+				if len(started) >= connectMaxTracked {
+					for id, at := range started {
+						if now.Sub(at) > lifetime {
+							delete(started, id)
+						}
+					}
+					if len(started) >= connectMaxTracked {
+						continue
+					}
+				}
+				started[ev.id] = now
+			case nfnlSubsysCtnetlink<<8 | ipctnlMsgCtDelete:
+				at, ok := started[ev.id]
+				if !ok {
+					continue
+				}
+				delete(started, ev.id)
+				if ev.status&ipsAssured != 0 && now.Sub(at) <= lifetime {
+					noteConnect(ev.src, ev.dst, ev.port)
+				}
+			}
+		}
+	}
+}
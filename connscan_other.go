@@ -0,0 +1,13 @@
+//go:build !linux
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import "errors"
+
+func startConnectScan() error {
+	return errors.New("connect scan detection is only supported on linux")
+}
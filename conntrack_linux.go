@@ -0,0 +1,86 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// ctnetlink constants, see linux/netfilter/nfnetlink_conntrack.h
+const (
+	netlinkNetfilter    = 12
+	nfnlSubsysCtnetlink = 1
+	ipctnlMsgCtGet      = 1
+	ipctnlMsgCtDelete   = 2
+
+	ctaTupleOrig = 1
+	ctaTupleIp   = 1
+	ctaIpV4Src   = 1
+	ctaIpV4Dst   = 2
+	ctaZone      = 18
+)
+
+// nfgenmsg of ipv4: family, version, resource id
+var ctNfgenmsg = []byte{syscall.AF_INET, 0, 0, 0}
+
+// delete conntrack entries of flows from or to ip, so established connections are cut
+// once a firewall rule drops their next packet; returns how many were deleted
+func conntrackFlush(ip string) (int, error) {
+	ip4 := net.ParseIP(ip).To4()
+	if ip4 == nil {
+		return 0, errors.New("not an ipv4 address")
+	}
+	sock, err := netlinkOpen(netlinkNetfilter)
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.Close(sock)
+
+	// tuples of matching entries, as dumped, with their zone
+	var deletes [][]byte
+	err = netlinkSend(sock, nfnlSubsysCtnetlink<<8|ipctnlMsgCtGet, syscall.NLM_F_DUMP, ctNfgenmsg)
+	if err == nil {
+		err = netlinkReceive(sock, func(m *syscall.NetlinkMessage) {
+			if len(m.Data) < len(ctNfgenmsg) {
+				return
+			}
+			attrs := netlinkAttrs(m.Data[len(ctNfgenmsg):])
+			orig, ok := attrs[ctaTupleOrig]
+			if !ok {
+				return
+			}
+			addrs := netlinkAttrs(netlinkAttrs(orig)[ctaTupleIp])
+			if !bytes.Equal(addrs[ctaIpV4Src], ip4) && !bytes.Equal(addrs[ctaIpV4Dst], ip4) {
+				return
+			}
+			req := netlinkAttr(append([]byte{}, ctNfgenmsg...), ctaTupleOrig|syscall.NLA_F_NESTED, orig)
+			if zone, ok := attrs[ctaZone]; ok {
+				req = netlinkAttr(req, ctaZone, zone)
+			}
+			deletes = append(deletes, req)
+		})
+	}
+	if err != nil {
+		return 0, fmt.Errorf("dump conntrack:%w", err)
+	}
+
+	deleted := 0
+	for _, req := range deletes {
+		err := netlinkRequest(netlinkNetfilter, nfnlSubsysCtnetlink<<8|ipctnlMsgCtDelete, 0, req)
+		switch err {
+		case nil:
+			deleted++
+		case syscall.ENOENT:
+			// timed out or closed meanwhile
+		default:
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import "errors"
+
+func conntrackFlush(ip string) (int, error) {
+	return 0, errors.New("conntrack is only supported on linux")
+}
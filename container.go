@@ -0,0 +1,122 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// container networks
+// bridges of docker, podman, cni and the like see health checks and service traffic between
+// containers all the time; by container_networks:
+//
+//	ignore   the subnets of container_interface bridges are ignored, re-read with ignore_local_refresh
+//	protect  container subnets are watched like any other source, and ports the docker api at
+//	         docker_socket reports as published count as in use, even when no proxy listens on them
+//	off      container bridges are local interfaces like the others, see ignore_local
+
+const (
+	containerIgnore  = "ignore"
+	containerProtect = "protect"
+)
+
+var (
+	cfgContainerNetworks   = containerIgnore
+	cfgContainerInterfaces = []string{"docker0", "br-*", "cni*", "podman*", "lxcbr*", "cilium_*", "flannel.*", "kube-bridge", "weave"}
+	cfgDockerSocket        = "/var/run/docker.sock"
+	containerInterfacesSet bool // container_interface replaces the default patterns
+
+	publishedLock  sync.RWMutex
+	publishedPorts map[int]bool // host ports of published container ports of the guarded protocol
+	dockerDown     bool         // docker_socket failed last time, logged once
+)
+
+// if name matches a container_interface pattern
+func isContainerInterface(name string) bool {
+	for _, pattern := range cfgContainerInterfaces {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isPublishedPort(port int) bool {
+	publishedLock.RLock()
+	defer publishedLock.RUnlock()
+	return publishedPorts[port]
+}
+
+// re-read published ports from the docker api
+func refreshPublishedPorts() {
+	if cfgContainerNetworks != containerProtect {
+		return
+	}
+	ports, err := dockerPublishedPorts()
+	if err != nil {
+		if !dockerDown {
+			logMain(false, "query published ports from %s failed:%s", cfgDockerSocket, err.Error())
+		}
+		dockerDown = true
+		return
+	}
+	dockerDown = false
+	publishedLock.Lock()
+	old := publishedPorts
+	publishedPorts = ports
+	publishedLock.Unlock()
+	for port := range ports {
+		if !old[port] {
+			logMain(false, "published container port %d is in use", port)
+		}
+	}
+}
+
+// GET /containers/json: [{"Ports":[{"PrivatePort":80,"PublicPort":8080,"Type":"tcp"}, ...]}, ...]
+func dockerPublishedPorts() (map[int]bool, error) {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", cfgDockerSocket)
+			},
+		},
+	}
+	resp, err := client.Get("http://docker/containers/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("docker: %s", resp.Status)
+	}
+	var containers []struct {
+		Ports []struct {
+			PublicPort int
+			Type       string
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, err
+	}
+	ports := make(map[int]bool)
+	for _, c := range containers {
+		for _, p := range c.Ports {
+			if p.PublicPort > 0 && strings.EqualFold(p.Type, *mode) {
+				ports[p.PublicPort] = true
+			}
+		}
+	}
+	return ports, nil
+}
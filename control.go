@@ -0,0 +1,322 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// admin commands over a unix socket, one request line and one json reply line per connection:
+//	host 1.2.3.4 [days]
+//	health
+//	status
+//	block 1.2.3.4
+//	unblock 1.2.3.4
+//	trust 1.2.3.4 [30m|off]
+//	export
+//	import [{"host":"1.2.3.4","blocked":true,...}, ...]
+//	debug on|off
+//	trace [seconds]|off
+//	profile [name|default]
+//	request {"host":"1.2.3.4","ttl":3600,...}, see block requests
+//	test-responders 192.0.2.1 23, see responder test
+//	{"ok":true,"result":{...}} or {"ok":false,"error":"..."}
+// the socket is only accessible by portguard's user
+
+type controlReply struct {
+	OK     bool        `json:"ok"`
+	Error  string      `json:"error,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+var controlCommands = map[string]func(args []string) (interface{}, error){
+	"host":            controlHost,
+	"health":          controlHealth,
+	"status":          controlStatus,
+	"block":           controlBlock,
+	"unblock":         controlUnblock,
+	"trust":           controlTrust,
+	"export":          controlExport,
+	"import":          controlImport,
+	"debug":           controlDebug,
+	"trace":           controlTrace,
+	"profile":         controlProfile,
+	"request":         controlRequest,
+	"reload":          controlReload,
+	"test-responders": controlTestResponders,
+}
+
+var controlListener net.Listener
+
+func startControl() error {
+	os.Remove(cfgControlSocket)
+	ln, err := net.Listen("unix", cfgControlSocket)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(cfgControlSocket, 0600); err != nil {
+		ln.Close()
+		return err
+	}
+	controlListener = ln
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if isShutdown() {
+					return
+				}
+				logMain(false, "control socket accept failed:%s", err.Error())
+				time.Sleep(time.Second)
+				continue
+			}
+			go serveControl(conn)
+		}
+	}()
+	return nil
+}
+
+func stopControl() {
+	if controlListener != nil {
+		controlListener.Close()
+		os.Remove(chrootPath(cfgControlSocket))
+	}
+}
+
+func serveControl(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return
+	}
+	reply := &controlReply{}
+	fields, err := authorizeControl(strings.Fields(line))
+	if err != nil {
+		reply.Error = err.Error()
+	} else if len(fields) == 0 {
+		reply.Error = "empty command"
+	} else if cmd, ok := controlCommands[fields[0]]; !ok {
+		reply.Error = "unknown command " + fields[0]
+	} else if result, err := cmd(fields[1:]); err != nil {
+		reply.Error = err.Error()
+	} else {
+		reply.OK, reply.Result = true, result
+	}
+	// commands like test-responders run longer than it takes to send one
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	json.NewEncoder(conn).Encode(reply)
+}
+
+// send a command to the running daemon, return its result
+func controlCall(args ...string) (json.RawMessage, error) {
+	return controlCallTimeout(30*time.Second, args...)
+}
+
+// send a command that may take up to timeout to the running daemon, return its result
+func controlCallTimeout(timeout time.Duration, args ...string) (json.RawMessage, error) {
+	if cfgControlSocket == "" {
+		return nil, errors.New("control_socket is not set")
+	}
+	conn, err := net.DialTimeout("unix", cfgControlSocket, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if token := controlToken(); token != "" {
+		args = append([]string{"auth", token}, args...)
+	}
+	if _, err := fmt.Fprintln(conn, strings.Join(args, " ")); err != nil {
+		return nil, err
+	}
+	var reply struct {
+		OK     bool            `json:"ok"`
+		Error  string          `json:"error"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(conn).Decode(&reply); err != nil {
+		return nil, err
+	}
+	if !reply.OK {
+		return nil, errors.New(reply.Error)
+	}
+	return reply.Result, nil
+}
+
+// everything known about a host
+type hostInfo struct {
+	Host         string         `json:"host"`
+	Tracked      bool           `json:"tracked"`
+	Ports        []int          `json:"ports,omitempty"`
+	Score        int            `json:"score"`
+	BlockScore   int            `json:"block_score"`
+	FirstProbe   *time.Time     `json:"first_probe,omitempty"`
+	LastProbe    *time.Time     `json:"last_probe,omitempty"`
+	Blocked      bool           `json:"blocked"`
+	BlockedAt    *time.Time     `json:"blocked_at,omitempty"`
+	BlockedUntil *time.Time     `json:"blocked_until,omitempty"`
+	Offenses     int            `json:"offenses"`
+	TrustedUntil *time.Time     `json:"trusted_until,omitempty"`
+	Reputation   string         `json:"reputation,omitempty"`
+	ScanTypes    map[string]int `json:"scan_types,omitempty"`
+	Events       []*eventRecord `json:"events,omitempty"`
+}
+
+// host <ip> [days], days of event_db history, 30 by default
+func controlHost(args []string) (interface{}, error) {
+	if len(args) == 0 || net.ParseIP(args[0]) == nil || net.ParseIP(args[0]).To4() == nil {
+		return nil, errors.New("usage: host <ipv4> [days]")
+	}
+	ip := net.ParseIP(args[0]).String()
+	days := 30
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return nil, errors.New("invalid days " + args[1])
+		}
+		days = n
+	}
+
+	info, err := lookupHost(ip, days)
+	if err != nil {
+		return nil, err
+	}
+	info.Reputation = reputationOf(ip)
+	return info, nil
+}
+
+// state and score of ip, with days of event_db history
+func lookupHost(ip string, days int) (*hostInfo, error) {
+	info := &hostInfo{Host: ip}
+	stateLock.Lock()
+	if ports, ok := stateEngine[ip]; ok {
+		info.Tracked = true
+		info.Ports = append([]int(nil), ports...)
+		info.Score = hostScore(ip)
+	}
+	info.BlockScore = blockThreshold()
+	if first, ok := firstProbe[ip]; ok {
+		t := time.Unix(0, first)
+		info.FirstProbe = &t
+	}
+	if last, ok := lastProbe[ip]; ok {
+		t := time.Unix(0, last)
+		info.LastProbe = &t
+	}
+	info.Offenses = offenses[ip]
+	if at, ok := blockedAt[ip]; ok {
+		info.Blocked = true
+		t := time.Unix(at, 0)
+		info.BlockedAt = &t
+		if d := hostBlockDuration(ip); d > 0 {
+			until := time.Unix(at+d, 0)
+			info.BlockedUntil = &until
+		}
+	}
+	stateLock.Unlock()
+	if until := trustedUntil(ip); !until.IsZero() {
+		info.TrustedUntil = &until
+	}
+
+	if cfgEventDb != "" && days > 0 {
+		since := time.Now().AddDate(0, 0, -days)
+		info.ScanTypes = make(map[string]int)
+		err := scanEventDb(chrootPath(cfgEventDb), func(line []byte, rec *eventRecord) bool {
+			if rec.Host == ip && !rec.Time.Before(since) {
+				info.Events = append(info.Events, rec)
+				if rec.Event == eventAlarm {
+					info.ScanTypes[rec.ScanType]++
+				}
+			}
+			return true
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// summary of the running daemon for portguard status
+type statusReport struct {
+	Version string           `json:"version"`
+	Mode    string           `json:"mode"`
+	Health  string           `json:"health"`
+	Profile string           `json:"profile"`
+	Reasons []string         `json:"reasons,omitempty"`
+	Uptime  string           `json:"uptime"`
+	Tracked int              `json:"tracked"`
+	Blocked int              `json:"blocked"`
+	Stats   map[string]int64 `json:"stats"`
+}
+
+func controlStatus(args []string) (interface{}, error) {
+	health := checkHealth()
+	s := &statusReport{
+		Version: version,
+		Mode:    *mode,
+		Health:  health.Status,
+		Profile: currentProfileName(),
+		Reasons: health.Reasons,
+		Uptime:  health.Uptime,
+		Stats:   make(map[string]int64),
+	}
+	stateLock.Lock()
+	s.Tracked, s.Blocked = len(stateEngine), len(blockedAt)
+	stateLock.Unlock()
+	for _, c := range statsCounters() {
+		s.Stats[c.name] = c.value
+	}
+	return s, nil
+}
+
+// ipv4 argument of block and unblock
+func controlTarget(cmd string, args []string) (string, error) {
+	if len(args) != 1 || net.ParseIP(args[0]) == nil || net.ParseIP(args[0]).To4() == nil {
+		return "", errors.New("usage: " + cmd + " <ipv4>")
+	}
+	return net.ParseIP(args[0]).String(), nil
+}
+
+// block <ip>, block a host by hand and run responders as for a scan
+func controlBlock(args []string) (interface{}, error) {
+	ip, err := controlTarget("block", args)
+	if err != nil {
+		return nil, err
+	}
+	if isIgnoredIP(net.ParseIP(ip)) {
+		return nil, errors.New(ip + " is ignored")
+	}
+	ev := &event{Time: time.Now(), Kind: eventAlarm, Host: ip, Proto: strings.ToUpper(*mode), ScanType: "manual block"}
+	if !forceBlock(ip, 0, ev.ScanType) {
+		return nil, errors.New(ip + " is already blocked")
+	}
+	ev.ASN, ev.ASOrg = lookupAsn(net.ParseIP(ip))
+	ev.Country = lookupCountry(net.ParseIP(ip))
+	reportBlock(ev)
+	return map[string]interface{}{"host": ip, "blocked": true}, nil
+}
+
+// unblock <ip>, lift a block before it expires
+func controlUnblock(args []string) (interface{}, error) {
+	ip, err := controlTarget("unblock", args)
+	if err != nil {
+		return nil, err
+	}
+	if !unblockHost(ip, "by control socket") {
+		return nil, errors.New(ip + " is not blocked")
+	}
+	kvExpire(ip)
+	return map[string]interface{}{"host": ip, "blocked": false}, nil
+}
@@ -0,0 +1,116 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/csv"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// country of hosts, from maxmind GeoLite2-Country-Blocks-IPv4.csv and GeoLite2-Country-Locations-en.csv files
+var countryTable ipTable
+
+// locations file next to the blocks file
+func countryLocationsFile(blocks string) string {
+	return filepath.Join(filepath.Dir(blocks), strings.Replace(filepath.Base(blocks), "Blocks-IPv4", "Locations-en", 1))
+}
+
+// geoname id -> iso country code
+func loadCountryLocations(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	recs, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	codes := make(map[string]string)
+	id, code := -1, -1
+	for i, rec := range recs {
+		if i == 0 {
+			for j, name := range rec {
+				switch name {
+				case "geoname_id":
+					id = j
+				case "country_iso_code":
+					code = j
+				}
+			}
+			continue
+		}
+		if id >= 0 && code >= 0 && id < len(rec) && code < len(rec) && rec[code] != "" {
+			codes[rec[id]] = rec[code]
+		}
+	}
+	return codes, nil
+}
+
+func loadCountryDb(blocks string, locations string) error {
+	if locations == "" {
+		locations = countryLocationsFile(blocks)
+	}
+	codes, err := loadCountryLocations(locations)
+	if err != nil {
+		return err
+	}
+	t, err := loadCsvTable(blocks, func(row map[string]string) (int, string, bool) {
+		id := row["geoname_id"]
+		if id == "" {
+			id = row["registered_country_geoname_id"]
+		}
+		code, ok := codes[id]
+		return 0, code, ok
+	})
+	if err != nil {
+		return err
+	}
+	geoLock.Lock()
+	countryTable = t
+	geoLock.Unlock()
+	atomic.StoreInt64(&countryDbAt, geoipFileTime(blocks))
+	return nil
+}
+
+// iso country code of ip, empty if unknown
+func lookupCountry(ip net.IP) string {
+	geoLock.RLock()
+	defer geoLock.RUnlock()
+	if r := countryTable.lookup(ip); r != nil {
+		return r.name
+	}
+	return ""
+}
+
+// country_block = CN, RU
+func parseCountries(lineno int, token string, value string, countries map[string]bool) {
+	for _, field := range strings.Split(value, ",") {
+		code := strings.ToUpper(strings.TrimSpace(field))
+		if len(code) != 2 {
+			logMain(true, "line %d:%s, invalid country code:%s", lineno, token, field)
+		}
+		countries[code] = true
+	}
+}
+
+// decision of country_never_block and country_block for ev
+func countryPolicy(ev *event) string {
+	if ev.Country == "" {
+		return policyDefault
+	}
+	if cfgCountryNeverBlock[ev.Country] {
+		return policyAlarm
+	}
+	if cfgCountryBlock[ev.Country] {
+		return policyBlock
+	}
+	return policyDefault
+}
@@ -0,0 +1,64 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// write pid to file, fail if the file belongs to a running process
+func writePidFile(file string) error {
+	// pid is written to a temp file and linked into place,
+	// link fails if file exists, so readers never see a partial pid
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = fmt.Fprintf(tmp, "%d\n", os.Getpid())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err = os.Link(tmp.Name(), file); err == nil || !os.IsExist(err) {
+			return err
+		}
+		pid, running := readPidFile(file)
+		if running {
+			return fmt.Errorf("portguard already running, pid:%d", pid)
+		}
+		// stale pid file
+		os.Remove(file)
+	}
+	return err
+}
+
+// pid in file and whether that process is alive
+func readPidFile(file string) (int, bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	return pid, processAlive(pid)
+}
+
+// remove pid file if it's still ours
+func removePidFile(file string) {
+	if pid, _ := readPidFile(file); pid == os.Getpid() {
+		os.Remove(file)
+	}
+}
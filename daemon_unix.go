@@ -0,0 +1,65 @@
+//go:build unix
+
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// set in the environment of the background process
+const daemonEnv = "PORTGUARD_DAEMON"
+
+// start a detached copy of portguard and exit, returns only in the background process
+func daemonize() {
+	if os.Getenv(daemonEnv) == "1" {
+		return
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		logMain(true, "daemonize failed:%s", err.Error())
+	}
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		logMain(true, "daemonize failed:%s", err.Error())
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdin = null
+	cmd.Stdout = null
+	cmd.Stderr = null
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	// a config read from stdin is written to the daemon's stdin, it reads it again from there
+	var config io.WriteCloser
+	if stdinConfigData != nil {
+		cmd.Stdin = nil
+		if config, err = cmd.StdinPipe(); err != nil {
+			logMain(true, "daemonize failed:%s", err.Error())
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		logMain(true, "daemonize failed:%s", err.Error())
+	}
+	if config != nil {
+		_, err := io.WriteString(config, *stdinConfigData)
+		config.Close()
+		if err != nil {
+			logMain(true, "daemonize, write config failed:%s", err.Error())
+		}
+	}
+	logMain(false, "portguard daemon started, pid:%d", cmd.Process.Pid)
+	os.Exit(0)
+}
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
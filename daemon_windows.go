@@ -0,0 +1,23 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"os"
+)
+
+func daemonize() {
+	logMain(true, "daemon mode is not supported on windows, run portguard as a service")
+}
+
+// FindProcess opens the process on windows, it fails if pid doesn't exist
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,314 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a minimal d-bus client, only method calls with string and int32 arguments
+// see https://dbus.freedesktop.org/doc/dbus-specification.html
+type dbusConn struct {
+	conn   net.Conn
+	rd     *bufio.Reader
+	serial uint32
+}
+
+// message types
+const (
+	dbusMethodCall   = 1
+	dbusMethodReturn = 2
+	dbusError        = 3
+)
+
+// header fields
+const (
+	dbusFieldPath        = 1
+	dbusFieldInterface   = 2
+	dbusFieldMember      = 3
+	dbusFieldErrorName   = 4
+	dbusFieldReplySerial = 5
+	dbusFieldDestination = 6
+	dbusFieldSignature   = 8
+)
+
+const dbusTimeout = 10 * time.Second
+
+func dialSystemBus() (*dbusConn, error) {
+	path := "/var/run/dbus/system_bus_socket"
+	if addr := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"); strings.HasPrefix(addr, "unix:path=") {
+		path = strings.SplitN(strings.TrimPrefix(addr, "unix:path="), ",", 2)[0]
+	}
+	conn, err := net.DialTimeout("unix", path, dbusTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(dbusTimeout))
+
+	d := &dbusConn{conn: conn, rd: bufio.NewReader(conn)}
+	if err := d.auth(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := d.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *dbusConn) Close() error {
+	return d.conn.Close()
+}
+
+// authenticate with our uid
+func (d *dbusConn) auth() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := d.conn.Write([]byte("\x00AUTH EXTERNAL " + uid + "\r\n")); err != nil {
+		return err
+	}
+	line, err := d.rd.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("dbus auth failed:%s", strings.TrimSpace(line))
+	}
+	_, err = d.conn.Write([]byte("BEGIN\r\n"))
+	return err
+}
+
+// call method, args are string or int32
+// return first string or object path in reply, if any
+func (d *dbusConn) Call(dest, path, iface, member string, args ...interface{}) (string, error) {
+	var body dbusWriter
+	sig := ""
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			sig += "s"
+			body.string(v)
+		case int32:
+			sig += "i"
+			body.uint32(uint32(v))
+		default:
+			return "", fmt.Errorf("dbus: unsupported argument type %T", arg)
+		}
+	}
+
+	d.serial++
+	var msg dbusWriter
+	msg.byte('l')
+	msg.byte(dbusMethodCall)
+	msg.byte(0)
+	msg.byte(1)
+	msg.uint32(uint32(len(body.buf)))
+	msg.uint32(d.serial)
+
+	// array of (byte, variant)
+	msg.uint32(0)
+	msg.align(8)
+	start := len(msg.buf)
+	msg.field(dbusFieldPath, "o", path)
+	msg.field(dbusFieldDestination, "s", dest)
+	msg.field(dbusFieldInterface, "s", iface)
+	msg.field(dbusFieldMember, "s", member)
+	if sig != "" {
+		msg.field(dbusFieldSignature, "g", sig)
+	}
+	binary.LittleEndian.PutUint32(msg.buf[12:], uint32(len(msg.buf)-start))
+	msg.align(8)
+	msg.buf = append(msg.buf, body.buf...)
+
+	d.conn.SetDeadline(time.Now().Add(dbusTimeout))
+	if _, err := d.conn.Write(msg.buf); err != nil {
+		return "", err
+	}
+	return d.readReply(d.serial)
+}
+
+// skip signals and other messages until reply for serial arrives
+func (d *dbusConn) readReply(serial uint32) (string, error) {
+	for {
+		head := make([]byte, 16)
+		if _, err := io.ReadFull(d.rd, head); err != nil {
+			return "", err
+		}
+		var order binary.ByteOrder = binary.LittleEndian
+		if head[0] == 'B' {
+			order = binary.BigEndian
+		}
+		msgType := head[1]
+		bodyLen := int(order.Uint32(head[4:]))
+		fieldsLen := int(order.Uint32(head[12:]))
+		rest := make([]byte, (fieldsLen+7)&^7+bodyLen)
+		if _, err := io.ReadFull(d.rd, rest); err != nil {
+			return "", err
+		}
+
+		r := dbusReader{buf: append(head, rest...), off: 16, order: order}
+		fields := r.fields(16 + fieldsLen)
+		if msgType != dbusMethodReturn && msgType != dbusError {
+			continue
+		}
+		if fields.replySerial != serial {
+			continue
+		}
+
+		r.off = len(r.buf) - bodyLen
+		first := ""
+		if strings.HasPrefix(fields.signature, "s") || strings.HasPrefix(fields.signature, "o") {
+			first = r.string()
+		}
+		if msgType == dbusError {
+			return "", fmt.Errorf("%s: %s", fields.errorName, first)
+		}
+		return first, nil
+	}
+}
+
+type dbusWriter struct {
+	buf []byte
+}
+
+func (w *dbusWriter) align(n int) {
+	for len(w.buf)%n != 0 {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+func (w *dbusWriter) byte(b byte) {
+	w.buf = append(w.buf, b)
+}
+
+func (w *dbusWriter) uint32(v uint32) {
+	w.align(4)
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, v)
+}
+
+func (w *dbusWriter) string(s string) {
+	w.uint32(uint32(len(s)))
+	w.buf = append(w.buf, s...)
+	w.buf = append(w.buf, 0)
+}
+
+func (w *dbusWriter) signature(s string) {
+	w.byte(byte(len(s)))
+	w.buf = append(w.buf, s...)
+	w.buf = append(w.buf, 0)
+}
+
+// header field of type o, s or g
+func (w *dbusWriter) field(code byte, sig string, value string) {
+	w.align(8)
+	w.byte(code)
+	w.signature(sig)
+	if sig == "g" {
+		w.signature(value)
+	} else {
+		w.string(value)
+	}
+}
+
+type dbusReader struct {
+	buf   []byte
+	off   int
+	order binary.ByteOrder
+	err   error
+}
+
+type dbusFields struct {
+	replySerial uint32
+	errorName   string
+	signature   string
+}
+
+func (r *dbusReader) need(n int) bool {
+	if r.err == nil && r.off+n > len(r.buf) {
+		r.err = errors.New("dbus: short message")
+	}
+	return r.err == nil
+}
+
+func (r *dbusReader) align(n int) {
+	r.off = (r.off + n - 1) &^ (n - 1)
+}
+
+func (r *dbusReader) uint32() uint32 {
+	r.align(4)
+	if !r.need(4) {
+		return 0
+	}
+	v := r.order.Uint32(r.buf[r.off:])
+	r.off += 4
+	return v
+}
+
+func (r *dbusReader) string() string {
+	n := int(r.uint32())
+	if !r.need(n + 1) {
+		return ""
+	}
+	s := string(r.buf[r.off : r.off+n])
+	r.off += n + 1
+	return s
+}
+
+func (r *dbusReader) signature() string {
+	if !r.need(1) {
+		return ""
+	}
+	n := int(r.buf[r.off])
+	r.off++
+	if !r.need(n + 1) {
+		return ""
+	}
+	s := string(r.buf[r.off : r.off+n])
+	r.off += n + 1
+	return s
+}
+
+// header fields up to end, unknown fields are skipped
+func (r *dbusReader) fields(end int) dbusFields {
+	var f dbusFields
+	for r.err == nil && r.off < end {
+		r.align(8)
+		if !r.need(1) {
+			break
+		}
+		code := r.buf[r.off]
+		r.off++
+		switch sig := r.signature(); sig {
+		case "s", "o":
+			v := r.string()
+			if code == dbusFieldErrorName {
+				f.errorName = v
+			}
+		case "g":
+			v := r.signature()
+			if code == dbusFieldSignature {
+				f.signature = v
+			}
+		case "u":
+			v := r.uint32()
+			if code == dbusFieldReplySerial {
+				f.replySerial = v
+			}
+		default:
+			r.err = fmt.Errorf("dbus: unexpected header field signature %q", sig)
+		}
+	}
+	return f
+}
@@ -0,0 +1,130 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runtime log levels
+// debug logs the decision about every probe that reaches the filters, like excluded, ignored or alarm
+// trace also logs every packet dropped before, as noisy, malformed or a cache hit; it's switched off
+// after trace_duration seconds at most, it can flood the log during a scan
+// both are toggled with SIGUSR1 (debug) and SIGUSR2 (trace), or the control socket's debug and trace commands
+var (
+	debugLogs  int32
+	traceUntil int64 // unix nano, 0 when not tracing
+	traceTimer *time.Timer
+	traceLock  sync.Mutex
+)
+
+func debugEnabled() bool {
+	return atomic.LoadInt32(&debugLogs) != 0 || tracing()
+}
+
+func tracing() bool {
+	return atomic.LoadInt64(&traceUntil) != 0
+}
+
+func setDebug(on bool) {
+	v := int32(0)
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&debugLogs, v)
+	logMain(false, "debug log:%v", on)
+}
+
+// trace packets for d, 0 stops tracing
+func setTrace(d time.Duration) {
+	traceLock.Lock()
+	defer traceLock.Unlock()
+	if traceTimer != nil {
+		traceTimer.Stop()
+		traceTimer = nil
+	}
+	if d <= 0 {
+		atomic.StoreInt64(&traceUntil, 0)
+		logMain(false, "packet trace off")
+		return
+	}
+	atomic.StoreInt64(&traceUntil, time.Now().Add(d).UnixNano())
+	traceTimer = time.AfterFunc(d, func() { setTrace(0) })
+	logMain(false, "packet trace on for %s", d)
+}
+
+func logDebug(format string, a ...interface{}) {
+	if debugEnabled() {
+		logMain(false, "debug: "+format, a...)
+	}
+}
+
+// log what was decided about a probe of port from src
+func probeDecision(proto string, src net.IP, port int, decision string) {
+	if debugEnabled() {
+		logMain(false, "debug: %s %s -> port %d %s", proto, src, port, decision)
+	}
+}
+
+// log what was decided about a packet dropped before inspection, src may be nil
+func tracePacket(proto string, src net.IP, port int, decision string) {
+	if tracing() {
+		logMain(false, "trace: %s %s -> port %d %s", proto, src, port, decision)
+	}
+}
+
+// SIGUSR1 toggles debug, SIGUSR2 toggles tracing for trace_duration
+func runDebugSignals() {
+	if len(debugSignals) == 0 {
+		return
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, debugSignals...)
+	for sig := range sigs {
+		if sig == debugSignals[0] {
+			setDebug(atomic.LoadInt32(&debugLogs) == 0)
+		} else if tracing() {
+			setTrace(0)
+		} else {
+			setTrace(time.Duration(cfgTraceDuration) * time.Second)
+		}
+	}
+}
+
+// debug on|off
+func controlDebug(args []string) (interface{}, error) {
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		return nil, errors.New("usage: debug on|off")
+	}
+	setDebug(args[0] == "on")
+	return map[string]bool{"debug": args[0] == "on"}, nil
+}
+
+// trace [seconds]|off, seconds default to trace_duration and can't exceed it
+func controlTrace(args []string) (interface{}, error) {
+	d := cfgTraceDuration
+	if len(args) == 1 && args[0] == "off" {
+		d = 0
+	} else if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return nil, errors.New("usage: trace [seconds]|off")
+		}
+		if n < d {
+			d = n
+		}
+	} else if len(args) > 1 {
+		return nil, errors.New("usage: trace [seconds]|off")
+	}
+	setTrace(time.Duration(d) * time.Second)
+	return map[string]int{"trace_seconds": d}, nil
+}
@@ -0,0 +1,148 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// entries listed in each top list of a digest
+const digestTop = 10
+
+// alarms and blocks since the last digest
+type digest struct {
+	start     time.Time
+	alarms    int
+	blocks    int
+	hosts     map[string]int
+	ports     map[int]int
+	scanTypes map[string]int
+	patterns  map[string]int // alarms by scan pattern
+}
+
+var (
+	digestLock sync.Mutex
+	curDigest  = newDigest()
+)
+
+func newDigest() *digest {
+	return &digest{
+		start:     time.Now(),
+		hosts:     make(map[string]int),
+		ports:     make(map[int]int),
+		scanTypes: make(map[string]int),
+		patterns:  make(map[string]int),
+	}
+}
+
+func recordDigest(ev *event) {
+	if cfgDigestInterval <= 0 {
+		return
+	}
+	digestLock.Lock()
+	defer digestLock.Unlock()
+	if ev.Kind == eventBlock {
+		curDigest.blocks++
+		return
+	}
+	if ev.Kind == eventStage {
+		return
+	}
+	curDigest.alarms++
+	curDigest.hosts[ev.Host]++
+	curDigest.ports[ev.Port]++
+	curDigest.scanTypes[ev.ScanType]++
+	if ev.Pattern != "" {
+		curDigest.patterns[ev.Pattern]++
+	}
+}
+
+type digestEntry struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// at most n entries of m with the highest counts, in order
+func topCounts(m map[string]int, n int) []digestEntry {
+	entries := make([]digestEntry, 0, len(m))
+	for name, count := range m {
+		entries = append(entries, digestEntry{name, count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+func topEntries(m map[string]int, n int) string {
+	var items []string
+	for _, e := range topCounts(m, n) {
+		items = append(items, fmt.Sprintf("%s(%d)", e.Name, e.Count))
+	}
+	return strings.Join(items, " ")
+}
+
+func portCounts(m map[int]int) map[string]int {
+	ports := make(map[string]int, len(m))
+	for port, count := range m {
+		ports[fmt.Sprint(port)] = count
+	}
+	return ports
+}
+
+func (d *digest) String() string {
+	ports := portCounts(d.ports)
+	var b strings.Builder
+	fmt.Fprintf(&b, "portguard digest %s - %s: %d alarms, %d blocks, %d hosts\n",
+		formatLogTime(d.start), formatLogTime(time.Now()), d.alarms, d.blocks, len(d.hosts))
+	fmt.Fprintf(&b, "top hosts: %s\n", topEntries(d.hosts, digestTop))
+	fmt.Fprintf(&b, "top ports: %s\n", topEntries(ports, digestTop))
+	fmt.Fprintf(&b, "scan types: %s\n", topEntries(d.scanTypes, len(d.scanTypes)))
+	fmt.Fprintf(&b, "scan patterns: %s\n", topEntries(d.patterns, len(d.patterns)))
+	return b.String()
+}
+
+// write the digest to digest_log, or the main log, and post it to digest_url
+func sendDigest() {
+	digestLock.Lock()
+	d := curDigest
+	curDigest = newDigest()
+	digestLock.Unlock()
+
+	text := d.String()
+	if cfgDigestLog != nil {
+		fmt.Fprintf(cfgDigestLog, "%s\n", text)
+	} else {
+		for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+			logMain(false, "%s", line)
+		}
+	}
+
+	if cfgDigestUrl != "" {
+		resp, err := http.Post(cfgDigestUrl, "text/plain; charset=utf-8", strings.NewReader(text))
+		if err != nil {
+			logMain(false, "post digest to %s failed:%s", cfgDigestUrl, err.Error())
+			return
+		}
+		resp.Body.Close()
+	}
+}
+
+func runDigest() {
+	for range time.Tick(time.Duration(cfgDigestInterval) * time.Second) {
+		sendDigest()
+	}
+}
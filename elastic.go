@@ -0,0 +1,178 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// index events into elasticsearch or opensearch with the bulk api
+// events are indexed into elastic_index, where %Y, %m and %d are replaced by the event's date,
+// daily indices by default; they are kept in a buffer of elastic_buffer events while the cluster
+// is unreachable or rejects them as overloaded, sent again with backoff, the oldest dropped first
+
+const (
+	elasticBatch      = 500
+	elasticFlushTime  = 5 * time.Second
+	elasticBackoffMin = time.Second
+	elasticBackoffMax = 5 * time.Minute
+)
+
+var (
+	cfgElasticUrl     string
+	cfgElasticIndex   = "portguard-%Y.%m.%d"
+	cfgElasticHeaders []string
+	cfgElasticBuffer  = 10000
+
+	elasticClient = &http.Client{Timeout: 30 * time.Second}
+	elasticEvents chan *event
+)
+
+// queue event for indexing, dropped if the indexer falls behind
+func elasticEvent(ev *event) {
+	if elasticEvents == nil {
+		return
+	}
+	queueEvent(elasticEvents, ev, "elastic")
+}
+
+// elastic_index for an event at t
+func elasticIndex(t time.Time) string {
+	return strings.NewReplacer("%Y", t.Format("2006"), "%m", t.Format("01"), "%d", t.Format("02")).Replace(cfgElasticIndex)
+}
+
+// the bulk response, items in the order of the request
+type elasticBulkResult struct {
+	Errors bool
+	Items  []map[string]struct {
+		Status int
+		Error  struct {
+			Type   string
+			Reason string
+		}
+	}
+}
+
+// index recs, returning the ones to send again
+func elasticSend(recs []*eventRecord) ([]*eventRecord, error) {
+	var body bytes.Buffer
+	for _, rec := range recs {
+		doc, err := json.Marshal(rec)
+		if err != nil {
+			continue
+		}
+		action, _ := json.Marshal(map[string]interface{}{"create": map[string]string{"_index": elasticIndex(rec.Time)}})
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc)
+		body.WriteByte('\n')
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(cfgElasticUrl, "/")+"/_bulk", &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	for _, header := range cfgElasticHeaders {
+		if kv := strings.SplitN(header, ":", 2); len(kv) == 2 {
+			req.Header.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+		}
+	}
+	resp, err := elasticClient.Do(req)
+	if err != nil {
+		return recs, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		err = fmt.Errorf("%s/_bulk: %s", cfgElasticUrl, resp.Status)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return recs, err
+		}
+		return nil, err
+	}
+	var result elasticBulkResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || !result.Errors {
+		return nil, nil
+	}
+	// overloaded nodes reject single items with 429, the others won't index again
+	var retry []*eventRecord
+	var rejected int
+	var reason string
+	for i, item := range result.Items {
+		for _, r := range item {
+			if r.Status/100 == 2 || i >= len(recs) {
+				continue
+			}
+			if r.Status == http.StatusTooManyRequests || r.Status >= 500 {
+				retry = append(retry, recs[i])
+			} else {
+				rejected++
+				reason = r.Error.Type + ": " + r.Error.Reason
+			}
+		}
+	}
+	if rejected > 0 {
+		return retry, fmt.Errorf("%d events rejected, %s", rejected, reason)
+	}
+	return retry, nil
+}
+
+func startElastic() {
+	elasticEvents = make(chan *event, cfgEventQueue)
+	go runElastic()
+}
+
+// send buffered events in batches, backing off while they fail
+func runElastic() {
+	var buffer []*eventRecord
+	var dropped int
+	var retryAt time.Time
+	backoff := elasticBackoffMin
+	flush := time.NewTicker(elasticFlushTime)
+	send := func() {
+		for len(buffer) > 0 && !time.Now().Before(retryAt) {
+			n := len(buffer)
+			if n > elasticBatch {
+				n = elasticBatch
+			}
+			retry, err := elasticSend(buffer[:n])
+			if err != nil {
+				logMain(false, "index %d events to elasticsearch failed:%s", n, err.Error())
+			}
+			buffer = append(retry, buffer[n:]...)
+			if len(retry) > 0 {
+				retryAt = time.Now().Add(backoff)
+				if backoff *= 2; backoff > elasticBackoffMax {
+					backoff = elasticBackoffMax
+				}
+				return
+			}
+			backoff = elasticBackoffMin
+			if dropped > 0 {
+				logMain(false, "dropped %d events while elasticsearch fell behind", dropped)
+				dropped = 0
+			}
+		}
+	}
+	for {
+		select {
+		case ev := <-elasticEvents:
+			buffer = append(buffer, ev.record())
+			if len(buffer) > cfgElasticBuffer {
+				buffer = buffer[len(buffer)-cfgElasticBuffer:]
+				dropped++
+			}
+			if len(buffer) >= elasticBatch {
+				send()
+			}
+		case <-flush.C:
+			send()
+		}
+	}
+}
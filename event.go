@@ -0,0 +1,260 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	eventAlarm = "alarm"
+	eventBlock = "block"
+	eventOps   = "ops" // about portguard itself, see opsAlert
+	// eventStage, a host escalated to a response stage, is in stage.go
+)
+
+// an alarm or block, passed to digest and exporters
+type event struct {
+	Time        time.Time
+	Kind        string // eventAlarm, eventStage, eventBlock or eventNoisy
+	Host        string
+	Port        int
+	Proto       string // TCP, UDP or ARP
+	ScanType    string
+	Flags       uint8  // tcp flags, 0 for udp
+	TTL         uint8  // ip ttl of the probe
+	Payload     string // class of a udp probe's payload, see classifyUdpPayload
+	Alarms      int    // ports probed by host, set for blocks
+	Offense     int    // times host was blocked, set for blocks
+	ASN         int    // origin asn of host, 0 if unknown
+	ASOrg       string
+	Country     string // iso country code of host, empty if unknown
+	Reputation  string // verdict of reputation api, empty if unknown yet
+	Spoof       string // why the source looks spoofed, see spoofReasons
+	Laddr       net.IP
+	Peer        string // cluster node that reported the block, empty if it was made here
+	Trap        bool   // probe of a trap_port
+	VLAN        int    // innermost vlan id of the probe, 0 if untagged
+	Iface       string // capture interface of an ops event
+	Message     string // text of an ops event, who asked for an external block, the mac of an arp sweep
+	Evidence    string // pcap file of the host's packets, set for blocks, see evidence_dir
+	Pattern     string // vertical, sweep or targeted, see scan patterns
+	Capture     string // quoted start of what the host sent a honeypot_port
+	CaptureFile string // file of all of it in evidence_dir, empty if not written
+	Test        bool   // made up block of test-responders
+
+	// what led to a block, set for blocks
+	Ports     []int // distinct ports host probed
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Score     int
+	Stage     int // response stage the host reached, set for stage events
+
+	Responders []string // run only these responders if not empty, see policy_cmd
+}
+
+// if responder name should run for ev
+func (ev *event) wants(name string) bool {
+	if len(ev.Responders) == 0 {
+		return true
+	}
+	for _, r := range ev.Responders {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// what the probe carried for alarm logs, empty for untagged tcp
+func (ev *event) probe() string {
+	s := ""
+	if ev.VLAN != 0 {
+		s += fmt.Sprintf(", vlan: %d", ev.VLAN)
+	}
+	if ev.Payload != "" {
+		s += ", payload: " + ev.Payload
+	}
+	if ev.Pattern != "" {
+		s += ", pattern: " + ev.Pattern
+	}
+	return s
+}
+
+// what led to a block for blocked logs: the scan, ports probed, first and last probe, score and responders
+func (ev *event) history() string {
+	ports := make([]string, len(ev.Ports))
+	for i, port := range ev.Ports {
+		ports[i] = strconv.Itoa(port)
+	}
+	s := fmt.Sprintf(", scan: %s, ports: %s", ev.ScanType, strings.Join(ports, ","))
+	if !ev.FirstSeen.IsZero() {
+		s += ", first seen: " + formatLogTime(ev.FirstSeen)
+	}
+	s += fmt.Sprintf(", last seen: %s, score: %d", formatLogTime(ev.LastSeen), ev.Score)
+	if len(ev.Responders) > 0 {
+		s += ", responders: " + strings.Join(ev.Responders, ",")
+	}
+	return s
+}
+
+// origin of host for alarm and blocked logs, empty if unknown
+func (ev *event) origin() string {
+	s := ""
+	if ev.Country != "" {
+		s += " country: " + ev.Country
+	}
+	if ev.ASN != 0 {
+		s += fmt.Sprintf(" asn: AS%d %s", ev.ASN, ev.ASOrg)
+	}
+	if ev.Reputation != "" {
+		s += " reputation: " + ev.Reputation
+	}
+	if ev.Spoof != "" {
+		s += " spoofed: " + ev.Spoof
+	}
+	if ev.Peer != "" {
+		s += " reported by: " + ev.Peer
+	}
+	return s
+}
+
+// ev as stored in event_db and written to event_log
+type eventRecord struct {
+	Time        time.Time  `json:"time"`
+	Event       string     `json:"event"`
+	Severity    string     `json:"severity"`
+	Host        string     `json:"host"`
+	Port        int        `json:"port"`
+	Proto       string     `json:"proto"`
+	ScanType    string     `json:"scan_type"`
+	Flags       uint8      `json:"flags,omitempty"`
+	TTL         uint8      `json:"ttl,omitempty"`
+	Payload     string     `json:"payload,omitempty"`
+	Alarms      int        `json:"alarm_count,omitempty"`
+	Offense     int        `json:"offense,omitempty"`
+	ASN         int        `json:"asn,omitempty"`
+	ASOrg       string     `json:"as_org,omitempty"`
+	Country     string     `json:"country,omitempty"`
+	Reputation  string     `json:"reputation,omitempty"`
+	Spoof       string     `json:"spoof,omitempty"`
+	Laddr       string     `json:"laddr,omitempty"`
+	Responders  []string   `json:"responders,omitempty"`
+	Peer        string     `json:"peer,omitempty"`
+	Trap        bool       `json:"trap,omitempty"`
+	VLAN        int        `json:"vlan,omitempty"`
+	Iface       string     `json:"interface,omitempty"`
+	Message     string     `json:"message,omitempty"`
+	Evidence    string     `json:"evidence,omitempty"`
+	Pattern     string     `json:"pattern,omitempty"`
+	Capture     string     `json:"capture,omitempty"`
+	CaptureFile string     `json:"capture_file,omitempty"`
+	Ports       []int      `json:"ports,omitempty"`
+	FirstSeen   *time.Time `json:"first_seen,omitempty"`
+	LastSeen    *time.Time `json:"last_seen,omitempty"`
+	Score       int        `json:"score,omitempty"`
+	Stage       int        `json:"stage,omitempty"`
+}
+
+func (ev *event) record() *eventRecord {
+	rec := &eventRecord{
+		Time:        ev.Time,
+		Event:       ev.Kind,
+		Severity:    ev.severity(),
+		Host:        ev.Host,
+		Port:        ev.Port,
+		Proto:       ev.Proto,
+		ScanType:    ev.ScanType,
+		Flags:       ev.Flags,
+		TTL:         ev.TTL,
+		Payload:     ev.Payload,
+		Alarms:      ev.Alarms,
+		Offense:     ev.Offense,
+		ASN:         ev.ASN,
+		ASOrg:       ev.ASOrg,
+		Country:     ev.Country,
+		Reputation:  ev.Reputation,
+		Spoof:       ev.Spoof,
+		Responders:  ev.Responders,
+		Peer:        ev.Peer,
+		Trap:        ev.Trap,
+		VLAN:        ev.VLAN,
+		Iface:       ev.Iface,
+		Message:     ev.Message,
+		Evidence:    ev.Evidence,
+		Pattern:     ev.Pattern,
+		Capture:     ev.Capture,
+		CaptureFile: ev.CaptureFile,
+		Ports:       ev.Ports,
+		Score:       ev.Score,
+		Stage:       ev.Stage,
+	}
+	if ev.Laddr != nil {
+		rec.Laddr = ev.Laddr.String()
+	}
+	if !ev.FirstSeen.IsZero() {
+		t := logTime(ev.FirstSeen)
+		rec.FirstSeen = &t
+	}
+	if !ev.LastSeen.IsZero() {
+		t := logTime(ev.LastSeen)
+		rec.LastSeen = &t
+	}
+	return rec
+}
+
+func emitEvent(ev *event) {
+	ev.Time = logTime(ev.Time)
+	sev := ev.severity()
+	if sinkWants("digest", sev) {
+		recordDigest(ev)
+	}
+	if sinkWants("report", sev) {
+		recordReport(ev)
+	}
+	if sinkWants("event_db", sev) {
+		storeEvent(ev)
+	}
+	if sinkWants("event_log", sev) {
+		logEvent(ev)
+	}
+	if sinkWants("otlp", sev) {
+		otlpEvent(ev)
+	}
+	if sinkWants("elastic", sev) {
+		elasticEvent(ev)
+	}
+	if sinkWants("loki", sev) {
+		lokiEvent(ev)
+	}
+	if sinkWants("ipfix", sev) {
+		ipfixEvent(ev)
+	}
+	if sinkWants("snmp", sev) {
+		snmpEvent(ev)
+	}
+	if sinkWants("journald", sev) {
+		journalEvent(ev)
+	}
+	if sinkWants("wazuh", sev) {
+		wazuhEvent(ev)
+	}
+	if sinkWants("misp", sev) {
+		mispEvent(ev)
+	}
+	if sinkWants("stix", sev) {
+		stixEvent(ev)
+	}
+	if sinkWants("ubus", sev) {
+		ubusEvent(ev)
+	}
+	if sinkWants("event_socket", sev) {
+		socketEvent(ev)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// one json object per event appended to event_log, for filebeat, vector and the like
+// rotated when it grows over event_log_max_size MB: event_log.1 is the newest of
+// event_log_keep rotated files
+
+// a file renamed to path.1, path.2, ... as it grows over maxSize bytes
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+	f       *os.File
+	size    int64
+}
+
+func openRotatingFile(path string, maxSize int64, keep int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, keep: keep}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(chrootPath(r.path), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) rotate() error {
+	r.f.Close()
+	path := chrootPath(r.path)
+	if r.keep <= 0 {
+		os.Remove(path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", path, r.keep))
+		for i := r.keep - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+		}
+		os.Rename(path, path+".1")
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			r.f = nil
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	r.f.Sync()
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+var eventLog *rotatingFile
+
+func openEventLog() error {
+	var err error
+	eventLog, err = openRotatingFile(cfgEventLog, int64(cfgEventLogMaxSize)<<20, cfgEventLogKeep)
+	return err
+}
+
+func logEvent(ev *event) {
+	if eventLog == nil {
+		return
+	}
+	data, err := json.Marshal(ev.record())
+	if err != nil {
+		return
+	}
+	if _, err := eventLog.Write(append(data, '\n')); err != nil {
+		logMain(false, "write event_log %s failed:%s", cfgEventLog, err.Error())
+	}
+}
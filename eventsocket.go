@@ -0,0 +1,87 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+)
+
+// event socket
+// event_socket writes each event as an event_log record to a local consumer, without http or a broker:
+//   a unix datagram socket  one record per datagram
+//   a named pipe            one record per line, the pipe is held open so it needn't have a reader yet
+// records are queued like those of otlp, a consumer that falls behind loses events, not the guards' time
+// the socket or pipe is opened before chroot
+
+var (
+	cfgEventSocket string
+
+	eventSocketW      io.Writer
+	eventSocketFifo   bool
+	eventSocketEvents chan *event
+)
+
+func openEventSocket() error {
+	fi, err := os.Stat(cfgEventSocket)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeNamedPipe != 0 {
+		// read-write, so the open doesn't fail or wait while nothing reads the pipe
+		f, err := os.OpenFile(cfgEventSocket, os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		eventSocketW, eventSocketFifo = f, true
+	} else {
+		conn, err := net.Dial("unixgram", cfgEventSocket)
+		if err != nil {
+			return err
+		}
+		eventSocketW = conn
+	}
+	eventSocketEvents = make(chan *event, cfgEventQueue)
+	go runEventSocket()
+	return nil
+}
+
+func socketEvent(ev *event) {
+	if eventSocketEvents == nil {
+		return
+	}
+	queueEvent(eventSocketEvents, ev, "event_socket")
+}
+
+func runEventSocket() {
+	for ev := range eventSocketEvents {
+		data, err := json.Marshal(ev.record())
+		if err != nil {
+			continue
+		}
+		if eventSocketFifo {
+			data = append(data, '\n')
+		}
+		if _, err := eventSocketW.Write(data); err != nil {
+			logDebug("write event to event_socket %s failed:%s", cfgEventSocket, err.Error())
+			redialEventSocket()
+		}
+	}
+}
+
+// a restarted consumer binds a new socket at the same path, connect to it for the next event
+func redialEventSocket() {
+	if eventSocketFifo {
+		return
+	}
+	conn, err := net.Dial("unixgram", cfgEventSocket)
+	if err != nil {
+		return
+	}
+	eventSocketW.(net.Conn).Close()
+	eventSocketW = conn
+}
@@ -0,0 +1,180 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alarms and blocks with full context, appended as json lines to event_db
+// records older than event_db_retention days are dropped on startup and daily
+// query it with: portguard [-days 30] events <ip or cidr> [configFile]
+
+var (
+	eventDbLock sync.Mutex
+	eventDb     *os.File
+)
+
+// drop expired records and open event_db for appending
+func openEventDb() error {
+	if err := compactEventDb(cfgEventDb); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(cfgEventDb, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	eventDb = f
+	return nil
+}
+
+func storeEvent(ev *event) {
+	if eventDb == nil {
+		return
+	}
+	data, err := json.Marshal(ev.record())
+	if err != nil {
+		return
+	}
+	eventDbLock.Lock()
+	defer eventDbLock.Unlock()
+	if _, err := eventDb.Write(append(data, '\n')); err != nil {
+		logMain(false, "write event_db %s failed:%s", cfgEventDb, err.Error())
+	}
+}
+
+// read records of file, stop early if fn returns false
+func scanEventDb(file string, fn func(line []byte, rec *eventRecord) bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec eventRecord
+		// a torn last line of a crash is skipped
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil {
+			continue
+		}
+		if !fn(scanner.Bytes(), &rec) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+// rewrite file without records older than the retention
+func compactEventDb(file string) error {
+	if cfgEventDbRetention <= 0 {
+		return nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -cfgEventDbRetention)
+	var keep [][]byte
+	dropped := 0
+	err := scanEventDb(file, func(line []byte, rec *eventRecord) bool {
+		if rec.Time.Before(cutoff) {
+			dropped++
+		} else {
+			keep = append(keep, append([]byte(nil), line...))
+		}
+		return true
+	})
+	if os.IsNotExist(err) || (err == nil && dropped == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tmp := file + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, line := range keep {
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// compact daily, the open file is swapped for the rewritten one
+func runEventDbCompact() {
+	file := chrootPath(cfgEventDb)
+	for range time.Tick(24 * time.Hour) {
+		eventDbLock.Lock()
+		err := compactEventDb(file)
+		if err == nil {
+			var f *os.File
+			if f, err = os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640); err == nil {
+				eventDb.Close()
+				eventDb = f
+			}
+		}
+		eventDbLock.Unlock()
+		if err != nil {
+			logMain(false, "compact event_db %s failed:%s", cfgEventDb, err.Error())
+		}
+	}
+}
+
+// print records of hosts in target, an ip or cidr, from the last days
+func queryEvents(w io.Writer, target string, days int) error {
+	if cfgEventDb == "" {
+		return fmt.Errorf("event_db is not set")
+	}
+	if !strings.Contains(target, "/") {
+		target += "/32"
+	}
+	_, network, err := net.ParseCIDR(target)
+	if err != nil {
+		return err
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	found := 0
+	err = scanEventDb(cfgEventDb, func(line []byte, rec *eventRecord) bool {
+		ip := net.ParseIP(rec.Host)
+		if rec.Time.Before(since) || ip == nil || !network.Contains(ip) {
+			return true
+		}
+		found++
+		fmt.Fprintf(w, "%s %s %s %s port: %d %s", logTime(rec.Time).Format(time.RFC3339), rec.Event, rec.Host, rec.Proto, rec.Port, rec.ScanType)
+		if rec.Payload != "" {
+			fmt.Fprintf(w, " payload: %s", rec.Payload)
+		}
+		if rec.Event == eventBlock {
+			fmt.Fprintf(w, " ports: %d offense: %d", rec.Alarms, rec.Offense)
+			if len(rec.Responders) > 0 {
+				fmt.Fprintf(w, " responders: %s", strings.Join(rec.Responders, ","))
+			}
+		}
+		fmt.Fprintln(w)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d events of %s in the last %d days\n", found, network, days)
+	return nil
+}
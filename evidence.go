@@ -0,0 +1,188 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// per-offender packet capture
+// the last evidence_ring packets of each recent source are kept in memory; when a host is
+// blocked they are written to a pcap file in evidence_dir, followed by the packets it sends
+// on, until the file reaches evidence_max_size KB or evidence_duration seconds passed
+// files are raw ip pcaps, portguard replay reads them
+
+type evidencePacket struct {
+	time time.Time
+	data []byte
+}
+
+// last packets of a source, oldest first from next
+type evidenceRing struct {
+	packets []evidencePacket
+	next    int
+	elem    *list.Element
+}
+
+type evidenceFile struct {
+	f     *os.File
+	w     *bufio.Writer
+	size  int
+	until time.Time
+}
+
+var (
+	evidenceLock  sync.Mutex
+	evidenceRings = make(map[uint32]*evidenceRing)
+	evidenceOrder = list.New() // sources, most recent first, bounded by evidence_hosts
+	evidenceFiles = make(map[uint32]*evidenceFile)
+)
+
+// keep packet of a source, or write it if the source is being captured
+func recordEvidence(ip *IPv4Header, packet []byte) {
+	if cfgEvidenceDir == "" {
+		return
+	}
+	key := ipToUint32(ip.Source)
+	now := time.Now()
+	evidenceLock.Lock()
+	defer evidenceLock.Unlock()
+	if f, ok := evidenceFiles[key]; ok {
+		if err := f.write(now, packet); err != nil || f.full(now) {
+			closeEvidence(key)
+		}
+		return
+	}
+	r, ok := evidenceRings[key]
+	if !ok {
+		r = &evidenceRing{packets: make([]evidencePacket, 0, cfgEvidenceRing)}
+		r.elem = evidenceOrder.PushFront(key)
+		evidenceRings[key] = r
+		for evidenceOrder.Len() > cfgEvidenceHosts {
+			delete(evidenceRings, evidenceOrder.Remove(evidenceOrder.Back()).(uint32))
+		}
+	} else {
+		evidenceOrder.MoveToFront(r.elem)
+	}
+	r.add(now, packet)
+}
+
+func (r *evidenceRing) add(t time.Time, packet []byte) {
+	p := evidencePacket{time: t, data: append([]byte(nil), packet...)}
+	if len(r.packets) < cap(r.packets) {
+		r.packets = append(r.packets, p)
+		return
+	}
+	if len(r.packets) == 0 {
+		return
+	}
+	r.packets[r.next] = p
+	r.next = (r.next + 1) % len(r.packets)
+}
+
+// start writing the packets of host, return the file name, empty if not capturing
+func startEvidence(host string) string {
+	ip := net.ParseIP(host).To4()
+	if cfgEvidenceDir == "" || ip == nil {
+		return ""
+	}
+	key := ipToUint32(ip)
+	now := time.Now()
+	evidenceLock.Lock()
+	defer evidenceLock.Unlock()
+	if _, ok := evidenceFiles[key]; ok {
+		return ""
+	}
+	if len(evidenceFiles) >= cfgEvidenceMaxFiles {
+		logMain(false, "not capturing packets of %s, %d captures running", host, len(evidenceFiles))
+		return ""
+	}
+	name := filepath.Join(cfgEvidenceDir, fmt.Sprintf("%s-%s.pcap", host, now.Format("20060102T150405")))
+	f, err := os.OpenFile(chrootPath(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		logMain(false, "capture packets of %s failed:%s", host, err.Error())
+		return ""
+	}
+	ef := &evidenceFile{f: f, w: bufio.NewWriter(f), until: now.Add(time.Duration(cfgEvidenceDuration) * time.Second)}
+	// microsecond timestamps, raw ip link type
+	var hdr [24]byte
+	binary.LittleEndian.PutUint32(hdr[0:], pcapMagicMicro)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], 65535)
+	binary.LittleEndian.PutUint32(hdr[20:], linkRaw)
+	ef.w.Write(hdr[:])
+	ef.size = len(hdr)
+	if r, ok := evidenceRings[key]; ok {
+		for i := range r.packets {
+			p := r.packets[(r.next+i)%len(r.packets)]
+			ef.write(p.time, p.data)
+		}
+		evidenceOrder.Remove(r.elem)
+		delete(evidenceRings, key)
+	}
+	evidenceFiles[key] = ef
+	logMain(false, "capturing packets of %s to %s", host, name)
+	return name
+}
+
+func (ef *evidenceFile) write(t time.Time, packet []byte) error {
+	var rec [16]byte
+	binary.LittleEndian.PutUint32(rec[0:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(len(packet)))
+	ef.w.Write(rec[:])
+	_, err := ef.w.Write(packet)
+	ef.size += len(rec) + len(packet)
+	return err
+}
+
+func (ef *evidenceFile) full(now time.Time) bool {
+	return ef.size >= cfgEvidenceMaxSize*1024 || !now.Before(ef.until)
+}
+
+// evidenceLock must be held
+func closeEvidence(key uint32) {
+	ef := evidenceFiles[key]
+	delete(evidenceFiles, key)
+	ef.w.Flush()
+	ef.f.Close()
+}
+
+// flush captures so analysts see packets as they come, and close the ones that ran out of time
+// from hosts that went quiet
+func runEvidenceSweep() {
+	for range time.Tick(5 * time.Second) {
+		now := time.Now()
+		evidenceLock.Lock()
+		for key, ef := range evidenceFiles {
+			if ef.full(now) {
+				closeEvidence(key)
+			} else if err := ef.w.Flush(); err != nil {
+				logMain(false, "write packet capture %s failed:%s", ef.f.Name(), err.Error())
+				closeEvidence(key)
+			}
+		}
+		evidenceLock.Unlock()
+	}
+}
+
+// on shutdown
+func closeEvidenceFiles() {
+	evidenceLock.Lock()
+	defer evidenceLock.Unlock()
+	for key := range evidenceFiles {
+		closeEvidence(key)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// commands responders launch, kill_run_cmd, route and firewall tools and plugins, are limited to
+// exec_rate per minute by a token bucket holding up to exec_burst, whatever the number of workers,
+// so a flood of spoofed sources can't make portguard fork route or iptables without end;
+// launches over the limit fail, and are counted as exec_limited
+
+var (
+	cfgExecRate  = 0 // per minute, 0 means no limit
+	cfgExecBurst = 0 // exec_rate by default
+
+	execLock   sync.Mutex
+	execTokens float64
+	execFilled time.Time
+)
+
+// an error if launching what now goes over exec_rate
+func allowExec(what string) error {
+	if cfgExecRate <= 0 {
+		return nil
+	}
+	burst := cfgExecBurst
+	if burst <= 0 {
+		burst = cfgExecRate
+	}
+	now := time.Now()
+	execLock.Lock()
+	if execFilled.IsZero() {
+		execTokens = float64(burst)
+	} else {
+		execTokens += now.Sub(execFilled).Minutes() * float64(cfgExecRate)
+	}
+	if execTokens > float64(burst) {
+		execTokens = float64(burst)
+	}
+	execFilled = now
+	ok := execTokens >= 1
+	if ok {
+		execTokens--
+	}
+	execLock.Unlock()
+	if ok {
+		return nil
+	}
+	if atomic.AddInt64(&stats.execLimited, 1)%100 == 1 {
+		logMain(false, "exec rate of %d per minute reached, %s not run, raise exec_rate or exec_burst", cfgExecRate, what)
+	}
+	return fmt.Errorf("exec rate of %d per minute reached", cfgExecRate)
+}
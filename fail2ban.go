@@ -0,0 +1,142 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// fail2ban
+// sites banning everything through fail2ban can keep portguard as a detector only, two ways:
+//
+//	fail2ban_log   blocks are appended in the format of portsentry.history, which the portsentry
+//	               jail and filter shipped with fail2ban match as they are:
+//	               1760600000 - 10/16/2026 07:33:20 Host: 1.2.3.4/1.2.3.4 Port: 23 TCP Blocked
+//	fail2ban_jail  the fail2ban responder bans blocked hosts in that jail, and unbans them when
+//	               their block expires, over fail2ban's command socket, fail2ban_socket
+//
+// the socket speaks python pickle, commands like ["set", jail, "banip", ip] are sent as protocol 2
+// pickles ended by <F2B_END_COMMAND>, as fail2ban-client does; the reply is a pickled
+// [code, result], code 0 on success
+
+const (
+	fail2banEnd     = "<F2B_END_COMMAND>"
+	fail2banTimeout = 10 * time.Second
+)
+
+var (
+	cfgFail2banLog     io.Writer
+	cfgFail2banLogPath string
+	cfgFail2banJail    string
+	cfgFail2banSocket  = "/var/run/fail2ban/fail2ban.sock"
+)
+
+// append block ev to fail2ban_log as portsentry would
+func fail2banHistory(ev *event) {
+	if cfgFail2banLog == nil {
+		return
+	}
+	proto := ev.Proto
+	if proto != "TCP" && proto != "UDP" {
+		proto = strings.ToUpper(*mode)
+	}
+	fmt.Fprintf(cfgFail2banLog, "%d - %s Host: %s/%s Port: %d %s Blocked\n",
+		ev.Time.Unix(), ev.Time.Format("01/02/2006 15:04:05"), ev.Host, ev.Host, ev.Port, proto)
+}
+
+// a list of strings as a pickle of protocol 2
+func fail2banPickle(args ...string) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0x80, 2, ']', '('}) // proto 2, empty list, mark
+	for _, s := range args {
+		var n [4]byte
+		binary.LittleEndian.PutUint32(n[:], uint32(len(s)))
+		b.WriteByte('X') // binunicode
+		b.Write(n[:])
+		b.WriteString(s)
+	}
+	b.Write([]byte{'e', '.'}) // appends, stop
+	return b.Bytes()
+}
+
+// code of a pickled [code, result] reply, false if it isn't one
+func fail2banReplyCode(reply []byte) (int, bool) {
+	for i := 0; i < len(reply); {
+		switch reply[i] {
+		case 0x80, 'q': // proto, binput
+			i += 2
+		case 0x95: // frame
+			i += 9
+		case ']', ')', '(', 0x94: // empty list, empty tuple, mark, memoize
+			i++
+		case 'K': // binint1
+			if i+1 < len(reply) {
+				return int(reply[i+1]), true
+			}
+			return 0, false
+		case 'J': // binint
+			if i+4 < len(reply) {
+				return int(int32(binary.LittleEndian.Uint32(reply[i+1 : i+5]))), true
+			}
+			return 0, false
+		default:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// run a command on fail2ban's socket
+func fail2banCommand(ctx context.Context, args ...string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", cfgFail2banSocket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(fail2banTimeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write(append(fail2banPickle(args...), fail2banEnd...)); err != nil {
+		return err
+	}
+	var reply []byte
+	buf := make([]byte, 1024)
+	for !bytes.HasSuffix(reply, []byte(fail2banEnd)) {
+		n, err := conn.Read(buf)
+		reply = append(reply, buf[:n]...)
+		if err != nil {
+			return fmt.Errorf("read reply: %w", err)
+		}
+	}
+	code, ok := fail2banReplyCode(bytes.TrimSuffix(reply, []byte(fail2banEnd)))
+	if !ok {
+		return errors.New("unreadable reply")
+	}
+	if code != 0 {
+		return fmt.Errorf("%s failed, see the fail2ban log", strings.Join(args, " "))
+	}
+	return nil
+}
+
+func fail2banBan(ctx context.Context, ip string) error {
+	return fail2banCommand(ctx, "set", cfgFail2banJail, "banip", ip)
+}
+
+func fail2banUnban(ip string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), fail2banTimeout)
+	defer cancel()
+	return fail2banCommand(ctx, "set", cfgFail2banJail, "unbanip", ip)
+}
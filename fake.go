@@ -0,0 +1,191 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// the guards read packets from a packetConn and check ports with a portVerifier; besides the
+// raw sockets and bind checks they run on in-memory fakes, so the detection pipeline, from
+// tcpGuard and udpGuard through smartVerify to checkStateEngine, runs without root, raw
+// sockets or real scans, e.g.
+//
+//	verifier = newFakeVerifier(22)
+//	conn := newFakeConn()
+//	go tcpGuard(conn, serverIp, "")
+//	conn.Inject(fakeTcpPacket(src, serverIp, 23, SYN))
+//	conn.Close()
+
+// checks if a port is in use
+type portVerifier interface {
+	PortInUse(laddr net.IP, port int) bool
+}
+
+// binds the port, see smartVerifyPort
+type bindVerifier struct{}
+
+func (bindVerifier) PortInUse(laddr net.IP, port int) bool {
+	return smartVerifyPort(laddr, port)
+}
+
+// ports in use kept in memory, every other port is closed
+type fakeVerifier struct {
+	lock sync.Mutex
+	open map[int]bool
+}
+
+func newFakeVerifier(ports ...int) *fakeVerifier {
+	v := &fakeVerifier{open: make(map[int]bool)}
+	for _, port := range ports {
+		v.open[port] = true
+	}
+	return v
+}
+
+// mark port in use, or closed if open is false
+func (v *fakeVerifier) Set(port int, open bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if open {
+		v.open[port] = true
+	} else {
+		delete(v.open, port)
+	}
+}
+
+func (v *fakeVerifier) PortInUse(laddr net.IP, port int) bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.open[port]
+}
+
+// packets queued in memory, ipv4 header first
+// reads wait for an injected packet or the read deadline, and end with io.EOF once closed
+type fakeConn struct {
+	packets  chan []byte
+	lock     sync.Mutex
+	deadline time.Time
+	closed   chan struct{}
+	once     sync.Once
+	vlan     int
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{packets: make(chan []byte, 64), closed: make(chan struct{})}
+}
+
+// queue packet for the guard, waiting while the queue is full
+func (c *fakeConn) Inject(packet []byte) {
+	select {
+	case c.packets <- packet:
+	case <-c.closed:
+	}
+}
+
+// packets injected after this one are tagged with vlan
+func (c *fakeConn) SetVlan(vlan int) {
+	c.lock.Lock()
+	c.vlan = vlan
+	c.lock.Unlock()
+}
+
+func (c *fakeConn) ReadPacket(b []byte) (int, error) {
+	c.lock.Lock()
+	deadline := c.deadline
+	c.lock.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case packet := <-c.packets:
+		return copy(b, packet), nil
+	default:
+	}
+	select {
+	case packet := <-c.packets:
+		return copy(b, packet), nil
+	case <-c.closed:
+		return 0, io.EOF
+	case <-timeout:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *fakeConn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	c.deadline = t
+	c.lock.Unlock()
+	return nil
+}
+
+func (c *fakeConn) LastVlan() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.vlan
+}
+
+// queued packets are still read, then reads return io.EOF
+func (c *fakeConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// ipv4 packet of a tcp segment with flags from src to dst:port, checksummed
+func fakeTcpPacket(src net.IP, dst net.IP, port int, flags uint8) []byte {
+	tcp := TCPHeader{
+		Source:      40000,
+		Destination: uint16(port),
+		SeqNum:      1,
+		DataOffset:  5,
+		Ctrl:        flags,
+		Window:      1024,
+	}
+	var srcAddr, dstAddr [4]byte
+	copy(srcAddr[:], src.To4())
+	copy(dstAddr[:], dst.To4())
+	tcp.Checksum = csum(tcp.Marshal(), srcAddr, dstAddr)
+	segment := tcp.Marshal()
+	packet := make([]byte, 20+len(segment))
+	copy(packet[20:], segment)
+	replyIPv4Header(packet[:20], src, dst, protoTCP)
+	binary.BigEndian.PutUint16(packet[2:], uint16(len(packet)))
+	fixIPv4Checksum(packet[:20])
+	return packet
+}
+
+// ipv4 packet of a udp datagram with payload from src to dst:port, without udp checksum
+func fakeUdpPacket(src net.IP, dst net.IP, port int, payload []byte) []byte {
+	packet := make([]byte, 28+len(payload))
+	binary.BigEndian.PutUint16(packet[20:], 40000)
+	binary.BigEndian.PutUint16(packet[22:], uint16(port))
+	binary.BigEndian.PutUint16(packet[24:], uint16(8+len(payload)))
+	copy(packet[28:], payload)
+	replyIPv4Header(packet[:20], src, dst, protoUDP)
+	binary.BigEndian.PutUint16(packet[2:], uint16(len(packet)))
+	fixIPv4Checksum(packet[:20])
+	return packet
+}
+
+// checksum of an ipv4 header again after its fields changed
+func fixIPv4Checksum(hdr []byte) {
+	hdr[10], hdr[11] = 0, 0
+	var sum uint32
+	for i := 0; i < len(hdr); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(hdr[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	binary.BigEndian.PutUint16(hdr[10:], ^uint16(sum))
+}
@@ -0,0 +1,127 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"math/bits"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// nmap -O sends odd tcp probes no real client does, see nmap's osscan docs:
+// ECN, a SYN with ECE and CWR and an urgent pointer but no URG
+// T2, a NULL packet with options and DF
+// T3, SYN|FIN|PSH|URG with options, sent to an open port
+// T7, FIN|PSH|URG with options, unlike a plain XMAS scan
+// its ICMP and UDP probes are not captured by a tcp guard
+const (
+	fingerprintEcn = 1 << iota
+	fingerprintT2
+	fingerprintT3
+	fingerprintT7
+)
+
+var fingerprintNames = []string{"ECN", "T2", "T3", "T7"}
+
+type fingerprintState struct {
+	probes  uint8 // fingerprint* bits
+	first   int64
+	alarmed bool
+}
+
+var (
+	fingerprintLock sync.Mutex
+	fingerprintSeen = make(map[string]*fingerprintState)
+)
+
+// which fingerprinting probe tcp is, 0 if none
+func fingerprintProbe(ip *IPv4Header, tcp *TCPHeader) uint8 {
+	options := tcp.DataOffset > 5
+	switch {
+	case tcp.Ctrl&(SYN|URG) == SYN && tcp.ECN&3 == 3 && tcp.Urgent != 0:
+		return fingerprintEcn
+	case tcp.Ctrl == 0 && options && ip.Flags&ipv4DontFragment != 0:
+		return fingerprintT2
+	case tcp.Ctrl == SYN|FIN|PSH|URG && options:
+		return fingerprintT3
+	case tcp.Ctrl == FIN|PSH|URG && options:
+		return fingerprintT7
+	}
+	return 0
+}
+
+func fingerprintProbeNames(probes uint8) string {
+	var names []string
+	for i, name := range fingerprintNames {
+		if probes&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// track fingerprinting probes of a host, alarm once it sent fingerprint_probes kinds of them
+// within fingerprint_window seconds; it runs before port filters, T3 goes to open ports
+func checkFingerprint(ip *IPv4Header, tcp *TCPHeader, laddr net.IP) {
+	probe := fingerprintProbe(ip, tcp)
+	if probe == 0 || cfgFingerprintProbes <= 0 {
+		return
+	}
+	host := ip.Source.String()
+	now := time.Now().Unix()
+	window := int64(cfgFingerprintWindow)
+
+	fingerprintLock.Lock()
+	s := fingerprintSeen[host]
+	if s == nil || now-s.first > window {
+		if len(fingerprintSeen) >= 4096 {
+			for h, old := range fingerprintSeen {
+				if now-old.first > window {
+					delete(fingerprintSeen, h)
+				}
+			}
+		}
+		s = &fingerprintState{first: now}
+		fingerprintSeen[host] = s
+	}
+	s.probes |= probe
+	fire := !s.alarmed && bits.OnesCount8(s.probes) >= cfgFingerprintProbes
+	if fire {
+		s.alarmed = true
+	}
+	probes := s.probes
+	fingerprintLock.Unlock()
+
+	if fire {
+		fingerprintAlarm(ip, tcp, laddr, probes)
+	}
+}
+
+// an alarm more severe than a port probe, the host is blocked at once if fingerprint_block is on
+func fingerprintAlarm(ip *IPv4Header, tcp *TCPHeader, laddr net.IP, probes uint8) {
+	host := ip.Source.String()
+	port := int(tcp.Destination)
+	if isIgnoredIP(ip.Source) || isBlockedIP(host) {
+		return
+	}
+
+	ev := &event{Time: time.Now(), Kind: eventAlarm, Host: host, Port: port, Proto: "TCP",
+		ScanType: tcpPacketTypeFingerprint, Flags: tcp.Ctrl, TTL: ip.TTL, Laddr: laddr}
+	ev.ASN, ev.ASOrg = lookupAsn(ip.Source)
+	ev.Country = lookupCountry(ip.Source)
+	ev.Reputation = reputationOf(host)
+
+	statsAdd(&stats.alarms)
+	statsAdd(&stats.fingerprints)
+	emitEvent(ev)
+	logHostAlarm(severityCritical, host, "attackalert: %s from host: %s to TCP port: %d, probes: %s%s",
+		tcpPacketTypeFingerprint, host, port, fingerprintProbeNames(probes), ev.origin())
+
+	if cfgFingerprintBlock && forceBlock(host, port, tcpPacketTypeFingerprint) {
+		reportBlock(ev)
+	}
+}
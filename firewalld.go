@@ -0,0 +1,70 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+)
+
+// firewalld d-bus api
+const (
+	firewalldName          = "org.fedoraproject.FirewallD1"
+	firewalldPath          = "/org/fedoraproject/FirewallD1"
+	firewalldConfigPath    = "/org/fedoraproject/FirewallD1/config"
+	firewalldZoneIface     = "org.fedoraproject.FirewallD1.zone"
+	firewalldIPSetIface    = "org.fedoraproject.FirewallD1.ipset"
+	firewalldConfigIface   = "org.fedoraproject.FirewallD1.config"
+	firewalldConfZoneIface = "org.fedoraproject.FirewallD1.config.zone"
+	firewalldConfSetIface  = "org.fedoraproject.FirewallD1.config.ipset"
+)
+
+// block ips with firewalld over one bus connection, see firewalldBlockIp
+func firewalldBlock(zone string, ipset string, permanent bool, ips []string) error {
+	bus, err := dialSystemBus()
+	if err != nil {
+		return fmt.Errorf("connect system bus:%s", err.Error())
+	}
+	defer bus.Close()
+	for _, ip := range ips {
+		if err := firewalldBlockIp(bus, zone, ipset, permanent, ip); err != nil {
+			return fmt.Errorf("block %s:%w", ip, err)
+		}
+	}
+	return nil
+}
+
+// block ip with firewalld: add it to ipset if configured, or a drop rich rule to zone
+// permanent also writes the entry to firewalld's permanent config, so it survives reload
+func firewalldBlockIp(bus *dbusConn, zone string, ipset string, permanent bool, ip string) error {
+
+	if ipset != "" {
+		if _, err := bus.Call(firewalldName, firewalldPath, firewalldIPSetIface, "addEntry", ipset, ip); err != nil {
+			return err
+		}
+		if !permanent {
+			return nil
+		}
+		path, err := bus.Call(firewalldName, firewalldConfigPath, firewalldConfigIface, "getIPSetByName", ipset)
+		if err != nil {
+			return err
+		}
+		_, err = bus.Call(firewalldName, path, firewalldConfSetIface, "addEntry", ip)
+		return err
+	}
+
+	rule := fmt.Sprintf(`rule family="ipv4" source address="%s" drop`, ip)
+	if _, err := bus.Call(firewalldName, firewalldPath, firewalldZoneIface, "addRichRule", zone, rule, int32(0)); err != nil {
+		return err
+	}
+	if !permanent {
+		return nil
+	}
+	path, err := bus.Call(firewalldName, firewalldConfigPath, firewalldConfigIface, "getZoneByName", zone)
+	if err != nil {
+		return err
+	}
+	_, err = bus.Call(firewalldName, path, firewalldConfZoneIface, "addRichRule", rule)
+	return err
+}
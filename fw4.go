@@ -0,0 +1,97 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// openwrt fw4
+// fw4_set blocks hosts in a set of table inet fw4, the firewall of openwrt 22.03 and later;
+// the set and the chains dropping its hosts on input and forward are kept in fw4_include, a file
+// fw4 includes in its table, with the hosts blocked, so a firewall reload doesn't lift blocks;
+// a batch adds and deletes hosts with one nft transaction and writes the include again
+// if the set isn't there at start, the include is written and the firewall reloaded
+
+var (
+	cfgFw4Set     string
+	cfgFw4Include = "/etc/nftables.d/90-portguard.nft"
+)
+
+// the include for blocked hosts ips
+func fw4IncludeText(ips []string) string {
+	var b strings.Builder
+	b.WriteString("# written by portguard, hosts it blocks; fw4 includes it in table inet fw4\n")
+	fmt.Fprintf(&b, "set %s {\n\ttype ipv4_addr\n", cfgFw4Set)
+	if len(ips) > 0 {
+		fmt.Fprintf(&b, "\telements = { %s }\n", strings.Join(ips, ", "))
+	}
+	b.WriteString("}\n")
+	for _, hook := range []string{"input", "forward"} {
+		fmt.Fprintf(&b, "chain %s_%s {\n", cfgFw4Set, hook)
+		fmt.Fprintf(&b, "\ttype filter hook %s priority filter - 1; policy accept;\n", hook)
+		fmt.Fprintf(&b, "\tip saddr @%s counter drop\n}\n", cfgFw4Set)
+	}
+	return b.String()
+}
+
+func writeFw4Include(ips []string) error {
+	return writeFileAtomic(chrootPath(cfgFw4Include), []byte(fw4IncludeText(ips)), 0644)
+}
+
+// write the include and reload the firewall if the set is missing, before chroot
+func setupFw4() error {
+	if exec.Command("nft", "list", "set", "inet", "fw4", cfgFw4Set).Run() == nil {
+		return nil
+	}
+	if err := writeFw4Include(blockedIps()); err != nil {
+		return err
+	}
+	if out, err := exec.Command("fw4", "-q", "reload").CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("fw4 reload: %w: %s", err, msg)
+		}
+		return fmt.Errorf("fw4 reload: %w", err)
+	}
+	return nil
+}
+
+// one nft transaction like nft_set, then the include with the hosts blocked after it
+func fw4Apply(ctx context.Context, ops []fwOp) error {
+	set := "inet fw4 " + cfgFw4Set
+	var b strings.Builder
+	for _, op := range ops {
+		fmt.Fprintf(&b, "add element %s { %s }\n", set, op.ip)
+		if op.del {
+			fmt.Fprintf(&b, "delete element %s { %s }\n", set, op.ip)
+		}
+	}
+	if err := runBatchCmd(ctx, b.String(), "nft", "-f", "-"); err != nil {
+		return err
+	}
+
+	blocked := make(map[string]bool)
+	for _, ip := range blockedIps() {
+		blocked[ip] = true
+	}
+	for _, op := range ops {
+		blocked[op.ip] = !op.del
+	}
+	var ips []string
+	for ip, ok := range blocked {
+		if ok {
+			ips = append(ips, ip)
+		}
+	}
+	sort.Strings(ips)
+	if err := writeFw4Include(ips); err != nil {
+		return fmt.Errorf("write %s: %w", cfgFw4Include, err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// firewall sync
+// nft_set, ipset and fw4_set belong to portguard, and their hosts may outlive it: sets saved and
+// restored at boot, fw4_include, an nft ruleset reloaded from a file; at start each set is synced
+// with the blocks portguard has, those restored from state_file or none without it: blocked hosts
+// missing from the set are added back and hosts whose block expired while portguard was stopped are
+// deleted, in batches of firewall_batch_max; with action log_only the changes are only logged
+// entries that aren't single ips, like prefixes and ranges, were put there by hand and stay
+
+const fwSyncTimeout = time.Minute
+
+type fwSet struct {
+	name    string // of the responder
+	members func(ctx context.Context) ([]string, error)
+	apply   func(ctx context.Context, ops []fwOp) error
+}
+
+func syncFirewallSets() {
+	var sets []fwSet
+	if cfgNftSet != "" {
+		sets = append(sets, fwSet{"nft_set", func(ctx context.Context) ([]string, error) {
+			return nftSetMembers(ctx, strings.Fields(cfgNftSet)...)
+		}, nftApply})
+	}
+	if cfgFw4Set != "" {
+		sets = append(sets, fwSet{"fw4_set", func(ctx context.Context) ([]string, error) {
+			return nftSetMembers(ctx, "inet", "fw4", cfgFw4Set)
+		}, fw4Apply})
+	}
+	if cfgIpset != "" {
+		sets = append(sets, fwSet{"ipset", ipsetMembers, ipsetApply})
+	}
+	for _, s := range sets {
+		if err := s.sync(); err != nil {
+			logMain(false, "sync %s failed:%s", s.name, err.Error())
+		}
+	}
+}
+
+func (s fwSet) sync() error {
+	ctx, cancel := context.WithTimeout(context.Background(), fwSyncTimeout)
+	defer cancel()
+	members, err := s.members(ctx)
+	if err != nil {
+		return err
+	}
+	blocked := make(map[string]bool)
+	for _, ip := range blockedIps() {
+		blocked[ip] = true
+	}
+	var ops []fwOp
+	removed := 0
+	for _, ip := range members {
+		if blocked[ip] {
+			delete(blocked, ip)
+			continue
+		}
+		ops = append(ops, fwOp{ip: ip, del: true})
+		removed++
+	}
+	for _, ip := range blockedIps() {
+		if blocked[ip] {
+			ops = append(ops, fwOp{ip: ip})
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	if cfgAction == "log_only" {
+		logMain(false, "sync %s would add %d hosts and remove %d, action is log_only", s.name, len(ops)-removed, removed)
+		return nil
+	}
+	for len(ops) > 0 {
+		n := len(ops)
+		if n > cfgFirewallBatchMax {
+			n = cfgFirewallBatchMax
+		}
+		if err := s.apply(ctx, ops[:n]); err != nil {
+			return err
+		}
+		ops = ops[n:]
+	}
+	logMain(false, "synced %s, %d added, %d removed", s.name, len(blocked), removed)
+	return nil
+}
+
+// single ips in an nft set, from nft -j: elements are strings, or objects with a val when they
+// have a timeout or counter
+func nftSetMembers(ctx context.Context, set ...string) ([]string, error) {
+	if len(set) != 3 {
+		return nil, fmt.Errorf("invalid set %q", strings.Join(set, " "))
+	}
+	out, err := exec.CommandContext(ctx, "nft", append([]string{"-j", "list", "set"}, set...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("nft list set %s: %w", strings.Join(set, " "), err)
+	}
+	var list struct {
+		Nftables []struct {
+			Set *struct {
+				Elem []json.RawMessage `json:"elem"`
+			} `json:"set"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("nft list set %s: %w", strings.Join(set, " "), err)
+	}
+	var ips []string
+	for _, item := range list.Nftables {
+		if item.Set == nil {
+			continue
+		}
+		for _, raw := range item.Set.Elem {
+			var ip string
+			if json.Unmarshal(raw, &ip) != nil {
+				var elem struct {
+					Elem struct {
+						Val json.RawMessage `json:"val"`
+					} `json:"elem"`
+				}
+				if json.Unmarshal(raw, &elem) != nil || json.Unmarshal(elem.Elem.Val, &ip) != nil {
+					continue
+				}
+			}
+			if net.ParseIP(ip).To4() != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips, nil
+}
+
+// single ips in ipset, from the add lines of ipset save
+func ipsetMembers(ctx context.Context) ([]string, error) {
+	out, err := exec.CommandContext(ctx, "ipset", "save", cfgIpset).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ipset save %s: %w", cfgIpset, err)
+	}
+	var ips []string
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == "add" && fields[1] == cfgIpset && net.ParseIP(fields[2]).To4() != nil {
+			ips = append(ips, fields[2])
+		}
+	}
+	return ips, nil
+}
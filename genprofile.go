@@ -0,0 +1,325 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// portguard genprofile systemd|apparmor|seccomp [configFile]
+// prints a hardening profile allowing what the features enabled in config need, and nothing more:
+// capabilities, address families, files written, and exec only if commands are configured
+
+// what the configured features need from the system
+type profileNeeds struct {
+	caps      []string // capability names without CAP_, e.g. net_raw
+	exec      bool     // runs external commands
+	inet      bool     // tcp or udp clients: urls, statsd, dns lookups
+	listen    bool     // health_addr
+	netlink   bool
+	bpf       bool     // loads an xdp program and updates its map
+	reads     []string // files read
+	writes    []string // files written in place
+	dirs      []string // directories files are created or renamed in
+	chrootDir string
+}
+
+func configNeeds() *profileNeeds {
+	n := &profileNeeds{caps: []string{"net_raw"}, netlink: true}
+	if cfgMinPort < 1024 {
+		n.caps = append(n.caps, "net_bind_service")
+	}
+	if len(cfgKillRoute) > 0 || cfgFirewalldZone != "" || cfgFirewalldIPSet != "" || cfgNftSet != "" || cfgFw4Set != "" || cfgIpset != "" || cfgBlackholeRoute != "" || cfgConntrackFlush {
+		n.caps = append(n.caps, "net_admin")
+	}
+	if len(cfgXdpInterfaces) > 0 {
+		n.caps = append(n.caps, "net_admin", "bpf", "sys_admin")
+		n.bpf = true
+		n.dirs = append(n.dirs, filepath.Dir(cfgXdpMapPin))
+	}
+	if cfgRunAsUser != "" || cfgRunAsGroup != "" {
+		n.caps = append(n.caps, "setuid", "setgid")
+	}
+	if cfgChrootDir != "" {
+		n.caps = append(n.caps, "sys_chroot")
+		n.chrootDir = cfgChrootDir
+	}
+
+	n.exec = len(cfgKillRoute) > 0 || len(cfgKillRunCmd) > 0 || cfgNftSet != "" || cfgFw4Set != "" || cfgIpset != "" || cfgUbusEvents || len(cfgPlugins) > 0 || hasExecResponders() || cfgPolicyCmd != ""
+	n.inet = cfgKillNotifyUrl != "" || cfgReputationUrl != "" || cfgCloudflareToken != "" || cfgAwsNaclId != "" ||
+		cfgKubeBlocklist != "" || cfgStatsdAddr != "" || cfgIpfixCollector != "" || cfgSnmpTrap != "" || cfgOtlpEndpoint != "" || cfgDigestUrl != "" || cfgOpsAlertUrl != "" || cfgErrorReportUrl != "" || len(ignoreHosts) > 0 || len(cfgIgnoreUrls) > 0 || cfgBogonUrl != "" || cfgClusterListen != "" || cfgKvBackend != "" || cfgGeoipLicenseKey != ""
+	for _, conf := range cfgResponders {
+		if conf.enabled && conf.kind == "url" {
+			n.inet = true
+		}
+	}
+	n.listen = cfgHealthAddr != "" || cfgClusterListen != "" || cfgBlocklistAddr != "" || cfgScoreAddr != ""
+
+	for _, file := range cfgFiles {
+		if file != configStdin {
+			n.reads = append(n.reads, file)
+		}
+	}
+	for _, file := range []string{cfgAsnDb, cfgCountryDb, cfgCountryLocations, cfgHttpTlsCert, cfgHttpTlsKey, cfgHttpClientCa, cfgIgnoreUrlCa} {
+		if file != "" {
+			n.reads = append(n.reads, file)
+		}
+	}
+	if len(ignoreHosts) > 0 {
+		n.reads = append(n.reads, "/etc/resolv.conf")
+	}
+	if cfgKubeBlocklist != "" {
+		n.reads = append(n.reads, kubeTokenFile, kubeCaFile)
+	}
+	if cfgJournald {
+		n.writes = append(n.writes, journalSocket)
+	}
+	if cfgWazuhOutput != "" {
+		n.writes = append(n.writes, cfgWazuhSocket)
+	}
+	if cfgFail2banJail != "" {
+		n.writes = append(n.writes, cfgFail2banSocket)
+	}
+	if cfgContainerNetworks == containerProtect {
+		n.writes = append(n.writes, cfgDockerSocket)
+	}
+	for _, file := range []string{cfgAlarmLogPath, cfgBlockedLogPath, cfgDigestLogPath, cfgAuditLogPath, cfgFail2banLogPath} {
+		if file != "" {
+			n.writes = append(n.writes, file)
+		}
+	}
+	// written by rename of a temporary file, rotated or created
+	for _, file := range []string{cfgStateFile, cfgPidFile, cfgEventDb, cfgEventLog, cfgControlSocket, cfgBlocklistFile} {
+		if file != "" {
+			n.dirs = append(n.dirs, filepath.Dir(file))
+		}
+	}
+	if cfgEvidenceDir != "" {
+		n.dirs = append(n.dirs, cfgEvidenceDir)
+	}
+	if cfgFw4Set != "" {
+		n.dirs = append(n.dirs, filepath.Dir(cfgFw4Include))
+	}
+	if cfgGeoipLicenseKey != "" {
+		for _, e := range geoipEditions() {
+			for _, file := range e.files {
+				n.dirs = append(n.dirs, filepath.Dir(file))
+			}
+		}
+	}
+	n.reads = absPaths(n.reads)
+	n.writes = absPaths(n.writes)
+	n.dirs = uniqueStrings(absPaths(n.dirs))
+	return n
+}
+
+// profiles need absolute paths, relative ones are taken from the current directory like portguard does
+func absPaths(paths []string) []string {
+	var out []string
+	for _, p := range paths {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func uniqueStrings(list []string) []string {
+	sort.Strings(list)
+	var out []string
+	for i, s := range list {
+		if i == 0 || s != list[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func genProfile(w io.Writer, kind string) error {
+	n := configNeeds()
+	switch kind {
+	case "systemd":
+		genSystemd(w, n)
+	case "apparmor":
+		genAppArmor(w, n)
+	case "seccomp":
+		return genSeccomp(w, n)
+	default:
+		return fmt.Errorf("unknown profile %q, should be systemd, apparmor or seccomp", kind)
+	}
+	return nil
+}
+
+// drop-in for portguard.service, e.g. /etc/systemd/system/portguard.service.d/hardening.conf
+func genSystemd(w io.Writer, n *profileNeeds) {
+	var caps []string
+	for _, c := range n.caps {
+		caps = append(caps, "CAP_"+strings.ToUpper(c))
+	}
+	families := []string{"AF_INET", "AF_UNIX", "AF_NETLINK"}
+	if n.inet {
+		families = append(families, "AF_INET6")
+	}
+
+	fmt.Fprintln(w, "# generated by portguard genprofile for", strings.Join(absPaths(cfgFiles), ", "))
+	fmt.Fprintln(w, "[Service]")
+	fmt.Fprintln(w, "CapabilityBoundingSet="+strings.Join(caps, " "))
+	fmt.Fprintln(w, "RestrictAddressFamilies="+strings.Join(families, " "))
+	fmt.Fprintln(w, "ProtectSystem=strict")
+	fmt.Fprintln(w, "ProtectHome=yes")
+	fmt.Fprintln(w, "PrivateTmp=yes")
+	fmt.Fprintln(w, "PrivateDevices=yes")
+	fmt.Fprintln(w, "ProtectKernelModules=yes")
+	fmt.Fprintln(w, "ProtectControlGroups=yes")
+	fmt.Fprintln(w, "ProtectClock=yes")
+	fmt.Fprintln(w, "ProtectHostname=yes")
+	fmt.Fprintln(w, "RestrictNamespaces=yes")
+	fmt.Fprintln(w, "RestrictRealtime=yes")
+	fmt.Fprintln(w, "RestrictSUIDSGID=yes")
+	fmt.Fprintln(w, "LockPersonality=yes")
+	fmt.Fprintln(w, "MemoryDenyWriteExecute=yes")
+	fmt.Fprintln(w, "SystemCallArchitectures=native")
+	fmt.Fprintln(w, "SystemCallFilter=@system-service")
+	if !n.exec {
+		// no responder or policy commands, portguard never execs; only its own binary is executable
+		exe, err := os.Executable()
+		if err != nil {
+			exe = "/usr/sbin/portguard"
+		}
+		fmt.Fprintln(w, "NoExecPaths=/")
+		fmt.Fprintln(w, "ExecPaths="+exe)
+		fmt.Fprintln(w, "NoNewPrivileges=yes")
+		fmt.Fprintln(w, "ProtectKernelTunables=yes")
+	} else {
+		fmt.Fprintln(w, "# commands are configured; they may need more, e.g. iptables needs ProtectKernelTunables=no")
+	}
+	paths := append(append([]string{}, n.writes...), n.dirs...)
+	if n.chrootDir != "" {
+		paths = append(paths, n.chrootDir)
+	}
+	if len(paths) > 0 {
+		fmt.Fprintln(w, "ReadWritePaths="+strings.Join(uniqueStrings(paths), " "))
+	}
+}
+
+func genAppArmor(w io.Writer, n *profileNeeds) {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "/usr/sbin/portguard"
+	}
+	fmt.Fprintln(w, "# generated by portguard genprofile for", strings.Join(absPaths(cfgFiles), ", "))
+	fmt.Fprintln(w, "#include <tunables/global>")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%s {\n", exe)
+	fmt.Fprintln(w, "  #include <abstractions/base>")
+	if n.inet {
+		fmt.Fprintln(w, "  #include <abstractions/nameservice>")
+		fmt.Fprintln(w, "  #include <abstractions/ssl_certs>")
+	}
+	fmt.Fprintln(w)
+	for _, c := range n.caps {
+		fmt.Fprintf(w, "  capability %s,\n", c)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "  network inet raw,")
+	if usePacketCapture() {
+		fmt.Fprintln(w, "  network packet raw,")
+	}
+	// smartVerify binds probed ports
+	fmt.Fprintln(w, "  network inet stream,")
+	fmt.Fprintln(w, "  network inet dgram,")
+	if n.inet {
+		fmt.Fprintln(w, "  network inet6 stream,")
+		fmt.Fprintln(w, "  network inet6 dgram,")
+	}
+	fmt.Fprintln(w, "  network unix stream,")
+	fmt.Fprintln(w, "  network unix dgram,")
+	fmt.Fprintln(w, "  network netlink raw,")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "  %s mr,\n", exe)
+	fmt.Fprintln(w, "  /proc/sys/net/core/somaxconn r,")
+	fmt.Fprintln(w, "  /sys/kernel/mm/transparent_hugepage/hpage_pmd_size r,")
+	fmt.Fprintln(w, "  /dev/log w,")
+	fmt.Fprintln(w, "  /run/systemd/notify w,")
+	for _, file := range uniqueStrings(n.reads) {
+		fmt.Fprintf(w, "  %s r,\n", file)
+	}
+	for _, file := range n.writes {
+		fmt.Fprintf(w, "  %s w,\n", file)
+	}
+	for _, dir := range n.dirs {
+		fmt.Fprintf(w, "  %s/** rwl,\n", strings.TrimSuffix(dir, "/"))
+	}
+	if n.chrootDir != "" {
+		fmt.Fprintf(w, "  %s/ r,\n", strings.TrimSuffix(n.chrootDir, "/"))
+	}
+	if n.exec {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "  # responder and policy commands run through the shell, unconfined; confine them in their own profiles")
+		fmt.Fprintln(w, "  /{usr/,}bin/{,ba,da}sh Ux,")
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// oci seccomp profile, for docker run --security-opt seccomp=<file> and the like
+// keep in sync with seccompSyscalls
+var profileSyscalls = []string{
+	// runtime
+	"brk", "mmap", "munmap", "mprotect", "madvise", "futex", "clone", "clone3", "sched_yield",
+	"sched_getaffinity", "nanosleep", "clock_nanosleep", "clock_gettime", "gettimeofday", "time",
+	"gettid", "getpid", "getppid", "tgkill", "kill", "rt_sigaction", "rt_sigprocmask", "rt_sigreturn",
+	"sigaltstack", "exit", "exit_group", "set_robust_list", "set_tid_address", "rseq", "prlimit64",
+	"getrlimit", "uname", "getuid", "geteuid", "getgid", "getegid", "getrandom", "arch_prctl",
+	"epoll_create", "epoll_create1", "epoll_ctl", "epoll_wait", "epoll_pwait", "epoll_pwait2",
+	"eventfd2", "pipe", "pipe2", "poll", "ppoll",
+	// files
+	"read", "write", "readv", "writev", "pread64", "pwrite64", "close", "open", "openat", "fstat",
+	"stat", "lstat", "newfstatat", "fstatat", "statx", "lseek", "fcntl", "ioctl", "fsync", "fdatasync",
+	"dup2", "dup3", "unlink", "unlinkat", "rename", "renameat", "linkat", "readlink", "readlinkat",
+	"access", "faccessat", "faccessat2", "getdents64", "umask", "fchmod", "fchmodat", "fchown", "utimensat",
+	// sockets
+	"socket", "bind", "connect", "listen", "accept", "accept4", "sendto", "recvfrom", "sendmsg",
+	"recvmsg", "setsockopt", "getsockopt", "getsockname", "getpeername", "shutdown",
+	// startup: capabilities, dropping privileges, chroot and seccomp itself
+	"capget", "capset", "prctl", "seccomp", "setuid", "setgid", "setgroups", "setresuid", "setresgid",
+	"chroot", "chdir",
+	// started by the container runtime
+	"execve",
+}
+
+// only needed to run external commands
+var profileExecSyscalls = []string{
+	"execveat", "vfork", "wait4", "waitid", "setpgid", "setsid", "pidfd_open", "pidfd_send_signal",
+}
+
+func genSeccomp(w io.Writer, n *profileNeeds) error {
+	names := append([]string{}, profileSyscalls...)
+	if n.exec {
+		names = append(names, profileExecSyscalls...)
+	}
+	if n.bpf {
+		names = append(names, "bpf")
+	}
+	profile := map[string]interface{}{
+		"defaultAction": "SCMP_ACT_ERRNO",
+		"architectures": []string{"SCMP_ARCH_X86_64", "SCMP_ARCH_AARCH64"},
+		"syscalls": []map[string]interface{}{
+			{"names": uniqueStrings(names), "action": "SCMP_ACT_ALLOW"},
+		},
+	}
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
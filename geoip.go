@@ -0,0 +1,255 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// geoip updates
+// with geoip_license_key set, the GeoLite2 csv editions of country_db and asn_db are downloaded
+// from maxmind every geoip_update_interval seconds; a zip is only taken if its sha256 matches the
+// one maxmind publishes and its files load, then they replace the configured files by rename and
+// the tables in memory, so lookups never see half a database
+// the age of each database, from the build time of its file, is in stats as country_db_age and asn_db_age
+
+var (
+	cfgGeoipAccountId      string
+	cfgGeoipLicenseKey     string
+	cfgGeoipUrl            = "https://download.maxmind.com/geoip/databases"
+	cfgGeoipUpdateInterval = 86400 // seconds
+
+	geoipClient = &http.Client{Timeout: 5 * time.Minute}
+
+	// countryTable and asnTable are swapped by updates while guards look them up
+	geoLock     sync.RWMutex
+	countryDbAt int64 // build time of the loaded databases, unix seconds
+	asnDbAt     int64
+
+	geoipSums = make(map[string]string) // edition -> sha256 of the zip installed, only read by runGeoipUpdate
+)
+
+// a csv edition and where its files go
+type geoipEdition struct {
+	name  string
+	files map[string]string // file in the zip -> path it replaces
+	load  func(files map[string]string) error
+	at    *int64 // build time of the loaded database
+}
+
+func geoipEditions() []*geoipEdition {
+	var editions []*geoipEdition
+	if cfgCountryDb != "" {
+		locations := cfgCountryLocations
+		if locations == "" {
+			locations = countryLocationsFile(cfgCountryDb)
+		}
+		editions = append(editions, &geoipEdition{
+			name: "GeoLite2-Country-CSV",
+			files: map[string]string{
+				"GeoLite2-Country-Blocks-IPv4.csv":  chrootPath(cfgCountryDb),
+				"GeoLite2-Country-Locations-en.csv": chrootPath(locations),
+			},
+			load: func(files map[string]string) error {
+				return loadCountryDb(files["GeoLite2-Country-Blocks-IPv4.csv"], files["GeoLite2-Country-Locations-en.csv"])
+			},
+			at: &countryDbAt,
+		})
+	}
+	if cfgAsnDb != "" {
+		editions = append(editions, &geoipEdition{
+			name:  "GeoLite2-ASN-CSV",
+			files: map[string]string{"GeoLite2-ASN-Blocks-IPv4.csv": chrootPath(cfgAsnDb)},
+			load: func(files map[string]string) error {
+				return loadAsnDb(files["GeoLite2-ASN-Blocks-IPv4.csv"])
+			},
+			at: &asnDbAt,
+		})
+	}
+	return editions
+}
+
+// build time of a database file, its mtime as set from the zip
+func geoipFileTime(file string) int64 {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return 0
+	}
+	return fi.ModTime().Unix()
+}
+
+func geoipGet(url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(cfgGeoipAccountId, cfgGeoipLicenseKey)
+	resp, err := geoipClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// download e if maxmind has a new zip, check its sha256, load its files and put them in place
+func updateGeoipEdition(e *geoipEdition) error {
+	url := strings.TrimRight(cfgGeoipUrl, "/") + "/" + e.name + "/download?suffix=zip"
+	sumFile, err := geoipGet(url + ".sha256")
+	if err != nil {
+		return err
+	}
+	// <sha256>  GeoLite2-Country-CSV_20261013.zip
+	fields := strings.Fields(string(sumFile))
+	if len(fields) == 0 {
+		return fmt.Errorf("empty sha256 file")
+	}
+	want := strings.ToLower(fields[0])
+	if geoipSums[e.name] == want {
+		return nil
+	}
+	data, err := geoipGet(url)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("sha256 mismatch, got %s, want %s", got, want)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	tmp := make(map[string]string)
+	defer func() {
+		for _, file := range tmp {
+			os.Remove(file)
+		}
+	}()
+	for _, f := range zr.File {
+		target, ok := e.files[path.Base(f.Name)]
+		if !ok {
+			continue
+		}
+		if err := extractGeoipFile(f, target+".tmp"); err != nil {
+			return err
+		}
+		tmp[path.Base(f.Name)] = target + ".tmp"
+	}
+	for name := range e.files {
+		if _, ok := tmp[name]; !ok {
+			return fmt.Errorf("%s is not in the zip", name)
+		}
+	}
+	// loading them is the check that they parse, the tables are swapped only if they do
+	if err := e.load(tmp); err != nil {
+		return err
+	}
+	for name, file := range tmp {
+		if err := os.Rename(file, e.files[name]); err != nil {
+			return err
+		}
+		delete(tmp, name)
+	}
+	geoipSums[e.name] = want
+	return nil
+}
+
+func extractGeoipFile(f *zip.File, file string) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(file, f.Modified, f.Modified)
+}
+
+// download databases whose files don't exist yet, before they are loaded
+func fetchMissingGeoip() {
+	for _, e := range geoipEditions() {
+		missing := false
+		for _, file := range e.files {
+			if _, err := os.Stat(file); os.IsNotExist(err) {
+				missing = true
+			}
+		}
+		if !missing {
+			continue
+		}
+		if err := updateGeoipEdition(e); err != nil {
+			logMain(true, "download geoip %s failed:%s", e.name, err.Error())
+		}
+		logMain(false, "geoip %s downloaded", e.name)
+	}
+}
+
+func updateGeoip() {
+	for _, e := range geoipEditions() {
+		if err := updateGeoipEdition(e); err != nil {
+			statsAdd(&stats.geoipFailed)
+			logMain(false, "update geoip %s failed:%s", e.name, err.Error())
+			reportError("geoip", "", "update geoip %s failed:%s", e.name, err.Error())
+			continue
+		}
+		logMain(false, "geoip %s is up to date, built %s", e.name, formatLogTime(time.Unix(atomic.LoadInt64(e.at), 0)))
+	}
+}
+
+// the first update is due when the oldest database is geoip_update_interval old
+func runGeoipUpdate() {
+	interval := time.Duration(cfgGeoipUpdateInterval) * time.Second
+	oldest := time.Now()
+	for _, e := range geoipEditions() {
+		if at := time.Unix(atomic.LoadInt64(e.at), 0); at.Before(oldest) {
+			oldest = at
+		}
+	}
+	time.Sleep(time.Until(oldest.Add(interval)))
+	for {
+		updateGeoip()
+		time.Sleep(interval)
+	}
+}
+
+// seconds since the loaded databases were built, for statsGauges
+func geoipAges() []statsCounter {
+	now := time.Now().Unix()
+	var ages []statsCounter
+	if cfgCountryDb != "" {
+		ages = append(ages, statsCounter{"country_db_age", now - atomic.LoadInt64(&countryDbAt)})
+	}
+	if cfgAsnDb != "" {
+		ages = append(ages, statsCounter{"asn_db_age", now - atomic.LoadInt64(&asnDbAt)})
+	}
+	return ages
+}
@@ -6,63 +6,297 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"log/syslog"
 	"net"
 	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 )
 
 var (
-	tcpPacketTypeNull    string = "TCP NULL scan"
-	tcpPacketTypeXMAS    string = "TCP XMAS scan"
-	tcpPacketTypeSYN     string = "TCP SYN/Normal scan"
-	tcpPacketTypeUnknown string = "Unknown Type: TCP Packet Flags(FIN,SYN,RST,PSH,ACK,URG): %d"
+	tcpPacketTypeNull        string = "TCP NULL scan"
+	tcpPacketTypeXMAS        string = "TCP XMAS scan"
+	tcpPacketTypeSYN         string = "TCP SYN/Normal scan"
+	tcpPacketTypeFingerprint string = "TCP OS fingerprinting attempt"
+	tcpPacketTypeSynFlood    string = "TCP possible SYN flood"
+	tcpPacketTypeUnknown     string = "Unknown Type: TCP Packet Flags(FIN,SYN,RST,PSH,ACK,URG): %d"
 )
 
+// set at build time with -ldflags "-X main.version=1.2.3"
+var version = "dev"
+
 var (
 	mode              *string
 	debug             *bool
+	daemon            *bool
+	checkPrivs        *bool
+	selftestMode      *bool
+	dryRun            *bool
 	portCacheDuration *int64 // see smartVerify for explanation
 	serverIp          = net.ParseIP("0.0.0.0").To4()
-	sockAddr          syscall.SockaddrInet4
 	alarmLogger       *log.Logger
 	blockedLogger     *log.Logger
 	mainLogger        *log.Logger
-	checkedPortCache  map[int]int64
+	checkedPortCache  map[localPort]*cachedPort // ports found in use, until unix seconds
+	closedPortCache   map[localPort]*cachedPort // ports found closed, until unix nanoseconds
 	stateEngine       map[string][]int
+	blockedAt         map[string]int64 // when ip was blocked, see expireBlocks
+	offenses          map[string]int   // times ip was blocked, see blockDuration
+	blockTtls         map[string]int64 // seconds the block of ip lasts if a block request set it
+	stateLock         sync.Mutex       // guards share checkedPortCache and stateEngine
 )
 
 var (
-	cfgMinPort        int = 0
-	cfgMaxPort        int = 65535
-	cfgNoisyPorts     map[int]bool
-	cfgExcludePorts   map[int]bool
-	cfgIgnoreIps      []*net.IPNet
-	cfgKillRoute      string = ""
-	cfgKillRunCmd     string = ""
-	cfgKillNotifyUrl  string = ""
-	cfgScanTrigger    int    = 0
-	cfgAlarmLogPath   string
-	cfgAlarmLog       io.Writer
-	cfgBlockedLog     io.Writer
-	cfgBlockedLogPath string
+	cfgMinPort                   int = 0
+	cfgMaxPort                   int = 65535
+	cfgNoisyUdpPorts             portSet
+	cfgNoisyTcpPorts             portSet
+	cfgTrapPorts                 portSet
+	cfgDefaultNoisy              bool = true
+	cfgExcludePorts              portSet
+	cfgExcludePortLog            bool
+	cfgIgnoreIps                 []*net.IPNet
+	cfgIgnoreHostRefresh         int = 300
+	cfgIgnoreMacs                []net.HardwareAddr
+	cfgGatewayMacs               []net.HardwareAddr // only frames from these macs are inspected if set
+	cfgVlanCapture               bool
+	cfgVlans                     portSet // vlan ids inspected, all if empty
+	cfgCaptureFanout             int     = 1
+	cfgCaptureRcvbuf             int                   // bytes, 0 keeps the system default
+	cfgIgnoreLocal               string  = "addresses" // addresses, subnets or off, see localIgnoreNets
+	cfgIgnoreLocalInterfaces     []string
+	cfgIgnoreLocalRefresh        int = 30 // seconds, 0 reads local addresses only at startup
+	cfgExternalInterfaces        []string
+	cfgSpoofTtlDelta             int  = 8 // hops, 0 disables the ttl check, see spoofReasons
+	cfgBlockSpoofed              bool = true
+	cfgListenBaseline            bool
+	cfgListenBaselineInterval    int = 60
+	cfgListenBaselineAllow       portSet
+	cfgEvidenceDir               string
+	cfgEvidenceRing              int = 16
+	cfgEvidenceHosts             int = 4096
+	cfgEvidenceMaxFiles          int = 64
+	cfgEvidenceMaxSize           int = 1024 // KB
+	cfgEvidenceDuration          int = 600
+	cfgCmdTimeout                int = 30
+	cfgResponderWorkers          int = 4
+	cfgResponderQueue            int = 1000
+	cfgHealthAddr                string
+	cfgHealthMaxIdle             int
+	cfgHealthMaxResponderFailure int = 50
+	cfgTraceDuration             int = 60
+	cfgClusterListen             string
+	cfgClusterPeers              []string
+	cfgClusterKey                string
+	cfgClusterNode               string
+	cfgClusterSyncInterval       int = 300
+	cfgKvBackend                 string
+	cfgKvUrl                     string
+	cfgKvPrefix                  string = "portguard/"
+	cfgKvToken                   string
+	cfgKvPoll                    int = 10
+	cfgBlocklistAddr             string
+	cfgBlocklistFile             string
+	cfgBlocklistFormat           string   = "plain"
+	cfgBlocklistInterval         int      = 60
+	cfgBlocklistName             string   = "portguard_blocked"
+	cfgBlocklistNextHop          string   = "192.0.2.1"
+	cfgBlocklistCommunity        string   = "65535:666"
+	cfgKillRoute                 []string // repeated, run in order
+	cfgKillRunCmd                []string
+	cfgKillRouteUndo             []string // run in order when a block is lifted
+	cfgKillRunCmdUndo            []string
+	cfgKillNotifyUrl             string = ""
+	cfgScanTrigger               int    = 0
+	cfgMaxTrackedIps             int    = 0
+	cfgPortCacheDuration         int64  = 120
+	cfgPortCacheMax              int    = 4096
+	cfgClosedPortCacheMs         int64  = 1000
+	cfgAlarmLogPath              string
+	cfgAlarmLog                  io.Writer
+	cfgBlockedLog                io.Writer
+	cfgBlockedLogPath            string
+	cfgAuditLog                  io.Writer
+	cfgAuditLogPath              string
+	cfgInterfaces                []string
+	cfgCaptureBuffer             int  // 0 sizes it from interface mtu, see captureBufferSize
+	cfgChecksumCheck             bool = true
+	cfgCaptureErrorLimit         int  = 10 // read errors in a row before a capture is reopened, 0 never
+	cfgCaptureStallTimeout       int       // seconds without a packet before a capture is reopened, 0 never
+	cfgOpsAlertUrl               string
+	cfgFingerprintProbes         int = 3 // 0 disables os fingerprinting detection
+	cfgFingerprintWindow         int = 60
+	cfgFingerprintBlock          bool
+
+	cfgSynFloodSourceRate    int // syns per second from one host to open ports, 0 disables it
+	cfgSynFloodTotalRate     int // syns per second from all hosts to open ports, 0 disables it
+	cfgSynFloodCooldown      int = 60
+	cfgSynFloodBlock         bool
+	cfgListenIps             []net.IP
+	cfgPortWeights           map[int]int
+	cfgStateFile             string
+	cfgEventDb               string
+	cfgControlSocket         string
+	cfgEventDbRetention      int = 90
+	cfgShutdownTimeout       int = 10
+	cfgPidFile               string
+	cfgRunAsUser             string
+	cfgRunAsGroup            string
+	cfgSeccomp               string = "off"
+	cfgChrootDir             string
+	cfgJournald              bool
+	cfgChrootExec            bool
+	cfgWindowsFirewall       bool
+	cfgPfTable               string
+	cfgNftSet                string
+	cfgIpset                 string
+	cfgFirewallBatchInterval int = 200
+	cfgXdpInterfaces         []string
+	cfgXdpMode               string = "auto"
+	cfgXdpMapPin             string = "/sys/fs/bpf/portguard_blocked"
+	cfgXdpMaxEntries         int    = 65536
+	cfgBlackholeRoute        string
+	cfgBlackholeRouteTable   int = 254
+	cfgConntrackFlush        bool
+	cfgNflogGroup            int = -1 // off
+	cfgNfqueue               int = -1 // off
+	cfgNfqueueScore          int      // 0 for the block threshold
+	cfgActiveResponse        bool
+	cfgActiveResponseRate    int = 100
+	cfgFirewallBatchMax      int = 1000
+	cfgPfTableExpire         int
+	cfgFirewalldZone         string
+	cfgFirewalldIPSet        string
+	cfgFirewalldPerm         bool
+	cfgBlockDuration         int
+	cfgBlockDurationMax      int
+	cfgAwsNaclId             string
+	cfgAwsRegion             string
+	cfgAwsNaclRuleStart      int = 1
+	cfgAwsNaclRuleCount      int = 18
 )
 
-func init() {
-	copy(sockAddr.Addr[:], serverIp[:])
-	cfgNoisyPorts = make(map[int]bool)
-	cfgExcludePorts = make(map[int]bool)
+var cfgStatsInterval int
+
+var (
+	cfgStatsdAddr     string
+	cfgStatsdPrefix   string = "portguard."
+	cfgStatsdTags     []string
+	cfgStatsdInterval int = 10
+)
+
+var (
+	cfgSnmpTrap          string
+	cfgSnmpVersion       string = "2c"
+	cfgSnmpCommunity     string = "public"
+	cfgSnmpUser          string
+	cfgSnmpAuthProtocol  string = "sha"
+	cfgSnmpAuthPassword  string
+	cfgSnmpPrivPassword  string
+	cfgSnmpEngineId      string
+	cfgSnmpEnterpriseOid string = "1.3.6.1.4.1.32473.1"
+	cfgSnmpTrapAlarms    bool
+)
+
+var (
+	cfgIpfixCollector    string
+	cfgIpfixEnterpriseId int = 32473
+	cfgIpfixDomainId     int
+)
+
+var (
+	cfgOtlpEndpoint string
+	cfgOtlpHeaders  []string
+	cfgOtlpInterval int = 60
+)
+
+var (
+	cfgDigestInterval  int
+	cfgDigestLog       io.Writer
+	cfgDigestLogPath   string
+	cfgEventLog        string
+	cfgEventLogMaxSize int = 100 // MB, 0 never rotates
+	cfgEventLogKeep    int = 5
+	cfgDigestUrl       string
+)
+
+var (
+	cfgAlarmSuppressAfter  int
+	cfgAlarmSuppressWindow int = 60
+	cfgAlarmRateLimit      int // alarm lines per source and minute, 0 for no limit
+)
+
+var cfgPlugins []*pluginResponder
+
+var (
+	cfgReputationUrl       string
+	cfgReputationHeaders   []string
+	cfgReputationField     string = "classification"
+	cfgReputationTtl       int    = 86400
+	cfgReputationBenign           = make(map[string]bool)
+	cfgReputationMalicious        = make(map[string]bool)
+	cfgReputationBlock     bool
+	cfgReputationWeight    int
+)
+
+var (
+	cfgCountryDb         string
+	cfgCountryLocations  string
+	cfgCountryBlock      = make(map[string]bool)
+	cfgCountryNeverBlock = make(map[string]bool)
+)
+
+var (
+	cfgAsnDb         string
+	cfgAsnBlock      = make(map[int]bool)
+	cfgAsnNeverBlock = make(map[int]bool)
+)
+
+var (
+	cfgScoring      string = scoringPorts
+	cfgBlockScore   int
+	cfgRateInterval int = 1000 // milliseconds
+	cfgRateWeight   int
+)
+
+var (
+	cfgPolicyCmd     string
+	cfgPolicyTimeout int = 200 // milliseconds
+)
+
+var (
+	cfgAction            string = "block" // block or log_only
+	cfgCloudflareToken   string
+	cfgCloudflareZone    string
+	cfgCloudflareAccount string
+)
+
+// a port on a local address of a network namespace, empty for portguard's own, see smartVerify
+type localPort struct {
+	addr  [4]byte
+	port  int
+	netns string
+}
 
-	checkedPortCache = make(map[int]int64)
+func init() {
+	cfgPortWeights = make(map[int]int)
+	checkedPortCache = make(map[localPort]*cachedPort)
+	closedPortCache = make(map[localPort]*cachedPort)
 	stateEngine = make(map[string][]int)
+	blockedAt = make(map[string]int64)
+	offenses = make(map[string]int)
+	blockTtls = make(map[string]int64)
 }
 
 func createLogger(extra io.Writer) *log.Logger {
@@ -76,7 +310,7 @@ func createLogger(extra io.Writer) *log.Logger {
 	}
 
 	if len(writers) > 0 {
-		return log.New(io.MultiWriter(writers...), "", log.Ldate|log.Lmicroseconds)
+		return newLogger(io.MultiWriter(writers...))
 	} else {
 		return nil
 	}
@@ -84,7 +318,20 @@ func createLogger(extra io.Writer) *log.Logger {
 }
 
 func logAlarm(format string, a ...interface{}) {
-	if alarmLogger == nil {
+	logAlarmAt(severityWarning, format, a...)
+}
+
+// log an alarm of severity level, if alarm_log takes it
+func logAlarmAt(level string, format string, a ...interface{}) {
+	if alarmLogger == nil || !sinkWants("alarm_log", level) {
+		return
+	}
+	alarmLogger.Printf(format, a...)
+}
+
+// log an alarm line of host ip, unless ip used up its alarm_rate_limit
+func logHostAlarm(level string, ip string, format string, a ...interface{}) {
+	if alarmLogger == nil || !sinkWants("alarm_log", level) || !allowSourceAlarm(ip) {
 		return
 	}
 	alarmLogger.Printf(format, a...)
@@ -108,48 +355,110 @@ func logMain(exit bool, format string, a ...interface{}) {
 	}
 }
 
-// if port is in used
-// net.Listen will auto set SO_REUSEADDR when listen a port
-func smartVerifyPort(port int) bool {
-	stype := syscall.SOCK_STREAM
-	if *mode == "udp" {
-		stype = syscall.SOCK_DGRAM
+// checks if a port is in use, replaced when replaying a capture, see fake.go
+var verifier portVerifier = bindVerifier{}
+
+// use socket and bind api to check port is very expensive
+// if port is in use, we assume it'll be used as long as *port_cache_duration* seconds
+// so we cache the result; a closed port is assumed closed for only *port_closed_cache_ms*
+// milliseconds, long enough for a sweep hitting it again, short enough not to miss a new service
+// a guard in a network namespace calls it on its thread in the namespace, see netns
+func smartVerify(laddr net.IP, port int, netns string) bool {
+	statsAdd(&stats.verifies)
+	if cfgContainerNetworks == containerProtect && isPublishedPort(port) {
+		logDebug("port %s:%d is a published container port", laddr, port)
+		return true
 	}
-	fd, err := syscall.Socket(syscall.AF_INET, stype, 0)
-	if err != nil {
-		return false
+	if cfgPortCacheDuration <= 0 && cfgClosedPortCacheMs <= 0 {
+		return verifier.PortInUse(laddr, port)
 	}
-	sockAddr.Port = port
-	err = syscall.Bind(fd, &sockAddr)
-	syscall.Close(fd)
-	if err != nil {
-		return true
+
+	key := localPort{port: port, netns: netns}
+	copy(key.addr[:], laddr.To4())
+	now := time.Now()
+	timestamp := now.Unix()
+	stateLock.Lock()
+	if c, ok := closedPortCache[key]; ok {
+		if c.expire > now.UnixNano() {
+			c.used = now.UnixNano()
+			stateLock.Unlock()
+			statsAdd(&stats.closedHits)
+			logDebug("port %s:%d is closed, cache hit", laddr, port)
+			return false
+		}
+		delete(closedPortCache, key)
 	}
-	return false
+	if c, ok := checkedPortCache[key]; ok {
+		if c.expire > timestamp {
+			c.used = now.UnixNano()
+			stateLock.Unlock()
+			statsAdd(&stats.cacheHits)
+			logDebug("port %s:%d is open, cache hit", laddr, port)
+			return true
+		} else {
+			delete(checkedPortCache, key)
+		}
+	}
+	stateLock.Unlock()
+
+	statsAdd(&stats.cacheMisses)
+	ok := verifier.PortInUse(laddr, port)
+	if !ok && cfgClosedPortCacheMs > 0 {
+		stateLock.Lock()
+		if cfgPortCacheMax > 0 && len(closedPortCache) >= cfgPortCacheMax {
+			sweepClosedPortCache(now.UnixNano())
+			evictPortCache("closed port cache", closedPortCache)
+		}
+		if cfgPortCacheMax <= 0 || len(closedPortCache) < cfgPortCacheMax {
+			closedPortCache[key] = &cachedPort{now.UnixNano() + cfgClosedPortCacheMs*int64(time.Millisecond), now.UnixNano()}
+		}
+		stateLock.Unlock()
+	}
+	if ok && cfgPortCacheDuration > 0 {
+		stateLock.Lock()
+		if cfgPortCacheMax > 0 && len(checkedPortCache) >= cfgPortCacheMax {
+			sweepPortCache(timestamp)
+			evictPortCache("port cache", checkedPortCache)
+		}
+		// still full, the port is checked again next time
+		if cfgPortCacheMax <= 0 || len(checkedPortCache) < cfgPortCacheMax {
+			checkedPortCache[key] = &cachedPort{timestamp + cfgPortCacheDuration, now.UnixNano()}
+		}
+		stateLock.Unlock()
+	}
+	return ok
 }
 
-// use socket and bind api to check port is very expensive
-// if port is in use, we assume it'll be used as long as *portCacheDuration* seconds
-// so we cache the result
-func smartVerify(port int) bool {
-	if *portCacheDuration <= 0 {
-		return smartVerifyPort(port)
+// drop expired entries of checkedPortCache, stateLock must be held
+func sweepPortCache(now int64) {
+	for key, c := range checkedPortCache {
+		if c.expire <= now {
+			delete(checkedPortCache, key)
+		}
 	}
+}
 
-	timestamp := time.Now().Unix()
-	if expire, ok := checkedPortCache[port]; ok {
-		if expire > timestamp {
-			return true
-		} else {
-			delete(checkedPortCache, port)
+// drop expired entries of closedPortCache, stateLock must be held
+func sweepClosedPortCache(now int64) {
+	for key, c := range closedPortCache {
+		if c.expire <= now {
+			delete(closedPortCache, key)
 		}
 	}
+}
 
-	ok := smartVerifyPort(port)
-	if ok {
-		checkedPortCache[port] = timestamp + *portCacheDuration
+func runPortCacheSweep() {
+	interval := time.Duration(cfgPortCacheDuration) * time.Second
+	if interval <= 0 || interval > time.Minute {
+		interval = time.Minute
+	}
+	for range time.Tick(interval) {
+		now := time.Now()
+		stateLock.Lock()
+		sweepPortCache(now.Unix())
+		sweepClosedPortCache(now.UnixNano())
+		stateLock.Unlock()
 	}
-	return ok
 }
 
 func isExlcudePort(port int) bool {
@@ -158,60 +467,214 @@ func isExlcudePort(port int) bool {
 		return true
 	}
 
-	_, ok := cfgExcludePorts[port]
-	return ok
+	return cfgExcludePorts.Contains(port)
 }
 
 func isIgnoredIP(ip net.IP) bool {
-	if cfgIgnoreIps == nil {
-		return false
-	}
 	for _, n := range cfgIgnoreIps {
 		if n.Contains(ip) {
 			return true
 		}
 	}
-	return false
+	return isLocalIgnored(ip) || len(ignoreHosts) > 0 && isIgnoredHost(ip) || len(cfgIgnoreUrls) > 0 && isUrlIgnored(ip) ||
+		kvStore != nil && isKvIgnored(ip) || isTrusted(ip)
 }
 
-// cfgScanTrigger + 2 times scan
-func isBlockedIP(ip string) bool {
-	ports, ok := stateEngine[ip]
-	if !ok {
-		return false
+// how much a probe to port counts toward scan_trigger, 1 by default
+func portWeight(port int) int {
+	if w, ok := cfgPortWeights[port]; ok {
+		return w
 	}
+	return 1
+}
+
+// sum of port weights, equal to count of ports if no port_weight configured
+func stateWeight(ports []int) int {
+	weight := 0
+	for _, port := range ports {
+		weight += portWeight(port)
+	}
+	return weight
+}
 
-	if len(ports) > cfgScanTrigger {
+// blocked, or score reached the block threshold, see scoring
+func isBlockedIP(ip string) bool {
+	return isBlockedAt(ip, blockThreshold())
+}
+
+// blocked, or score reached sz, the block threshold of an interface profile
+func isBlockedAt(ip string, sz int) bool {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	if _, ok := blockedAt[ip]; ok {
 		return true
 	}
-	return false
+	if _, ok := stateEngine[ip]; !ok {
+		return false
+	}
+	return hostScore(ip) >= sz
 }
 
-// true if trigger blocked
-func checkStateEngine(ip string, port int) bool {
+// true if trigger blocked, sz is the block threshold
+func checkStateEngine(ip string, port int, scanType string, sz int) bool {
+	stateLock.Lock()
+	defer stateLock.Unlock()
 	ports, ok := stateEngine[ip]
-	sz := cfgScanTrigger + 1
 	if !ok {
-		ports = make([]int, sz)[:0]
+		ports = make([]int, cfgScanTrigger+1)[:0]
 	}
-	if len(ports) >= sz {
+	if ok && hostScore(ip) >= sz {
 		return true
 	}
 
 	for _, v := range ports {
 		if v == port {
+			touchTracked(ip)
 			return false
 		}
 	}
 
 	ports = append(ports, port)
 	stateEngine[ip] = ports
-	if len(ports) >= sz {
+	touchTracked(ip)
+	addScore(ip, port, scanType)
+	if hostScore(ip) >= sz || scanTypeTriggered(ip, scanType) {
+		markBlocked(ip)
 		return true
 	}
 	return false
 }
 
+// record a block of ip, stateLock must be held
+func markBlocked(ip string) {
+	blockedAt[ip] = time.Now().Unix()
+	offenses[ip]++
+}
+
+// take back the block of ip its responders never ran for, its next probe blocks it again
+func unmarkBlocked(ip string) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	delete(blockedAt, ip)
+	delete(blockTtls, ip)
+	if offenses[ip]--; offenses[ip] <= 0 {
+		delete(offenses, ip)
+	}
+}
+
+// seconds the offense-th block of a host lasts, from block_duration of the active profile
+// doubled for every repeated offense, up to block_duration_max
+func blockDuration(offense int) int64 {
+	d := int64(cfgBlockDuration)
+	if p := currentProfile(); p != nil && p.blockDuration > 0 {
+		d = int64(p.blockDuration)
+	}
+	base := d
+	max := int64(cfgBlockDurationMax)
+	for i := 1; i < offense && d < max; i++ {
+		d *= 2
+	}
+	if max > base && d > max {
+		d = max
+	}
+	return d
+}
+
+// seconds the current block of ip lasts, 0 for ever; stateLock must be held
+func hostBlockDuration(ip string) int64 {
+	if ttl, ok := blockTtls[ip]; ok {
+		return ttl
+	}
+	return blockDuration(offenses[ip])
+}
+
+// times ip was blocked
+func offenseCount(ip string) int {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	return offenses[ip]
+}
+
+// distinct ports ip has probed, when it first probed one and its score
+func probeHistory(ip string) (ports []int, first time.Time, score int) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	if at, ok := firstProbe[ip]; ok {
+		first = time.Unix(0, at)
+	}
+	return append([]int(nil), stateEngine[ip]...), first, hostScore(ip)
+}
+
+// block ip regardless of its weight, false if it's blocked already
+func forceBlock(ip string, port int, scanType string) bool {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	if _, ok := blockedAt[ip]; ok {
+		return false
+	}
+	ports := stateEngine[ip]
+	for _, v := range ports {
+		if v == port {
+			markBlocked(ip)
+			return true
+		}
+	}
+	stateEngine[ip] = append(ports, port)
+	touchTracked(ip)
+	addScore(ip, port, scanType)
+	markBlocked(ip)
+	return true
+}
+
+// forget hosts blocked longer than their block duration and undo their blocks
+func expireBlocks() {
+	now := time.Now().Unix()
+	var expired []string
+	stateLock.Lock()
+	for ip, at := range blockedAt {
+		if d := hostBlockDuration(ip); d > 0 && at+d <= now {
+			expired = append(expired, ip)
+			delete(blockedAt, ip)
+			forgetTracked(ip)
+		}
+	}
+	stateLock.Unlock()
+
+	for _, ip := range expired {
+		reportUnblock(true)
+		logBlocked("Host: %s Unblocked", ip)
+		runUnblockers(ip)
+		kvExpire(ip)
+	}
+}
+
+// lift the block of ip before it expires, false if it isn't blocked
+func unblockHost(ip string, reason string) bool {
+	stateLock.Lock()
+	_, ok := blockedAt[ip]
+	if ok {
+		delete(blockedAt, ip)
+		forgetTracked(ip)
+	}
+	stateLock.Unlock()
+	if ok {
+		reportUnblock(false)
+		logBlocked("Host: %s Unblocked, %s", ip, reason)
+		runUnblockers(ip)
+	}
+	return ok
+}
+
+func runBlockExpiry() {
+	interval := time.Duration(cfgBlockDuration) * time.Second
+	if interval <= 0 || interval > time.Minute {
+		interval = time.Minute
+	}
+	for range time.Tick(interval) {
+		expireBlocks()
+	}
+}
+
 func reportPacketType(flags uint8) *string {
 	if flags == 0 {
 		return &tcpPacketTypeNull
@@ -225,47 +688,255 @@ func reportPacketType(flags uint8) *string {
 	}
 }
 
-func runExternalCommand(ip string, port int) {
-	if cfgKillRoute == "" && cfgKillRunCmd == "" && cfgKillNotifyUrl == "" {
+// log a probe of a closed excluded port to the alarm log, it never counts toward a block
+// probes of excluded ports in use, and of ignored or blocked hosts, aren't logged
+func logExcludedProbe(proto string, scanType string, laddr net.IP, ip net.IP, dst net.IP, port int, prof *ifaceProfile) {
+	if isIgnoredIP(ip) || isBlockedIP(ip.String()) || probedPortInUse(laddr, dst, port, prof) {
 		return
 	}
-	go func(ip string, port int) {
-		if cfgKillRoute != "" {
-			if err := runCmd(cfgKillRoute, *mode, ip, port); err != nil {
-				logMain(false, "run kill_route:%s, host:%s:%d failed:%s", cfgKillRoute, ip, port, err.Error())
-			}
+	logHostAlarm(severityWarning, ip.String(), "attackalert: %s from host: %s to %s excluded port: %d", scanType, ip, proto, port)
+}
+
+// run a packet to a closed port through filters and stateEngine
+// proto is TCP or UDP, scanType describes the probe, flags are tcp flags, laddr is where the guard listens
+// hdr is the ipv4 header of the packet
+// payload is the class of a udp probe's payload, empty for tcp
+// prof holds the settings of the guard's interface, see interface profiles
+func inspectPacket(proto string, scanType string, flags uint8, laddr net.IP, hdr *IPv4Header, port int, payload string, vlan int, prof *ifaceProfile) {
+	ip := hdr.Source
+	ipString := ip.String()
+	trap := cfgTrapPorts.Contains(port)
+
+	// is exclude port
+	if !trap && prof.isExcludePort(port) {
+		statsAdd(&stats.excluded)
+		probeDecision(proto, ip, port, "excluded")
+		if cfgExcludePortLog {
+			logExcludedProbe(proto, scanType, laddr, ip, hdr.Destination, port, prof)
 		}
+		return
+	}
 
-		if cfgKillRunCmd != "" {
-			if err := runCmd(cfgKillRunCmd, *mode, ip, port); err != nil {
-				logMain(false, "run kill_run_cmd:%s, host:%s:%d failed:%s", cfgKillRunCmd, ip, port, err.Error())
-			}
+	// check ignore ip
+	if isIgnoredIP(ip) {
+		statsAdd(&stats.ignored)
+		probeDecision(proto, ip, port, "ignored")
+		return
+	}
+
+	// spoofed from a bogon, kept out of stateEngine
+	if cfgBogonFilter == bogonDrop && isBogon(ip) {
+		statsAdd(&stats.bogons)
+		probeDecision(proto, ip, port, "bogon source")
+		return
+	}
+
+	// if blocked before
+	if isBlockedAt(ipString, prof.blockThreshold()) {
+		statsAdd(&stats.blocked)
+		probeDecision(proto, ip, port, "already blocked")
+		return
+	}
+
+	// verify port usage, trap ports are unused by definition
+	if !trap && probedPortInUse(laddr, hdr.Destination, port, prof) {
+		statsAdd(&stats.openPorts)
+		probeDecision(proto, ip, port, "open")
+		if proto == "TCP" && flags == SYN {
+			countSyn(hdr, laddr, port)
 		}
+		return
+	}
 
-		if cfgKillNotifyUrl != "" {
-			if err := requestUrl(cfgKillNotifyUrl, *mode, ip, port); err != nil {
-				logMain(false, "notify kill_notify_url:%s, host:%s:%d failed:%s", cfgKillNotifyUrl, ip, port, err.Error())
-			}
+	noteAnomaly(ipString, port)
+	ev := &event{Time: time.Now(), Kind: eventAlarm, Host: ipString, Port: port, Proto: proto, ScanType: scanType, Flags: flags, TTL: hdr.TTL, Payload: payload, Laddr: laddr, Trap: trap, VLAN: vlan, Iface: prof.iface}
+	if prof.mirror() {
+		// the probed host of the segment
+		ev.Laddr = hdr.Destination
+	}
+	ev.Spoof = spoofReasons(hdr)
+	raiseAlarm(ip, hdr.Destination, ev, prof)
+}
+
+// run alarm ev of a probe from ip to our address dst through policy, log it and block or escalate the host
+// trap alarms block at once; ev.TTL is 0 if the probe's ttl is unknown
+func raiseAlarm(ip net.IP, dst net.IP, ev *event, prof *ifaceProfile) {
+	ipString, proto, port, scanType, trap := ev.Host, ev.Proto, ev.Port, ev.ScanType, ev.Trap
+	if proto == protoArp {
+		ev.Pattern = patternSweep // of the local segment
+	} else {
+		ev.Pattern = scanPattern(ev, dst)
+	}
+	ev.ASN, ev.ASOrg = lookupAsn(ip)
+	ev.Country = lookupCountry(ip)
+	ev.Reputation = reputationOf(ipString)
+	policy := askPolicy(ev)
+	if policy.Decision == policyDefault {
+		policy.Decision = listPolicy(ev)
+	}
+	if policy.Decision == policyIgnore {
+		statsAdd(&stats.policyIgnored)
+		probeDecision(proto, ip, port, "ignored by policy")
+		return
+	}
+	probeDecision(proto, ip, port, "alarm, policy:"+policy.Decision)
+
+	statsAdd(&stats.alarms)
+	if ev.Spoof != "" {
+		statsAdd(&stats.spoofed)
+	}
+	if scanType == udpPacketTypeAmplification {
+		statsAdd(&stats.amplification)
+	}
+	emitEvent(ev)
+	if ev.Capture != "" {
+		logHostAlarm(severityCritical, ipString, "attackalert: %s from host: %s to %s honeypot port: %d, sent: %s%s%s", scanType, ipString, proto, port, ev.Capture, ev.probe(), ev.origin())
+	} else if trap {
+		logHostAlarm(severityCritical, ipString, "attackalert: %s from host: %s to %s trap port: %d%s%s", scanType, ipString, proto, port, ev.probe(), ev.origin())
+	} else if proto == protoArp {
+		logHostAlarm(severityWarning, ipString, "attackalert: %s from host: %s, %s%s%s", scanType, ipString, ev.Message, ev.probe(), ev.origin())
+	} else if allowAlarm(ipString, scanType) {
+		logHostAlarm(severityWarning, ipString, "attackalert: %s from host: %s to %s port: %d%s%s", scanType, ipString, proto, port, ev.probe(), ev.origin())
+	}
+
+	var blocked bool
+	var stage int
+	switch {
+	case policy.Decision == policyAlarm:
+	case prof.alarmOnly && policy.Decision != policyBlock:
+		tracePacket(proto, ip, port, "not blocked, interface "+prof.iface+" only alarms")
+	case ev.Spoof != "" && !cfgBlockSpoofed:
+		tracePacket(proto, ip, port, "not blocked, source looks spoofed")
+	case trap:
+		statsAdd(&stats.traps)
+		blocked = forceBlock(ipString, port, scanType)
+		ev.Responders = policy.Responders
+	case policy.Decision == policyBlock:
+		blocked = forceBlock(ipString, port, scanType)
+		ev.Responders = policy.Responders
+	default:
+		if blocked = checkStateEngine(ipString, port, scanType, prof.blockThreshold()); !blocked {
+			stage = escalateStage(ipString)
 		}
-	}(ip, port)
+	}
+	if ev.TTL != 0 {
+		noteHops(ipString, ev.TTL)
+	}
+	if blocked && len(ev.Responders) == 0 {
+		ev.Responders = prof.responders
+	}
+	if blocked {
+		reportBlock(ev)
+	} else if stage > 0 {
+		reportStage(ev, stage)
+	}
 }
 
-// tcp guard
-func tcpGuard() {
-	conn, err := net.ListenIP("ip4:tcp", &net.IPAddr{IP: serverIp})
-	if err != nil {
-		logMain(true, err.Error())
+// set what led to the host's block or escalation, up to the alarm ev was made from
+func (ev *event) fillHistory() {
+	ev.Ports, ev.FirstSeen, ev.Score = probeHistory(ev.Host)
+	ev.LastSeen = ev.Time
+	if ev.FirstSeen.After(ev.LastSeen) {
+		ev.FirstSeen = ev.LastSeen
+	}
+	ev.Alarms = len(ev.Ports)
+}
+
+// log a block of the host of alarm ev and run responders
+func reportBlock(ev *event) {
+	offense := offenseCount(ev.Host)
+	statsAdd(&stats.blocks)
+	block := *ev
+	block.Kind = eventBlock
+	block.fillHistory()
+	block.Offense = offense
+	block.Responders = wantedResponders(&block)
+	block.Evidence = startEvidence(ev.Host)
+	if offense > 1 {
+		logBlocked("Host: %s Port: %d %s Blocked, offense: %d%s%s", ev.Host, ev.Port, ev.Proto, offense, block.history(), ev.origin())
+	} else {
+		logBlocked("Host: %s Port: %d %s Blocked%s%s", ev.Host, ev.Port, ev.Proto, block.history(), ev.origin())
+	}
+	emitEvent(&block)
+	fail2banHistory(&block)
+	if !runResponders(&block) {
+		unmarkBlocked(ev.Host)
+		return
+	}
+	clusterAnnounce(&block)
+	kvAnnounce(&block)
+}
+
+// parse the ipv4 header of packet, false if it's not a first fragment of proto
+// with at least minLen bytes of transport header and a right checksum
+// loopback packets aren't checksummed by the kernel, nor are reads cut short checkable
+func decodeIPv4(packet []byte, proto uint8, minLen int, ip *IPv4Header) bool {
+	if NewIPv4Header(packet, ip) != nil || ip.Protocol != proto {
+		statsAdd(&stats.malformed)
+		tracePacket("", nil, 0, "malformed ip header")
+		return false
+	}
+	if ip.IsFragment() {
+		statsAdd(&stats.fragments)
+		tracePacket("", ip.Source, 0, "fragment")
+		return false
+	}
+	if len(ip.Payload(packet)) < minLen {
+		statsAdd(&stats.malformed)
+		tracePacket("", ip.Source, 0, "short transport header")
+		return false
 	}
+	if cfgChecksumCheck && !ip.Destination.IsLoopback() && int(ip.TotalLen) <= len(packet) &&
+		!ip.ValidChecksum(ip.Payload(packet)) {
+		statsAdd(&stats.badChecksum)
+		tracePacket("", ip.Source, 0, "bad checksum")
+		return false
+	}
+	return true
+}
 
-	b := make([]byte, 1024)
+// tcp guard, iface is the interface it captures on, empty for all of them
+func tcpGuard(conn packetConn, laddr net.IP, iface string) {
+	prof := profileFor(iface)
+	mirror := prof.mirror()
+	b := make([]byte, cfgCaptureBuffer)
+	var ip IPv4Header
 	var tcp TCPHeader
+	var seq uint64
+	hb := newHeartbeat()
 	for {
-		numRead, remoteAddr, err := conn.ReadFromIP(b)
+		keepAlive(conn, hb)
+		numRead, err := conn.ReadPacket(b)
 		if err != nil {
-			logMain(false, "read from ip:%s", err.Error())
+			if isShutdown() || err == io.EOF {
+				return
+			}
+			if isTimeout(err) {
+				continue
+			}
+			noteReadError(err)
+			continue
+		}
+		notePacket()
+		if skipSampled(&seq) {
+			continue
+		}
+		if isTruncated(numRead, b) {
+			noteTruncated("TCP", numRead, b)
+		}
+		if !decodeIPv4(b[:numRead], protoTCP, 20, &ip) {
+			continue
+		}
+		recordEvidence(&ip, b[:numRead])
+		if NewTCPHeader(ip.Payload(b[:numRead]), &tcp) != nil {
+			statsAdd(&stats.malformed)
+			tracePacket("TCP", ip.Source, 0, "malformed tcp header")
 			continue
 		}
-		NewTCPHeader(b[:numRead], &tcp)
+		if mirror && !mirrorPacket(&ip, int(tcp.Source), tcp.Ctrl) {
+			continue
+		}
+		checkFingerprint(&ip, &tcp, laddr)
 		/*nmap: Page 65 of RFC 793 says that “if the [destination] port state is
 		CLOSED .... an incoming segment not containing a RST causes a RST to be
 		sent in response.”  Then the next page discusses packets sent to open
@@ -273,98 +944,87 @@ func tcpGuard() {
 		unlikely to get here, but if you do, drop the segment, and return.”
 		*/
 		if tcp.HasFlag(RST) || tcp.HasFlag(ACK) {
+			tracePacket("TCP", ip.Source, int(tcp.Destination), "rst or ack")
 			continue
 		}
 
-		port := int(tcp.Destination)
-		ip := remoteAddr.IP
-		ipString := ip.String()
-
-		// is exclude port
-		if isExlcudePort(port) {
-			continue
-		}
-
-		// check ignore ip
-		if isIgnoredIP(ip) {
-			continue
-		}
-
-		// if blocked before
-		if isBlockedIP(ipString) {
-			continue
+		if activeSend != nil && !mirror {
+			activeRespond(&ip, &tcp, b[:numRead])
 		}
 
-		// verify port usage
-		if smartVerify(port) {
+		// ignore noisy port
+		if cfgNoisyTcpPorts.Contains(int(tcp.Destination)) {
+			statsAdd(&stats.noisy)
+			tracePacket("TCP", ip.Source, int(tcp.Destination), "noisy")
+			noisyProbe("TCP", *reportPacketType(tcp.Ctrl), tcp.Ctrl, laddr, &ip, int(tcp.Destination), lastVlan(conn), iface)
 			continue
 		}
 
-		logAlarm("attackalert: %s from host: %s to TCP port: %d",
-			*reportPacketType(tcp.Ctrl), ipString, port)
-		if checkStateEngine(ipString, port) {
-			logBlocked("Host: %s Port: %d TCP Blocked", ipString, port)
-			// run extern command
-			runExternalCommand(ipString, port)
-		}
+		inspectPacket("TCP", *reportPacketType(tcp.Ctrl), tcp.Ctrl, laddr, &ip, int(tcp.Destination), "", lastVlan(conn), prof)
 	}
 }
 
-func udpGuard() {
-	conn, err := net.ListenIP("ip4:udp", &net.IPAddr{IP: serverIp})
-	if err != nil {
-		logMain(true, err.Error())
-	}
-
-	b := make([]byte, 1024)
+func udpGuard(conn packetConn, laddr net.IP, iface string) {
+	prof := profileFor(iface)
+	mirror := prof.mirror()
+	b := make([]byte, cfgCaptureBuffer)
+	var ip IPv4Header
 	var udp UDPHeader
+	var seq uint64
+	hb := newHeartbeat()
 	for {
-		numRead, remoteAddr, err := conn.ReadFromIP(b)
+		keepAlive(conn, hb)
+		numRead, err := conn.ReadPacket(b)
 		if err != nil {
-			logMain(false, "read from ip:%s", err.Error())
+			if isShutdown() || err == io.EOF {
+				return
+			}
+			if isTimeout(err) {
+				continue
+			}
+			noteReadError(err)
 			continue
 		}
-		NewUDPHeader(b[:numRead], &udp)
-		port := int(udp.Destination)
-
-		// ignore noisy port
-		if _, ok := cfgNoisyPorts[port]; ok {
+		notePacket()
+		if skipSampled(&seq) {
 			continue
 		}
-
-		log.Printf("%v: %d->%d", remoteAddr, udp.Source, udp.Destination)
-		ip := remoteAddr.IP
-		ipString := ip.String()
-
-		// is exclude port
-		if isExlcudePort(port) {
+		if isTruncated(numRead, b) {
+			noteTruncated("UDP", numRead, b)
+		}
+		if !decodeIPv4(b[:numRead], protoUDP, 8, &ip) {
 			continue
 		}
-
-		// check ignore ip
-		if isIgnoredIP(ip) {
+		recordEvidence(&ip, b[:numRead])
+		if NewUDPHeader(ip.Payload(b[:numRead]), &udp) != nil {
+			statsAdd(&stats.malformed)
+			tracePacket("UDP", ip.Source, 0, "malformed udp header")
 			continue
 		}
-
-		// if blocked before
-		if isBlockedIP(ipString) {
+		port := int(udp.Destination)
+		if mirror && !mirrorPacket(&ip, int(udp.Source), 0) {
 			continue
 		}
+		if activeSend != nil && !mirror {
+			activeRespond(&ip, nil, b[:numRead])
+		}
 
-		// verify port usage
-		if smartVerify(port) {
+		// ignore noisy port
+		if cfgNoisyUdpPorts.Contains(port) {
+			statsAdd(&stats.noisy)
+			tracePacket("UDP", ip.Source, port, "noisy")
+			noisyProbe("UDP", "UDP scan", 0, laddr, &ip, port, lastVlan(conn), iface)
 			continue
 		}
 
-		logAlarm("attackalert: UDP scan from host: %s to UDP port: %d", ipString, port)
-		if checkStateEngine(ipString, port) {
-			logBlocked("Host: %s Port: %d UDP Blocked", ipString, port)
-			// run extern command
-			runExternalCommand(ipString, port)
-		}
+		log.Printf("%v: %d->%d", ip.Source, udp.Source, udp.Destination)
+		payload := classifyUdpPayload(udp.Payload(ip.Payload(b[:numRead])))
+		inspectPacket("UDP", udpScanType(port, payload), 0, laddr, &ip, port, payload, lastVlan(conn), prof)
 	}
 }
 
+// split "token = value"
+// portsentry style lines, like KILL_ROUTE="/sbin/route add -host $TARGET$ reject", are accepted too
 func parseToken(line string) (token, value string) {
 	line = strings.TrimRight(line, "\r\n")
 	tokens := strings.SplitN(line, "=", 2)
@@ -372,10 +1032,13 @@ func parseToken(line string) (token, value string) {
 		return
 	}
 	value = strings.TrimSpace(tokens[1])
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
 	if value == "" {
 		return
 	}
-	token = strings.TrimSpace(tokens[0])
+	token = strings.ToLower(strings.TrimSpace(tokens[0]))
 	return
 }
 
@@ -391,6 +1054,62 @@ func parseInt(lineno int, token string, value string) int {
 	return v
 }
 
+// parse port list like "8000-8100,9090,9443" into set
+func parsePorts(lineno int, token string, value string, set *portSet) {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		// a service or group name, see service names
+		if item != "" && (item[0] < '0' || item[0] > '9') {
+			ports, ok := lookupService(item)
+			if !ok {
+				logMain(true, "line %d:%s, unknown service:%s", lineno, token, item)
+			}
+			for _, r := range ports {
+				set.Add(r.min, r.max)
+			}
+			continue
+		}
+		bounds := strings.SplitN(item, "-", 2)
+		min := parsePort(lineno, token, bounds[0])
+		max := min
+		if len(bounds) == 2 {
+			max = parsePort(lineno, token, bounds[1])
+		}
+		if min > max {
+			logMain(true, "line %d:%s, invalid port range:%s", lineno, token, item)
+		}
+		set.Add(min, max)
+	}
+}
+
+func parsePort(lineno int, token string, value string) int {
+	port := parseInt(lineno, token, strings.TrimSpace(value))
+	if port > 65535 {
+		logMain(true, "line %d:%s, invalid port:%d", lineno, token, port)
+	}
+	return port
+}
+
+// parse weight list like "23:5, 445:5" into cfgPortWeights
+func parsePortWeights(lineno int, token string, value string) {
+	for _, item := range strings.Split(value, ",") {
+		pair := strings.SplitN(strings.TrimSpace(item), ":", 2)
+		if len(pair) != 2 {
+			logMain(true, "line %d:%s, invalid port weight:%s", lineno, token, item)
+		}
+		port := parsePort(lineno, token, pair[0])
+		cfgPortWeights[port] = parseInt(lineno, token, strings.TrimSpace(pair[1]))
+	}
+}
+
+func parseBool(lineno int, token string, value string) bool {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		logMain(true, "line %d:%s, convert %s to bool failed:%s", lineno, token, value, err.Error())
+	}
+	return v
+}
+
 func parseIp(lineno int, token string, value string) *net.IPNet {
 	formalValue := value
 	if !strings.Contains(value, "/") {
@@ -411,54 +1130,901 @@ func parseFile(lineno int, token string, value string) io.Writer {
 	return f
 }
 
-func readConfigFile(file string) {
-	f, err := os.Open(file)
-	if err != nil {
-		logMain(true, "open file %s failed: %s", file, err.Error())
+// apply a config key, lineno is 0 for environment overrides
+func setConfig(lineno int, token string, value string) {
+	if strings.HasPrefix(token, "responder.") {
+		parseResponderKey(lineno, token, value)
+		return
+	}
+	if strings.HasPrefix(token, "profile.") {
+		parseProfileKey(lineno, token, value)
+		return
+	}
+	if strings.HasPrefix(token, "interface.") {
+		parseIfaceProfileKey(lineno, token, value)
+		return
+	}
+	if strings.HasPrefix(token, "severity.") {
+		parseSeverityKey(lineno, token, value)
+		return
+	}
+	if strings.HasPrefix(token, "port_group.") {
+		parsePortGroup(lineno, token, value)
+		return
+	}
+	if key, ok := serviceKeys[token]; ok {
+		token = key
+	}
+	switch token {
+	case "min_port":
+		cfgMinPort = parseInt(lineno, token, value)
+	case "max_port":
+		cfgMaxPort = parseInt(lineno, token, value)
+	case "noisy_udp_port":
+		parsePorts(lineno, token, value, &cfgNoisyUdpPorts)
+	case "noisy_tcp_port":
+		parsePorts(lineno, token, value, &cfgNoisyTcpPorts)
+	case "default_noisy_ports":
+		cfgDefaultNoisy = parseBool(lineno, token, value)
+	case "exclude_port":
+		parsePorts(lineno, token, value, &cfgExcludePorts)
+	case "exclude_port_log":
+		cfgExcludePortLog = parseBool(lineno, token, value)
+	case "sweep_sources":
+		if cfgSweepSources = parseInt(lineno, token, value); cfgSweepSources <= 0 {
+			logMain(true, "line %d:%s, invalid value:%s, should be positive", lineno, token, value)
+		}
+	case "sweep_window":
+		if cfgSweepWindow = parseInt(lineno, token, value); cfgSweepWindow <= 0 {
+			logMain(true, "line %d:%s, invalid value:%s, should be positive", lineno, token, value)
+		}
+	case "trap_port":
+		parsePorts(lineno, token, value, &cfgTrapPorts)
+	case "include_ports_file":
+		includePortsFile(lineno, token, value)
+	case "honeypot_port":
+		parsePorts(lineno, token, value, &cfgHoneypotPorts)
+	case "honeypot_bytes":
+		if cfgHoneypotBytes = parseInt(lineno, token, value); cfgHoneypotBytes <= 0 {
+			logMain(true, "line %d:%s, invalid value:%s, should be positive", lineno, token, value)
+		}
+	case "honeypot_timeout":
+		if cfgHoneypotTimeout = parseInt(lineno, token, value); cfgHoneypotTimeout <= 0 {
+			logMain(true, "line %d:%s, invalid value:%s, should be positive", lineno, token, value)
+		}
+	case "ignore_ip":
+		ipNet := parseIp(lineno, token, value)
+		cfgIgnoreIps = append(cfgIgnoreIps, ipNet)
+	case "ignore_local":
+		if value != "addresses" && value != "subnets" && value != "off" {
+			logMain(true, "line %d:%s, invalid value:%s, should be addresses, subnets or off", lineno, token, value)
+		}
+		cfgIgnoreLocal = value
+	case "ignore_local_interface":
+		cfgIgnoreLocalInterfaces = append(cfgIgnoreLocalInterfaces, value)
+	case "ignore_local_refresh":
+		cfgIgnoreLocalRefresh = parseInt(lineno, token, value)
+	case "container_networks":
+		if value != containerIgnore && value != containerProtect && value != "off" {
+			logMain(true, "line %d:%s, invalid value:%s, should be ignore, protect or off", lineno, token, value)
+		}
+		cfgContainerNetworks = value
+	case "container_interface":
+		if _, err := path.Match(value, ""); err != nil {
+			logMain(true, "line %d:%s, invalid pattern:%s", lineno, token, value)
+		}
+		if !containerInterfacesSet {
+			cfgContainerInterfaces, containerInterfacesSet = nil, true
+		}
+		cfgContainerInterfaces = append(cfgContainerInterfaces, value)
+	case "docker_socket":
+		cfgDockerSocket = value
+	case "external_interface":
+		cfgExternalInterfaces = append(cfgExternalInterfaces, value)
+	case "spoof_ttl_delta":
+		cfgSpoofTtlDelta = parseInt(lineno, token, value)
+	case "block_spoofed":
+		cfgBlockSpoofed = parseBool(lineno, token, value)
+	case "bogon_filter":
+		cfgBogonFilter = parseBogonFilter(lineno, token, value)
+	case "bogon_url":
+		if !strings.HasPrefix(value, "https://") {
+			logMain(true, "line %d:%s, invalid value:%s, should be an https url", lineno, token, value)
+		}
+		cfgBogonUrl = value
+	case "bogon_refresh":
+		if cfgBogonRefresh = parseInt(lineno, token, value); cfgBogonRefresh < 3600 {
+			logMain(true, "line %d:%s, invalid value:%s, should be at least 3600", lineno, token, value)
+		}
+	case "ignore_mac", "gateway_mac":
+		if runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, mac filtering is only supported on linux", lineno, token)
+		}
+		mac, err := net.ParseMAC(value)
+		if err != nil {
+			logMain(true, "line %d:%s, invalid mac:%s", lineno, token, value)
+		}
+		if token == "ignore_mac" {
+			cfgIgnoreMacs = append(cfgIgnoreMacs, mac)
+		} else {
+			cfgGatewayMacs = append(cfgGatewayMacs, mac)
+		}
+	case "capture_fanout":
+		if runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, capture fanout is only supported on linux", lineno, token)
+		}
+		cfgCaptureFanout = parseInt(lineno, token, value)
+		if cfgCaptureFanout < 1 {
+			logMain(true, "line %d:%s, invalid value:%s, should be at least 1", lineno, token, value)
+		}
+	case "capture_rcvbuf":
+		cfgCaptureRcvbuf = parseInt(lineno, token, value)
+		if cfgCaptureRcvbuf < 0 {
+			logMain(true, "line %d:%s, invalid value:%s, should be at least 0", lineno, token, value)
+		}
+	case "vlan":
+		cfgVlanCapture = true
+		if value != "all" {
+			parsePorts(lineno, token, value, &cfgVlans)
+			if cfgVlans[len(cfgVlans)-1].max > 4094 {
+				logMain(true, "line %d:%s, invalid vlan id:%s", lineno, token, value)
+			}
+		}
+	case "ignore_host":
+		ignoreHosts = append(ignoreHosts, &ignoreHost{name: value})
+	case "ignore_url":
+		cfgIgnoreUrls = append(cfgIgnoreUrls, parseIgnoreUrl(lineno, token, value))
+	case "ignore_url_refresh":
+		if cfgIgnoreUrlRefresh = parseInt(lineno, token, value); cfgIgnoreUrlRefresh < 1 {
+			logMain(true, "line %d:%s, invalid value:%s, should be at least 1", lineno, token, value)
+		}
+	case "ignore_url_ca":
+		cfgIgnoreUrlCa = value
+	case "ignore_url_key":
+		cfgIgnoreUrlKey = parseIgnoreUrlKey(lineno, token, value)
+	case "ignore_host_refresh":
+		cfgIgnoreHostRefresh = parseInt(lineno, token, value)
+	case "kill_route":
+		cfgKillRoute = append(cfgKillRoute, value)
+	case "kill_run_cmd":
+		cfgKillRunCmd = append(cfgKillRunCmd, value)
+	case "kill_route_undo":
+		cfgKillRouteUndo = append(cfgKillRouteUndo, value)
+	case "kill_run_cmd_undo":
+		cfgKillRunCmdUndo = append(cfgKillRunCmdUndo, value)
+	case "kill_notify_url":
+		if _, err := url.Parse(value); err != nil {
+			logMain(true, "line %d:%s, invalid url:%s", lineno, token, value)
+		}
+		cfgKillNotifyUrl = value
+	case "run_as_user":
+		cfgRunAsUser = value
+	case "run_as_group":
+		cfgRunAsGroup = value
+	case "privsep":
+		if runtime.GOOS == "windows" {
+			logMain(true, "line %d:%s, privsep is not supported on windows", lineno, token)
+		}
+		cfgPrivsep = parseBool(lineno, token, value)
+	case "chroot_dir":
+		cfgChrootDir = value
+	case "chroot_exec":
+		cfgChrootExec = parseBool(lineno, token, value)
+	case "seccomp":
+		if value != "off" && value != "on" && value != "strict" {
+			logMain(true, "line %d:%s, invalid value:%s, should be off, on or strict", lineno, token, value)
+		}
+		cfgSeccomp = value
+	case "pid_file":
+		cfgPidFile = value
+	case "state_file":
+		cfgStateFile = value
+	case "block_intake":
+		cfgBlockIntake = value
+	case "control_socket":
+		cfgControlSocket = value
+	case "listen_baseline":
+		cfgListenBaseline = parseBool(lineno, token, value)
+	case "listen_baseline_interval":
+		cfgListenBaselineInterval = parseInt(lineno, token, value)
+		if cfgListenBaselineInterval <= 0 {
+			logMain(true, "line %d:%s, invalid value:%s", lineno, token, value)
+		}
+	case "listen_baseline_allow":
+		parsePorts(lineno, token, value, &cfgListenBaselineAllow)
+	case "evidence_dir":
+		cfgEvidenceDir = value
+	case "evidence_ring":
+		cfgEvidenceRing = parseInt(lineno, token, value)
+	case "evidence_hosts":
+		cfgEvidenceHosts = parseInt(lineno, token, value)
+	case "evidence_max_files":
+		cfgEvidenceMaxFiles = parseInt(lineno, token, value)
+	case "evidence_max_size":
+		cfgEvidenceMaxSize = parseInt(lineno, token, value)
+	case "evidence_duration":
+		cfgEvidenceDuration = parseInt(lineno, token, value)
+	case "event_db":
+		cfgEventDb = value
+	case "event_db_retention":
+		cfgEventDbRetention = parseInt(lineno, token, value)
+	case "shutdown_timeout":
+		cfgShutdownTimeout = parseInt(lineno, token, value)
+	case "windows_firewall":
+		cfgWindowsFirewall = parseBool(lineno, token, value)
+		if cfgWindowsFirewall && runtime.GOOS != "windows" {
+			logMain(true, "line %d:%s, windows firewall is only supported on windows", lineno, token)
+		}
+	case "pf_table":
+		if runtime.GOOS != "freebsd" && runtime.GOOS != "openbsd" {
+			logMain(true, "line %d:%s, pf table is only supported on freebsd and openbsd", lineno, token)
+		}
+		cfgPfTable = value
+	case "pf_table_expire":
+		cfgPfTableExpire = parseInt(lineno, token, value)
+	case "firewalld_zone":
+		cfgFirewalldZone = value
+	case "firewalld_ipset":
+		cfgFirewalldIPSet = value
+	case "firewalld_permanent":
+		cfgFirewalldPerm = parseBool(lineno, token, value)
+	case "nft_set":
+		if runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, nft set is only supported on linux", lineno, token)
+		}
+		if len(strings.Fields(value)) != 3 {
+			logMain(true, "line %d:%s, invalid value:%s, should be <family> <table> <set>", lineno, token, value)
+		}
+		cfgNftSet = strings.Join(strings.Fields(value), " ")
+	case "fw4_set":
+		if runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, fw4 is only supported on linux", lineno, token)
+		}
+		cfgFw4Set = value
+	case "fw4_include":
+		cfgFw4Include = value
+	case "ubus_events":
+		if cfgUbusEvents = parseBool(lineno, token, value); cfgUbusEvents && runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, ubus is only supported on linux", lineno, token)
+		}
+	case "ipset":
+		if runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, ipset is only supported on linux", lineno, token)
+		}
+		cfgIpset = value
+	case "firewall_action":
+		if value != fwActionDrop && value != fwActionThrottle {
+			logMain(true, "line %d:%s, invalid value:%s, should be drop or throttle", lineno, token, value)
+		}
+		cfgFirewallAction = value
+	case "throttle_rate":
+		cfgThrottleRate = parseThrottleRate(lineno, token, value)
+	case "blackhole_route":
+		if runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, blackhole routes are only supported on linux", lineno, token)
+		}
+		if value != "blackhole" && value != "unreachable" && value != "prohibit" {
+			logMain(true, "line %d:%s, invalid value:%s, should be blackhole, unreachable or prohibit", lineno, token, value)
+		}
+		cfgBlackholeRoute = value
+	case "blackhole_route_table":
+		cfgBlackholeRouteTable = parseInt(lineno, token, value)
+		if cfgBlackholeRouteTable < 1 || cfgBlackholeRouteTable == 255 {
+			logMain(true, "line %d:%s, invalid table:%s", lineno, token, value)
+		}
+	case "active_response":
+		cfgActiveResponse = parseBool(lineno, token, value)
+		if cfgActiveResponse && runtime.GOOS == "windows" {
+			logMain(true, "line %d:%s, active response is not supported on windows", lineno, token)
+		}
+	case "active_response_rate":
+		cfgActiveResponseRate = parseInt(lineno, token, value)
+	case "conntrack_flush":
+		cfgConntrackFlush = parseBool(lineno, token, value)
+		if cfgConntrackFlush && runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, conntrack is only supported on linux", lineno, token)
+		}
+	case "netns":
+		if runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, network namespaces are only supported on linux", lineno, token)
+		}
+		cfgNetns = append(cfgNetns, netnsPath(value))
+	case "connect_scan_ports":
+		if runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, connect scan detection is only supported on linux", lineno, token)
+		}
+		cfgConnectScanPorts = parseInt(lineno, token, value)
+	case "connect_scan_window":
+		if cfgConnectScanWindow = parseInt(lineno, token, value); cfgConnectScanWindow < 1 {
+			logMain(true, "line %d:%s, invalid value:%s, should be at least 1", lineno, token, value)
+		}
+	case "connect_scan_lifetime":
+		if cfgConnectScanLifetime = parseInt(lineno, token, value); cfgConnectScanLifetime < 1 {
+			logMain(true, "line %d:%s, invalid value:%s, should be at least 1", lineno, token, value)
+		}
+	case "arp_scan_threshold":
+		if runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, arp sweep detection is only supported on linux", lineno, token)
+		}
+		cfgArpScanThreshold = parseInt(lineno, token, value)
+	case "arp_scan_window":
+		if cfgArpScanWindow = parseInt(lineno, token, value); cfgArpScanWindow < 1 {
+			logMain(true, "line %d:%s, invalid value:%s, should be at least 1", lineno, token, value)
+		}
+	case "nflog_group":
+		if runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, nflog is only supported on linux", lineno, token)
+		}
+		if cfgNflogGroup = parseInt(lineno, token, value); cfgNflogGroup < 0 || cfgNflogGroup > 65535 {
+			logMain(true, "line %d:%s, invalid value:%s, should be 0-65535", lineno, token, value)
+		}
+	case "nfqueue":
+		if runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, nfqueue is only supported on linux", lineno, token)
+		}
+		if cfgNfqueue = parseInt(lineno, token, value); cfgNfqueue < 0 || cfgNfqueue > 65535 {
+			logMain(true, "line %d:%s, invalid value:%s, should be 0-65535", lineno, token, value)
+		}
+	case "nfqueue_score":
+		cfgNfqueueScore = parseInt(lineno, token, value)
+	case "xdp_interface":
+		if runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, xdp is only supported on linux", lineno, token)
+		}
+		cfgXdpInterfaces = append(cfgXdpInterfaces, value)
+	case "xdp_mode":
+		if value != "auto" && value != "native" && value != "generic" {
+			logMain(true, "line %d:%s, invalid value:%s, should be auto, native or generic", lineno, token, value)
+		}
+		cfgXdpMode = value
+	case "xdp_map_pin":
+		cfgXdpMapPin = value
+	case "xdp_max_entries":
+		cfgXdpMaxEntries = parseInt(lineno, token, value)
+	case "firewall_batch_interval":
+		cfgFirewallBatchInterval = parseInt(lineno, token, value)
+	case "firewall_batch_max":
+		cfgFirewallBatchMax = parseInt(lineno, token, value)
+		if cfgFirewallBatchMax < 1 {
+			logMain(true, "line %d:%s, invalid value:%s, should be at least 1", lineno, token, value)
+		}
+	case "block_duration":
+		cfgBlockDuration = parseInt(lineno, token, value)
+	case "block_duration_max":
+		cfgBlockDurationMax = parseInt(lineno, token, value)
+	case "kube_blocklist":
+		if value != kubeCalico && value != kubeCilium {
+			logMain(true, "line %d:%s, invalid value:%s, should be calico or cilium", lineno, token, value)
+		}
+		cfgKubeBlocklist = value
+	case "kube_blocklist_name":
+		cfgKubeBlocklistName = value
+	case "kube_api":
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			logMain(true, "line %d:%s, invalid url:%s", lineno, token, value)
+		}
+		cfgKubeApi = strings.TrimRight(value, "/")
+	case "aws_nacl_id":
+		cfgAwsNaclId = value
+	case "stats_interval":
+		cfgStatsInterval = parseInt(lineno, token, value)
+	case "journald":
+		if runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, journald is only supported on linux", lineno, token)
+		}
+		cfgJournald = parseBool(lineno, token, value)
+	case "wazuh_output":
+		if value != wazuhPortsentry && value != wazuhJson {
+			logMain(true, "line %d:%s, invalid value:%s, should be portsentry or json", lineno, token, value)
+		}
+		if runtime.GOOS == "windows" {
+			logMain(true, "line %d:%s, wazuh output is not supported on windows", lineno, token)
+		}
+		cfgWazuhOutput = value
+	case "wazuh_socket":
+		cfgWazuhSocket = value
+	case "event_socket":
+		if runtime.GOOS == "windows" {
+			logMain(true, "line %d:%s, event_socket is not supported on windows", lineno, token)
+		}
+		cfgEventSocket = value
+	case "statsd_addr":
+		cfgStatsdAddr = value
+	case "statsd_prefix":
+		cfgStatsdPrefix = value
+	case "statsd_tag":
+		cfgStatsdTags = append(cfgStatsdTags, value)
+	case "statsd_interval":
+		cfgStatsdInterval = parseInt(lineno, token, value)
+	case "snmp_trap":
+		cfgSnmpTrap = value
+	case "snmp_version":
+		if value != "2c" && value != "3" {
+			logMain(true, "line %d:%s, invalid value:%s, should be 2c or 3", lineno, token, value)
+		}
+		cfgSnmpVersion = value
+	case "snmp_community":
+		cfgSnmpCommunity = value
+	case "snmp_user":
+		cfgSnmpUser = value
+	case "snmp_auth_protocol":
+		if value != "md5" && value != "sha" {
+			logMain(true, "line %d:%s, invalid value:%s, should be md5 or sha", lineno, token, value)
+		}
+		cfgSnmpAuthProtocol = value
+	case "snmp_auth_password", "snmp_priv_password":
+		if len(value) < 8 {
+			logMain(true, "line %d:%s, should be at least 8 characters", lineno, token)
+		}
+		if token == "snmp_auth_password" {
+			cfgSnmpAuthPassword = value
+		} else {
+			cfgSnmpPrivPassword = value
+		}
+	case "snmp_engine_id":
+		cfgSnmpEngineId = value
+	case "snmp_enterprise_oid":
+		if !validOid(value) {
+			logMain(true, "line %d:%s, invalid oid:%s", lineno, token, value)
+		}
+		cfgSnmpEnterpriseOid = value
+	case "snmp_trap_alarms":
+		cfgSnmpTrapAlarms = parseBool(lineno, token, value)
+	case "ipfix_collector":
+		cfgIpfixCollector = value
+	case "ipfix_enterprise_id":
+		cfgIpfixEnterpriseId = parseInt(lineno, token, value)
+	case "ipfix_domain_id":
+		cfgIpfixDomainId = parseInt(lineno, token, value)
+	case "otlp_endpoint":
+		cfgOtlpEndpoint = value
+	case "otlp_header":
+		cfgOtlpHeaders = append(cfgOtlpHeaders, value)
+	case "otlp_interval":
+		cfgOtlpInterval = parseInt(lineno, token, value)
+	case "loki_url":
+		cfgLokiUrl = value
+	case "loki_labels":
+		parseLokiLabels(lineno, token, value)
+	case "loki_header":
+		cfgLokiHeaders = append(cfgLokiHeaders, value)
+	case "elastic_url":
+		cfgElasticUrl = value
+	case "elastic_index":
+		cfgElasticIndex = value
+	case "elastic_header":
+		cfgElasticHeaders = append(cfgElasticHeaders, value)
+	case "elastic_buffer":
+		cfgElasticBuffer = parseInt(lineno, token, value)
+		if cfgElasticBuffer < elasticBatch {
+			logMain(true, "line %d:%s, invalid value:%s, should be at least %d", lineno, token, value, elasticBatch)
+		}
+	case "misp_url":
+		cfgMispUrl = value
+	case "misp_key":
+		cfgMispKey = value
+	case "misp_event":
+		cfgMispEvent = parseInt(lineno, token, value)
+	case "misp_distribution":
+		if cfgMispDistribution = parseInt(lineno, token, value); cfgMispDistribution > 3 {
+			logMain(true, "line %d:%s, invalid value:%s, should be 0 to 3", lineno, token, value)
+		}
+	case "misp_tag":
+		cfgMispTags = append(cfgMispTags, value)
+	case "stix_dir":
+		cfgStixDir = value
+	case "stix_interval":
+		if cfgStixInterval = parseInt(lineno, token, value); cfgStixInterval == 0 {
+			logMain(true, "line %d:%s, invalid value:%s, should be at least 1", lineno, token, value)
+		}
+	case "taxii_url":
+		cfgTaxiiUrl = value
+	case "taxii_header":
+		cfgTaxiiHeaders = append(cfgTaxiiHeaders, value)
+	case "digest_interval":
+		cfgDigestInterval = parseInt(lineno, token, value)
+	case "digest_log":
+		cfgDigestLogPath = value
+		cfgDigestLog = parseFile(lineno, token, value)
+	case "event_log":
+		cfgEventLog = value
+	case "event_log_max_size":
+		cfgEventLogMaxSize = parseInt(lineno, token, value)
+	case "event_log_keep":
+		cfgEventLogKeep = parseInt(lineno, token, value)
+	case "digest_url":
+		cfgDigestUrl = value
+	case "report_interval":
+		if value != reportDaily && value != reportWeekly && value != "off" {
+			logMain(true, "line %d:%s, invalid value:%s, should be daily, weekly or off", lineno, token, value)
+		}
+		if cfgReportInterval = value; value == "off" {
+			cfgReportInterval = ""
+		}
+	case "report_dir":
+		cfgReportDir = value
+	case "report_url":
+		cfgReportUrl = value
+	case "alarm_suppress_after":
+		cfgAlarmSuppressAfter = parseInt(lineno, token, value)
+	case "alarm_suppress_window":
+		cfgAlarmSuppressWindow = parseInt(lineno, token, value)
+	case "alarm_rate_limit":
+		cfgAlarmRateLimit = parseInt(lineno, token, value)
+	case "policy_cmd":
+		cfgPolicyCmd = value
+	case "policy_timeout":
+		cfgPolicyTimeout = parseInt(lineno, token, value)
+	case "reputation_url":
+		cfgReputationUrl = value
+	case "reputation_header":
+		cfgReputationHeaders = append(cfgReputationHeaders, value)
+	case "reputation_field":
+		cfgReputationField = value
+	case "reputation_ttl":
+		cfgReputationTtl = parseInt(lineno, token, value)
+	case "reputation_benign":
+		parseVerdicts(value, cfgReputationBenign)
+	case "reputation_malicious":
+		parseVerdicts(value, cfgReputationMalicious)
+	case "reputation_block":
+		cfgReputationBlock = parseBool(lineno, token, value)
+	case "reputation_weight":
+		cfgReputationWeight = parseInt(lineno, token, value)
+	case "country_db":
+		cfgCountryDb = value
+	case "country_locations":
+		cfgCountryLocations = value
+	case "country_block":
+		parseCountries(lineno, token, value, cfgCountryBlock)
+	case "country_never_block":
+		parseCountries(lineno, token, value, cfgCountryNeverBlock)
+	case "asn_db":
+		cfgAsnDb = value
+	case "geoip_account_id":
+		cfgGeoipAccountId = value
+	case "geoip_license_key":
+		cfgGeoipLicenseKey = value
+	case "geoip_url":
+		cfgGeoipUrl = value
+	case "geoip_update_interval":
+		cfgGeoipUpdateInterval = parseInt(lineno, token, value)
+	case "asn_block":
+		parseAsns(lineno, token, value, cfgAsnBlock)
+	case "asn_never_block":
+		parseAsns(lineno, token, value, cfgAsnNeverBlock)
+	case "scoring":
+		if value != scoringPorts && value != scoringWeighted {
+			logMain(true, "line %d:%s, invalid value:%s, should be ports or weighted", lineno, token, value)
+		}
+		cfgScoring = value
+	case "block_score":
+		cfgBlockScore = parseInt(lineno, token, value)
+	case "scan_type_weight":
+		parseScanTypeWeight(lineno, token, value)
+	case "scan_type_action":
+		parseScanTypeAction(lineno, token, value)
+	case "scan_type_trigger":
+		parseScanTypeTrigger(lineno, token, value)
+	case "udp_payload_action":
+		parseUdpPayloadAction(lineno, token, value)
+	case "rate_interval":
+		cfgRateInterval = parseInt(lineno, token, value)
+	case "rate_weight":
+		cfgRateWeight = parseInt(lineno, token, value)
+	case "cmd_timeout":
+		cfgCmdTimeout = parseInt(lineno, token, value)
+	case "cluster_listen":
+		cfgClusterListen = value
+	case "cluster_peer":
+		cfgClusterPeers = append(cfgClusterPeers, value)
+	case "cluster_key":
+		cfgClusterKey = value
+	case "cluster_node":
+		cfgClusterNode = value
+	case "cluster_sync_interval":
+		cfgClusterSyncInterval = parseInt(lineno, token, value)
+	case "kv_backend":
+		if value != "consul" && value != "etcd" {
+			logMain(true, "line %d:%s, invalid value:%s, should be consul or etcd", lineno, token, value)
+		}
+		cfgKvBackend = value
+	case "kv_url":
+		cfgKvUrl = value
+	case "kv_prefix":
+		cfgKvPrefix = value
+	case "kv_token":
+		cfgKvToken = value
+	case "kv_poll":
+		cfgKvPoll = parseInt(lineno, token, value)
+	case "score_addr":
+		cfgScoreAddr = value
+	case "blocklist_addr":
+		cfgBlocklistAddr = value
+	case "blocklist_file":
+		cfgBlocklistFile = value
+	case "blocklist_format":
+		if _, ok := blocklistFormats[value]; !ok {
+			logMain(true, "line %d:%s, invalid value:%s, should be plain, cidr, bird, frr or rtbh", lineno, token, value)
+		}
+		cfgBlocklistFormat = value
+	case "blocklist_interval":
+		cfgBlocklistInterval = parseInt(lineno, token, value)
+	case "blocklist_name":
+		cfgBlocklistName = value
+	case "blocklist_next_hop":
+		if net.ParseIP(value) == nil {
+			logMain(true, "line %d:%s, invalid ip:%s", lineno, token, value)
+		}
+		cfgBlocklistNextHop = value
+	case "blocklist_community":
+		cfgBlocklistCommunity = value
+	case "blocklist_aggregate":
+		cfgBlocklistAggregate = parseBool(lineno, token, value)
+	case "blocklist_max_entries":
+		cfgBlocklistMaxEntries = parseInt(lineno, token, value)
+	case "blocklist_min_prefix":
+		if cfgBlocklistMinPrefix = parseInt(lineno, token, value); cfgBlocklistMinPrefix < 1 || cfgBlocklistMinPrefix > 32 {
+			logMain(true, "line %d:%s, invalid value:%s, should be 1-32", lineno, token, value)
+		}
+	case "log_level":
+		if value != "info" && value != "debug" {
+			logMain(true, "line %d:%s, invalid value:%s, should be info or debug", lineno, token, value)
+		}
+		debugLogs = 0
+		if value == "debug" {
+			debugLogs = 1
+		}
+	case "trace_duration":
+		cfgTraceDuration = parseInt(lineno, token, value)
+	case "log_time_format":
+		if value != logTimeDefault && value != logTimeRFC3339 && value != logTimeRFC3339Nano {
+			logMain(true, "line %d:%s, invalid value:%s, should be default, rfc3339 or rfc3339nano", lineno, token, value)
+		}
+		cfgLogTimeFormat = value
+	case "log_utc":
+		cfgLogUTC = parseBool(lineno, token, value)
+	case "health_addr":
+		cfgHealthAddr = value
+	case "http_tls_cert":
+		cfgHttpTlsCert = value
+	case "http_tls_key":
+		cfgHttpTlsKey = value
+	case "http_client_ca":
+		cfgHttpClientCa = value
+	case "http_token":
+		cfgHttpToken = value
+	case "api_token":
+		cfgApiTokens = append(cfgApiTokens, parseApiToken(lineno, token, value))
+	case "health_max_idle":
+		cfgHealthMaxIdle = parseInt(lineno, token, value)
+	case "health_max_responder_failure":
+		cfgHealthMaxResponderFailure = parseInt(lineno, token, value)
+	case "fail2ban_log":
+		cfgFail2banLogPath = value
+		cfgFail2banLog = parseFile(lineno, token, value)
+	case "fail2ban_jail":
+		cfgFail2banJail = value
+	case "fail2ban_socket":
+		cfgFail2banSocket = value
+	case "audit_log":
+		cfgAuditLogPath = value
+		cfgAuditLog = parseFile(lineno, token, value)
+	case "responder_workers":
+		cfgResponderWorkers = parseInt(lineno, token, value)
+	case "responder_queue":
+		cfgResponderQueue = parseInt(lineno, token, value)
+	case "exec_rate":
+		cfgExecRate = parseInt(lineno, token, value)
+	case "exec_burst":
+		cfgExecBurst = parseInt(lineno, token, value)
+	case "response_stage":
+		parseResponseStage(lineno, token, value)
+	case "responder_order":
+		cfgResponderOrder = nil
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				cfgResponderOrder = append(cfgResponderOrder, name)
+			}
+		}
+	case "responder_mode":
+		if value != responderSequential && value != responderConcurrent {
+			logMain(true, "line %d:%s, invalid value:%s, should be sequential or concurrent", lineno, token, value)
+		}
+		cfgResponderMode = value
+	case "responder_plugin":
+		cfgPlugins = append(cfgPlugins, parsePlugin(lineno, token, value))
+	case "action":
+		if value != "block" && value != "log_only" {
+			logMain(true, "line %d:%s, invalid value:%s, should be block or log_only", lineno, token, value)
+		}
+		cfgAction = value
+	case "cloudflare_token":
+		cfgCloudflareToken = value
+	case "cloudflare_zone":
+		cfgCloudflareZone = value
+	case "cloudflare_account":
+		cfgCloudflareAccount = value
+	case "aws_region":
+		cfgAwsRegion = value
+	case "aws_nacl_rule_start":
+		cfgAwsNaclRuleStart = parseInt(lineno, token, value)
+	case "aws_nacl_rule_count":
+		cfgAwsNaclRuleCount = parseInt(lineno, token, value)
+	case "scan_trigger":
+		cfgScanTrigger = parseInt(lineno, token, value)
+	case "profile":
+		cfgProfile = value
+	case "port_cache_duration":
+		cfgPortCacheDuration = int64(parseInt(lineno, token, value))
+	case "port_cache_max":
+		cfgPortCacheMax = parseInt(lineno, token, value)
+	case "overload_protection":
+		cfgOverloadProtection = parseBool(lineno, token, value)
+	case "overload_backlog":
+		cfgOverloadBacklog = parseInt(lineno, token, value)
+	case "overload_drops":
+		cfgOverloadDrops = parseInt(lineno, token, value)
+	case "overload_sample":
+		cfgOverloadSample = parseInt(lineno, token, value)
+		if cfgOverloadSample < 2 {
+			logMain(true, "line %d:%s, invalid value:%s, should be at least 2", lineno, token, value)
+		}
+	case "overload_cooldown":
+		cfgOverloadCooldown = parseInt(lineno, token, value)
+	case "anomaly_factor":
+		cfgAnomalyFactor = parseInt(lineno, token, value)
+	case "anomaly_hours":
+		if cfgAnomalyHours = parseInt(lineno, token, value); cfgAnomalyHours < 1 {
+			logMain(true, "line %d:%s, invalid value:%s, should be at least 1", lineno, token, value)
+		}
+	case "anomaly_learn":
+		cfgAnomalyLearn = parseInt(lineno, token, value)
+	case "anomaly_min":
+		cfgAnomalyMin = parseInt(lineno, token, value)
+	case "advanced_ports":
+		cfgAdvancedPorts = parseInt(lineno, token, value)
+		if cfgAdvancedPorts < 0 || cfgAdvancedPorts > 65535 {
+			logMain(true, "line %d:%s, invalid value:%s, should be 0 to 65535", lineno, token, value)
+		}
+	case "advanced_refresh":
+		cfgAdvancedRefresh = parseInt(lineno, token, value)
+		if cfgAdvancedRefresh <= 0 {
+			logMain(true, "line %d:%s, invalid value:%s, should be positive", lineno, token, value)
+		}
+	case "port_closed_cache_ms":
+		cfgClosedPortCacheMs = int64(parseInt(lineno, token, value))
+	case "max_tracked_ips":
+		cfgMaxTrackedIps = parseInt(lineno, token, value)
+	case "tracked_eviction":
+		cfgTrackedEviction = parseEviction(lineno, token, value, false)
+	case "port_cache_eviction":
+		cfgPortCacheEviction = parseEviction(lineno, token, value, true)
+	case "reputation_cache_max":
+		cfgReputationCacheMax = parseInt(lineno, token, value)
+	case "reputation_cache_eviction":
+		cfgReputationEviction = parseEviction(lineno, token, value, false)
+	case "event_queue":
+		if cfgEventQueue = parseInt(lineno, token, value); cfgEventQueue <= 0 {
+			logMain(true, "line %d:%s, invalid value:%s, should be positive", lineno, token, value)
+		}
+	case "event_queue_drop":
+		if value != "newest" && value != evictOldest {
+			logMain(true, "line %d:%s, invalid value:%s, should be newest or oldest", lineno, token, value)
+		}
+		cfgEventQueueDrop = value
+	case "track_idle_timeout":
+		cfgTrackIdleTimeout = parseInt(lineno, token, value)
+	case "port_weight":
+		parsePortWeights(lineno, token, value)
+	case "alarm_log":
+		cfgAlarmLogPath = value
+		cfgAlarmLog = parseFile(lineno, token, value)
+	case "blocked_log":
+		cfgBlockedLogPath = value
+		cfgBlockedLog = parseFile(lineno, token, value)
+	case "interface":
+		if err := checkInterface(value); err != nil {
+			logMain(true, "line %d:%s, invalid interface %s:%s", lineno, token, value, err.Error())
+		}
+		cfgInterfaces = append(cfgInterfaces, value)
+	case "mirror_interface":
+		if runtime.GOOS != "linux" {
+			logMain(true, "line %d:%s, mirror monitoring is only supported on linux", lineno, token)
+		}
+		if err := checkInterface(value); err != nil {
+			logMain(true, "line %d:%s, invalid interface %s:%s", lineno, token, value, err.Error())
+		}
+		cfgMirrorInterfaces = append(cfgMirrorInterfaces, value)
+	case "mirror_hosts":
+		cfgMirrorHosts = append(cfgMirrorHosts, parseIp(lineno, token, value))
+	case "mirror_open":
+		cfgMirrorOpen = append(cfgMirrorOpen, parseMirrorOpen(lineno, token, value))
+	case "mirror_learn":
+		cfgMirrorLearn = parseBool(lineno, token, value)
+	case "mirror_learn_ttl":
+		cfgMirrorLearnTtl = parseInt(lineno, token, value)
+	case "mirror_decap":
+		cfgMirrorDecap = parseMirrorDecap(lineno, token, value)
+	case "mirror_vxlan_port":
+		cfgMirrorVxlanPort = nil
+		parsePorts(lineno, token, value, &cfgMirrorVxlanPort)
+	case "capture_buffer":
+		cfgCaptureBuffer = parseInt(lineno, token, value)
+	case "capture_error_limit":
+		cfgCaptureErrorLimit = parseInt(lineno, token, value)
+	case "capture_stall_timeout":
+		cfgCaptureStallTimeout = parseInt(lineno, token, value)
+	case "ops_alert_url":
+		cfgOpsAlertUrl = value
+	case "error_report_url":
+		cfgErrorReportUrl = value
+	case "error_report_interval":
+		cfgErrorReportInterval = parseInt(lineno, token, value)
+	case "checksum_check":
+		cfgChecksumCheck = parseBool(lineno, token, value)
+	case "fingerprint_probes":
+		cfgFingerprintProbes = parseInt(lineno, token, value)
+	case "fingerprint_window":
+		cfgFingerprintWindow = parseInt(lineno, token, value)
+	case "fingerprint_block":
+		cfgFingerprintBlock = parseBool(lineno, token, value)
+	case "synflood_source_rate":
+		cfgSynFloodSourceRate = parseInt(lineno, token, value)
+	case "synflood_total_rate":
+		cfgSynFloodTotalRate = parseInt(lineno, token, value)
+	case "synflood_cooldown":
+		cfgSynFloodCooldown = parseInt(lineno, token, value)
+	case "synflood_block":
+		cfgSynFloodBlock = parseBool(lineno, token, value)
+	case "listen_ip":
+		ip := net.ParseIP(value)
+		if ip == nil || ip.To4() == nil {
+			logMain(true, "line %d:%s, %s is not a legal ipv4 address", lineno, token, value)
+		}
+		cfgListenIps = append(cfgListenIps, ip.To4())
+	default:
+	}
+}
+
+// files read so far, in order, includes after the file including them
+var cfgFiles []string
+
+func readConfigFile(file string) {
+	if len(cfgFiles) >= 256 {
+		logMain(true, "too many config files, include loop at %s?", file)
 	}
-	defer f.Close()
+	cfgFiles = append(cfgFiles, file)
 
-	rd := bufio.NewReader(f)
+	var data string
+	if file == configStdin {
+		data = stdinConfig()
+	} else {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			logMain(true, "open file %s failed: %s", file, err.Error())
+		}
+		data = string(b)
+	}
+	if isUciConfig(data) {
+		readUciConfig(file, data)
+		return
+	}
+	readConfig(file, strings.NewReader(data))
+}
+
+func readConfig(file string, r io.Reader) {
+	rd := bufio.NewReader(r)
 	lineno := 0
 	for {
 		line, err := rd.ReadString('\n')
 		lineno++
 
-		if !strings.HasPrefix(line, "#") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "include" {
+			includeConfig(file, lineno, fields[1])
+		} else if !strings.HasPrefix(line, "#") {
 			token, value := parseToken(line)
-			switch token {
-			case "min_port":
-				cfgMinPort = parseInt(lineno, token, value)
-			case "max_port":
-				cfgMaxPort = parseInt(lineno, token, value)
-			case "noisy_udp_port":
-				port := parseInt(lineno, token, value)
-				cfgNoisyPorts[port] = true
-			case "exclude_port":
-				port := parseInt(lineno, token, value)
-				cfgExcludePorts[port] = true
-			case "ignore_ip":
-				ipNet := parseIp(lineno, token, value)
-				cfgIgnoreIps = append(cfgIgnoreIps, ipNet)
-			case "kill_route":
-				cfgKillRoute = value
-			case "kill_run_cmd":
-				cfgKillRunCmd = value
-			case "kill_notify_url":
-				if _, err := url.Parse(value); err != nil {
-					logMain(true, "line %d:%s, invalid url:%s", lineno, token, value)
-				}
-				cfgKillNotifyUrl = value
-			case "scan_trigger":
-				cfgScanTrigger = parseInt(lineno, token, value)
-			case "alarm_log":
-				cfgAlarmLogPath = value
-				cfgAlarmLog = parseFile(lineno, token, value)
-			case "blocked_log":
-				cfgBlockedLogPath = value
-				cfgBlockedLog = parseFile(lineno, token, value)
-			default:
-			}
+			setConfig(lineno, token, expandConfigEnv(value))
 		}
 		if err != nil {
 			break
@@ -466,42 +2032,148 @@ func readConfigFile(file string) {
 	}
 }
 
+// read files matching pattern in name order, right where the include line is
+// so keys in them override earlier single values and add to repeated ones, like exclude_port
+// a relative pattern is relative to the directory of the including file
+func includeConfig(file string, lineno int, pattern string) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(file), pattern)
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		logMain(true, "%s line %d:include, invalid pattern %s:%s", file, lineno, pattern, err.Error())
+	}
+	for _, name := range files {
+		readConfigFile(name)
+	}
+}
+
 func configGuard() {
-	// add default ignore network
-	defaultIgnoreNetwork := []string{
-		"127.0.0.1/8",
+	cfgCaptureBuffer = captureBufferSize()
+
+	// well-known broadcast and ident chatter
+	if cfgDefaultNoisy {
+		// netbios, mdns, ssdp
+		cfgNoisyUdpPorts.Add(137, 138)
+		cfgNoisyUdpPorts.Add(5353, 5353)
+		cfgNoisyUdpPorts.Add(1900, 1900)
+		// ident
+		cfgNoisyTcpPorts.Add(113, 113)
 	}
 
-	for _, network := range defaultIgnoreNetwork {
-		_, ipNet, err := net.ParseCIDR(network)
-		if err != nil {
-			log.Fatal(err)
+	// ignore loopback and local interface addresses or subnets, see ignore_local
+	if err := refreshLocalNets(); err != nil {
+		logMain(true, "query system network interface addresses failed:%s", err.Error())
+	}
+	if err := refreshExternalAddrs(); err != nil {
+		logMain(true, "query external interface addresses failed:%s", err.Error())
+	}
+	refreshPublishedPorts()
+
+	if len(ignoreHosts) > 0 {
+		dnsServer = readDnsServer()
+		resolveIgnoreHosts()
+	}
+	if len(cfgIgnoreUrls) > 0 {
+		if err := setupIgnoreUrls(); err != nil {
+			logMain(true, "ignore_url failed:%s", err.Error())
 		}
-		cfgIgnoreIps = append(cfgIgnoreIps, ipNet)
 	}
 
-	// add local interface addresses to ignored list
-	addrs, err := net.InterfaceAddrs()
-	if err != nil {
-		logMain(true, "query system network interface addresses failed:%s", err.Error())
+	if *dryRun {
+		cfgAction = "log_only"
+	}
+	if cfgBlockScore == 0 {
+		cfgBlockScore = cfgScanTrigger + 1
+	}
+
+	if cfgCloudflareToken != "" && cfgCloudflareZone == "" && cfgCloudflareAccount == "" {
+		logMain(true, "cloudflare_token needs cloudflare_zone or cloudflare_account")
+	}
+	if cfgMispUrl != "" && cfgMispKey == "" {
+		logMain(true, "misp_url needs misp_key")
+	}
+	if cfgKubeBlocklist != "" {
+		if err := setupKube(); err != nil {
+			logMain(true, "kube_blocklist %s failed:%s", cfgKubeBlocklist, err.Error())
+		}
+	}
+	if cfgErrorReportUrl != "" {
+		if err := setupErrorReport(); err != nil {
+			logMain(true, "error_report_url %s failed:%s", cfgErrorReportUrl, err.Error())
+		}
+	}
+
+	if cfgPrivsep && cfgRunAsUser == "" {
+		logMain(true, "privsep needs run_as_user")
+	}
+	if cfgPrivsep && len(cfgNetns) > 0 {
+		logMain(true, "netns can't be used with privsep")
+	}
+
+	// strict seccomp forbids exec, commands run in the privileged helper with privsep
+	if cfgSeccomp == "strict" && !cfgPrivsep && (len(cfgKillRoute) > 0 || len(cfgKillRunCmd) > 0 || len(cfgPlugins) > 0 || hasExecResponders()) {
+		logMain(false, "WARNING kill_route, kill_run_cmd, cmd and plugin responders are disabled in strict seccomp mode")
+		cfgKillRoute = nil
+		cfgKillRunCmd = nil
+		cfgKillRouteUndo = nil
+		cfgKillRunCmdUndo = nil
+		cfgPlugins = nil
+		disableExecResponders()
+	}
+	if cfgSeccomp == "strict" && cfgPolicyCmd != "" {
+		logMain(false, "WARNING policy_cmd can't be restarted in strict seccomp mode")
 	}
 
-	for _, addr := range addrs {
-		if addr.Network() == "ip+net" {
-			str := strings.Split(addr.String(), "/")[0]
-			if ip := net.ParseIP(str); ip != nil {
-				if ip = ip.To4(); ip != nil {
-					if !isIgnoredIP(ip) {
-						cfgIgnoreIps = append(cfgIgnoreIps, &net.IPNet{
-							IP:   ip,
-							Mask: net.CIDRMask(32, 32),
-						})
-					}
-				}
+	// commands can't be found in an empty chroot, they must be enabled explicitly
+	if cfgChrootDir != "" && !cfgChrootExec && !cfgPrivsep && (len(cfgKillRoute) > 0 || len(cfgKillRunCmd) > 0 || len(cfgPlugins) > 0 || hasExecResponders()) {
+		logMain(false, "WARNING kill_route, kill_run_cmd, cmd and plugin responders are disabled in chroot, set chroot_exec = true to run them inside %s", cfgChrootDir)
+		cfgKillRoute = nil
+		cfgKillRunCmd = nil
+		cfgKillRouteUndo = nil
+		cfgKillRunCmdUndo = nil
+		cfgPlugins = nil
+		disableExecResponders()
+	}
+	if cfgChrootDir != "" {
+		files := []string{cfgStateFile, cfgPidFile, cfgEventDb, cfgEventLog, cfgControlSocket, cfgBlocklistFile, cfgEvidenceDir}
+		if cfgGeoipLicenseKey != "" {
+			files = append(files, cfgCountryDb, cfgAsnDb)
+		}
+		dir := strings.TrimRight(cfgChrootDir, "/") + "/"
+		for _, file := range files {
+			if file != "" && !strings.HasPrefix(file, dir) {
+				logMain(false, "WARNING %s is outside chroot %s, it can't be updated after chroot", file, cfgChrootDir)
 			}
 		}
 	}
 
+	// first runs with geoip_license_key download the databases
+	if cfgGeoipLicenseKey != "" {
+		fetchMissingGeoip()
+	}
+	if cfgAsnDb != "" {
+		if err := loadAsnDb(cfgAsnDb); err != nil {
+			logMain(true, "load asn_db %s failed:%s", cfgAsnDb, err.Error())
+		}
+	}
+
+	if cfgCountryDb != "" {
+		if err := loadCountryDb(cfgCountryDb, cfgCountryLocations); err != nil {
+			logMain(true, "load country_db %s failed:%s", cfgCountryDb, err.Error())
+		}
+	}
+
+	setupResponders()
+	checkResponseStages()
+	checkIfaceProfiles()
+	checkProfiles()
+	checkSeverity()
+	checkHoneypot()
+	checkThrottle()
+	checkReport()
+	checkHttpApi()
+
 	// set logger
 	if alarmLogger = createLogger(cfgAlarmLog); alarmLogger == nil {
 		logMain(false, "WARNING no alarm log")
@@ -510,69 +2182,819 @@ func configGuard() {
 	if blockedLogger = createLogger(cfgBlockedLog); blockedLogger == nil {
 		logMain(false, "WARNING no blocked log")
 	}
+
+	if cfgEventLog != "" {
+		if err := openEventLog(); err != nil {
+			logMain(true, "open event_log %s failed:%s", cfgEventLog, err.Error())
+		}
+	}
 }
 
 func configEcho() {
 	logMain(false, "+++++++++++++ portguard started +++++++++++++")
 	logMain(false, "+++++++++++++ config +++++++++++++")
-	logMain(false, "+ debug: %v", *debug)
+	logMain(false, "+ config files:%s", strings.Join(cfgFiles, ","))
+	logLevel := "info"
+	if debugEnabled() {
+		logLevel = "debug"
+	}
+	logMain(false, "+ debug: %v log level:%s trace duration:%d", *debug, logLevel, cfgTraceDuration)
+	logMain(false, "+ log time format:%s utc:%v", cfgLogTimeFormat, cfgLogUTC)
 	logMain(false, "+ mode: %s", *mode)
 	logMain(false, "+ monitor port range[%d, %d]", cfgMinPort, cfgMaxPort)
-	var ports []string
-	for port := range cfgExcludePorts {
-		ports = append(ports, strconv.Itoa(port))
+	logMain(false, "+ interfaces:%s", strings.Join(cfgInterfaces, ","))
+	if len(cfgMirrorInterfaces) > 0 {
+		logMain(false, "+ mirror %s learn:%v ttl:%d decap:%s vxlan port:%s", mirrorString(), cfgMirrorLearn, cfgMirrorLearnTtl,
+			mirrorDecapString(), cfgMirrorVxlanPort)
 	}
-
-	logMain(false, "+ exclude ports:%s", strings.Join(ports, ","))
+	logMain(false, "+ capture buffer:%d fanout:%d rcvbuf:%d", cfgCaptureBuffer, cfgCaptureFanout, cfgCaptureRcvbuf)
+	logMain(false, "+ capture error limit:%d stall timeout:%d ops alert url:%q", cfgCaptureErrorLimit, cfgCaptureStallTimeout, cfgOpsAlertUrl)
+	logMain(false, "+ error report url:%q interval:%d", cfgErrorReportUrl, cfgErrorReportInterval)
+	logMain(false, "+ checksum check:%v", cfgChecksumCheck)
+	logMain(false, "+ fingerprint probes:%d window:%d block:%v", cfgFingerprintProbes, cfgFingerprintWindow, cfgFingerprintBlock)
+	logMain(false, "+ synflood source rate:%d total rate:%d cooldown:%d block:%v", cfgSynFloodSourceRate, cfgSynFloodTotalRate, cfgSynFloodCooldown, cfgSynFloodBlock)
+	var addrs []string
+	for _, ip := range cfgListenIps {
+		addrs = append(addrs, ip.String())
+	}
+	logMain(false, "+ listen ip:%s", strings.Join(addrs, ","))
+	logMain(false, "+ exclude ports:%s log:%v", cfgExcludePorts.String(), cfgExcludePortLog)
+	for _, name := range ifaceProfileNames() {
+		logMain(false, "-interface %s %s", name, cfgIfaceProfiles[name].String())
+	}
+	logMain(false, "+ sweep sources:%d window:%d", cfgSweepSources, cfgSweepWindow)
+	logMain(false, "+ trap ports:%s", cfgTrapPorts.String())
+	logMain(false, "+ honeypot ports:%s bytes:%d timeout:%d", cfgHoneypotPorts.String(), cfgHoneypotBytes, cfgHoneypotTimeout)
+	logMain(false, "+ noisy udp ports:%s", cfgNoisyUdpPorts.String())
+	logMain(false, "+ noisy tcp ports:%s", cfgNoisyTcpPorts.String())
+	logMain(false, "+ ignore local:%s interfaces:%s refresh:%d", cfgIgnoreLocal, strings.Join(cfgIgnoreLocalInterfaces, ","), cfgIgnoreLocalRefresh)
+	logMain(false, "+ container networks:%s interfaces:%s docker socket:%s", cfgContainerNetworks, strings.Join(cfgContainerInterfaces, ","), cfgDockerSocket)
+	localNetLock.RLock()
+	for _, network := range localNets {
+		logMain(false, "-%s", network.String())
+	}
+	localNetLock.RUnlock()
 	logMain(false, "+ ignore ip:")
 	for _, network := range cfgIgnoreIps {
 		logMain(false, "-%s", network.String())
 	}
+	logMain(false, "+ external interfaces:%s spoof ttl delta:%d block spoofed:%v", strings.Join(cfgExternalInterfaces, ","), cfgSpoofTtlDelta, cfgBlockSpoofed)
+	logMain(false, "+ bogon filter:%s url:%q refresh:%d", cfgBogonFilter, cfgBogonUrl, cfgBogonRefresh)
+	logMain(false, "+ ignore mac:%s gateway mac:%s", joinMacs(cfgIgnoreMacs), joinMacs(cfgGatewayMacs))
+	logMain(false, "+ vlan capture:%v vlans:%s", cfgVlanCapture, cfgVlans.String())
+	logMain(false, "+ ignore host, refresh:%d", cfgIgnoreHostRefresh)
+	for _, h := range ignoreHosts {
+		logMain(false, "-%s %s", h.name, joinIps(h.ips))
+	}
+	logMain(false, "+ ignore url:%s refresh:%d ca:%q key:%v", ignoreUrlString(), cfgIgnoreUrlRefresh, cfgIgnoreUrlCa, cfgIgnoreUrlKey != nil)
 	logMain(false, "+ scan trigger:%d", cfgScanTrigger)
-	logMain(false, "+ kill route:%q", cfgKillRoute)
-	logMain(false, "+ kill run cmd:%q", cfgKillRunCmd)
+	logMain(false, "+ max tracked ips:%d eviction:%s idle timeout:%d", cfgMaxTrackedIps, cfgTrackedEviction, cfgTrackIdleTimeout)
+	logMain(false, "+ reputation cache max:%d eviction:%s", cfgReputationCacheMax, cfgReputationEviction)
+	logMain(false, "+ event queue:%d drop:%s", cfgEventQueue, cfgEventQueueDrop)
+	logMain(false, "+ port cache duration:%d max:%d closed:%dms eviction:%s", cfgPortCacheDuration, cfgPortCacheMax, cfgClosedPortCacheMs, cfgPortCacheEviction)
+	logMain(false, "+ advanced ports:%d refresh:%d", cfgAdvancedPorts, cfgAdvancedRefresh)
+	logMain(false, "+ overload protection:%v backlog:%d drops:%d sample:%d cooldown:%d", cfgOverloadProtection, cfgOverloadBacklog, cfgOverloadDrops, cfgOverloadSample, cfgOverloadCooldown)
+	logMain(false, "+ anomaly factor:%d hours:%d learn:%d min:%d", cfgAnomalyFactor, cfgAnomalyHours, cfgAnomalyLearn, cfgAnomalyMin)
+	for port, weight := range cfgPortWeights {
+		logMain(false, "-port %d weight:%d", port, weight)
+	}
+	for key, action := range scanTypeActions {
+		logMain(false, "-scan type %s action:%s", key, action)
+	}
+	for key, trigger := range scanTypeTriggers {
+		logMain(false, "-scan type %s trigger:%d", key, trigger)
+	}
+	for class, action := range udpPayloadActions {
+		logMain(false, "-udp payload %s action:%s", class, action)
+	}
+	logMain(false, "+ kill route:%q undo:%q", cfgKillRoute, cfgKillRouteUndo)
+	logMain(false, "+ kill run cmd:%q undo:%q", cfgKillRunCmd, cfgKillRunCmdUndo)
 	logMain(false, "+ kill notify url:%q", cfgKillNotifyUrl)
+	logMain(false, "+ cmd timeout:%d", cfgCmdTimeout)
+	logMain(false, "+ audit log:%q", cfgAuditLogPath)
+	logMain(false, "+ fail2ban log:%q jail:%q socket:%s", cfgFail2banLogPath, cfgFail2banJail, cfgFail2banSocket)
+	logMain(false, "+ windows firewall:%v", cfgWindowsFirewall)
+	logMain(false, "+ pf table:%q expire:%d", cfgPfTable, cfgPfTableExpire)
+	logMain(false, "+ nft set:%q ipset:%q batch interval:%dms max:%d", cfgNftSet, cfgIpset, cfgFirewallBatchInterval, cfgFirewallBatchMax)
+	logMain(false, "+ fw4 set:%q include:%s ubus events:%v", cfgFw4Set, cfgFw4Include, cfgUbusEvents)
+	logMain(false, "+ firewall action:%s throttle rate:%s", cfgFirewallAction, cfgThrottleRate)
+	logMain(false, "+ active response:%v rate:%d", cfgActiveResponse, cfgActiveResponseRate)
+	logMain(false, "+ blackhole route:%q table:%d conntrack flush:%v", cfgBlackholeRoute, cfgBlackholeRouteTable, cfgConntrackFlush)
+	logMain(false, "+ nflog group:%d", cfgNflogGroup)
+	logMain(false, "+ arp scan threshold:%d window:%d", cfgArpScanThreshold, cfgArpScanWindow)
+	logMain(false, "+ connect scan ports:%d window:%d lifetime:%d", cfgConnectScanPorts, cfgConnectScanWindow, cfgConnectScanLifetime)
+	logMain(false, "+ netns:%s", strings.Join(cfgNetns, ","))
+	logMain(false, "+ nfqueue:%d score:%d", cfgNfqueue, cfgNfqueueScore)
+	logMain(false, "+ xdp interfaces:%s mode:%s map pin:%q max entries:%d", strings.Join(cfgXdpInterfaces, ","), cfgXdpMode, cfgXdpMapPin, cfgXdpMaxEntries)
+	logMain(false, "+ firewalld zone:%q ipset:%q permanent:%v", cfgFirewalldZone, cfgFirewalldIPSet, cfgFirewalldPerm)
+	logMain(false, "+ aws nacl:%q region:%q rules:[%d, %d)", cfgAwsNaclId, cfgAwsRegion, cfgAwsNaclRuleStart, cfgAwsNaclRuleStart+cfgAwsNaclRuleCount)
+	logMain(false, "+ cloudflare zone:%q account:%q", cfgCloudflareZone, cfgCloudflareAccount)
+	logMain(false, "+ kube blocklist:%q name:%q api:%q", cfgKubeBlocklist, cfgKubeBlocklistName, cfgKubeApi)
+	logMain(false, "+ block duration:%d max:%d", cfgBlockDuration, cfgBlockDurationMax)
+	logMain(false, "+ severity:%s", severityString())
+	logMain(false, "+ profile:%s", cfgProfile)
+	for _, name := range profileNames() {
+		p := cfgProfiles[name]
+		logMain(false, "-profile %s scan trigger:%d block score:%d block duration:%d responders:%s", name, p.scanTrigger, p.blockScore, p.blockDuration, strings.Join(p.responders, ","))
+	}
+	logMain(false, "+ action:%s", cfgAction)
+	logMain(false, "+ scoring:%s block score:%d rate interval:%dms weight:%d", cfgScoring, blockThreshold(), cfgRateInterval, cfgRateWeight)
+	logMain(false, "+ asn db:%q entries:%d block:%d never block:%d", cfgAsnDb, len(asnTable), len(cfgAsnBlock), len(cfgAsnNeverBlock))
+	logMain(false, "+ country db:%q entries:%d block:%d never block:%d", cfgCountryDb, len(countryTable), len(cfgCountryBlock), len(cfgCountryNeverBlock))
+	logMain(false, "+ geoip account id:%q update interval:%d url:%q", cfgGeoipAccountId, cfgGeoipUpdateInterval, cfgGeoipUrl)
+	logMain(false, "+ reputation url:%q field:%q ttl:%d block:%v weight:%d", cfgReputationUrl, cfgReputationField, cfgReputationTtl, cfgReputationBlock, cfgReputationWeight)
+	logMain(false, "+ policy cmd:%q timeout:%dms", cfgPolicyCmd, cfgPolicyTimeout)
+	var names []string
+	for _, r := range responders {
+		names = append(names, r.Name())
+	}
+	logMain(false, "+ responders:%s mode:%s workers:%d queue:%d", strings.Join(names, ","), cfgResponderMode, cfgResponderWorkers, cfgResponderQueue)
+	logMain(false, "+ exec rate:%d burst:%d", cfgExecRate, cfgExecBurst)
+	for i, stage := range cfgResponseStages {
+		action := stageAlarm
+		if len(stage.responders) > 0 {
+			action = strings.Join(stage.responders, ",")
+		}
+		logMain(false, "+ response stage %d: score %d %s", i+1, stage.score, action)
+	}
+	for _, conf := range cfgResponders {
+		logMain(false, "-%s type:%q timeout:%d when:%q enabled:%v on failure:%s retries:%d delay:%d",
+			conf.name, conf.kind, conf.timeout, conf.when.String(), conf.enabled, conf.onFailure, conf.retries, conf.retryDelay)
+	}
+	logMain(false, "+ cluster listen:%q node:%q peers:%s sync interval:%d", cfgClusterListen, cfgClusterNode, strings.Join(cfgClusterPeers, ","), cfgClusterSyncInterval)
+	logMain(false, "+ kv backend:%q url:%q prefix:%q poll:%d", cfgKvBackend, cfgKvUrl, cfgKvPrefix, cfgKvPoll)
+	logMain(false, "+ score addr:%q", cfgScoreAddr)
+	logMain(false, "+ blocklist addr:%q file:%q format:%s interval:%d", cfgBlocklistAddr, cfgBlocklistFile, cfgBlocklistFormat, cfgBlocklistInterval)
+	logMain(false, "+ blocklist aggregate:%v max entries:%d min prefix:/%d", cfgBlocklistAggregate, cfgBlocklistMaxEntries, cfgBlocklistMinPrefix)
+	logMain(false, "+ stats interval:%d", cfgStatsInterval)
+	logMain(false, "+ health addr:%q max idle:%d max responder failure:%d%%", cfgHealthAddr, cfgHealthMaxIdle, cfgHealthMaxResponderFailure)
+	logMain(false, "+ http api:%s", httpApiString())
+	logMain(false, "+ api tokens:%s", apiTokenString())
+	logMain(false, "+ journald:%v", cfgJournald)
+	logMain(false, "+ wazuh output:%q socket:%s", cfgWazuhOutput, cfgWazuhSocket)
+	logMain(false, "+ event socket:%q", cfgEventSocket)
+	logMain(false, "+ statsd addr:%q prefix:%q tags:%s interval:%d", cfgStatsdAddr, cfgStatsdPrefix, strings.Join(cfgStatsdTags, ","), cfgStatsdInterval)
+	logMain(false, "+ snmp trap:%q version:%s user:%q auth:%s/%v priv:%v oid:%s alarms:%v", cfgSnmpTrap, cfgSnmpVersion, cfgSnmpUser, cfgSnmpAuthProtocol, cfgSnmpAuthPassword != "", cfgSnmpPrivPassword != "", cfgSnmpEnterpriseOid, cfgSnmpTrapAlarms)
+	logMain(false, "+ ipfix collector:%q enterprise id:%d domain id:%d", cfgIpfixCollector, cfgIpfixEnterpriseId, cfgIpfixDomainId)
+	logMain(false, "+ otlp endpoint:%q interval:%d", cfgOtlpEndpoint, cfgOtlpInterval)
+	logMain(false, "+ loki url:%q labels:%s", cfgLokiUrl, strings.Join(cfgLokiLabels, ","))
+	logMain(false, "+ elastic url:%q index:%s buffer:%d", cfgElasticUrl, cfgElasticIndex, cfgElasticBuffer)
+	logMain(false, "+ misp:%s", mispString())
+	logMain(false, "+ stix dir:%q interval:%d taxii url:%q", cfgStixDir, cfgStixInterval, cfgTaxiiUrl)
+	logMain(false, "+ digest interval:%d url:%q", cfgDigestInterval, cfgDigestUrl)
+	logMain(false, "+ report:%s", reportString())
+	logMain(false, "+ alarm suppress after:%d window:%d rate limit:%d/min", cfgAlarmSuppressAfter, cfgAlarmSuppressWindow, cfgAlarmRateLimit)
 	logMain(false, "+ alarm log file:%q", cfgAlarmLogPath)
 	logMain(false, "+ blocked log file:%q", cfgBlockedLogPath)
+	logMain(false, "+ state file:%q", cfgStateFile)
+	logMain(false, "+ event db:%q retention:%d", cfgEventDb, cfgEventDbRetention)
+	logMain(false, "+ listen baseline:%v interval:%d allow:%s", cfgListenBaseline, cfgListenBaselineInterval, cfgListenBaselineAllow.String())
+	logMain(false, "+ evidence dir:%q ring:%d hosts:%d max files:%d max size:%dKB duration:%d", cfgEvidenceDir, cfgEvidenceRing, cfgEvidenceHosts, cfgEvidenceMaxFiles, cfgEvidenceMaxSize, cfgEvidenceDuration)
+	logMain(false, "+ control socket:%q", cfgControlSocket)
+	logMain(false, "+ block intake:%q", cfgBlockIntake)
+	logMain(false, "+ event log:%q max size:%dMB keep:%d", cfgEventLog, cfgEventLogMaxSize, cfgEventLogKeep)
+	logMain(false, "+ pid file:%q", cfgPidFile)
+	logMain(false, "+ run as user:%q group:%q privsep:%v", cfgRunAsUser, cfgRunAsGroup, cfgPrivsep)
+	logMain(false, "+ seccomp:%s", cfgSeccomp)
+	logMain(false, "+ chroot dir:%q exec:%v", cfgChrootDir, cfgChrootExec)
 	logMain(false, "++++++++++++++++++ end ++++++++++++++++")
 }
 
+// subcommands, flags go before or right after the name; without one portguard runs,
+// so "portguard guard.conf" still works
+var subcommands = []struct {
+	name  string
+	args  int // arguments before the config file
+	usage string
+}{
+	{"run", 0, "run [configFile], - reads it from stdin"},
+	{"check", 0, "check [configFile]"},
+	{"status", 0, "status [configFile]"},
+	{"block", 1, "block <ip> [configFile]"},
+	{"unblock", 1, "unblock <ip> [configFile]"},
+	{"trust", 1, "trust [-for 30m] <ip> [configFile], -for 0 ends the trust"},
+	{"export", 0, "export [-format json|csv|cidr] [configFile]"},
+	{"import", 1, "import <file> [configFile]"},
+	{"host", 1, "host [-days 30] <ip> [configFile]"},
+	{"profile", 1, "profile <name>|default [configFile]"},
+	{"events", 1, "events [-days 30] <ip or cidr> [configFile]"},
+	{"health", 0, "health [configFile]"},
+	{"test-responders", 0, "test-responders [-ip 192.0.2.1] [-port 23] [configFile], fires the responders for a test block"},
+	{"replay", 1, "replay capture.pcap [configFile]"},
+	{"genprofile", 1, "genprofile systemd|apparmor|seccomp [configFile]"},
+	{"scan", 1, "scan [-type syn] [-ports 1-1024] [-rate 100] <host>"},
+	{"init", 0, "init [-yes] [outputFile], writes a config for this host, to stdout without a file"},
+	{"version", 0, "version"},
+}
+
 func usage() {
-	fmt.Fprintf(os.Stderr, "usage: %s [configFile]\n", os.Args[0])
+	for i, sc := range subcommands {
+		prefix := "usage:"
+		if i > 0 {
+			prefix = "      "
+		}
+		fmt.Fprintf(os.Stderr, "%s %s [flags] %s\n", prefix, os.Args[0], sc.usage)
+	}
+	fmt.Fprintf(os.Stderr, "       %s [flags] [configFile], same as run\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nflags:\n")
 	flag.PrintDefaults()
 	os.Exit(1)
 }
 
+// pretty print a json result of the control socket
+func printJson(result json.RawMessage) {
+	var out bytes.Buffer
+	json.Indent(&out, result, "", "  ")
+	fmt.Println(out.String())
+}
+
 func main() {
 
 	mode = flag.String("m", "tcp", "portguard work mode: tcp or udp")
 	debug = flag.Bool("d", false, "debug mode, print log to stderr")
-	portCacheDuration = flag.Int64("duration", 120, "port cache duration")
+	daemon = flag.Bool("daemon", false, "run in background")
+	dryRun = flag.Bool("dry-run", false, "detect and log normally, but only log what responders would run")
+	selftestMode = flag.Bool("selftest", false, "probe closed local ports, check that alarms and blocks fire, and exit")
+	checkPrivs = flag.Bool("check-privileges", false, "report capabilities needed by configured features and exit")
+	queryDays := flag.Int("days", 30, "days of events to query")
+	scanType := flag.String("type", "syn", "scan probes: syn, null, xmas or udp")
+	scanPorts := flag.String("ports", "1-1024", "ports to scan, like 22,80,8000-8100")
+	scanRate := flag.Int("rate", 100, "scan probes per second")
+	trustFor := flag.Duration("for", defaultTrustDuration, "how long trust ignores a host")
+	exportFormat := flag.String("format", "json", "export format: json, csv or cidr")
+	initYes := flag.Bool("yes", false, "init: take the defaults instead of asking")
+	testIp := flag.String("ip", "192.0.2.1", "test-responders: host of the test block")
+	testPort := flag.Int("port", 23, "test-responders: port of the test block")
+	portCacheDuration = flag.Int64("duration", 120, "port cache duration, overrides port_cache_duration")
 
 	flag.Usage = usage
 	flag.Parse()
 
-	if *debug {
+	cmd, target, args := "run", "", flag.Args()
+	for _, sc := range subcommands {
+		if len(args) == 0 || args[0] != sc.name {
+			continue
+		}
+		cmd = sc.name
+		flag.CommandLine.Parse(args[1:])
+		args = flag.Args()
+		if len(args) < sc.args {
+			usage()
+		}
+		if sc.args > 0 {
+			// flags may follow the target too, like trust 1.2.3.4 -for 1h
+			target = args[0]
+			flag.CommandLine.Parse(args[1:])
+			args = flag.Args()
+		}
+		break
+	}
+	if len(args) > 1 || cmd == "version" && len(args) > 0 {
+		usage()
+	}
+	if cmd == "version" {
+		fmt.Printf("portguard %s %s %s/%s\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+		return
+	}
+	if cmd == "scan" {
+		if len(args) > 0 {
+			usage()
+		}
+		mainLogger = log.New(io.Writer(os.Stderr), "", log.Ldate|log.Lmicroseconds)
+		if err := runScan(target, *scanType, *scanPorts, *scanRate); err != nil {
+			logMain(true, "scan %s failed:%s", target, err.Error())
+		}
+		return
+	}
+	if cmd == "init" {
+		mainLogger = log.New(io.Writer(os.Stderr), "", log.Ldate|log.Lmicroseconds)
+		file := ""
+		if len(args) > 0 {
+			file = args[0]
+		}
+		if err := runInit(file, *initYes); err != nil {
+			logMain(true, "init failed:%s", err.Error())
+		}
+		return
+	}
+
+	if *debug || cmd != "run" {
 		mainLogger = log.New(io.Writer(os.Stderr), "", log.Ldate|log.Lmicroseconds)
 	} else {
 		var err error
-		if mainLogger, err = syslog.NewLogger(syslog.LOG_ERR|syslog.LOG_LOCAL7, log.Ldate|log.Lmicroseconds); err != nil {
+		if mainLogger, err = openSystemLogger(); err != nil {
 			logMain(true, "open syslog failed:%s", err.Error())
 		}
 	}
 
-	args := flag.Args()
 	if len(args) > 0 {
 		readConfigFile(args[0])
 	}
+	applyConfigEnv()
+	configLoaded = time.Now()
+	setLogTime(mainLogger)
+	switch cmd {
+	case "events":
+		if err := queryEvents(os.Stdout, target, *queryDays); err != nil {
+			logMain(true, "query events of %s failed:%s", target, err.Error())
+		}
+		return
+	case "host":
+		result, err := controlCall("host", target, strconv.Itoa(*queryDays))
+		if err != nil {
+			logMain(true, "query host %s failed:%s", target, err.Error())
+		}
+		printJson(result)
+		return
+	case "genprofile":
+		if err := genProfile(os.Stdout, target); err != nil {
+			logMain(true, "genprofile failed:%s", err.Error())
+		}
+		return
+	case "health":
+		result, err := controlCall("health")
+		if err != nil {
+			logMain(true, "query health failed:%s", err.Error())
+		}
+		printJson(result)
+		var report healthReport
+		if json.Unmarshal(result, &report) != nil || report.Status != "ok" {
+			os.Exit(1)
+		}
+		return
+	case "profile":
+		result, err := controlCall("profile", target)
+		if err != nil {
+			logMain(true, "switch to profile %s failed:%s", target, err.Error())
+		}
+		printJson(result)
+		return
+	case "status":
+		result, err := controlCall("status")
+		if err != nil {
+			logMain(true, "query status failed:%s", err.Error())
+		}
+		printJson(result)
+		return
+	case "block", "unblock":
+		if _, err := controlCall(cmd, target); err != nil {
+			logMain(true, "%s %s failed:%s", cmd, target, err.Error())
+		}
+		fmt.Printf("%s %sed\n", target, cmd)
+		return
+	case "test-responders":
+		// the last undo may take up to cmd_timeout after the test's time is up
+		result, err := controlCallTimeout(responderTestTimeout+time.Minute, "test-responders", *testIp, strconv.Itoa(*testPort))
+		if err != nil {
+			logMain(true, "test responders failed:%s", err.Error())
+		}
+		printJson(result)
+		var results []responderTestResult
+		json.Unmarshal(result, &results)
+		for _, r := range results {
+			if r.Status == "failed" || strings.HasPrefix(r.Undo, "failed") {
+				os.Exit(1)
+			}
+		}
+		return
+	case "trust":
+		duration := trustFor.String()
+		if *trustFor <= 0 {
+			duration = "off"
+		}
+		result, err := controlCall("trust", target, duration)
+		if err != nil {
+			logMain(true, "trust %s failed:%s", target, err.Error())
+		}
+		printJson(result)
+		return
+	case "export":
+		write, ok := exportFormats[*exportFormat]
+		if !ok {
+			logMain(true, "unknown export format %s, should be json, csv or cidr", *exportFormat)
+		}
+		result, err := controlCall("export")
+		if err != nil {
+			logMain(true, "export failed:%s", err.Error())
+		}
+		var entries []*hostEntry
+		if err := json.Unmarshal(result, &entries); err != nil {
+			logMain(true, "export failed:%s", err.Error())
+		}
+		if err := write(os.Stdout, entries); err != nil {
+			logMain(true, "export failed:%s", err.Error())
+		}
+		return
+	case "import":
+		data, err := os.ReadFile(target)
+		if err != nil {
+			logMain(true, "import %s failed:%s", target, err.Error())
+		}
+		entries, err := parseHostEntries(data)
+		if err != nil {
+			logMain(true, "import %s failed:%s", target, err.Error())
+		}
+		request, _ := json.Marshal(entries)
+		result, err := controlCall("import", string(request))
+		if err != nil {
+			logMain(true, "import %s failed:%s", target, err.Error())
+		}
+		printJson(result)
+		return
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "duration" {
+			cfgPortCacheDuration = *portCacheDuration
+		}
+	})
 	configGuard()
+
+	if cmd == "replay" {
+		if *mode != "tcp" && *mode != "udp" {
+			logMain(true, "don't support mode: %s", *mode)
+		}
+		replay(target)
+		return
+	}
+	if cmd == "check" {
+		if *mode != "tcp" && *mode != "udp" {
+			logMain(true, "don't support mode: %s", *mode)
+		}
+		configEcho()
+		fmt.Println("config ok:", strings.Join(cfgFiles, " "))
+		return
+	}
+	if isPrivHelper() {
+		runPrivHelper()
+		return
+	}
+
+	if *checkPrivs {
+		if !checkPrivileges() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	configEcho()
+	verifyCaptureCaps()
+
+	if *selftestMode {
+		if *mode != "tcp" && *mode != "udp" {
+			logMain(true, "don't support mode: %s", *mode)
+		}
+		if !selftest() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// opened after selftest, its made up alarms and blocks don't reach them
+	if cfgJournald {
+		if err := openJournal(); err != nil {
+			logMain(true, "open journald socket %s failed:%s", journalSocket, err.Error())
+		}
+		if !*debug {
+			mainLogger = log.New(journalWriter{}, "", 0)
+		}
+	}
+	if cfgWazuhOutput != "" {
+		if err := openWazuh(); err != nil {
+			logMain(true, "open wazuh socket %s failed:%s", cfgWazuhSocket, err.Error())
+		}
+	}
+	if cfgEventSocket != "" {
+		if err := openEventSocket(); err != nil {
+			logMain(true, "open event_socket %s failed:%s", cfgEventSocket, err.Error())
+		}
+	}
+
+	if *daemon {
+		// checked before forking too, so a second start fails with a status init scripts see
+		if cfgPidFile != "" {
+			if pid, running := readPidFile(cfgPidFile); running {
+				logMain(true, "portguard already running, pid:%d", pid)
+			}
+		}
+		daemonize()
+	}
+	if cfgPidFile != "" {
+		if err := writePidFile(cfgPidFile); err != nil {
+			logMain(true, "write pid file %s failed:%s", cfgPidFile, err.Error())
+		}
+	}
+
+	if cfgStateFile != "" {
+		if err := loadState(cfgStateFile); err != nil {
+			logMain(true, "load state from %s failed:%s", cfgStateFile, err.Error())
+		}
+	}
+	if cfgActiveResponse {
+		if err := startActiveResponse(); err != nil {
+			logMain(true, "open raw socket for active_response failed:%s", err.Error())
+		}
+	}
+	if cfgFw4Set != "" {
+		if err := setupFw4(); err != nil {
+			logMain(true, "set up fw4 set %s failed:%s", cfgFw4Set, err.Error())
+		}
+	}
+	if cfgNftSet != "" || cfgFw4Set != "" || cfgIpset != "" {
+		syncFirewallSets()
+	}
+	if cfgAwsNaclId != "" {
+		syncAwsNacl()
+	}
+	if cfgBlackholeRoute != "" {
+		if err := syncBlackholeRoutes(); err != nil {
+			logMain(false, "sync %s routes failed:%s", cfgBlackholeRoute, err.Error())
+		}
+	}
+	if len(cfgXdpInterfaces) > 0 {
+		if err := startXdp(); err != nil {
+			logMain(true, "start xdp failed:%s", err.Error())
+		}
+	}
+	if cfgListenBaseline {
+		go runListenBaseline()
+	}
+	if cfgEvidenceDir != "" {
+		if fi, err := os.Stat(cfgEvidenceDir); err != nil || !fi.IsDir() {
+			logMain(true, "evidence_dir %s isn't a directory", cfgEvidenceDir)
+		}
+		go runEvidenceSweep()
+	}
+	if cfgEventDb != "" {
+		if err := openEventDb(); err != nil {
+			logMain(true, "open event_db %s failed:%s", cfgEventDb, err.Error())
+		}
+	}
+	if cfgBlockIntake != "" {
+		if err := startBlockIntake(); err != nil {
+			logMain(true, "open block_intake %s failed:%s", cfgBlockIntake, err.Error())
+		}
+	}
+	if cfgControlSocket != "" {
+		if err := startControl(); err != nil {
+			logMain(true, "listen on control_socket %s failed:%s", cfgControlSocket, err.Error())
+		}
+	}
+	if cfgClusterListen != "" {
+		if err := startCluster(); err != nil {
+			logMain(true, "start cluster on %s failed:%s", cfgClusterListen, err.Error())
+		}
+	}
+	if cfgKvBackend != "" {
+		if err := startKvStore(); err != nil {
+			logMain(true, "read kv store %s failed:%s", cfgKvUrl, err.Error())
+		}
+	}
+	if err := setupHttpApi(); err != nil {
+		logMain(true, "load http_tls_cert %s failed:%s", cfgHttpTlsCert, err.Error())
+	}
+	if cfgHealthAddr != "" {
+		if err := startHealth(); err != nil {
+			logMain(true, "listen on health_addr %s failed:%s", cfgHealthAddr, err.Error())
+		}
+	}
+	if cfgScoreAddr != "" {
+		if err := startScore(); err != nil {
+			logMain(true, "listen on score_addr %s failed:%s", cfgScoreAddr, err.Error())
+		}
+	}
+	if cfgBlocklistAddr != "" {
+		if err := startBlocklist(); err != nil {
+			logMain(true, "listen on blocklist_addr %s failed:%s", cfgBlocklistAddr, err.Error())
+		}
+	}
+	if cfgBlocklistFile != "" {
+		go runBlocklistExport()
+	}
+	go runSweepExpiry()
+	if len(cfgHoneypotPorts) > 0 && *mode == "tcp" {
+		if err := startHoneypot(); err != nil {
+			logMain(true, "listen on honeypot_port failed:%s", err.Error())
+		}
+	}
 
+	var guard func(packetConn, net.IP, string)
 	if *mode == "tcp" {
-		tcpGuard()
+		guard = tcpGuard
 	} else if *mode == "udp" {
-		udpGuard()
+		guard = udpGuard
 	} else {
 		fmt.Fprintf(os.Stderr, "don't support mode: %s\n", *mode)
+		return
+	}
+
+	// one guard per interface and listen ip, capture_fanout guards with af_packet fanout
+	// empty name means all interfaces, serverIp means all local addresses
+	ifaces := append(append([]string(nil), cfgInterfaces...), cfgMirrorInterfaces...)
+	if len(ifaces) == 0 {
+		ifaces = []string{""}
+	}
+	laddrs := cfgListenIps
+	if len(laddrs) == 0 {
+		laddrs = []net.IP{serverIp}
+	}
+	setupWatchdog()
+	if cfgAdvancedPorts > 0 {
+		refreshAdvanced()
+	}
+	var wg sync.WaitGroup
+	for _, iface := range ifaces {
+		addrs := laddrs
+		if isMirrorIface(iface) {
+			// a mirror port carries traffic to the hosts of the segment, not to a listen ip
+			addrs = []net.IP{serverIp}
+		}
+		for _, laddr := range addrs {
+			for q := 0; q < cfgCaptureFanout; q++ {
+				conn := listenGuard("ip4:"+*mode, iface, laddr)
+				wg.Add(1)
+				go func(iface string, laddr net.IP) {
+					defer wg.Done()
+					runGuard(guard, conn, laddr, iface)
+				}(iface, laddr)
+			}
+		}
+	}
+	for _, path := range cfgNetns {
+		if err := startNetnsGuard(path, guard, &wg); err != nil {
+			logMain(true, "enter netns %s failed:%s", path, err.Error())
+		}
+	}
+	if cfgNfqueue >= 0 {
+		if err := startNfqueue(cfgNfqueue); err != nil {
+			logMain(true, "bind nfqueue %d failed:%s", cfgNfqueue, err.Error())
+		}
+	}
+	if cfgConnectScanPorts > 0 && *mode == "tcp" {
+		if err := startConnectScan(); err != nil {
+			logMain(true, "subscribe to conntrack events failed:%s", err.Error())
+		}
+	}
+	if cfgArpScanThreshold > 0 {
+		if err := startArpScan(); err != nil {
+			logMain(true, "open arp capture failed:%s", err.Error())
+		}
+	}
+	if cfgNflogGroup >= 0 {
+		conn, err := openNflog(cfgNflogGroup)
+		if err != nil {
+			logMain(true, "open nflog_group %d failed:%s", cfgNflogGroup, err.Error())
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runGuard(guard, conn, serverIp, "")
+		}()
+	}
+
+	if cfgStatsdAddr != "" {
+		if err := openStatsd(); err != nil {
+			logMain(true, "open statsd %s failed:%s", cfgStatsdAddr, err.Error())
+		}
+	}
+	if cfgSnmpTrap != "" {
+		if cfgSnmpVersion == "3" && cfgSnmpUser == "" {
+			logMain(true, "snmp_version 3 needs snmp_user")
+		}
+		if err := openSnmp(); err != nil {
+			logMain(true, "open snmp trap %s failed:%s", cfgSnmpTrap, err.Error())
+		}
+		if cfgSnmpVersion == "3" {
+			logMain(false, "snmp engine id of traps:%x", snmpEngineId)
+		}
+	}
+	if cfgIpfixCollector != "" {
+		if err := openIpfix(); err != nil {
+			logMain(true, "open ipfix collector %s failed:%s", cfgIpfixCollector, err.Error())
+		}
+	}
+
+	// started before chroot and seccomp, it's restarted on failure if they allow
+	if cfgPolicyCmd != "" {
+		if err := startPolicy(); err != nil {
+			logMain(true, "start policy_cmd %s failed:%s", cfgPolicyCmd, err.Error())
+		}
+	}
+
+	// sockets and log files are open, root is no longer needed
+	// nothing to drop if started without root, e.g. by setcap
+	dropRoot := cfgRunAsUser != "" && os.Geteuid() == 0
+	if cfgPrivsep && dropRoot {
+		if err := startPrivHelper(); err != nil {
+			logMain(true, "start privileged helper failed:%s", err.Error())
+		}
+	}
+	var uid, gid int
+	if dropRoot {
+		var err error
+		if uid, gid, err = lookupIds(cfgRunAsUser, cfgRunAsGroup); err != nil {
+			logMain(true, "lookup user %s failed:%s", cfgRunAsUser, err.Error())
+		}
+	}
+
+	if cfgChrootDir != "" {
+		if err := enterChroot(cfgChrootDir); err != nil {
+			logMain(true, "chroot to %s failed:%s", cfgChrootDir, err.Error())
+		}
+	}
+
+	if dropRoot {
+		if err := dropPrivileges(uid, gid); err != nil {
+			logMain(true, "drop privileges to %s failed:%s", cfgRunAsUser, err.Error())
+		}
+	}
+
+	if cfgSeccomp != "off" {
+		if err := applySeccomp(cfgSeccomp == "strict"); err != nil {
+			logMain(true, "apply seccomp filter failed:%s", err.Error())
+		}
+	}
+
+	// all sockets are open, tell systemd we are ready
+	if err := sdNotify("READY=1"); err != nil {
+		logMain(false, "sd_notify failed:%s", err.Error())
+	}
+	go runWatchdog()
+	if cfgStatsInterval > 0 {
+		go runStats()
+	}
+	if statsdConn != nil && cfgStatsdInterval > 0 {
+		go runStatsd()
+	}
+	if cfgOtlpEndpoint != "" {
+		startOtlp()
+	}
+	if cfgElasticUrl != "" {
+		startElastic()
+	}
+	if cfgLokiUrl != "" {
+		startLoki()
+	}
+	if cfgMispUrl != "" {
+		startMisp()
+	}
+	if cfgStixDir != "" || cfgTaxiiUrl != "" {
+		startStix()
+	}
+	if cfgUbusEvents {
+		startUbus()
+	}
+	if cfgDigestInterval > 0 {
+		go runDigest()
+	}
+	if cfgReportInterval != "" {
+		go runReport()
+	}
+	if cfgReputationUrl != "" {
+		go runReputationExpiry()
+	}
+	if cfgAlarmSuppressAfter > 0 || cfgAlarmRateLimit > 0 {
+		go runAlarmSuppress()
+	}
+	// block requests may set a ttl though blocks last for ever
+	if cfgBlockDuration > 0 || cfgBlockIntake != "" || cfgControlSocket != "" {
+		go runBlockExpiry()
+	}
+	if cfgTrackIdleTimeout > 0 {
+		go runIdleExpiry()
+	}
+	if eventDb != nil && cfgEventDbRetention > 0 {
+		go runEventDbCompact()
+	}
+	if cfgPortCacheDuration > 0 || cfgClosedPortCacheMs > 0 {
+		go runPortCacheSweep()
+	}
+	if cfgAdvancedPorts > 0 {
+		go runAdvancedRefresh()
+	}
+	if cfgOverloadProtection {
+		go runOverloadWatch()
+	}
+	if cfgAnomalyFactor > 0 {
+		go runAnomalyWatch()
+	}
+	go runDebugSignals()
+	go runReloadSignal()
+	if len(ignoreHosts) > 0 {
+		go runIgnoreHostRefresh()
+	}
+	if len(cfgIgnoreUrls) > 0 {
+		go runIgnoreUrlRefresh()
+	}
+	if cfgBogonUrl != "" && cfgBogonFilter != bogonOff {
+		go runBogonRefresh()
+	}
+	if cfgGeoipLicenseKey != "" && cfgGeoipUpdateInterval > 0 && (cfgCountryDb != "" || cfgAsnDb != "") {
+		go runGeoipUpdate()
+	}
+	if (cfgIgnoreLocal != "off" || len(cfgExternalInterfaces) > 0 || cfgContainerNetworks != "off") && cfgIgnoreLocalRefresh > 0 {
+		go runLocalRefresh()
+	}
+	if cfgPfTable != "" && cfgPfTableExpire > 0 {
+		go runPfExpire(cfgPfTable, cfgPfTableExpire)
 	}
+	waitSignal(&wg)
 }
@@ -0,0 +1,84 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+// portguard settings a test guard needs, set once
+func setupTestGuard(t *testing.T, proto string) {
+	t.Helper()
+	if mode == nil {
+		mode, debug, dryRun = new(string), new(bool), new(bool)
+		portCacheDuration = new(int64)
+	}
+	*mode = proto
+	serverIp = net.IPv4(198, 51, 100, 7).To4()
+	cfgScanTrigger = 2
+	cfgBlockScore = cfgScanTrigger + 1
+	cfgAction = "log_only"
+	cfgCaptureBuffer = captureBufferSize()
+}
+
+// probes of closed ports up to the trigger block the host, probes of ports in use don't count
+func TestTcpGuardBlocks(t *testing.T) {
+	setupTestGuard(t, "tcp")
+	verifier = newFakeVerifier(22)
+	src := net.IPv4(203, 0, 114, 10).To4()
+
+	conn := newFakeConn()
+	done := make(chan struct{})
+	go func() {
+		tcpGuard(conn, serverIp, "")
+		close(done)
+	}()
+	for _, port := range []int{22, 22, 22, 23, 25} {
+		conn.Inject(fakeTcpPacket(src, serverIp, port, SYN))
+	}
+	// an ack isn't a probe
+	conn.Inject(fakeTcpPacket(src, serverIp, 80, ACK))
+	conn.Close()
+	<-done
+	if isBlockedIP(src.String()) {
+		t.Fatalf("%s blocked after probing 2 closed ports, trigger is %d", src, cfgScanTrigger)
+	}
+
+	conn = newFakeConn()
+	done = make(chan struct{})
+	go func() {
+		tcpGuard(conn, serverIp, "")
+		close(done)
+	}()
+	conn.Inject(fakeTcpPacket(src, serverIp, 110, SYN))
+	conn.Close()
+	<-done
+	if !isBlockedIP(src.String()) {
+		t.Fatalf("%s not blocked after probing 3 closed ports", src)
+	}
+}
+
+func TestUdpGuardAlarms(t *testing.T) {
+	setupTestGuard(t, "udp")
+	verifier = newFakeVerifier(53)
+	src := net.IPv4(203, 0, 114, 11).To4()
+	alarms := atomic.LoadInt64(&stats.alarms)
+
+	conn := newFakeConn()
+	done := make(chan struct{})
+	go func() {
+		udpGuard(conn, serverIp, "")
+		close(done)
+	}()
+	conn.Inject(fakeUdpPacket(src, serverIp, 53, []byte("query")))
+	conn.Inject(fakeUdpPacket(src, serverIp, 161, []byte("public")))
+	conn.Close()
+	<-done
+	if n := atomic.LoadInt64(&stats.alarms) - alarms; n != 1 {
+		t.Fatalf("%d alarms for one probe of a closed port", n)
+	}
+}
@@ -0,0 +1,174 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// health of the guard, served as json on health_addr/healthz with status 200 if ok and 503
+// if degraded, and by the control socket's health command; degraded means:
+// a guard loop exited, a guard's capture is down, a capture read failed within the last minute, no packet was read for
+// health_max_idle seconds, or more than health_max_responder_failure percent of responder
+// runs failed within the last 5 minutes
+type healthReport struct {
+	Status      string     `json:"status"` // ok or degraded
+	Reasons     []string   `json:"reasons,omitempty"`
+	Guards      int        `json:"guards"`
+	GuardsUp    int        `json:"guards_running"`
+	GuardsBlind int        `json:"guards_blind,omitempty"`
+	LastPacket  *time.Time `json:"last_packet,omitempty"`
+	LastError   string     `json:"last_read_error,omitempty"`
+	LastErrAt   *time.Time `json:"last_read_error_at,omitempty"`
+	// af_packet sockets, one per capture_fanout queue
+	Captures []captureStat `json:"captures,omitempty"`
+	// responder runs and failures within the last 5 minutes
+	ResponderRuns   int64     `json:"responder_runs"`
+	ResponderFailed int64     `json:"responder_failed"`
+	ResponderDrops  int64     `json:"responder_dropped_total"`
+	ConfigFiles     []string  `json:"config_files"`
+	ConfigLoaded    time.Time `json:"config_loaded"`
+	Uptime          string    `json:"uptime"`
+}
+
+const healthResponderWindow = 5 // minutes
+
+var (
+	guardsStarted int64
+	guardsRunning int64
+	lastPacketAt  int64 // unix nano
+
+	healthLock    sync.Mutex
+	lastReadError string
+	lastReadErrAt time.Time
+	configLoaded  time.Time
+	startedAt     = time.Now()
+
+	// responder runs and failures per minute, indexed by unix minute % window
+	responderBuckets [healthResponderWindow]struct {
+		minute       int64
+		runs, failed int64
+	}
+)
+
+// wrap a guard loop so health knows when it exits
+func runGuard(guard func(packetConn, net.IP, string), conn packetConn, laddr net.IP, iface string) {
+	atomic.AddInt64(&guardsStarted, 1)
+	atomic.AddInt64(&guardsRunning, 1)
+	defer atomic.AddInt64(&guardsRunning, -1)
+	defer recoverPanic("guard on " + laddr.String())
+	guard(conn, laddr, iface)
+}
+
+func notePacket() {
+	statsAdd(&stats.packets)
+	atomic.StoreInt64(&lastPacketAt, time.Now().UnixNano())
+}
+
+func noteReadError(err error) {
+	logMain(false, "read from ip:%s", err.Error())
+	healthLock.Lock()
+	lastReadError = err.Error()
+	lastReadErrAt = time.Now()
+	healthLock.Unlock()
+}
+
+func noteResponderResult(failed bool) {
+	minute := time.Now().Unix() / 60
+	healthLock.Lock()
+	b := &responderBuckets[minute%healthResponderWindow]
+	if b.minute != minute {
+		b.minute, b.runs, b.failed = minute, 0, 0
+	}
+	b.runs++
+	if failed {
+		b.failed++
+	}
+	healthLock.Unlock()
+}
+
+func checkHealth() *healthReport {
+	now := time.Now()
+	r := &healthReport{
+		Status:         "ok",
+		Guards:         int(atomic.LoadInt64(&guardsStarted)),
+		GuardsUp:       int(atomic.LoadInt64(&guardsRunning)),
+		ResponderDrops: atomic.LoadInt64(&stats.respDropped),
+		ConfigFiles:    cfgFiles,
+		ConfigLoaded:   configLoaded,
+		Uptime:         now.Sub(startedAt).Truncate(time.Second).String(),
+	}
+	if r.Guards == 0 || r.GuardsUp < r.Guards {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("%d of %d guards running", r.GuardsUp, r.Guards))
+	}
+	r.Captures = captureStatList()
+	if r.GuardsBlind = int(atomic.LoadInt64(&blindGuards)); r.GuardsBlind > 0 {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("%d guards blind, capture is being reopened", r.GuardsBlind))
+	}
+	if ns := atomic.LoadInt64(&lastPacketAt); ns > 0 {
+		t := time.Unix(0, ns)
+		r.LastPacket = &t
+	}
+	if cfgHealthMaxIdle > 0 {
+		last := startedAt
+		if r.LastPacket != nil {
+			last = *r.LastPacket
+		}
+		if idle := now.Sub(last); idle > time.Duration(cfgHealthMaxIdle)*time.Second {
+			r.Reasons = append(r.Reasons, fmt.Sprintf("no packet for %s", idle.Truncate(time.Second)))
+		}
+	}
+
+	healthLock.Lock()
+	if lastReadError != "" {
+		t := lastReadErrAt
+		r.LastError, r.LastErrAt = lastReadError, &t
+		if now.Sub(t) < time.Minute {
+			r.Reasons = append(r.Reasons, "capture read failed: "+lastReadError)
+		}
+	}
+	minute := now.Unix() / 60
+	for _, b := range responderBuckets {
+		if minute-b.minute < healthResponderWindow {
+			r.ResponderRuns += b.runs
+			r.ResponderFailed += b.failed
+		}
+	}
+	healthLock.Unlock()
+	if r.ResponderRuns > 0 && r.ResponderFailed*100 > r.ResponderRuns*int64(cfgHealthMaxResponderFailure) {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("%d of %d responder runs failed", r.ResponderFailed, r.ResponderRuns))
+	}
+
+	if len(r.Reasons) > 0 {
+		r.Status = "degraded"
+	}
+	return r
+}
+
+func controlHealth(args []string) (interface{}, error) {
+	return checkHealth(), nil
+}
+
+func serveHealth(w http.ResponseWriter, req *http.Request) {
+	report := checkHealth()
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// listen before chroot and dropping privileges, health_addr may be a low port
+func startHealth() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", serveHealth)
+	return serveHttpApi(cfgHealthAddr, mux)
+}
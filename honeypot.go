@@ -0,0 +1,133 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// honeypot ports
+// in tcp mode portguard listens on honeypot_port itself, accepts connections and keeps the first
+// honeypot_bytes a client sends within honeypot_timeout seconds, e.g. an http request line, an ssh
+// version string or an smb negotiation; then the connection is closed and raised as an alarm that
+// blocks like a trap_port, with what was sent quoted in "capture" and the raw bytes written to
+// <evidence_dir>/<ip>-<port>-<time>.bin if evidence_dir is set
+// the ports are in use, so the guard doesn't alarm on the syn and the client gets to send before its block
+
+const (
+	tcpPacketTypeHoneypot = "TCP honeypot connection"
+
+	// connections held at a time, more are closed at once
+	honeypotConns = 64
+	// longest capture kept in events and logs, the file has all of it
+	honeypotQuoteMax = 256
+)
+
+var (
+	cfgHoneypotPorts   portSet
+	cfgHoneypotBytes   = 1024
+	cfgHoneypotTimeout = 10 // seconds
+
+	honeypotSlots = make(chan struct{}, honeypotConns)
+)
+
+// honeypot ports can't be trap ports, the syn would block the client before it sends anything
+func checkHoneypot() {
+	for _, r := range cfgHoneypotPorts {
+		for port := r.min; port <= r.max; port++ {
+			if cfgTrapPorts.Contains(port) {
+				logMain(true, "honeypot_port %d is a trap_port too", port)
+			}
+		}
+	}
+	if len(cfgHoneypotPorts) > 0 && *mode != "tcp" {
+		logMain(false, "WARNING honeypot_port only works in tcp mode")
+	}
+}
+
+func startHoneypot() error {
+	for _, r := range cfgHoneypotPorts {
+		for port := r.min; port <= r.max; port++ {
+			ln, err := net.Listen("tcp4", ":"+strconv.Itoa(port))
+			if err != nil {
+				return err
+			}
+			go serveHoneypot(ln)
+		}
+	}
+	return nil
+}
+
+func serveHoneypot(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if isShutdown() {
+				return
+			}
+			logDebug("honeypot %s accept failed:%s", ln.Addr(), err.Error())
+			time.Sleep(time.Second)
+			continue
+		}
+		select {
+		case honeypotSlots <- struct{}{}:
+			go func() {
+				captureHoneypot(conn)
+				<-honeypotSlots
+			}()
+		default:
+			conn.Close()
+		}
+	}
+}
+
+// read what the client sends and raise it as an alarm
+func captureHoneypot(conn net.Conn) {
+	defer conn.Close()
+	raddr := conn.RemoteAddr().(*net.TCPAddr)
+	laddr := conn.LocalAddr().(*net.TCPAddr)
+	ip := raddr.IP.To4()
+	if ip == nil || isIgnoredIP(ip) || isBlockedIP(ip.String()) {
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Duration(cfgHoneypotTimeout) * time.Second))
+	data, _ := io.ReadAll(io.LimitReader(conn, int64(cfgHoneypotBytes)))
+	conn.Close()
+
+	statsAdd(&stats.honeypots)
+	ev := &event{Time: time.Now(), Kind: eventAlarm, Host: ip.String(), Port: laddr.Port, Proto: "TCP",
+		ScanType: tcpPacketTypeHoneypot, Laddr: laddr.IP.To4(), Trap: true, Capture: quoteCapture(data)}
+	if len(data) > 0 {
+		ev.CaptureFile = writeCapture(ev.Host, ev.Port, ev.Time, data)
+	}
+	raiseAlarm(ip, laddr.IP, ev, profileFor(""))
+}
+
+// data as a go string literal, cut at honeypotQuoteMax bytes; "" if the client sent nothing
+func quoteCapture(data []byte) string {
+	if len(data) > honeypotQuoteMax {
+		return strconv.QuoteToASCII(string(data[:honeypotQuoteMax])) + "..."
+	}
+	return strconv.QuoteToASCII(string(data))
+}
+
+// write a capture to evidence_dir, return its name, empty if it wasn't written
+func writeCapture(host string, port int, t time.Time, data []byte) string {
+	if cfgEvidenceDir == "" {
+		return ""
+	}
+	name := filepath.Join(cfgEvidenceDir, fmt.Sprintf("%s-%d-%s.bin", host, port, t.Format("20060102T150405")))
+	if err := os.WriteFile(chrootPath(name), data, 0640); err != nil {
+		logMain(false, "write honeypot capture %s failed:%s", name, err.Error())
+		return ""
+	}
+	return name
+}
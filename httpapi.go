@@ -0,0 +1,118 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// http api security
+// health_addr, score_addr and blocklist_addr serve https with http_tls_cert and http_tls_key;
+// with http_client_ca, clients presenting a certificate signed by it are let in, and with
+// http_token or any api_token, clients sending "Authorization: Bearer <token>" are too; with
+// http_client_ca and no token a client certificate is required; with neither anyone reaching the
+// address is let in, as without tls
+
+var (
+	cfgHttpTlsCert  string
+	cfgHttpTlsKey   string
+	cfgHttpClientCa string
+	cfgHttpToken    string
+
+	httpTlsConfig *tls.Config // nil for plain http, loaded by setupHttpApi
+)
+
+func checkHttpApi() {
+	if (cfgHttpTlsCert == "") != (cfgHttpTlsKey == "") {
+		logMain(true, "http_tls_cert and http_tls_key must be set together")
+	}
+	if cfgHttpClientCa != "" && cfgHttpTlsCert == "" {
+		logMain(true, "http_client_ca needs http_tls_cert")
+	}
+	if cfgHttpToken != "" && cfgHttpTlsCert == "" {
+		logMain(false, "WARNING http_token is sent in clear text without http_tls_cert")
+	}
+}
+
+// load certificates before chroot, a changed certificate applies after a restart
+func setupHttpApi() error {
+	if cfgHttpTlsCert == "" {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfgHttpTlsCert, cfgHttpTlsKey)
+	if err != nil {
+		return err
+	}
+	httpTlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfgHttpClientCa != "" {
+		ca, err := os.ReadFile(cfgHttpClientCa)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("no certificate in %s", cfgHttpClientCa)
+		}
+		httpTlsConfig.ClientCAs = pool
+		httpTlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		if cfgHttpToken != "" || hasApiTokens() {
+			// clients without a certificate may send the token instead
+			httpTlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return nil
+}
+
+// if req is let in, see http api security
+func httpAuthorized(req *http.Request) bool {
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+		// every endpoint is read only, any role will do
+		if tokenRole(token) != "" || (cfgHttpToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfgHttpToken)) == 1) {
+			return true
+		}
+	}
+	return cfgHttpClientCa == "" && cfgHttpToken == "" && !hasApiTokens()
+}
+
+func httpAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !httpAuthorized(req) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="portguard"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// listen on addr before chroot and dropping privileges, and serve mux with tls and authentication
+func serveHttpApi(addr string, mux *http.ServeMux) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if httpTlsConfig != nil {
+		ln = tls.NewListener(ln, httpTlsConfig)
+	}
+	go http.Serve(ln, httpAuth(mux))
+	return nil
+}
+
+func httpApiString() string {
+	if cfgHttpTlsCert == "" {
+		return fmt.Sprintf("plain token:%v", cfgHttpToken != "")
+	}
+	return fmt.Sprintf("tls cert:%q client ca:%q token:%v", cfgHttpTlsCert, cfgHttpClientCa, cfgHttpToken != "")
+}
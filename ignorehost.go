@@ -0,0 +1,252 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ignore_host names, like dynamic dns names of admin endpoints, resolved at startup and
+// again when their dns ttl runs out, at most every ignore_host_refresh seconds
+// a failed lookup keeps the last addresses and is retried a minute later
+
+type ignoreHost struct {
+	name    string
+	ips     []net.IP
+	expires time.Time
+}
+
+var (
+	ignoreHostLock sync.RWMutex
+	ignoreHosts    []*ignoreHost
+
+	// first nameserver of resolv.conf, read before chroot
+	dnsServer string
+)
+
+const (
+	ignoreHostMinTtl = 30 * time.Second
+	ignoreHostRetry  = time.Minute
+)
+
+func isIgnoredHost(ip net.IP) bool {
+	ignoreHostLock.RLock()
+	defer ignoreHostLock.RUnlock()
+	for _, h := range ignoreHosts {
+		for _, v := range h.ips {
+			if v.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolve names whose addresses expired
+func resolveIgnoreHosts() {
+	now := time.Now()
+	ignoreHostLock.RLock()
+	var due []*ignoreHost
+	for _, h := range ignoreHosts {
+		if !now.Before(h.expires) {
+			due = append(due, h)
+		}
+	}
+	ignoreHostLock.RUnlock()
+
+	for _, h := range due {
+		ips, ttl, err := lookupHostTtl(h.name)
+		if err != nil {
+			logMain(false, "resolve ignore_host %s failed:%s", h.name, err.Error())
+			ignoreHostLock.Lock()
+			h.expires = now.Add(ignoreHostRetry)
+			ignoreHostLock.Unlock()
+			continue
+		}
+		max := time.Duration(cfgIgnoreHostRefresh) * time.Second
+		if ttl < ignoreHostMinTtl {
+			ttl = ignoreHostMinTtl
+		}
+		if max > 0 && ttl > max {
+			ttl = max
+		}
+		ignoreHostLock.Lock()
+		if !sameIps(h.ips, ips) {
+			logMain(false, "ignore_host %s is %s", h.name, joinIps(ips))
+		}
+		h.ips, h.expires = ips, now.Add(ttl)
+		ignoreHostLock.Unlock()
+	}
+}
+
+func runIgnoreHostRefresh() {
+	for range time.Tick(10 * time.Second) {
+		resolveIgnoreHosts()
+	}
+}
+
+func sameIps(a, b []net.IP) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func joinIps(ips []net.IP) string {
+	var s []string
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	return strings.Join(s, ",")
+}
+
+// first nameserver of /etc/resolv.conf, empty if there's none, like on windows
+func readDnsServer() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" && net.ParseIP(fields[1]) != nil {
+			return net.JoinHostPort(fields[1], "53")
+		}
+	}
+	return ""
+}
+
+// ipv4 addresses of name and their ttl
+// the system resolver hides ttls, so name is asked from dnsServer directly if known
+func lookupHostTtl(name string) ([]net.IP, time.Duration, error) {
+	if dnsServer != "" {
+		if ips, ttl, err := dnsQueryA(dnsServer, name); err == nil {
+			return ips, ttl, nil
+		}
+	}
+	addrs, err := net.LookupIP(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	var ips []net.IP
+	for _, ip := range addrs {
+		if ip.To4() != nil {
+			ips = append(ips, ip.To4())
+		}
+	}
+	if len(ips) == 0 {
+		return nil, 0, errors.New("no ipv4 address")
+	}
+	return ips, time.Duration(cfgIgnoreHostRefresh) * time.Second, nil
+}
+
+var errDnsReply = errors.New("invalid dns reply")
+
+// ask server for A records of name, return them with the smallest ttl
+func dnsQueryA(server string, name string) ([]net.IP, time.Duration, error) {
+	id := uint16(rand.Intn(1 << 16))
+	query := []byte{byte(id >> 8), byte(id), 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, 0, errors.New("invalid name " + name)
+		}
+		query = append(query, byte(len(label)))
+		query = append(query, label...)
+	}
+	query = append(query, 0, 0, 1, 0, 1)
+
+	conn, err := net.DialTimeout("udp", server, 3*time.Second)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Write(query); err != nil {
+		return nil, 0, err
+	}
+	reply := make([]byte, 1500)
+	n, err := conn.Read(reply)
+	if err != nil {
+		return nil, 0, err
+	}
+	reply = reply[:n]
+
+	if len(reply) < 12 || binary.BigEndian.Uint16(reply) != id || reply[2]&0x80 == 0 {
+		return nil, 0, errDnsReply
+	}
+	if rcode := reply[3] & 0x0f; rcode != 0 {
+		return nil, 0, errors.New("dns lookup of " + name + " failed")
+	}
+	qdcount := int(binary.BigEndian.Uint16(reply[4:6]))
+	ancount := int(binary.BigEndian.Uint16(reply[6:8]))
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		if off = skipDnsName(reply, off); off < 0 || off+4 > len(reply) {
+			return nil, 0, errDnsReply
+		}
+		off += 4
+	}
+
+	var ips []net.IP
+	var ttl uint32
+	for i := 0; i < ancount; i++ {
+		if off = skipDnsName(reply, off); off < 0 || off+10 > len(reply) {
+			return nil, 0, errDnsReply
+		}
+		rtype := binary.BigEndian.Uint16(reply[off:])
+		rttl := binary.BigEndian.Uint32(reply[off+4:])
+		rdlen := int(binary.BigEndian.Uint16(reply[off+8:]))
+		off += 10
+		if off+rdlen > len(reply) {
+			return nil, 0, errDnsReply
+		}
+		// cnames before the addresses are skipped
+		if rtype == 1 && rdlen == 4 {
+			ips = append(ips, net.IPv4(reply[off], reply[off+1], reply[off+2], reply[off+3]).To4())
+			if len(ips) == 1 || rttl < ttl {
+				ttl = rttl
+			}
+		}
+		off += rdlen
+	}
+	if len(ips) == 0 {
+		return nil, 0, errors.New("no ipv4 address")
+	}
+	return ips, time.Duration(ttl) * time.Second, nil
+}
+
+// offset after a possibly compressed name at off, -1 if it's malformed
+func skipDnsName(msg []byte, off int) int {
+	for off < len(msg) {
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			return off + 1
+		case n&0xc0 == 0xc0:
+			if off+2 > len(msg) {
+				return -1
+			}
+			return off + 2
+		case n&0xc0 != 0:
+			return -1
+		}
+		off += 1 + n
+	}
+	return -1
+}
@@ -0,0 +1,239 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// remote ignore lists
+// ignore_url lists kept centrally, like vpn egress ranges and scanner appliances, are fetched at
+// startup and every ignore_url_refresh seconds, with the etag and last-modified of the last copy
+// so an unchanged list costs a 304; one ip or cidr per line, # comments
+// https urls are checked against the system roots, or ignore_url_ca if set; with ignore_url_key,
+// an ed25519 public key in base64, <url>.sig must hold the signature of the list, raw or base64,
+// and plain http is only allowed then
+// a list replaces the last one whole, only once it's fetched, verified and parsed; a failed fetch
+// or a bad line keeps the last one and is logged
+
+const (
+	ignoreUrlMaxSize = 4 << 20
+	ignoreUrlTimeout = 30 * time.Second
+)
+
+var (
+	cfgIgnoreUrls       []*ignoreUrl
+	cfgIgnoreUrlRefresh = 300
+	cfgIgnoreUrlCa      string
+	cfgIgnoreUrlKey     ed25519.PublicKey
+
+	ignoreUrlLock   sync.RWMutex
+	ignoreUrlClient *http.Client
+)
+
+type ignoreUrl struct {
+	url          string
+	etag         string
+	lastModified string
+	nets         []*net.IPNet // guarded by ignoreUrlLock
+}
+
+func parseIgnoreUrl(lineno int, token, value string) *ignoreUrl {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		logMain(true, "line %d:%s, invalid value:%s, should be an http or https url", lineno, token, value)
+	}
+	return &ignoreUrl{url: value}
+}
+
+func parseIgnoreUrlKey(lineno int, token, value string) ed25519.PublicKey {
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		logMain(true, "line %d:%s, invalid value:%s, should be an ed25519 public key in base64", lineno, token, value)
+	}
+	return ed25519.PublicKey(key)
+}
+
+func isUrlIgnored(ip net.IP) bool {
+	ignoreUrlLock.RLock()
+	defer ignoreUrlLock.RUnlock()
+	for _, u := range cfgIgnoreUrls {
+		for _, n := range u.nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// http client for the lists, and their first fetch
+func setupIgnoreUrls() error {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfgIgnoreUrlCa != "" {
+		ca, err := os.ReadFile(cfgIgnoreUrlCa)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("no certificate in %s", cfgIgnoreUrlCa)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	for _, u := range cfgIgnoreUrls {
+		if strings.HasPrefix(u.url, "http:") && cfgIgnoreUrlKey == nil {
+			return fmt.Errorf("%s is plain http, use https or set ignore_url_key", u.url)
+		}
+	}
+	ignoreUrlClient = &http.Client{Timeout: ignoreUrlTimeout, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	refreshIgnoreUrls()
+	return nil
+}
+
+func refreshIgnoreUrls() {
+	for _, u := range cfgIgnoreUrls {
+		if err := u.refresh(); err != nil {
+			logMain(false, "fetch ignore_url %s failed:%s, keeping the last list", u.url, err.Error())
+		}
+	}
+}
+
+func runIgnoreUrlRefresh() {
+	for range time.Tick(time.Duration(cfgIgnoreUrlRefresh) * time.Second) {
+		refreshIgnoreUrls()
+	}
+}
+
+// fetch the list if it changed, and swap it in once verified and parsed
+func (u *ignoreUrl) refresh() error {
+	req, err := http.NewRequest(http.MethodGet, u.url, nil)
+	if err != nil {
+		return err
+	}
+	if u.etag != "" {
+		req.Header.Set("If-None-Match", u.etag)
+	}
+	if u.lastModified != "" {
+		req.Header.Set("If-Modified-Since", u.lastModified)
+	}
+	body, resp, err := ignoreUrlGet(ignoreUrlClient, req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if cfgIgnoreUrlKey != nil {
+		if err := verifyIgnoreUrl(u.url, body); err != nil {
+			return err
+		}
+	}
+	nets, err := parseIgnoreList(body)
+	if err != nil {
+		return err
+	}
+	ignoreUrlLock.Lock()
+	old := len(u.nets)
+	u.nets = nets
+	ignoreUrlLock.Unlock()
+	u.etag, u.lastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	logMain(false, "ignore_url %s updated, %d entries, %d before", u.url, len(nets), old)
+	return nil
+}
+
+// body of a 200, or none for a 304
+func ignoreUrlGet(client *http.Client, req *http.Request) ([]byte, *http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, resp, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, ignoreUrlMaxSize+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(body) > ignoreUrlMaxSize {
+		return nil, nil, fmt.Errorf("list larger than %d bytes", ignoreUrlMaxSize)
+	}
+	return body, resp, nil
+}
+
+// check body against the signature at <url>.sig
+func verifyIgnoreUrl(rawUrl string, body []byte) error {
+	req, err := http.NewRequest(http.MethodGet, rawUrl+".sig", nil)
+	if err != nil {
+		return err
+	}
+	sig, _, err := ignoreUrlGet(ignoreUrlClient, req)
+	if err != nil {
+		return fmt.Errorf("fetch signature: %w", err)
+	}
+	if len(sig) != ed25519.SignatureSize {
+		if sig, err = base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig))); err != nil {
+			return errors.New("signature is neither raw nor base64")
+		}
+	}
+	if !ed25519.Verify(cfgIgnoreUrlKey, body, sig) {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
+// ips and cidrs of a list, one per line
+func parseIgnoreList(body []byte) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.Contains(line, "/") {
+			line += "/32"
+		}
+		_, n, err := net.ParseCIDR(line)
+		if err != nil || n.IP.To4() == nil {
+			return nil, fmt.Errorf("line %d, invalid ip or cidr:%s", lineno, line)
+		}
+		nets = append(nets, n)
+	}
+	return nets, scanner.Err()
+}
+
+func ignoreUrlString() string {
+	ignoreUrlLock.RLock()
+	defer ignoreUrlLock.RUnlock()
+	var items []string
+	for _, u := range cfgIgnoreUrls {
+		items = append(items, fmt.Sprintf("%s(%d)", u.url, len(u.nets)))
+	}
+	return strings.Join(items, ",")
+}
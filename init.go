@@ -0,0 +1,253 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// portguard init
+// inspects the host and writes a config to start from: the interfaces to guard, services listening
+// now as exclude_port, so a restarting service doesn't alarm, lan chatter as noisy_udp_port, the
+// default gateway and local subnets ignored, and kill_route if blocks should be enforced; it asks
+// about each on a terminal, -yes or a non-interactive stdin takes the defaults; keys it doesn't
+// write keep the defaults of guard.conf; an existing file is never overwritten
+
+// noisy ports of a host on a lan, see guard.conf
+var initLanNoisyPorts = []int{137, 138, 139, 5353, 17500}
+
+type initHost struct {
+	ifaces    []string // up, with an ipv4 address, not loopback or a container bridge
+	subnets   []string
+	listeners []initListener
+	gateway   net.IP // default route, nil if unknown
+	lan       bool   // on a private subnet
+}
+
+type initListener struct {
+	proto string
+	port  int
+	owner string // process, empty if unknown
+}
+
+func inspectHost() (*initHost, error) {
+	h := &initHost{}
+	ifis, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, ifi := range ifis {
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagLoopback != 0 || isContainerInterface(ifi.Name) {
+			continue
+		}
+		addrs, _ := ifi.Addrs()
+		found := false
+		for _, a := range addrs {
+			n, ok := a.(*net.IPNet)
+			if !ok || n.IP.To4() == nil {
+				continue
+			}
+			found = true
+			subnet := &net.IPNet{IP: n.IP.Mask(n.Mask), Mask: n.Mask}
+			h.subnets = append(h.subnets, subnet.String())
+			h.lan = h.lan || inNets(privateNets, n.IP)
+		}
+		if found {
+			h.ifaces = append(h.ifaces, ifi.Name)
+		}
+	}
+
+	saved := *mode
+	defer func() { *mode = saved }()
+	seen := make(map[string]bool)
+	for _, proto := range []string{"tcp", "udp"} {
+		*mode = proto
+		ls, err := listeningPorts()
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range ls {
+			// loopback services can't be reached from outside, probes of their ports are real
+			if ip := net.ParseIP(l.addr); ip != nil && ip.IsLoopback() {
+				continue
+			}
+			key := fmt.Sprintf("%s/%d", proto, l.port)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			h.listeners = append(h.listeners, initListener{proto: proto, port: l.port, owner: socketOwner(l.inode)})
+		}
+	}
+	sort.Slice(h.listeners, func(i, j int) bool {
+		if h.listeners[i].port != h.listeners[j].port {
+			return h.listeners[i].port < h.listeners[j].port
+		}
+		return h.listeners[i].proto < h.listeners[j].proto
+	})
+	h.gateway = defaultGateway()
+	return h, nil
+}
+
+// gateway of the default route in /proc/net/route, nil elsewhere
+func defaultGateway() net.IP {
+	data, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		// Iface Destination Gateway Flags ..., addresses in host byte order
+		f := strings.Fields(line)
+		if len(f) < 3 || f[1] != "00000000" {
+			continue
+		}
+		b, err := hex.DecodeString(f[2])
+		if err != nil || len(b) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(b))
+		if !ip.IsUnspecified() {
+			return ip
+		}
+	}
+	return nil
+}
+
+// asks questions on stderr, answers are read from in; ask returns def when not interactive
+type initPrompt struct {
+	in          *bufio.Reader
+	interactive bool
+}
+
+func (p *initPrompt) ask(question string, def string) string {
+	if !p.interactive {
+		return def
+	}
+	fmt.Fprintf(os.Stderr, "%s [%s]: ", question, def)
+	line, err := p.in.ReadString('\n')
+	if err != nil {
+		// stdin ended, defaults from here on
+		p.interactive = false
+	}
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
+
+func (p *initPrompt) yes(question string, def bool) bool {
+	d := "n"
+	if def {
+		d = "y"
+	}
+	answer := strings.ToLower(p.ask(question+" (y/n)", d))
+	return strings.HasPrefix(answer, "y")
+}
+
+// write a config for this host to file, stdout if empty
+func runInit(file string, assumeYes bool) error {
+	h, err := inspectHost()
+	if err != nil {
+		return err
+	}
+	p := &initPrompt{in: bufio.NewReader(os.Stdin)}
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		p.interactive = !assumeYes
+	}
+
+	var b strings.Builder
+	host, _ := os.Hostname()
+	fmt.Fprintf(&b, "# written by portguard init on %s at %s\n", host, time.Now().Format(time.RFC3339))
+	b.WriteString("# keys not set here keep the defaults described in guard.conf\n")
+
+	if len(h.ifaces) > 0 {
+		answer := p.ask("interfaces to guard, comma separated, or all", strings.Join(h.ifaces, ","))
+		if answer != "all" {
+			b.WriteString("\n# monitor interfaces\n")
+			for _, name := range strings.Split(answer, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					fmt.Fprintf(&b, "interface = %s\n", name)
+				}
+			}
+		}
+	}
+
+	if len(h.listeners) > 0 {
+		var names []string
+		for _, l := range h.listeners {
+			names = append(names, fmt.Sprintf("%d/%s", l.port, l.proto))
+		}
+		if p.yes("exclude the ports of services listening now ("+strings.Join(names, " ")+")", true) {
+			b.WriteString("\n# services listening at init, never alarmed, even while they restart\n")
+			for _, l := range h.listeners {
+				if l.owner != "" {
+					fmt.Fprintf(&b, "# %s %s\n", l.proto, l.owner)
+				} else {
+					fmt.Fprintf(&b, "# %s\n", l.proto)
+				}
+				fmt.Fprintf(&b, "exclude_port = %d\n", l.port)
+			}
+		}
+	}
+
+	var noisy []string
+	if h.lan {
+		for _, port := range initLanNoisyPorts {
+			noisy = append(noisy, fmt.Sprintf("noisy_udp_port = %d", port))
+		}
+	}
+	for _, l := range h.listeners {
+		// mail servers get ident lookups back from the servers they talk to
+		if l.proto == "tcp" && l.port == 25 {
+			noisy = append(noisy, "noisy_tcp_port = 113")
+			break
+		}
+	}
+	if len(noisy) > 0 && p.yes("treat lan broadcast chatter, and ident lookups for a mail server, as noise", true) {
+		b.WriteString("\n# noisy ports\n")
+		b.WriteString(strings.Join(noisy, "\n") + "\n")
+	}
+
+	b.WriteString("\n# ignore local\n")
+	if len(h.subnets) > 0 && p.yes("ignore probes from the local subnets ("+strings.Join(h.subnets, " ")+")", false) {
+		b.WriteString("ignore_local = subnets\n")
+	} else {
+		b.WriteString("ignore_local = addresses\n")
+	}
+	if h.gateway != nil && p.yes("ignore the default gateway "+h.gateway.String()+", which may send health checks", true) {
+		b.WriteString("\n# ignore ip\n")
+		fmt.Fprintf(&b, "ignore_ip = %s\n", h.gateway)
+	}
+
+	if p.yes("block scanners with iptables, instead of only logging alarms", false) {
+		b.WriteString("\n# kill route\n")
+		b.WriteString("kill_route = /sbin/iptables -I INPUT -s $TARGET$ -j DROP\n")
+	} else {
+		b.WriteString("\n# no responder runs until one is set, blocks are only logged\n")
+		b.WriteString("#kill_route = /sbin/iptables -I INPUT -s $TARGET$ -j DROP\n")
+	}
+
+	var w io.Writer = os.Stdout
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
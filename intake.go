@@ -0,0 +1,172 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// block requests
+// other tools, fail2ban, an ids or scripts, have portguard apply their blocks, so it's the one
+// place blocks are enforced on the host; a request is a json object on one line:
+//	{"host":"1.2.3.4","ttl":3600,"source":"fail2ban","reason":"sshd"}
+//	{"host":"1.2.3.4","action":"unblock","source":"fail2ban"}
+// a block runs the responders like a manual block and lasts ttl seconds, block_duration if 0
+// requests are read from block_intake, a named pipe or a file followed from its end like tail -f,
+// and taken by the request command of control_socket
+
+const scanTypeExternal = "external block"
+
+var cfgBlockIntake string
+
+type blockRequest struct {
+	Host   string `json:"host"`
+	Action string `json:"action,omitempty"` // block, the default, or unblock
+	TTL    int64  `json:"ttl,omitempty"`    // seconds
+	Source string `json:"source,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// who asked and why, for logs and events
+func (req *blockRequest) origin() string {
+	s := req.Source
+	if s == "" {
+		s = "unknown"
+	}
+	if req.Reason != "" {
+		s += ": " + req.Reason
+	}
+	return s
+}
+
+func applyBlockRequest(req *blockRequest) error {
+	ip := net.ParseIP(req.Host).To4()
+	if ip == nil {
+		return errors.New("invalid host " + req.Host)
+	}
+	host := ip.String()
+	switch req.Action {
+	case "unblock":
+		if !unblockHost(host, "requested by "+req.origin()) {
+			return errors.New(host + " is not blocked")
+		}
+		kvExpire(host)
+		return nil
+	case "", "block":
+	default:
+		return errors.New("unknown action " + req.Action)
+	}
+	if req.TTL < 0 {
+		return errors.New("invalid ttl")
+	}
+	if isIgnoredIP(ip) {
+		return errors.New(host + " is ignored")
+	}
+	ev := &event{Time: time.Now(), Kind: eventAlarm, Host: host, Proto: strings.ToUpper(*mode), ScanType: scanTypeExternal, Message: req.origin()}
+	if !forceBlock(host, 0, ev.ScanType) {
+		return errors.New(host + " is already blocked")
+	}
+	if req.TTL > 0 {
+		stateLock.Lock()
+		blockTtls[host] = req.TTL
+		stateLock.Unlock()
+	}
+	statsAdd(&stats.blockRequests)
+	logMain(false, "block %s requested by %s", host, req.origin())
+	ev.ASN, ev.ASOrg = lookupAsn(ip)
+	ev.Country = lookupCountry(ip)
+	reportBlock(ev)
+	return nil
+}
+
+// request <json>, apply a block request
+func controlRequest(args []string) (interface{}, error) {
+	var req blockRequest
+	if len(args) == 0 || json.Unmarshal([]byte(strings.Join(args, " ")), &req) != nil {
+		return nil, errors.New(`usage: request {"host":"1.2.3.4","ttl":3600,...}`)
+	}
+	if err := applyBlockRequest(&req); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"host": req.Host, "blocked": req.Action != "unblock"}, nil
+}
+
+// open block_intake before chroot, a pipe read-write so it never sees eof while writers come and go
+func startBlockIntake() error {
+	fi, err := os.Stat(cfgBlockIntake)
+	if err != nil {
+		return err
+	}
+	fifo := fi.Mode()&os.ModeNamedPipe != 0
+	flags := os.O_RDONLY
+	if fifo {
+		flags = os.O_RDWR
+	}
+	f, err := os.OpenFile(cfgBlockIntake, flags, 0)
+	if err != nil {
+		return err
+	}
+	var pos int64
+	if !fifo {
+		if pos, err = f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	go runBlockIntake(f, pos)
+	return nil
+}
+
+// read requests from f; a file truncated or replaced, like by logrotate, is read again from its start
+func runBlockIntake(f *os.File, pos int64) {
+	r := bufio.NewReader(f)
+	var partial string
+	for {
+		line, err := r.ReadString('\n')
+		pos += int64(len(line))
+		if err == io.EOF {
+			partial += line
+			time.Sleep(time.Second)
+			if cur, serr := os.Stat(chrootPath(cfgBlockIntake)); serr == nil {
+				if fi, ferr := f.Stat(); ferr == nil && (!os.SameFile(fi, cur) || cur.Size() < pos) {
+					nf, oerr := os.Open(chrootPath(cfgBlockIntake))
+					if oerr == nil {
+						f.Close()
+						f, pos, partial = nf, 0, ""
+						r.Reset(f)
+					}
+				}
+			}
+			continue
+		}
+		if err != nil {
+			logMain(false, "read block_intake %s failed:%s", cfgBlockIntake, err.Error())
+			return
+		}
+		line, partial = partial+line, ""
+		handleBlockRequest(strings.TrimSpace(line))
+	}
+}
+
+func handleBlockRequest(line string) {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+	var req blockRequest
+	if err := json.Unmarshal([]byte(line), &req); err != nil {
+		logMain(false, "invalid block request %q:%s", line, err.Error())
+		return
+	}
+	if err := applyBlockRequest(&req); err != nil {
+		logMain(false, "block request from %s failed:%s", req.origin(), err.Error())
+	}
+}
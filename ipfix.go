@@ -0,0 +1,157 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+// export alarms and blocks as ipfix (rfc 7011) data records over udp, so flow collectors
+// show probes next to router flows; scan type, event and alarm count are enterprise
+// specific fields of ipfix_enterprise_id
+
+const (
+	ipfixVersion     = 10
+	ipfixTemplateSet = 2
+	ipfixTemplateId  = 256
+	ipfixVarLen      = 0xffff
+
+	// enterprise specific information elements
+	ipfixScanType   = 1
+	ipfixEventKind  = 2
+	ipfixAlarmCount = 3
+
+	// templates are sent again at this interval, udp collectors may have missed them
+	ipfixTemplateRefresh = 5 * time.Minute
+)
+
+// information elements of the template in record order, enterprise ones are of ipfix_enterprise_id
+var ipfixFields = []struct {
+	id         uint16
+	length     uint16
+	enterprise bool
+}{
+	{152, 8, false}, // flowStartMilliseconds
+	{8, 4, false},   // sourceIPv4Address
+	{12, 4, false},  // destinationIPv4Address
+	{11, 2, false},  // destinationTransportPort
+	{4, 1, false},   // protocolIdentifier
+	{6, 2, false},   // tcpControlBits
+	{192, 1, false}, // ipTTL
+	{58, 2, false},  // vlanId
+	{ipfixScanType, ipfixVarLen, true},
+	{ipfixEventKind, ipfixVarLen, true},
+	{ipfixAlarmCount, 4, true},
+}
+
+var (
+	ipfixLock     sync.Mutex
+	ipfixConn     net.Conn
+	ipfixSequence uint32 // data records sent
+	ipfixSentAt   time.Time
+)
+
+// dial before chroot, the address can't be resolved after it
+func openIpfix() error {
+	conn, err := net.Dial("udp", cfgIpfixCollector)
+	if err != nil {
+		return err
+	}
+	ipfixConn = conn
+	return nil
+}
+
+func ipfixEvent(ev *event) {
+	if ipfixConn == nil || ev.Kind == eventOps {
+		return
+	}
+	ipfixLock.Lock()
+	defer ipfixLock.Unlock()
+	now := time.Now()
+	msg := make([]byte, 16, 256)
+	if now.Sub(ipfixSentAt) >= ipfixTemplateRefresh {
+		msg = appendIpfixTemplate(msg)
+		ipfixSentAt = now
+	}
+	msg = appendIpfixRecord(msg, ev)
+	binary.BigEndian.PutUint16(msg[0:], ipfixVersion)
+	binary.BigEndian.PutUint16(msg[2:], uint16(len(msg)))
+	binary.BigEndian.PutUint32(msg[4:], uint32(now.Unix()))
+	binary.BigEndian.PutUint32(msg[8:], ipfixSequence)
+	binary.BigEndian.PutUint32(msg[12:], uint32(cfgIpfixDomainId))
+	ipfixSequence++
+	if _, err := ipfixConn.Write(msg); err != nil {
+		logDebug("send ipfix record to %s failed:%s", cfgIpfixCollector, err.Error())
+		// a collector that comes back gets the template first
+		ipfixSentAt = time.Time{}
+	}
+}
+
+func appendIpfixTemplate(b []byte) []byte {
+	start := len(b)
+	b = binary.BigEndian.AppendUint16(b, ipfixTemplateSet)
+	b = binary.BigEndian.AppendUint16(b, 0) // set length
+	b = binary.BigEndian.AppendUint16(b, ipfixTemplateId)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(ipfixFields)))
+	for _, f := range ipfixFields {
+		if f.enterprise {
+			b = binary.BigEndian.AppendUint16(b, f.id|0x8000)
+			b = binary.BigEndian.AppendUint16(b, f.length)
+			b = binary.BigEndian.AppendUint32(b, uint32(cfgIpfixEnterpriseId))
+		} else {
+			b = binary.BigEndian.AppendUint16(b, f.id)
+			b = binary.BigEndian.AppendUint16(b, f.length)
+		}
+	}
+	binary.BigEndian.PutUint16(b[start+2:], uint16(len(b)-start))
+	return b
+}
+
+func appendIpfixRecord(b []byte, ev *event) []byte {
+	start := len(b)
+	b = binary.BigEndian.AppendUint16(b, ipfixTemplateId)
+	b = binary.BigEndian.AppendUint16(b, 0) // set length
+	b = binary.BigEndian.AppendUint64(b, uint64(ev.Time.UnixMilli()))
+	b = append(b, ipfixAddr(net.ParseIP(ev.Host))...)
+	b = append(b, ipfixAddr(ev.Laddr)...)
+	b = binary.BigEndian.AppendUint16(b, uint16(ev.Port))
+	proto := byte(protoTCP)
+	if ev.Proto == "UDP" {
+		proto = protoUDP
+	}
+	b = append(b, proto)
+	b = binary.BigEndian.AppendUint16(b, uint16(ev.Flags))
+	b = append(b, ev.TTL)
+	b = binary.BigEndian.AppendUint16(b, uint16(ev.VLAN))
+	b = appendIpfixString(b, ev.ScanType)
+	b = appendIpfixString(b, ev.Kind)
+	b = binary.BigEndian.AppendUint32(b, uint32(ev.Alarms))
+	binary.BigEndian.PutUint16(b[start+2:], uint16(len(b)-start))
+	return b
+}
+
+func ipfixAddr(ip net.IP) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return net.IPv4zero.To4()
+}
+
+// variable length field, rfc 7011 section 7
+func appendIpfixString(b []byte, s string) []byte {
+	if len(s) > 0xfffe {
+		s = s[:0xfffe]
+	}
+	if len(s) < 255 {
+		b = append(b, byte(len(s)))
+	} else {
+		b = append(b, 255)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	}
+	return append(b, s...)
+}
@@ -0,0 +1,91 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+)
+
+// ipv4 ranges with a value, loaded from maxmind geolite2 style csv files
+type ipRange struct {
+	start uint32
+	end   uint32
+	value int
+	name  string
+}
+
+type ipTable []ipRange
+
+func ipToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+// range containing ip, nil if none
+func (t ipTable) lookup(ip net.IP) *ipRange {
+	if t == nil || ip.To4() == nil {
+		return nil
+	}
+	n := ipToUint32(ip)
+	i := sort.Search(len(t), func(i int) bool { return t[i].end >= n })
+	if i < len(t) && t[i].start <= n {
+		return &t[i]
+	}
+	return nil
+}
+
+// read a csv file with a header row, parse is called with each row as column name -> value
+// rows with a "network" column in cidr notation become ranges, ipv6 networks are skipped
+func loadCsvTable(file string, parse func(row map[string]string) (int, string, bool)) (ipTable, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header of %s:%s", file, err.Error())
+	}
+	header = append([]string(nil), header...)
+
+	var t ipTable
+	row := make(map[string]string, len(header))
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, name := range header {
+			if i < len(rec) {
+				row[name] = rec[i]
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(row["network"])
+		if err != nil || ipNet.IP.To4() == nil {
+			continue
+		}
+		value, name, ok := parse(row)
+		if !ok {
+			continue
+		}
+		start := ipToUint32(ipNet.IP)
+		ones, _ := ipNet.Mask.Size()
+		end := start | uint32(uint64(1)<<(32-uint(ones))-1)
+		t = append(t, ipRange{start: start, end: end, value: value, name: name})
+	}
+	sort.Slice(t, func(i, j int) bool { return t[i].start < t[j].start })
+	return t, nil
+}
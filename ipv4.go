@@ -0,0 +1,102 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+)
+
+const (
+	ipv4MoreFragments = 1 // flags, bottom bit
+	ipv4DontFragment  = 2
+)
+
+type IPv4Header struct {
+	Version     uint8
+	IHL         uint8 // header length in bytes, options included
+	TOS         uint8
+	TotalLen    uint16
+	ID          uint16
+	Flags       uint8  // 3 bits
+	FragOffset  uint16 // 13 bits, in 8 byte units
+	TTL         uint8
+	Protocol    uint8
+	Checksum    uint16
+	Source      net.IP
+	Destination net.IP
+}
+
+var errIPv4Header = errors.New("invalid ipv4 header")
+
+// parse the ipv4 header of packet, options are skipped
+func NewIPv4Header(data []byte, ip *IPv4Header) error {
+	if len(data) < 20 {
+		return errIPv4Header
+	}
+	ip.Version = data[0] >> 4
+	ip.IHL = data[0] & 0x0f * 4
+	if ip.Version != 4 || ip.IHL < 20 || int(ip.IHL) > len(data) {
+		return errIPv4Header
+	}
+	ip.TOS = data[1]
+	ip.TotalLen = binary.BigEndian.Uint16(data[2:4])
+	ip.ID = binary.BigEndian.Uint16(data[4:6])
+	frag := binary.BigEndian.Uint16(data[6:8])
+	ip.Flags = uint8(frag >> 13)
+	ip.FragOffset = frag & 0x1fff
+	ip.TTL = data[8]
+	ip.Protocol = data[9]
+	ip.Checksum = binary.BigEndian.Uint16(data[10:12])
+	ip.Source = net.IPv4(data[12], data[13], data[14], data[15])
+	ip.Destination = net.IPv4(data[16], data[17], data[18], data[19])
+	return nil
+}
+
+// transport header and payload of packet
+// bounded by total length, unless the read was cut short
+func (ip *IPv4Header) Payload(data []byte) []byte {
+	end := int(ip.TotalLen)
+	if end < int(ip.IHL) || end > len(data) {
+		end = len(data)
+	}
+	return data[ip.IHL:end]
+}
+
+// a later fragment carries no transport header
+func (ip *IPv4Header) IsFragment() bool {
+	return ip.FragOffset != 0
+}
+
+// ones' complement sum of the pseudo header and a tcp or udp segment
+// a segment with a right checksum sums to 0xffff
+func (ip *IPv4Header) transportSum(segment []byte) uint16 {
+	src, dst := ip.Source.To4(), ip.Destination.To4()
+	sum := uint32(src[0])<<8 | uint32(src[1])
+	sum += uint32(src[2])<<8 | uint32(src[3])
+	sum += uint32(dst[0])<<8 | uint32(dst[1])
+	sum += uint32(dst[2])<<8 | uint32(dst[3])
+	sum += uint32(ip.Protocol)
+	sum += uint32(len(segment))
+	for i := 0; i+1 < len(segment); i += 2 {
+		sum += uint32(segment[i])<<8 | uint32(segment[i+1])
+	}
+	if len(segment)%2 != 0 {
+		sum += uint32(segment[len(segment)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return uint16(sum)
+}
+
+// checksum of segment is right, a udp segment without checksum passes
+func (ip *IPv4Header) ValidChecksum(segment []byte) bool {
+	if ip.Protocol == protoUDP && len(segment) >= 8 && segment[6] == 0 && segment[7] == 0 {
+		return true
+	}
+	return ip.transportSum(segment) == 0xffff
+}
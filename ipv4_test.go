@@ -0,0 +1,31 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import "testing"
+
+// 192.0.2.1 to 198.51.100.7, tcp, 40 bytes
+var ipv4Seed = []byte{0x45, 0, 0, 40, 0, 1, 0, 0, 64, protoTCP, 0, 0, 192, 0, 2, 1, 198, 51, 100, 7}
+
+func FuzzNewIPv4Header(f *testing.F) {
+	f.Add(append(append([]byte{}, ipv4Seed...), tcpSeeds[0]...))
+	f.Add(ipv4Seed)
+	f.Add(append([]byte{0x4f}, ipv4Seed[1:]...)) // options past the end
+	f.Add(append([]byte{0x46, 0, 0xff, 0xff}, ipv4Seed[4:]...))
+	f.Add(ipv4Seed[:12])
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var ip IPv4Header
+		if err := NewIPv4Header(data, &ip); err != nil {
+			return
+		}
+		payload := ip.Payload(data)
+		if ip.IsFragment() {
+			return
+		}
+		ip.ValidChecksum(payload)
+		var tcp TCPHeader
+		NewTCPHeader(payload, &tcp)
+	})
+}
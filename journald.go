@@ -0,0 +1,126 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// log to journald with its native protocol, so alarms and blocks carry structured fields:
+//
+//	journalctl -u portguard PORTGUARD_SRC_IP=1.2.3.4
+//
+// the main log goes there too instead of syslog; the socket is connected before chroot
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// syslog priorities
+const (
+	journalErr     = 3
+	journalWarning = 4
+)
+
+var (
+	journalLock sync.Mutex
+	journalConn *net.UnixConn
+)
+
+func openJournal() error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	journalConn = conn
+	return nil
+}
+
+// send an entry of fields, in order, with MESSAGE and PRIORITY
+func journalSend(priority int, message string, fields ...string) error {
+	var b bytes.Buffer
+	journalField(&b, "MESSAGE", message)
+	journalField(&b, "PRIORITY", strconv.Itoa(priority))
+	journalField(&b, "SYSLOG_IDENTIFIER", "portguard")
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i+1] != "" {
+			journalField(&b, fields[i], fields[i+1])
+		}
+	}
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	_, err := journalConn.Write(b.Bytes())
+	return err
+}
+
+// KEY=value, or the binary form for values with newlines
+func journalField(b *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(key + "=" + value + "\n")
+		return
+	}
+	b.WriteString(key + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
+
+// journal writer of the main log, a line per entry
+type journalWriter struct{}
+
+func (journalWriter) Write(p []byte) (int, error) {
+	if err := journalSend(journalErr, strings.TrimSuffix(string(p), "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// alarms and blocks with their context as PORTGUARD_* fields
+func journalEvent(ev *event) {
+	if journalConn == nil {
+		return
+	}
+	priority, message := journalWarning, "attackalert: "+ev.ScanType+" from host: "+ev.Host+" to "+ev.Proto+" port: "+strconv.Itoa(ev.Port)+ev.probe()+ev.origin()
+	if ev.Kind == eventStage {
+		message = "Host: " + ev.Host + " Port: " + strconv.Itoa(ev.Port) + " " + ev.Proto + " Stage " + strconv.Itoa(ev.Stage) + ev.history() + ev.origin()
+	}
+	if ev.Kind == eventBlock {
+		priority, message = journalErr, "Host: "+ev.Host+" Port: "+strconv.Itoa(ev.Port)+" "+ev.Proto+" Blocked"+ev.history()+ev.origin()
+	}
+	itoa := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	err := journalSend(priority, message,
+		"PORTGUARD_EVENT", ev.Kind,
+		"PORTGUARD_SRC_IP", ev.Host,
+		"PORTGUARD_PORT", itoa(ev.Port),
+		"PORTGUARD_PROTO", ev.Proto,
+		"PORTGUARD_SCAN_TYPE", ev.ScanType,
+		"PORTGUARD_FLAGS", itoa(int(ev.Flags)),
+		"PORTGUARD_TTL", itoa(int(ev.TTL)),
+		"PORTGUARD_PAYLOAD", ev.Payload,
+		"PORTGUARD_ALARM_COUNT", itoa(ev.Alarms),
+		"PORTGUARD_OFFENSE", itoa(ev.Offense),
+		"PORTGUARD_ASN", itoa(ev.ASN),
+		"PORTGUARD_COUNTRY", ev.Country,
+		"PORTGUARD_REPUTATION", ev.Reputation,
+		"PORTGUARD_SPOOF", ev.Spoof,
+		"PORTGUARD_VLAN", itoa(ev.VLAN),
+		"PORTGUARD_INTERFACE", ev.Iface,
+		"PORTGUARD_PEER", ev.Peer,
+		"PORTGUARD_EVIDENCE", ev.Evidence,
+		"PORTGUARD_SCORE", itoa(ev.Score),
+		"PORTGUARD_STAGE", itoa(ev.Stage),
+		"PORTGUARD_RESPONDERS", strings.Join(ev.Responders, ","),
+	)
+	if err != nil {
+		logDebug("write event to journald failed:%s", err.Error())
+	}
+}
@@ -0,0 +1,214 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// block hosts cluster wide from a daemonset: blocked hosts are kept as /32s in one object of
+// the kubernetes api instead of the node firewall, so every node enforces them and they
+// survive node replacement
+//
+//	calico  GlobalNetworkSet kube_blocklist_name with spec.nets, labeled portguard.io/blocklist,
+//	        for a GlobalNetworkPolicy denying that selector
+//	cilium  CiliumClusterwideNetworkPolicy kube_blocklist_name denying ingress from the hosts
+//
+// every node updates the same object, conflicting updates are read again and retried
+// the service account token is read for every update, kubelet rotates it
+
+const (
+	kubeCalico = "calico"
+	kubeCilium = "cilium"
+
+	kubeTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	kubeCaFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	kubeRetries   = 5
+)
+
+var (
+	cfgKubeBlocklist     string
+	cfgKubeBlocklistName = "portguard-blocked"
+	cfgKubeApi           string // in-cluster api server by default
+
+	kubeClient *http.Client
+	kubeToken  string // last token read, used if it can't be read again
+)
+
+// in-cluster api server and credentials
+func setupKube() error {
+	if cfgKubeApi == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return errors.New("not running in a kubernetes pod, set kube_api")
+		}
+		cfgKubeApi = "https://" + net.JoinHostPort(host, port)
+	}
+	tlsConfig := &tls.Config{}
+	if ca, err := os.ReadFile(kubeCaFile); err == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("no certificate in %s", kubeCaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	kubeClient = &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	if _, err := readKubeToken(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func readKubeToken() (string, error) {
+	data, err := os.ReadFile(kubeTokenFile)
+	if err != nil {
+		if kubeToken != "" {
+			return kubeToken, nil
+		}
+		return "", err
+	}
+	kubeToken = strings.TrimSpace(string(data))
+	return kubeToken, nil
+}
+
+func kubeObjectUrl() string {
+	if cfgKubeBlocklist == kubeCilium {
+		return cfgKubeApi + "/apis/cilium.io/v2/ciliumclusterwidenetworkpolicies/" + cfgKubeBlocklistName
+	}
+	return cfgKubeApi + "/apis/crd.projectcalico.org/v1/globalnetworksets/" + cfgKubeBlocklistName
+}
+
+func kubeCall(ctx context.Context, method string, url string, body interface{}, result interface{}) (int, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return 0, err
+	}
+	token, err := readKubeToken()
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := kubeClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var status struct{ Message string }
+		json.NewDecoder(resp.Body).Decode(&status)
+		return resp.StatusCode, fmt.Errorf("kubernetes: %s %s", resp.Status, status.Message)
+	}
+	if result != nil {
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(result)
+	}
+	return resp.StatusCode, nil
+}
+
+// the blocklist object with nets
+func kubeObject(nets []string, resourceVersion string) map[string]interface{} {
+	meta := map[string]interface{}{
+		"name":   cfgKubeBlocklistName,
+		"labels": map[string]string{"portguard.io/blocklist": "true"},
+	}
+	if resourceVersion != "" {
+		meta["resourceVersion"] = resourceVersion
+	}
+	if cfgKubeBlocklist == kubeCilium {
+		spec := map[string]interface{}{
+			"endpointSelector":  map[string]interface{}{},
+			"enableDefaultDeny": map[string]bool{"ingress": false, "egress": false},
+		}
+		if len(nets) > 0 {
+			spec["ingressDeny"] = []interface{}{map[string]interface{}{"fromCIDR": nets}}
+		}
+		return map[string]interface{}{"apiVersion": "cilium.io/v2", "kind": "CiliumClusterwideNetworkPolicy", "metadata": meta, "spec": spec}
+	}
+	return map[string]interface{}{"apiVersion": "crd.projectcalico.org/v1", "kind": "GlobalNetworkSet", "metadata": meta,
+		"spec": map[string]interface{}{"nets": nets}}
+}
+
+// the blocklist object as read from the api
+type kubeBlocklist struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Spec struct {
+		Nets        []string `json:"nets"`
+		IngressDeny []struct {
+			FromCIDR []string `json:"fromCIDR"`
+		} `json:"ingressDeny"`
+	} `json:"spec"`
+}
+
+func (b *kubeBlocklist) nets() []string {
+	if cfgKubeBlocklist == kubeCilium {
+		var nets []string
+		for _, rule := range b.Spec.IngressDeny {
+			nets = append(nets, rule.FromCIDR...)
+		}
+		return nets
+	}
+	return b.Spec.Nets
+}
+
+// apply ops to the blocklist object, created if missing, read again on conflicts
+func kubeApply(ctx context.Context, ops []fwOp) error {
+	var err error
+	for i := 0; i < kubeRetries; i++ {
+		var current kubeBlocklist
+		status, gerr := kubeCall(ctx, "GET", kubeObjectUrl(), nil, &current)
+		if gerr != nil && status != http.StatusNotFound {
+			return gerr
+		}
+		set := make(map[string]bool)
+		for _, n := range current.nets() {
+			set[n] = true
+		}
+		for _, op := range ops {
+			set[op.ip+"/32"] = !op.del
+		}
+		nets := make([]string, 0, len(set))
+		for n, in := range set {
+			if in {
+				nets = append(nets, n)
+			}
+		}
+		sort.Strings(nets)
+
+		if status == http.StatusNotFound {
+			url := kubeObjectUrl()
+			status, err = kubeCall(ctx, "POST", url[:strings.LastIndex(url, "/")], kubeObject(nets, ""), nil)
+		} else {
+			status, err = kubeCall(ctx, "PUT", kubeObjectUrl(), kubeObject(nets, current.Metadata.ResourceVersion), nil)
+		}
+		// another node changed or created it since it was read
+		if err == nil || status != http.StatusConflict {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,377 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shared state in consul or etcd, for a fleet managed centrally; keys under kv_prefix:
+//
+//	ignore/<name>        an ip or cidr, ignored like ignore_ip
+//	policy/<list>        comma separated values of country_block, country_never_block,
+//	                     asn_block or asn_never_block, used together with the config's lists
+//	blocks/<ip>          {"at":1700000000,"node":"web-1"}, the active blocklist
+//
+// every node writes its blocks and deletes them when they expire; a node takes blocks of others
+// like cluster mode does, and unblocks a host taken from the store when its key is deleted,
+// so operators can unblock fleet-wide; at startup the current blocklist is taken before capture
+// starts, a new node doesn't begin with empty state
+// consul is watched with blocking queries, etcd's v3 json gateway is polled every kv_poll seconds
+type kvBackend interface {
+	// keys and values under prefix, blocking until they change after index if the backend can
+	list(prefix string, index uint64) (map[string]string, uint64, error)
+	put(key string, value string) error
+	delete(key string) error
+}
+
+type kvBlock struct {
+	At   int64  `json:"at"`
+	Node string `json:"node"`
+}
+
+var (
+	kvStore kvBackend
+	kvNode  string // name of this node in blocks it writes, cluster_node or hostname
+
+	kvLock        sync.RWMutex
+	kvIgnoreIps   []*net.IPNet
+	kvCountries   = map[string]map[string]bool{} // policy list -> countries
+	kvAsns        = map[string]map[int]bool{}    // policy list -> asns
+	kvBlocks      = map[string]kvBlock{}         // blocks in the store at the last list
+	kvTakenBlocks = map[string]bool{}            // hosts blocked here because of the store
+)
+
+func kvClient() *http.Client {
+	return &http.Client{Timeout: 10 * time.Minute}
+}
+
+func kvRequest(method string, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if cfgKvToken != "" {
+		if cfgKvBackend == "consul" {
+			req.Header.Set("X-Consul-Token", cfgKvToken)
+		} else {
+			req.Header.Set("Authorization", cfgKvToken)
+		}
+	}
+	return kvClient().Do(req)
+}
+
+type consulKV struct{ url string }
+
+func (c *consulKV) list(prefix string, index uint64) (map[string]string, uint64, error) {
+	url := fmt.Sprintf("%s/v1/kv/%s?recurse=true", c.url, prefix)
+	if index > 0 {
+		url += fmt.Sprintf("&index=%d&wait=5m", index)
+	}
+	resp, err := kvRequest("GET", url, nil)
+	if err != nil {
+		return nil, index, err
+	}
+	defer resp.Body.Close()
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	kvs := make(map[string]string)
+	if resp.StatusCode == http.StatusNotFound {
+		return kvs, next, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, index, fmt.Errorf("consul: %s", resp.Status)
+	}
+	var entries []struct {
+		Key   string
+		Value []byte // base64 in json
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, index, err
+	}
+	for _, e := range entries {
+		kvs[e.Key] = string(e.Value)
+	}
+	// consul index went backwards, e.g. after a snapshot restore
+	if next < index {
+		next = 0
+	}
+	return kvs, next, nil
+}
+
+func (c *consulKV) put(key string, value string) error {
+	return kvCheck(kvRequest("PUT", c.url+"/v1/kv/"+key, strings.NewReader(value)))
+}
+
+func (c *consulKV) delete(key string) error {
+	return kvCheck(kvRequest("DELETE", c.url+"/v1/kv/"+key, nil))
+}
+
+type etcdKV struct{ url string }
+
+func (e *etcdKV) call(path string, req interface{}, reply interface{}) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := kvRequest("POST", e.url+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("etcd: %s", resp.Status)
+	}
+	if reply == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(reply)
+}
+
+// first key after all keys with prefix
+func etcdRangeEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return "\x00"
+}
+
+func (e *etcdKV) list(prefix string, index uint64) (map[string]string, uint64, error) {
+	if index > 0 {
+		time.Sleep(time.Duration(cfgKvPoll) * time.Second)
+	}
+	var reply struct {
+		Header struct {
+			Revision string `json:"revision"`
+		} `json:"header"`
+		Kvs []struct {
+			Key   []byte `json:"key"`
+			Value []byte `json:"value"`
+		} `json:"kvs"`
+	}
+	req := map[string][]byte{"key": []byte(prefix), "range_end": []byte(etcdRangeEnd(prefix))}
+	if err := e.call("/v3/kv/range", req, &reply); err != nil {
+		return nil, index, err
+	}
+	kvs := make(map[string]string)
+	for _, kv := range reply.Kvs {
+		kvs[string(kv.Key)] = string(kv.Value)
+	}
+	rev, _ := strconv.ParseUint(reply.Header.Revision, 10, 64)
+	return kvs, rev, nil
+}
+
+func (e *etcdKV) put(key string, value string) error {
+	return e.call("/v3/kv/put", map[string][]byte{"key": []byte(key), "value": []byte(value)}, nil)
+}
+
+func (e *etcdKV) delete(key string) error {
+	return e.call("/v3/kv/deleterange", map[string][]byte{"key": []byte(key)}, nil)
+}
+
+func kvCheck(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// connect and take the current state, before capture starts
+func startKvStore() error {
+	url := strings.TrimSuffix(cfgKvUrl, "/")
+	switch cfgKvBackend {
+	case "consul":
+		kvStore = &consulKV{url: url}
+	case "etcd":
+		kvStore = &etcdKV{url: url}
+	default:
+		return fmt.Errorf("unknown kv_backend %q, should be consul or etcd", cfgKvBackend)
+	}
+	kvNode = cfgClusterNode
+	if kvNode == "" {
+		kvNode, _ = os.Hostname()
+	}
+	kvs, index, err := kvStore.list(cfgKvPrefix, 0)
+	if err != nil {
+		return err
+	}
+	applyKv(kvs)
+	go runKvWatch(index)
+	return nil
+}
+
+func runKvWatch(index uint64) {
+	for {
+		kvs, next, err := kvStore.list(cfgKvPrefix, index)
+		if err != nil {
+			if isShutdown() {
+				return
+			}
+			logMain(false, "watch kv store %s failed:%s", cfgKvUrl, err.Error())
+			time.Sleep(10 * time.Second)
+			continue
+		}
+		if next == index && cfgKvBackend == "consul" {
+			continue
+		}
+		index = next
+		applyKv(kvs)
+	}
+}
+
+// take ignore lists, policy lists and blocks of a full listing
+func applyKv(kvs map[string]string) {
+	var ignores []*net.IPNet
+	countries := map[string]map[string]bool{}
+	asns := map[string]map[int]bool{}
+	blocks := map[string]kvBlock{}
+	for key, value := range kvs {
+		name := strings.TrimPrefix(key, cfgKvPrefix)
+		value = strings.TrimSpace(value)
+		switch {
+		case strings.HasPrefix(name, "ignore/"):
+			if !strings.Contains(value, "/") {
+				value += "/32"
+			}
+			if _, ipNet, err := net.ParseCIDR(value); err == nil {
+				ignores = append(ignores, ipNet)
+			} else {
+				logMain(false, "kv %s, invalid ip:%s", key, value)
+			}
+		case name == "policy/country_block" || name == "policy/country_never_block":
+			list := map[string]bool{}
+			for _, field := range strings.Split(value, ",") {
+				if code := strings.ToUpper(strings.TrimSpace(field)); len(code) == 2 {
+					list[code] = true
+				}
+			}
+			countries[strings.TrimPrefix(name, "policy/")] = list
+		case name == "policy/asn_block" || name == "policy/asn_never_block":
+			list := map[int]bool{}
+			for _, field := range strings.Split(value, ",") {
+				field = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(field)), "AS")
+				if asn, err := strconv.Atoi(field); err == nil && asn > 0 {
+					list[asn] = true
+				}
+			}
+			asns[strings.TrimPrefix(name, "policy/")] = list
+		case strings.HasPrefix(name, "blocks/"):
+			var b kvBlock
+			if err := json.Unmarshal([]byte(value), &b); err != nil {
+				logMain(false, "kv %s, invalid block:%s", key, value)
+				continue
+			}
+			blocks[strings.TrimPrefix(name, "blocks/")] = b
+		}
+	}
+
+	kvLock.Lock()
+	kvIgnoreIps, kvCountries, kvAsns = ignores, countries, asns
+	kvBlocks = blocks
+	var removed []string
+	for ip := range kvTakenBlocks {
+		if _, ok := blocks[ip]; !ok {
+			removed = append(removed, ip)
+			delete(kvTakenBlocks, ip)
+		}
+	}
+	kvLock.Unlock()
+
+	for ip, b := range blocks {
+		if b.Node == kvNode {
+			continue
+		}
+		cb := &clusterBlock{Host: ip, At: b.At}
+		if applyClusterBlock("kv:"+b.Node, cb) {
+			kvLock.Lock()
+			kvTakenBlocks[ip] = true
+			kvLock.Unlock()
+		}
+	}
+	for _, ip := range removed {
+		unblockHost(ip, "deleted from kv store")
+	}
+}
+
+func isKvIgnored(ip net.IP) bool {
+	kvLock.RLock()
+	defer kvLock.RUnlock()
+	for _, n := range kvIgnoreIps {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// decision of the store's policy lists for ev
+func kvPolicy(ev *event) string {
+	if kvStore == nil {
+		return policyDefault
+	}
+	kvLock.RLock()
+	defer kvLock.RUnlock()
+	if kvCountries["country_never_block"][ev.Country] || kvAsns["asn_never_block"][ev.ASN] {
+		return policyAlarm
+	}
+	if kvCountries["country_block"][ev.Country] || kvAsns["asn_block"][ev.ASN] {
+		return policyBlock
+	}
+	return policyDefault
+}
+
+// write a block made here to the store, in background
+func kvAnnounce(ev *event) {
+	if kvStore == nil || ev.Peer != "" {
+		return
+	}
+	stateLock.Lock()
+	at := blockedAt[ev.Host]
+	stateLock.Unlock()
+	data, _ := json.Marshal(kvBlock{At: at, Node: kvNode})
+	go func() {
+		if err := kvStore.put(cfgKvPrefix+"blocks/"+ev.Host, string(data)); err != nil {
+			logMain(false, "write block of %s to kv store failed:%s", ev.Host, err.Error())
+		}
+	}()
+}
+
+// undo the block of a host whose key was deleted from the store
+// remove expired blocks this node wrote from the store
+func kvExpire(ip string) {
+	if kvStore == nil {
+		return
+	}
+	kvLock.Lock()
+	b, ok := kvBlocks[ip]
+	delete(kvTakenBlocks, ip)
+	kvLock.Unlock()
+	if !ok || b.Node != kvNode {
+		return
+	}
+	go func() {
+		if err := kvStore.delete(cfgKvPrefix + "blocks/" + ip); err != nil {
+			logMain(false, "delete block of %s from kv store failed:%s", ip, err.Error())
+		}
+	}()
+}
@@ -0,0 +1,174 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// table limits
+// tables that grow with traffic have a max size and a policy for what goes when it's reached:
+//   lru     the entry used least recently
+//   oldest  the entry added first
+//   none    nothing, new entries aren't added until old ones expire
+// max_tracked_ips and tracked_eviction bound hosts in stateEngine, port_cache_max and
+// port_cache_eviction the port caches, reputation_cache_max and reputation_cache_eviction the
+// reputation verdicts, event_queue and event_queue_drop the queues of otlp, elastic, loki and event_socket;
+// a full table is logged as a warning at most once an hour, evicted entries are counted as
+// cache_evicted in stats and dropped events as events_dropped
+// ignore_host addresses and the geoip tables are as large as their config and files, they aren't bounded
+
+const (
+	evictLru    = "lru"
+	evictOldest = "oldest"
+	evictNone   = "none"
+
+	// an eviction makes room for this share of a full cache at once, so it's not sorted on every insert
+	evictShare = 16
+
+	limitWarnInterval = time.Hour
+)
+
+var (
+	cfgTrackedEviction    = evictLru
+	cfgPortCacheEviction  = evictNone
+	cfgReputationCacheMax = 100000
+	cfgReputationEviction = evictLru
+	cfgEventQueue         = 1024
+	cfgEventQueueDrop     = "newest" // or oldest
+
+	limitLock   sync.Mutex
+	limitWarned = make(map[string]time.Time)
+)
+
+// eviction policy of a config key, none only where allowNone
+func parseEviction(lineno int, token string, value string, allowNone bool) string {
+	if value == evictLru || value == evictOldest || allowNone && value == evictNone {
+		return value
+	}
+	if allowNone {
+		logMain(true, "line %d:%s, invalid value:%s, should be lru, oldest or none", lineno, token, value)
+	}
+	logMain(true, "line %d:%s, invalid value:%s, should be lru or oldest", lineno, token, value)
+	return ""
+}
+
+// log that table reached its limit and what is done about it, at most once per limitWarnInterval
+func warnLimit(table string, max int, action string) {
+	now := time.Now()
+	limitLock.Lock()
+	defer limitLock.Unlock()
+	if now.Sub(limitWarned[table]) < limitWarnInterval {
+		return
+	}
+	limitWarned[table] = now
+	logMain(false, "WARNING %s is full at %d entries, %s", table, max, action)
+}
+
+func evictAction(policy string) string {
+	switch policy {
+	case evictLru:
+		return "least recently used entries are evicted"
+	case evictOldest:
+		return "oldest entries are evicted"
+	}
+	return "new entries are not added"
+}
+
+// how many entries an eviction of a full cache of n entries removes
+func evictCount(n int) int {
+	if n/evictShare > 1 {
+		return n / evictShare
+	}
+	return 1
+}
+
+// a port in checkedPortCache or closedPortCache
+type cachedPort struct {
+	expire int64 // unix seconds in checkedPortCache, nanoseconds in closedPortCache
+	used   int64 // last hit or when it was added, unix nanoseconds
+}
+
+// make room in a port cache still full after its expired entries were swept,
+// by port_cache_eviction; stateLock must be held
+func evictPortCache(table string, cache map[localPort]*cachedPort) {
+	if len(cache) < cfgPortCacheMax {
+		return
+	}
+	warnLimit(table, cfgPortCacheMax, evictAction(cfgPortCacheEviction))
+	if cfgPortCacheEviction == evictNone {
+		return
+	}
+	keys := make([]localPort, 0, len(cache))
+	for key := range cache {
+		keys = append(keys, key)
+	}
+	// every entry of a cache lives as long, the one expiring first was added first
+	rank := func(c *cachedPort) int64 {
+		if cfgPortCacheEviction == evictLru {
+			return c.used
+		}
+		return c.expire
+	}
+	sort.Slice(keys, func(i, j int) bool { return rank(cache[keys[i]]) < rank(cache[keys[j]]) })
+	for _, key := range keys[:evictCount(len(keys))] {
+		delete(cache, key)
+		statsAdd(&stats.cacheEvicted)
+	}
+}
+
+// make room in reputationCache if it's full, by reputation_cache_eviction; pending lookups stay
+// reputationLock must be held
+func evictReputation() {
+	if cfgReputationCacheMax <= 0 || len(reputationCache) < cfgReputationCacheMax {
+		return
+	}
+	warnLimit("reputation cache", cfgReputationCacheMax, evictAction(cfgReputationEviction))
+	var ips []string
+	for ip, e := range reputationCache {
+		if !e.pending {
+			ips = append(ips, ip)
+		}
+	}
+	rank := func(e *reputationEntry) int64 {
+		if cfgReputationEviction == evictLru {
+			return e.used
+		}
+		return e.added
+	}
+	sort.Slice(ips, func(i, j int) bool { return rank(reputationCache[ips[i]]) < rank(reputationCache[ips[j]]) })
+	n := evictCount(len(reputationCache))
+	if n > len(ips) {
+		n = len(ips)
+	}
+	for _, ip := range ips[:n] {
+		delete(reputationCache, ip)
+		statsAdd(&stats.cacheEvicted)
+	}
+}
+
+// queue ev for an exporter without blocking the guard, when the queue is full the new event,
+// or by event_queue_drop the oldest queued one, is dropped
+func queueEvent(queue chan *event, ev *event, exporter string) {
+	for {
+		select {
+		case queue <- ev:
+			return
+		default:
+		}
+		statsAdd(&stats.eventsDropped)
+		if cfgEventQueueDrop != evictOldest {
+			warnLimit(exporter+" event queue", cfgEventQueue, "new events are dropped")
+			return
+		}
+		warnLimit(exporter+" event queue", cfgEventQueue, "oldest events are dropped")
+		select {
+		case <-queue:
+		default:
+		}
+	}
+}
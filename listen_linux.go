@@ -0,0 +1,110 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// socket states of /proc/net/tcp and udp, see include/net/tcp_states.h
+const (
+	tcpListen = 0x0a
+	udpBound  = 0x07 // TCP_CLOSE, an unconnected udp socket
+)
+
+// listening sockets of /proc/net/tcp or udp, by bind scan if /proc isn't there, like in chroot
+// ipv6 sockets are read too, a socket on :: takes ipv4 connections as well
+func listeningPorts() ([]listener, error) {
+	ls, err := readListeners("/proc/net/" + *mode)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return bindScanListeners(), nil
+		}
+		return nil, err
+	}
+	ls6, err := readListeners("/proc/net/" + *mode + "6")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return append(ls, ls6...), nil
+}
+
+func readListeners(file string) ([]listener, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	state := uint64(tcpListen)
+	if *mode == "udp" {
+		state = udpBound
+	}
+	var ls []listener
+	s := bufio.NewScanner(f)
+	s.Scan() // header
+	for s.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(s.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		if st, err := strconv.ParseUint(fields[3], 16, 8); err != nil || st != state {
+			continue
+		}
+		local := strings.SplitN(fields[1], ":", 2)
+		if len(local) != 2 {
+			continue
+		}
+		ip := procAddr(local[0])
+		port, err1 := strconv.ParseUint(local[1], 16, 16)
+		inode, err2 := strconv.ParseUint(fields[9], 10, 64)
+		if ip == nil || err1 != nil || err2 != nil {
+			continue
+		}
+		ls = append(ls, listener{addr: ip.String(), port: int(port), inode: inode})
+	}
+	return ls, s.Err()
+}
+
+// address of /proc/net, printed as 32 bit words of its bytes in host order
+func procAddr(s string) net.IP {
+	if len(s) != 8 && len(s) != 32 {
+		return nil
+	}
+	ip := make(net.IP, len(s)/2)
+	for i := 0; i < len(ip); i += 4 {
+		w, err := strconv.ParseUint(s[i*2:i*2+8], 16, 32)
+		if err != nil {
+			return nil
+		}
+		binary.NativeEndian.PutUint32(ip[i:], uint32(w))
+	}
+	return ip
+}
+
+// process owning socket inode, like "nc[1234]", empty if not found
+func socketOwner(inode uint64) string {
+	if inode == 0 {
+		return ""
+	}
+	target := fmt.Sprintf("socket:[%d]", inode)
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		if link, err := os.Readlink(fd); err != nil || link != target {
+			continue
+		}
+		pid := strings.Split(fd, "/")[2]
+		comm, _ := os.ReadFile("/proc/" + pid + "/comm")
+		return fmt.Sprintf("%s[%s]", strings.TrimSpace(string(comm)), pid)
+	}
+	return ""
+}
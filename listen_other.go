@@ -0,0 +1,15 @@
+//go:build !linux
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+func listeningPorts() ([]listener, error) {
+	return bindScanListeners(), nil
+}
+
+func socketOwner(inode uint64) string {
+	return ""
+}
@@ -0,0 +1,155 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// local networks ignored by ignore_local, re-read every ignore_local_refresh seconds so
+// addresses from dhcp renewals, vpn tunnels or new cloud nics are ignored as they appear
+var (
+	localNetLock sync.RWMutex
+	localNets    []*net.IPNet
+)
+
+func isLocalIgnored(ip net.IP) bool {
+	localNetLock.RLock()
+	defer localNetLock.RUnlock()
+	for _, n := range localNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// re-read local networks and log what changed
+func refreshLocalNets() error {
+	nets, err := localIgnoreNets()
+	if err != nil {
+		return err
+	}
+	localNetLock.Lock()
+	old := localNets
+	localNets = nets
+	localNetLock.Unlock()
+	if old == nil {
+		return nil
+	}
+	for _, n := range nets {
+		if !hasNet(old, n) {
+			logMain(false, "local network %s is ignored", n)
+		}
+	}
+	for _, n := range old {
+		if !hasNet(nets, n) {
+			logMain(false, "local network %s is no longer ignored", n)
+		}
+	}
+	return nil
+}
+
+func runLocalRefresh() {
+	for range time.Tick(time.Duration(cfgIgnoreLocalRefresh) * time.Second) {
+		if err := refreshLocalNets(); err != nil {
+			logMain(false, "query system network interface addresses failed:%s", err.Error())
+		}
+		if err := refreshExternalAddrs(); err != nil {
+			logMain(false, "query external interface addresses failed:%s", err.Error())
+		}
+		refreshPublishedPorts()
+	}
+}
+
+func hasNet(nets []*net.IPNet, n *net.IPNet) bool {
+	for _, v := range nets {
+		if v.String() == n.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// networks of this host to ignore, by ignore_local:
+//
+//	addresses  127.0.0.0/8 and each ipv4 address of the interfaces as a /32
+//	subnets    127.0.0.0/8 and the attached subnet of each ipv4 address
+//	off        none
+//
+// only interfaces in ignore_local_interface count, if it's set
+// subnets of container bridges are ignored, or only their addresses, by container_networks
+func localIgnoreNets() ([]*net.IPNet, error) {
+	if cfgIgnoreLocal == "off" && cfgContainerNetworks != containerIgnore {
+		return []*net.IPNet{}, nil
+	}
+	nets := []*net.IPNet{}
+	if cfgIgnoreLocal != "off" {
+		nets = append(nets, &net.IPNet{IP: net.IPv4(127, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)})
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		mode := cfgIgnoreLocal
+		container := cfgContainerNetworks != "off" && isContainerInterface(iface.Name)
+		switch {
+		case container && cfgContainerNetworks == containerIgnore:
+			mode = "subnets"
+		case !wantLocalInterface(iface.Name):
+			continue
+		case container && mode == "subnets":
+			mode = "addresses"
+		}
+		if mode == "off" {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+			n := &net.IPNet{IP: ipNet.IP.To4(), Mask: net.CIDRMask(32, 32)}
+			if mode == "subnets" {
+				n.Mask = ipNet.Mask[len(ipNet.Mask)-4:]
+				n.IP = n.IP.Mask(n.Mask)
+			}
+			if !containsNet(nets, n) {
+				nets = append(nets, n)
+			}
+		}
+	}
+	return nets, nil
+}
+
+func wantLocalInterface(name string) bool {
+	if len(cfgIgnoreLocalInterfaces) == 0 {
+		return true
+	}
+	for _, want := range cfgIgnoreLocalInterfaces {
+		if want == name {
+			return true
+		}
+	}
+	return false
+}
+
+// if n is inside one of nets
+func containsNet(nets []*net.IPNet, n *net.IPNet) bool {
+	ones, _ := n.Mask.Size()
+	for _, c := range nets {
+		if o, _ := c.Mask.Size(); o <= ones && c.Contains(n.IP) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"log"
+	"log/syslog"
+	"os"
+	"syscall"
+)
+
+// toggle debug and trace logs, see runDebugSignals
+var debugSignals = []os.Signal{syscall.SIGUSR1, syscall.SIGUSR2}
+
+// reload api tokens, see runReloadSignal
+var reloadSignals = []os.Signal{syscall.SIGHUP}
+
+func openSystemLogger() (*log.Logger, error) {
+	return syslog.NewLogger(syslog.LOG_ERR|syslog.LOG_LOCAL7, log.Ldate|log.Lmicroseconds)
+}
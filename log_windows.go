@@ -0,0 +1,21 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"log"
+	"os"
+)
+
+// no SIGUSR1 or SIGUSR2 on windows, debug and trace are toggled over control_socket
+var debugSignals []os.Signal
+
+// no SIGHUP either, api tokens are reloaded over control_socket
+var reloadSignals []os.Signal
+
+// no syslog on windows, the service manager captures stderr
+func openSystemLogger() (*log.Logger, error) {
+	return log.New(os.Stderr, "", log.Ldate|log.Lmicroseconds), nil
+}
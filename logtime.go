@@ -0,0 +1,77 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"io"
+	"log"
+	"time"
+)
+
+// timestamps of the main, alarm and blocked logs, digests and event records
+// log_time_format is default, the log package's 2006/01/02 15:04:05.000000, rfc3339 or
+// rfc3339nano; log_utc writes them all in utc, for correlating hosts in different timezones
+
+const (
+	logTimeDefault     = "default"
+	logTimeRFC3339     = "rfc3339"
+	logTimeRFC3339Nano = "rfc3339nano"
+)
+
+var (
+	cfgLogTimeFormat = logTimeDefault
+	cfgLogUTC        bool
+)
+
+// t in the zone of the logs
+func logTime(t time.Time) time.Time {
+	if cfgLogUTC {
+		return t.UTC()
+	}
+	return t
+}
+
+func formatLogTime(t time.Time) string {
+	t = logTime(t)
+	switch cfgLogTimeFormat {
+	case logTimeRFC3339:
+		return t.Format(time.RFC3339)
+	case logTimeRFC3339Nano:
+		return t.Format(time.RFC3339Nano)
+	}
+	return t.Format("2006/01/02 15:04:05.000000")
+}
+
+// prefixes each write, an entry of a log.Logger, with its time
+type timeWriter struct {
+	w io.Writer
+}
+
+func (tw timeWriter) Write(p []byte) (int, error) {
+	if _, err := tw.w.Write(append([]byte(formatLogTime(time.Now())+" "), p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func newLogger(w io.Writer) *log.Logger {
+	l := log.New(w, "", 0)
+	setLogTime(l)
+	return l
+}
+
+// apply log_time_format and log_utc to l, once; the log package does the default format
+func setLogTime(l *log.Logger) {
+	if cfgLogTimeFormat == logTimeDefault {
+		flags := log.Ldate | log.Lmicroseconds
+		if cfgLogUTC {
+			flags |= log.LUTC
+		}
+		l.SetFlags(flags)
+		return
+	}
+	l.SetFlags(0)
+	l.SetOutput(timeWriter{l.Writer()})
+}
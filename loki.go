@@ -0,0 +1,193 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// push events to grafana loki, as event_log records in streams labeled by loki_labels:
+//
+//	host       hostname of portguard
+//	event      alarm, block, ...
+//	proto      TCP or UDP
+//	scan_type  scan type of the alarm
+//	iface      interface the probe came in on
+//	country    country of the source
+//	name=value a fixed label
+//
+// job=portguard is always set; source ips stay in the line, as labels they would create a stream
+// per scanner, e.g.
+//
+//	{job="portguard", event="block"} |= "\"host\":\"1.2.3.4\""
+
+const (
+	lokiBatch     = 500
+	lokiFlushTime = 5 * time.Second
+)
+
+var (
+	cfgLokiUrl     string
+	cfgLokiLabels  = []string{"host", "event", "proto", "scan_type"}
+	cfgLokiHeaders []string
+
+	lokiClient   = &http.Client{Timeout: 10 * time.Second}
+	lokiEvents   chan *event
+	lokiHostname string
+)
+
+var lokiLabelNames = []string{"host", "event", "proto", "scan_type", "iface", "country"}
+
+// loki_labels = <label>[,<label>...]
+func parseLokiLabels(lineno int, token string, value string) {
+	cfgLokiLabels = nil
+	for _, label := range strings.Split(value, ",") {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		if !strings.Contains(label, "=") && !containsString(lokiLabelNames, label) {
+			logMain(true, "line %d:%s, invalid label:%s, should be one of %s or name=value", lineno, token, label, strings.Join(lokiLabelNames, ","))
+		}
+		cfgLokiLabels = append(cfgLokiLabels, label)
+	}
+}
+
+// queue event for loki, dropped if the pusher falls behind
+func lokiEvent(ev *event) {
+	if lokiEvents == nil {
+		return
+	}
+	queueEvent(lokiEvents, ev, "loki")
+}
+
+func lokiStreamLabels(ev *event) map[string]string {
+	labels := map[string]string{"job": "portguard"}
+	for _, label := range cfgLokiLabels {
+		if kv := strings.SplitN(label, "=", 2); len(kv) == 2 {
+			labels[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			continue
+		}
+		var value string
+		switch label {
+		case "host":
+			value = lokiHostname
+		case "event":
+			value = ev.Kind
+		case "proto":
+			value = ev.Proto
+		case "scan_type":
+			value = ev.ScanType
+		case "iface":
+			value = ev.Iface
+		case "country":
+			value = ev.Country
+		}
+		if value != "" {
+			labels[label] = value
+		}
+	}
+	return labels
+}
+
+func lokiPush(events []*event) error {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	streams := make(map[string]*stream)
+	var keys []string
+	for _, ev := range events {
+		line, err := json.Marshal(ev.record())
+		if err != nil {
+			continue
+		}
+		labels := lokiStreamLabels(ev)
+		key, _ := json.Marshal(labels)
+		s, ok := streams[string(key)]
+		if !ok {
+			s = &stream{Stream: labels}
+			streams[string(key)] = s
+			keys = append(keys, string(key))
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(ev.Time.UnixNano(), 10), string(line)})
+	}
+	body := struct {
+		Streams []*stream `json:"streams"`
+	}{}
+	for _, key := range keys {
+		s := streams[key]
+		// loki wants the entries of a stream in order
+		sort.SliceStable(s.Values, func(i, j int) bool {
+			a, _ := strconv.ParseInt(s.Values[i][0], 10, 64)
+			b, _ := strconv.ParseInt(s.Values[j][0], 10, 64)
+			return a < b
+		})
+		body.Streams = append(body.Streams, s)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(cfgLokiUrl, "/")+"/loki/api/v1/push", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for _, header := range cfgLokiHeaders {
+		if kv := strings.SplitN(header, ":", 2); len(kv) == 2 {
+			req.Header.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+		}
+	}
+	resp, err := lokiClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s/loki/api/v1/push: %s", cfgLokiUrl, resp.Status)
+	}
+	return nil
+}
+
+func startLoki() {
+	lokiHostname, _ = os.Hostname()
+	lokiEvents = make(chan *event, cfgEventQueue)
+	go runLoki()
+}
+
+// push events in batches
+func runLoki() {
+	var batch []*event
+	flush := time.NewTicker(lokiFlushTime)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := lokiPush(batch); err != nil {
+			logMain(false, "push %d events to loki failed:%s", len(batch), err.Error())
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case ev := <-lokiEvents:
+			batch = append(batch, ev)
+			if len(batch) >= lokiBatch {
+				send()
+			}
+		case <-flush.C:
+			send()
+		}
+	}
+}
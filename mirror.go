@@ -0,0 +1,196 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mirror monitoring
+// a sensor on a mirror or span port sees the traffic of a whole segment: guards on mirror_interface
+// read it with a promiscuous af_packet socket and take the destination of a packet as the target,
+// not the sensor itself; only hosts in mirror_hosts are protected, every destination if none is set
+// the sensor can't bind ports of other hosts, so a port is open if mirror_open lists it for the host
+// or, with mirror_learn, if the host was seen answering on it, a syn-ack or a udp reply, within
+// mirror_learn_ttl seconds; probes of the other ports raise alarms and blocks as for local ports
+// responders should block on a router or firewall of the segment, kill_route on the sensor protects
+// nothing
+
+var (
+	cfgMirrorInterfaces []string
+	cfgMirrorHosts      []*net.IPNet
+	cfgMirrorOpen       []mirrorOpen
+	cfgMirrorLearn      = true
+	cfgMirrorLearnTtl   = 86400
+)
+
+// ports of mirror_open, proto "" for both
+type mirrorOpen struct {
+	hosts *net.IPNet
+	proto string
+	ports portSet
+}
+
+// a port of a protected host
+type mirrorPort struct {
+	addr [4]byte
+	port int
+}
+
+// learned ports are dropped past this many, the expired ones first
+const mirrorLearnMax = 65536
+
+var (
+	mirrorLock    sync.Mutex
+	mirrorLearned = make(map[mirrorPort]int64) // expiry, unix seconds
+)
+
+// mirror_open = <host|cidr> [tcp|udp] <ports>
+func parseMirrorOpen(lineno int, token, value string) mirrorOpen {
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		logMain(true, "line %d:%s, invalid value:%s, should be <host|cidr> [tcp|udp] <ports>", lineno, token, value)
+	}
+	o := mirrorOpen{hosts: parseIp(lineno, token, fields[0])}
+	rest := fields[1:]
+	if p := strings.ToLower(rest[0]); p == "tcp" || p == "udp" {
+		o.proto = p
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		logMain(true, "line %d:%s, invalid value:%s, should be <host|cidr> [tcp|udp] <ports>", lineno, token, value)
+	}
+	for _, f := range rest {
+		parsePorts(lineno, token, strings.Trim(f, ","), &o.ports)
+	}
+	return o
+}
+
+func isMirrorIface(iface string) bool {
+	return iface != "" && containsString(cfgMirrorInterfaces, iface)
+}
+
+// the guards of the interface watch a mirror port
+func (p *ifaceProfile) mirror() bool {
+	return isMirrorIface(p.iface)
+}
+
+// ip is a host of the segment portguard protects
+func isMirrorProtected(ip net.IP) bool {
+	if len(cfgMirrorHosts) == 0 {
+		return true
+	}
+	for _, n := range cfgMirrorHosts {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func newMirrorPort(ip net.IP, port int) mirrorPort {
+	k := mirrorPort{port: port}
+	copy(k.addr[:], ip.To4())
+	return k
+}
+
+// note port of protected host ip as open
+func learnMirrorPort(ip net.IP, port int) {
+	now := time.Now().Unix()
+	k := newMirrorPort(ip, port)
+	mirrorLock.Lock()
+	defer mirrorLock.Unlock()
+	if _, ok := mirrorLearned[k]; !ok {
+		if len(mirrorLearned) >= mirrorLearnMax {
+			sweepMirrorPorts(now)
+		}
+		statsAdd(&stats.mirrorLearned)
+	}
+	mirrorLearned[k] = now + int64(cfgMirrorLearnTtl)
+}
+
+// drop expired ports, or any half of them if none expired; mirrorLock held
+func sweepMirrorPorts(now int64) {
+	for k, expiry := range mirrorLearned {
+		if expiry <= now {
+			delete(mirrorLearned, k)
+		}
+	}
+	for k := range mirrorLearned {
+		if len(mirrorLearned) < mirrorLearnMax/2 {
+			break
+		}
+		delete(mirrorLearned, k)
+	}
+}
+
+// port of protected host ip is open by mirror_open or was learned
+func mirrorPortOpen(ip net.IP, port int) bool {
+	for _, o := range cfgMirrorOpen {
+		if (o.proto == "" || o.proto == *mode) && o.hosts.Contains(ip) && o.ports.Contains(port) {
+			return true
+		}
+	}
+	if !cfgMirrorLearn {
+		return false
+	}
+	mirrorLock.Lock()
+	expiry, ok := mirrorLearned[newMirrorPort(ip, port)]
+	mirrorLock.Unlock()
+	return ok && expiry > time.Now().Unix()
+}
+
+// run a packet of the mirrored segment through learning, false if it isn't to a protected host
+// or is a reply of one; sport is the source port, flags the tcp flags, 0 for udp
+func mirrorPacket(ip *IPv4Header, sport int, flags uint8) bool {
+	if isMirrorProtected(ip.Source) {
+		switch {
+		case *mode == "tcp" && flags&(SYN|ACK) == SYN|ACK:
+			if cfgMirrorLearn {
+				learnMirrorPort(ip.Source, sport)
+			}
+		case *mode == "udp" && mirrorPortOpen(ip.Source, sport):
+			// an answer of an open port, not a probe of the client's
+			return false
+		case *mode == "udp" && cfgMirrorLearn && sport < 32768:
+			learnMirrorPort(ip.Source, sport)
+			return false
+		}
+	}
+	if !isMirrorProtected(ip.Destination) {
+		statsAdd(&stats.mirrorOther)
+		tracePacket(strings.ToUpper(*mode), ip.Source, 0, "not to a protected host")
+		return false
+	}
+	return true
+}
+
+// port of the probe's target is in use: of host dst on a mirror port, else of laddr here
+func probedPortInUse(laddr net.IP, dst net.IP, port int, prof *ifaceProfile) bool {
+	if prof.mirror() {
+		return mirrorPortOpen(dst, port)
+	}
+	return portInUse(laddr, port, prof.netns())
+}
+
+func mirrorString() string {
+	var open []string
+	for _, o := range cfgMirrorOpen {
+		s := o.hosts.String()
+		if o.proto != "" {
+			s += " " + o.proto
+		}
+		open = append(open, s+" "+o.ports.String())
+	}
+	var hosts []string
+	for _, n := range cfgMirrorHosts {
+		hosts = append(hosts, n.String())
+	}
+	return "interfaces:" + strings.Join(cfgMirrorInterfaces, ",") + " hosts:" + strings.Join(hosts, ",") +
+		" open:" + strings.Join(open, ";")
+}
@@ -0,0 +1,254 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// misp
+// blocks are shared as indicators with the misp instance at misp_url, authenticated by the api key
+// misp_key: the host as an ip-src attribute, for ids, with its first and last probe, and the ports it
+// probed as port attributes, added to event misp_event, or to an event of the day portguard makes,
+// "portguard scan indicators <date>", tagged with misp_tag; every block of a host is a sighting,
+// so a host already in the event only gets one more
+// blocks from cluster peers are left to the node that made them
+
+const (
+	// port attributes added for a host, a full scan would add thousands
+	mispMaxPorts = 20
+
+	mispSource  = "portguard"
+	mispDayInfo = "portguard scan indicators "
+)
+
+var (
+	cfgMispUrl          string
+	cfgMispKey          string
+	cfgMispEvent        int // 0 for an event of the day
+	cfgMispDistribution int // of the events made, 0 your organisation only to 3 all communities
+	cfgMispTags         []string
+
+	mispClient = &http.Client{Timeout: 30 * time.Second}
+	mispEvents chan *event
+
+	// event of the day made or found, only used by runMisp
+	mispDay   string
+	mispDayId string
+)
+
+type mispAttribute struct {
+	Type         string `json:"type"`
+	Category     string `json:"category"`
+	Value        string `json:"value"`
+	ToIds        bool   `json:"to_ids"`
+	Comment      string `json:"comment,omitempty"`
+	FirstSeen    string `json:"first_seen,omitempty"`
+	LastSeen     string `json:"last_seen,omitempty"`
+	Distribution string `json:"distribution"`
+}
+
+// queue a block for misp
+func mispEvent(ev *event) {
+	if mispEvents == nil || ev.Kind != eventBlock || ev.Peer != "" {
+		return
+	}
+	queueEvent(mispEvents, ev, "misp")
+}
+
+// call the misp api at path, decoding the reply into result if not nil
+func mispCall(method string, path string, body interface{}, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(cfgMispUrl, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", cfgMispKey)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := mispClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var v struct {
+			Message string
+		}
+		json.NewDecoder(resp.Body).Decode(&v)
+		if v.Message != "" {
+			return fmt.Errorf("%s %s: %s, %s", method, path, resp.Status, v.Message)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// id of the event to add indicators of a block at t to, found or made for the day without misp_event
+func mispEventId(t time.Time) (string, error) {
+	if cfgMispEvent > 0 {
+		return strconv.Itoa(cfgMispEvent), nil
+	}
+	day := t.Format("2006-01-02")
+	if day == mispDay {
+		return mispDayId, nil
+	}
+	info := mispDayInfo + day
+	var found struct {
+		Response []struct {
+			Event struct {
+				Id   string
+				Info string
+			}
+		} `json:"response"`
+	}
+	search := map[string]interface{}{"returnFormat": "json", "eventinfo": info, "metadata": true}
+	if err := mispCall("POST", "/events/restSearch", search, &found); err != nil {
+		return "", err
+	}
+	for _, r := range found.Response {
+		if r.Event.Info == info {
+			mispDay, mispDayId = day, r.Event.Id
+			return mispDayId, nil
+		}
+	}
+
+	var tags []map[string]string
+	for _, tag := range cfgMispTags {
+		tags = append(tags, map[string]string{"name": tag})
+	}
+	ev := map[string]interface{}{"Event": map[string]interface{}{
+		"info":            info,
+		"date":            day,
+		"distribution":    strconv.Itoa(cfgMispDistribution),
+		"threat_level_id": "3", // low
+		"analysis":        "2", // completed
+		"Tag":             tags,
+	}}
+	var made struct {
+		Event struct {
+			Id string
+		}
+	}
+	if err := mispCall("POST", "/events/add", ev, &made); err != nil {
+		return "", err
+	}
+	if made.Event.Id == "" {
+		return "", fmt.Errorf("no id of event %q made", info)
+	}
+	mispDay, mispDayId = day, made.Event.Id
+	return mispDayId, nil
+}
+
+// if event id has an ip-src attribute of host
+func mispHasHost(id string, host string) (bool, error) {
+	var found struct {
+		Response struct {
+			Attribute []struct {
+				Id string
+			}
+		} `json:"response"`
+	}
+	search := map[string]interface{}{"returnFormat": "json", "eventid": id, "type": "ip-src", "value": host}
+	if err := mispCall("POST", "/attributes/restSearch", search, &found); err != nil {
+		return false, err
+	}
+	return len(found.Response.Attribute) > 0, nil
+}
+
+// share a block: the attributes of a host new to the event, and a sighting
+func mispShare(ev *event) error {
+	id, err := mispEventId(ev.Time)
+	if err != nil {
+		return err
+	}
+	known, err := mispHasHost(id, ev.Host)
+	if err != nil {
+		return err
+	}
+	if !known {
+		first, last := ev.FirstSeen, ev.LastSeen
+		if first.IsZero() {
+			first, last = ev.Time, ev.Time
+		}
+		comment := fmt.Sprintf("%s, %d ports probed", ev.ScanType, len(ev.Ports))
+		if ev.Pattern != "" {
+			comment += ", " + ev.Pattern
+		}
+		attrs := []mispAttribute{{
+			Type:         "ip-src",
+			Category:     "Network activity",
+			Value:        ev.Host,
+			ToIds:        true,
+			Comment:      comment,
+			FirstSeen:    first.Format(time.RFC3339),
+			LastSeen:     last.Format(time.RFC3339),
+			Distribution: "5", // inherit the event's
+		}}
+		ports := ev.Ports
+		if len(ports) == 0 {
+			ports = []int{ev.Port}
+		}
+		if len(ports) > mispMaxPorts {
+			ports = ports[:mispMaxPorts]
+		}
+		for _, port := range ports {
+			attrs = append(attrs, mispAttribute{
+				Type:         "port",
+				Category:     "Network activity",
+				Value:        strconv.Itoa(port),
+				Comment:      fmt.Sprintf("%s probed by %s", ev.Proto, ev.Host),
+				Distribution: "5",
+			})
+		}
+		if err := mispCall("POST", "/attributes/add/"+id, attrs, nil); err != nil {
+			return err
+		}
+	}
+	sighting := map[string]interface{}{
+		"values":    []string{ev.Host},
+		"source":    mispSource,
+		"timestamp": ev.Time.Unix(),
+	}
+	return mispCall("POST", "/sightings/add", sighting, nil)
+}
+
+func startMisp() {
+	mispEvents = make(chan *event, cfgEventQueue)
+	go runMisp()
+}
+
+// share blocks one by one, a failed one is logged and left out
+func runMisp() {
+	for ev := range mispEvents {
+		if err := mispShare(ev); err != nil {
+			logMain(false, "share block of %s with misp failed:%s", ev.Host, err.Error())
+		}
+	}
+}
+
+func mispString() string {
+	if cfgMispUrl == "" {
+		return "off"
+	}
+	event := "daily"
+	if cfgMispEvent > 0 {
+		event = strconv.Itoa(cfgMispEvent)
+	}
+	return fmt.Sprintf("url:%q event:%s distribution:%d tags:%s", cfgMispUrl, event, cfgMispDistribution, strings.Join(cfgMispTags, ","))
+}
@@ -0,0 +1,161 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// named profiles
+// profile.<name>.<key> lines bundle settings to switch between at runtime, like "normal",
+// "under-attack" or "pentest-week"; keys a profile doesn't set use the global ones:
+//   scan_trigger, block_score  block threshold, see scoring
+//   block_duration             seconds of a first block, needs block_duration, current blocks expire by it too
+//   responders                 comma separated responders that may run, none for no responder at all
+// profile names the one active at startup; "profile <name>" on control_socket switches to
+// another without a restart, "profile default" back to the global settings
+// keys of interface profiles win over the active profile
+
+const profileDefault = "default"
+
+type namedProfile struct {
+	name          string
+	scanTrigger   int // 0 for the global one
+	blockScore    int
+	blockDuration int
+	responders    []string // nil for all of them
+}
+
+var (
+	cfgProfiles = make(map[string]*namedProfile)
+	cfgProfile  = profileDefault // active at startup
+
+	profileLock   sync.Mutex
+	activeProfile *namedProfile // nil for the global settings
+)
+
+func parseProfileKey(lineno int, token string, value string) {
+	fields := strings.Split(token, ".")
+	if len(fields) != 3 || fields[1] == "" || fields[1] == profileDefault {
+		logMain(true, "line %d:%s, invalid key, should be profile.<name>.<key>, name not %s", lineno, token, profileDefault)
+	}
+	p, ok := cfgProfiles[fields[1]]
+	if !ok {
+		p = &namedProfile{name: fields[1]}
+		cfgProfiles[fields[1]] = p
+	}
+	switch fields[2] {
+	case "scan_trigger":
+		if p.scanTrigger = parseInt(lineno, token, value); p.scanTrigger <= 0 {
+			logMain(true, "line %d:%s, invalid value:%s, should be positive", lineno, token, value)
+		}
+	case "block_score":
+		if p.blockScore = parseInt(lineno, token, value); p.blockScore <= 0 {
+			logMain(true, "line %d:%s, invalid value:%s, should be positive", lineno, token, value)
+		}
+	case "block_duration":
+		if p.blockDuration = parseInt(lineno, token, value); p.blockDuration <= 0 {
+			logMain(true, "line %d:%s, invalid value:%s, should be positive", lineno, token, value)
+		}
+	case "responders":
+		p.responders = []string{}
+		if value == "none" {
+			break
+		}
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				p.responders = append(p.responders, name)
+			}
+		}
+	default:
+		logMain(true, "line %d:%s, unknown key %s, should be scan_trigger, block_score, block_duration or responders", lineno, token, fields[2])
+	}
+}
+
+// profiles must name configured responders, block_duration needs blocks to expire at all
+func checkProfiles() {
+	for _, name := range profileNames() {
+		p := cfgProfiles[name]
+		if p.blockDuration > 0 && cfgBlockDuration == 0 {
+			logMain(true, "profile.%s.block_duration, blocks never expire without block_duration", name)
+		}
+		for _, r := range p.responders {
+			found := false
+			for _, c := range responders {
+				found = found || c.Name() == r
+			}
+			if !found {
+				logMain(false, "WARNING profile.%s, responder %s is not configured", name, r)
+			}
+		}
+	}
+	if cfgProfile == profileDefault {
+		return
+	}
+	if err := switchProfile(cfgProfile); err != nil {
+		logMain(true, "profile %s:%s", cfgProfile, err.Error())
+	}
+}
+
+// make profile name active, default for the global settings
+func switchProfile(name string) error {
+	var p *namedProfile
+	if name != profileDefault {
+		var ok bool
+		if p, ok = cfgProfiles[name]; !ok {
+			return errors.New("unknown profile " + name + ", should be " + strings.Join(append(profileNames(), profileDefault), ", "))
+		}
+	}
+	profileLock.Lock()
+	activeProfile = p
+	profileLock.Unlock()
+	logMain(false, "profile %s is active", name)
+	return nil
+}
+
+// the active profile, nil for the global settings
+func currentProfile() *namedProfile {
+	profileLock.Lock()
+	defer profileLock.Unlock()
+	return activeProfile
+}
+
+func currentProfileName() string {
+	if p := currentProfile(); p != nil {
+		return p.name
+	}
+	return profileDefault
+}
+
+// if the active profile lets responder name run
+func profileAllows(name string) bool {
+	p := currentProfile()
+	return p == nil || p.responders == nil || containsString(p.responders, name)
+}
+
+func profileNames() []string {
+	var names []string
+	for name := range cfgProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profile [name], show the active profile or switch to name
+func controlProfile(args []string) (interface{}, error) {
+	if len(args) > 1 {
+		return nil, errors.New("usage: profile [name|default]")
+	}
+	if len(args) == 1 {
+		if err := switchProfile(args[0]); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]interface{}{"profile": currentProfileName(), "profiles": profileNames(), "block_score": blockThreshold()}, nil
+}
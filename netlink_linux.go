@@ -0,0 +1,112 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"syscall"
+)
+
+// append a netlink attribute, padded to 4 bytes
+func netlinkAttr(b []byte, typ uint16, value []byte) []byte {
+	b = binary.NativeEndian.AppendUint16(b, uint16(syscall.SizeofRtAttr+len(value)))
+	b = binary.NativeEndian.AppendUint16(b, typ)
+	b = append(b, value...)
+	for len(b)%syscall.NLMSG_ALIGNTO != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func netlinkUint32(v uint32) []byte {
+	return binary.NativeEndian.AppendUint32(nil, v)
+}
+
+// attributes of a netlink message body by type, nested and byte order flags cleared
+func netlinkAttrs(b []byte) map[uint16][]byte {
+	attrs := make(map[uint16][]byte)
+	for len(b) >= syscall.SizeofRtAttr {
+		l := int(binary.NativeEndian.Uint16(b))
+		if l < syscall.SizeofRtAttr || l > len(b) {
+			break
+		}
+		attrs[binary.NativeEndian.Uint16(b[2:])&0x3fff] = b[syscall.SizeofRtAttr:l]
+		l = (l + syscall.NLMSG_ALIGNTO - 1) &^ (syscall.NLMSG_ALIGNTO - 1)
+		if l > len(b) {
+			break
+		}
+		b = b[l:]
+	}
+	return attrs
+}
+
+func netlinkOpen(proto int) (int, error) {
+	sock, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return -1, err
+	}
+	if err := syscall.Bind(sock, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(sock)
+		return -1, err
+	}
+	return sock, nil
+}
+
+func netlinkSend(sock int, typ uint16, flags uint16, body []byte) error {
+	msg := make([]byte, syscall.NLMSG_HDRLEN, syscall.NLMSG_HDRLEN+len(body))
+	binary.NativeEndian.PutUint32(msg[0:], uint32(syscall.NLMSG_HDRLEN+len(body)))
+	binary.NativeEndian.PutUint16(msg[4:], typ)
+	binary.NativeEndian.PutUint16(msg[6:], flags|syscall.NLM_F_REQUEST)
+	binary.NativeEndian.PutUint32(msg[8:], 1)
+	msg = append(msg, body...)
+	return syscall.Sendto(sock, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+}
+
+// read replies until the ack of a request or the end of a dump, each message of a dump
+// is passed to fn
+func netlinkReceive(sock int, fn func(m *syscall.NetlinkMessage)) error {
+	reply := make([]byte, 65536)
+	for {
+		n, _, err := syscall.Recvfrom(sock, reply, 0)
+		if err != nil {
+			return err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(reply[:n])
+		if err != nil {
+			return err
+		}
+		for i := range msgs {
+			m := &msgs[i]
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return nil
+			case syscall.NLMSG_ERROR:
+				if len(m.Data) >= 4 {
+					if errno := -int32(binary.NativeEndian.Uint32(m.Data)); errno != 0 {
+						return syscall.Errno(errno)
+					}
+				}
+				return nil
+			default:
+				if fn != nil {
+					fn(m)
+				}
+			}
+		}
+	}
+}
+
+// send a netlink request and wait for its ack
+func netlinkRequest(proto int, typ uint16, flags uint16, body []byte) error {
+	sock, err := netlinkOpen(proto)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(sock)
+	if err := netlinkSend(sock, typ, flags|syscall.NLM_F_ACK, body); err != nil {
+		return err
+	}
+	return netlinkReceive(sock, nil)
+}
@@ -0,0 +1,52 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// network namespaces
+// on linux, netns adds a guard watching the namespace, e.g. a vrf of a router or the network of a
+// container, where probes arrive: its capture is opened in the namespace and its port checks bind
+// there, on an os thread that stays in the namespace; netns can be repeated
+// its alarms and events name interface netns:<name>, an interface.netns:<name>.<key> profile
+// applies to it; responders run in portguard's own namespace, kill_run_cmd can use ip netns exec
+// it can't be used with privsep, whose helper checks ports in portguard's namespace
+
+const (
+	netnsIfacePrefix = "netns:"
+	netnsDir         = "/var/run/netns"
+)
+
+var cfgNetns []string // paths of namespace files
+
+// a name of ip netns, or a path like /proc/<pid>/ns/net
+func netnsPath(value string) string {
+	if !strings.ContainsRune(value, '/') {
+		return filepath.Join(netnsDir, value)
+	}
+	return value
+}
+
+// interface name of the guard of namespace path
+func netnsIface(path string) string {
+	name := filepath.Base(path)
+	// /proc/<pid>/ns/net
+	if name == "net" {
+		name = filepath.Base(filepath.Dir(filepath.Dir(path)))
+	}
+	return netnsIfacePrefix + name
+}
+
+func isNetnsIface(iface string) bool {
+	for _, path := range cfgNetns {
+		if netnsIface(path) == iface {
+			return true
+		}
+	}
+	return false
+}
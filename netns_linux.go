@@ -0,0 +1,46 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+)
+
+// setns isn't in package syscall
+var sysSetns = map[string]uintptr{"amd64": 308, "arm64": 268, "386": 346, "arm": 375}[runtime.GOARCH]
+
+// start a guard in the network namespace at path; it returns once the capture is open, so the
+// namespace is entered before privileges are dropped
+func startNetnsGuard(path string, guard func(packetConn, net.IP, string), wg *sync.WaitGroup) error {
+	if sysSetns == 0 {
+		return errors.New("network namespaces are not supported on " + runtime.GOARCH)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	ready := make(chan error, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// never unlocked: the thread stays in the namespace and ends with the guard
+		runtime.LockOSThread()
+		_, _, errno := syscall.RawSyscall(sysSetns, f.Fd(), syscall.CLONE_NEWNET, 0)
+		f.Close()
+		if errno != 0 {
+			ready <- errno
+			return
+		}
+		conn := listenGuard("ip4:"+*mode, "", serverIp)
+		ready <- nil
+		runGuard(guard, conn, serverIp, netnsIface(path))
+	}()
+	return <-ready
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+func startNetnsGuard(path string, guard func(packetConn, net.IP, string), wg *sync.WaitGroup) error {
+	return errors.New("network namespaces are only supported on linux")
+}
@@ -0,0 +1,128 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// nflog input
+// packets the firewall logs to nflog_group, e.g. with
+//   iptables -A INPUT -p tcp -j NFLOG --nflog-group 5
+//   nft add rule inet filter input counter log group 5 drop
+// are read by one more guard, so probes dropped before they reach the raw socket still count
+// a raw socket only gets packets netfilter let through, af_packet captures get both and would see
+// logged packets twice
+
+// nfnetlink_log constants, see linux/netfilter/nfnetlink_log.h
+const (
+	nfnlSubsysUlog  = 4
+	nfulnlMsgPacket = 0
+	nfulnlMsgConfig = 1
+
+	nfulaCfgCmd      = 1
+	nfulaCfgMode     = 2
+	nfulnlCfgCmdBind = 1
+	nfulnlCopyPacket = 2
+
+	nfulaPayload = 9
+)
+
+// reads packets of an nflog group from an nfnetlink socket
+type nflogConn struct {
+	*os.File
+	rc      syscall.RawConn
+	buf     []byte
+	pending [][]byte // packets of the last read not returned yet
+}
+
+func openNflog(group int) (packetConn, error) {
+	fd, err := netlinkOpen(netlinkNetfilter)
+	if err != nil {
+		return nil, err
+	}
+	if err = nflogBind(fd, group); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	if err = syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	size, err := setRcvbuf(fd)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	logRcvbuf("nflog:"+strconv.Itoa(group), "", serverIp, size)
+	c := &nflogConn{File: os.NewFile(uintptr(fd), "nflog"), buf: make([]byte, 65536)}
+	if c.rc, err = c.File.SyscallConn(); err != nil {
+		c.File.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// bind the socket to group and have whole packets copied
+func nflogBind(fd int, group int) error {
+	// nfgenmsg: family, version, group in network order
+	msg := []byte{syscall.AF_UNSPEC, 0, byte(group >> 8), byte(group)}
+	bind := netlinkAttr(append([]byte(nil), msg...), nfulaCfgCmd, []byte{nfulnlCfgCmdBind})
+	if err := netlinkSend(fd, nfnlSubsysUlog<<8|nfulnlMsgConfig, syscall.NLM_F_ACK, bind); err != nil {
+		return err
+	}
+	if err := netlinkReceive(fd, nil); err != nil {
+		return err
+	}
+	// copy range and mode
+	mode := binary.BigEndian.AppendUint32(nil, 0xffff)
+	mode = append(mode, nfulnlCopyPacket, 0)
+	if err := netlinkSend(fd, nfnlSubsysUlog<<8|nfulnlMsgConfig, syscall.NLM_F_ACK, netlinkAttr(append([]byte(nil), msg...), nfulaCfgMode, mode)); err != nil {
+		return err
+	}
+	return netlinkReceive(fd, nil)
+}
+
+// a read may carry several packets, they are returned one by one
+// the kernel drops packets with ENOBUFS when the socket is full, they are counted as capture drops
+func (c *nflogConn) ReadPacket(b []byte) (int, error) {
+	for len(c.pending) == 0 {
+		var n int
+		var serr error
+		err := c.rc.Read(func(fd uintptr) bool {
+			n, _, serr = syscall.Recvfrom(int(fd), c.buf, 0)
+			return serr != syscall.EAGAIN
+		})
+		if err != nil {
+			return 0, err
+		}
+		if serr == syscall.ENOBUFS {
+			statsAdd(&stats.captureDrops)
+			continue
+		}
+		if serr != nil {
+			return 0, serr
+		}
+		msgs, err := syscall.ParseNetlinkMessage(c.buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, m := range msgs {
+			if m.Header.Type != nfnlSubsysUlog<<8|nfulnlMsgPacket || len(m.Data) < 4 {
+				continue
+			}
+			if payload, ok := netlinkAttrs(m.Data[4:])[nfulaPayload]; ok {
+				c.pending = append(c.pending, payload)
+			}
+		}
+	}
+	packet := c.pending[0]
+	c.pending = c.pending[1:]
+	// a packet larger than b fills it, so the guard counts it as truncated
+	return copy(b, packet), nil
+}
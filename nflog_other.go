@@ -0,0 +1,13 @@
+//go:build !linux
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import "errors"
+
+func openNflog(group int) (packetConn, error) {
+	return nil, errors.New("nflog is only supported on linux")
+}
@@ -0,0 +1,142 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+)
+
+// inline mode
+// with nfqueue set, portguard binds that netfilter queue and gives each queued packet a verdict:
+// packets of blocked hosts, and of hosts whose score reached nfqueue_score, are dropped in the
+// kernel at once, before a responder's firewall rule is in place; everything else is accepted
+// packets of ignored hosts are always accepted, and the queue fails open when it's full
+
+// nfnetlink_queue constants, see linux/netfilter/nfnetlink_queue.h
+const (
+	nfnlSubsysQueue  = 3
+	nfqnlMsgPacket   = 0
+	nfqnlMsgVerdict  = 1
+	nfqnlMsgConfig   = 2
+	nfqaPacketHdr    = 1
+	nfqaVerdictHdr   = 2
+	nfqaPayload      = 10
+	nfqaCfgCmd       = 1
+	nfqaCfgParams    = 2
+	nfqaCfgMask      = 4
+	nfqaCfgFlags     = 5
+	nfqnlCfgCmdBind  = 1
+	nfqnlCopyPacket  = 2
+	nfqaCfgFFailOpen = 1
+
+	nfDrop   = 0
+	nfAccept = 1
+
+	// only the ipv4 header is needed for a verdict
+	nfqueueCopyRange = 20
+)
+
+func startNfqueue(queue int) error {
+	fd, err := netlinkOpen(netlinkNetfilter)
+	if err != nil {
+		return err
+	}
+	size, err := setRcvbuf(fd)
+	if err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	logMain(false, "nfqueue %d bound, receive buffer:%d bytes", queue, size)
+	if err := nfqueueBind(fd, queue); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	go runNfqueue(fd, queue)
+	return nil
+}
+
+// nfgenmsg of queue: family, version, queue number in network order
+func nfqueueMsg(queue int) []byte {
+	return []byte{syscall.AF_UNSPEC, 0, byte(queue >> 8), byte(queue)}
+}
+
+// bind the queue, copy the ip header of packets and let them pass while the queue is full
+func nfqueueBind(fd int, queue int) error {
+	flags := binary.BigEndian.AppendUint32(nil, nfqaCfgFFailOpen)
+	configs := [][]byte{
+		netlinkAttr(nfqueueMsg(queue), nfqaCfgCmd, []byte{nfqnlCfgCmdBind, 0, 0, syscall.AF_INET}),
+		netlinkAttr(nfqueueMsg(queue), nfqaCfgParams, append(binary.BigEndian.AppendUint32(nil, nfqueueCopyRange), nfqnlCopyPacket)),
+		netlinkAttr(netlinkAttr(nfqueueMsg(queue), nfqaCfgFlags, flags), nfqaCfgMask, flags),
+	}
+	for _, config := range configs {
+		if err := netlinkSend(fd, nfnlSubsysQueue<<8|nfqnlMsgConfig, syscall.NLM_F_ACK, config); err != nil {
+			return err
+		}
+		// packets may be queued once it's bound, they get their verdict right away
+		if err := netlinkReceive(fd, func(m *syscall.NetlinkMessage) { nfqueueVerdict(fd, queue, m) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runNfqueue(fd int, queue int) {
+	defer recoverPanic("nfqueue")
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err == syscall.ENOBUFS || err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			logMain(false, "read nfqueue %d failed:%s", queue, err.Error())
+			reportError("nfqueue", "", "read nfqueue %d failed:%s", queue, err.Error())
+			return
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		for i := range msgs {
+			nfqueueVerdict(fd, queue, &msgs[i])
+		}
+	}
+}
+
+// give a queued packet its verdict
+func nfqueueVerdict(fd int, queue int, m *syscall.NetlinkMessage) {
+	if m.Header.Type != nfnlSubsysQueue<<8|nfqnlMsgPacket || len(m.Data) < 4 {
+		return
+	}
+	attrs := netlinkAttrs(m.Data[4:])
+	hdr := attrs[nfqaPacketHdr]
+	if len(hdr) < 4 {
+		return
+	}
+	verdict := uint32(nfAccept)
+	if payload := attrs[nfqaPayload]; len(payload) >= 20 && payload[0]>>4 == 4 && dropInline(net.IP(payload[12:16])) {
+		verdict = nfDrop
+		statsAdd(&stats.inlineDropped)
+	}
+	body := binary.BigEndian.AppendUint32(nil, verdict)
+	body = append(body, hdr[:4]...) // packet id, in network order already
+	if err := netlinkSend(fd, nfnlSubsysQueue<<8|nfqnlMsgVerdict, 0, netlinkAttr(nfqueueMsg(queue), nfqaVerdictHdr, body)); err != nil {
+		logDebug("nfqueue %d verdict failed:%s", queue, err.Error())
+	}
+}
+
+// drop packets of ip, unless it's ignored, if it's blocked or its score reached nfqueue_score
+func dropInline(ip net.IP) bool {
+	if isIgnoredIP(ip) {
+		return false
+	}
+	sz := cfgNfqueueScore
+	if sz <= 0 {
+		sz = blockThreshold()
+	}
+	return isBlockedAt(ip.String(), sz)
+}
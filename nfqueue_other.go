@@ -0,0 +1,13 @@
+//go:build !linux
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import "errors"
+
+func startNfqueue(queue int) error {
+	return errors.New("nfqueue is only supported on linux")
+}
@@ -0,0 +1,220 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// export events as opentelemetry logs, and counters as metrics, with otlp/http json
+
+const (
+	otlpBatch     = 100
+	otlpFlushTime = 5 * time.Second
+
+	// severity numbers, see the opentelemetry logs data model
+	otlpSeverityWarn  = 13
+	otlpSeverityError = 17
+)
+
+var (
+	otlpClient = &http.Client{Timeout: 10 * time.Second}
+	otlpEvents chan *event
+	otlpStart  = time.Now()
+)
+
+func otlpString(key string, value string) map[string]interface{} {
+	return map[string]interface{}{"key": key, "value": map[string]interface{}{"stringValue": value}}
+}
+
+func otlpInt(key string, value int64) map[string]interface{} {
+	return map[string]interface{}{"key": key, "value": map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}}
+}
+
+// attributes of this portguard instance
+func otlpResource() map[string]interface{} {
+	host, _ := os.Hostname()
+	iface := strings.Join(cfgInterfaces, ",")
+	if iface == "" {
+		iface = "all"
+	}
+	return map[string]interface{}{
+		"attributes": []interface{}{
+			otlpString("service.name", "portguard"),
+			otlpString("host.name", host),
+			otlpString("portguard.interface", iface),
+			otlpString("portguard.mode", *mode),
+		},
+	}
+}
+
+func otlpScope() map[string]interface{} {
+	return map[string]interface{}{"name": "portguard"}
+}
+
+func otlpPost(path string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(cfgOtlpEndpoint, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for _, header := range cfgOtlpHeaders {
+		if kv := strings.SplitN(header, ":", 2); len(kv) == 2 {
+			req.Header.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+		}
+	}
+	resp, err := otlpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s%s: %s", cfgOtlpEndpoint, path, resp.Status)
+	}
+	return nil
+}
+
+// queue event for export, dropped if the exporter falls behind
+func otlpEvent(ev *event) {
+	if otlpEvents == nil {
+		return
+	}
+	queueEvent(otlpEvents, ev, "otlp")
+}
+
+func otlpLogRecord(ev *event) map[string]interface{} {
+	severity, text := otlpSeverityWarn, "WARN"
+	body := fmt.Sprintf("attackalert: %s from host: %s to %s port: %d", ev.ScanType, ev.Host, ev.Proto, ev.Port)
+	if ev.ScanType == tcpPacketTypeFingerprint || ev.Trap {
+		severity, text = otlpSeverityError, "ERROR"
+	}
+	if ev.Kind == eventBlock {
+		severity, text = otlpSeverityError, "ERROR"
+		body = fmt.Sprintf("Host: %s Port: %d %s Blocked", ev.Host, ev.Port, ev.Proto)
+	}
+	if ev.Kind == eventOps {
+		severity, text = otlpSeverityError, "ERROR"
+		body = ev.Message
+	}
+	return map[string]interface{}{
+		"timeUnixNano":   strconv.FormatInt(ev.Time.UnixNano(), 10),
+		"severityNumber": severity,
+		"severityText":   text,
+		"body":           map[string]interface{}{"stringValue": body},
+		"attributes": []interface{}{
+			otlpString("portguard.event", ev.Kind),
+			otlpString("source.address", ev.Host),
+			otlpInt("destination.port", int64(ev.Port)),
+			otlpInt("portguard.ttl", int64(ev.TTL)),
+			otlpString("destination.address", ev.Laddr.String()),
+			otlpString("network.transport", strings.ToLower(ev.Proto)),
+			otlpString("portguard.scan_type", ev.ScanType),
+			otlpString("portguard.payload", ev.Payload),
+			otlpInt("portguard.vlan", int64(ev.VLAN)),
+			otlpString("portguard.spoof", ev.Spoof),
+		},
+	}
+}
+
+func otlpSendLogs(events []*event) error {
+	records := make([]interface{}, 0, len(events))
+	for _, ev := range events {
+		records = append(records, otlpLogRecord(ev))
+	}
+	return otlpPost("/v1/logs", map[string]interface{}{
+		"resourceLogs": []interface{}{map[string]interface{}{
+			"resource":  otlpResource(),
+			"scopeLogs": []interface{}{map[string]interface{}{"scope": otlpScope(), "logRecords": records}},
+		}},
+	})
+}
+
+// counters as cumulative monotonic sums, gauges as gauges
+func otlpSendMetrics() error {
+	start := strconv.FormatInt(otlpStart.UnixNano(), 10)
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	var metrics []interface{}
+	for _, c := range statsGauges() {
+		metrics = append(metrics, map[string]interface{}{
+			"name": "portguard." + c.name,
+			"gauge": map[string]interface{}{
+				"dataPoints": []interface{}{map[string]interface{}{
+					"asInt":        strconv.FormatInt(c.value, 10),
+					"timeUnixNano": now,
+				}},
+			},
+		})
+	}
+	for _, c := range statsCounters() {
+		metrics = append(metrics, map[string]interface{}{
+			"name": "portguard." + c.name,
+			"sum": map[string]interface{}{
+				"aggregationTemporality": 2,
+				"isMonotonic":            true,
+				"dataPoints": []interface{}{map[string]interface{}{
+					"asInt":             strconv.FormatInt(c.value, 10),
+					"startTimeUnixNano": start,
+					"timeUnixNano":      now,
+				}},
+			},
+		})
+	}
+	return otlpPost("/v1/metrics", map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource":     otlpResource(),
+			"scopeMetrics": []interface{}{map[string]interface{}{"scope": otlpScope(), "metrics": metrics}},
+		}},
+	})
+}
+
+func startOtlp() {
+	otlpEvents = make(chan *event, cfgEventQueue)
+	go runOtlp()
+}
+
+// send events in batches, and metrics every otlp_interval seconds
+func runOtlp() {
+	var batch []*event
+	flush := time.NewTicker(otlpFlushTime)
+	var metrics <-chan time.Time
+	if cfgOtlpInterval > 0 {
+		metrics = time.Tick(time.Duration(cfgOtlpInterval) * time.Second)
+	}
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := otlpSendLogs(batch); err != nil {
+			logMain(false, "export %d events to otlp failed:%s", len(batch), err.Error())
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case ev := <-otlpEvents:
+			batch = append(batch, ev)
+			if len(batch) >= otlpBatch {
+				send()
+			}
+		case <-flush.C:
+			send()
+		case <-metrics:
+			if err := otlpSendMetrics(); err != nil {
+				logMain(false, "export metrics to otlp failed:%s", err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// overload protection
+// every second the bytes queued on the capture sockets and the packets the kernel dropped from them
+// are read; over overload_backlog bytes queued, or overload_drops drops a second, guards only
+// process 1 packet in overload_sample, counted as sampled in stats, and an ops alert says detection
+// is degraded; after overload_cooldown seconds under half the backlog without drops they process
+// every packet again and another ops alert says so
+// the backlog is read from /proc on linux; elsewhere only af_packet drops are seen
+
+const (
+	opsOverload          = "overload"
+	opsOverloadRecovered = "overload_recovered"
+)
+
+var (
+	cfgOverloadProtection = true
+	cfgOverloadBacklog    = 128 << 10 // bytes, below the socket receive buffer
+	cfgOverloadDrops      = 100       // per second
+	cfgOverloadSample     = 10
+	cfgOverloadCooldown   = 30
+
+	sampleEvery int64 // process 1 packet in this many, 0 or 1 for all of them
+)
+
+// whether a guard skips the packet numbered seq while sampling
+func skipSampled(seq *uint64) bool {
+	n := atomic.LoadInt64(&sampleEvery)
+	if n <= 1 {
+		return false
+	}
+	*seq++
+	if *seq%uint64(n) == 0 {
+		return false
+	}
+	statsAdd(&stats.sampled)
+	return true
+}
+
+func runOverloadWatch() {
+	var lastDrops int64
+	var calmSince time.Time
+	first, warned := true, false
+	for range time.Tick(time.Second) {
+		backlog, rawDrops, err := captureBacklog()
+		if err != nil {
+			if !warned {
+				logMain(false, "read capture backlog failed:%s, overload protection only sees capture drops", err.Error())
+				warned = true
+			}
+		}
+		updateCaptureStats()
+		drops := atomic.LoadInt64(&stats.captureDrops) + rawDrops
+		rate := drops - lastDrops
+		if first {
+			// drops before the watch started don't count
+			rate, first = 0, false
+		}
+		lastDrops = drops
+
+		overloaded := backlog > int64(cfgOverloadBacklog) || cfgOverloadDrops > 0 && rate >= int64(cfgOverloadDrops)
+		sampling := atomic.LoadInt64(&sampleEvery) > 1
+		switch {
+		case overloaded && !sampling:
+			atomic.StoreInt64(&sampleEvery, int64(cfgOverloadSample))
+			calmSince = time.Time{}
+			opsAlert(opsOverload, "ip4:"+*mode, "", serverIp,
+				fmt.Sprintf("guards are overloaded, backlog %d bytes, %d drops/s, detection is degraded: processing 1 packet in %d", backlog, rate, cfgOverloadSample))
+		case sampling && !overloaded && backlog <= int64(cfgOverloadBacklog)/2 && rate == 0:
+			if calmSince.IsZero() {
+				calmSince = time.Now()
+			}
+			if time.Since(calmSince) >= time.Duration(cfgOverloadCooldown)*time.Second {
+				atomic.StoreInt64(&sampleEvery, 0)
+				opsAlert(opsOverloadRecovered, "ip4:"+*mode, "", serverIp,
+					fmt.Sprintf("guards recovered from overload, processing every packet, %d packets skipped so far", atomic.LoadInt64(&stats.sampled)))
+			}
+		case sampling:
+			calmSince = time.Time{}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// bytes queued on the raw and af_packet sockets of this process, and the packets the kernel
+// dropped from raw sockets, from /proc/net/raw and /proc/net/packet
+func captureBacklog() (backlog int64, drops int64, err error) {
+	inodes, err := socketInodes()
+	if err != nil {
+		return 0, 0, err
+	}
+	// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ref pointer drops
+	err = readProcNet("/proc/net/raw", func(fields []string) {
+		if len(fields) < 13 || !inodes[fields[9]] {
+			return
+		}
+		if i := strings.IndexByte(fields[4], ':'); i >= 0 {
+			n, _ := strconv.ParseInt(fields[4][i+1:], 16, 64)
+			backlog += n
+		}
+		n, _ := strconv.ParseInt(fields[12], 10, 64)
+		drops += n
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	// sk RefCnt Type Proto Iface R Rmem User Inode
+	err = readProcNet("/proc/net/packet", func(fields []string) {
+		if len(fields) < 9 || !inodes[fields[8]] {
+			return
+		}
+		n, _ := strconv.ParseInt(fields[6], 10, 64)
+		backlog += n
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+// inodes of the sockets this process has open
+func socketInodes() (map[string]bool, error) {
+	fds, err := filepath.Glob("/proc/self/fd/*")
+	if err != nil {
+		return nil, err
+	}
+	if len(fds) == 0 {
+		return nil, os.ErrNotExist
+	}
+	inodes := make(map[string]bool)
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if err == nil && strings.HasPrefix(link, "socket:[") {
+			inodes[strings.TrimSuffix(link[len("socket:["):], "]")] = true
+		}
+	}
+	return inodes, nil
+}
+
+// call row with the fields of each line of a /proc/net table, after its header
+func readProcNet(path string, row func(fields []string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	s.Scan()
+	for s.Scan() {
+		row(strings.Fields(s.Text()))
+	}
+	return s.Err()
+}
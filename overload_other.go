@@ -0,0 +1,11 @@
+//go:build !linux
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+func captureBacklog() (int64, int64, error) {
+	return 0, 0, errNotSupported
+}
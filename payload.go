@@ -0,0 +1,102 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"strings"
+)
+
+// classes of udp probe payloads, from nmap-payloads and common reflection scanners
+// checked in order, ntp payloads can pass for dns queries
+// empty: no payload, a plain udp scan
+// crafted: a payload none of the signatures match
+type udpSignature struct {
+	name  string
+	match func(p []byte) bool
+}
+
+var udpSignatures = []udpSignature{
+	// version.bind CH TXT
+	{"nmap-dns", func(p []byte) bool {
+		return len(p) > 2 && bytes.HasPrefix(p[2:], []byte("\x01\x00\x00\x01\x00\x00\x00\x00\x00\x00\x07version\x04bind\x00\x00\x10\x00\x03"))
+	}},
+	{"nmap-ntp", func(p []byte) bool {
+		return bytes.HasPrefix(p, []byte("\xe3\x00\x04\xfa\x00\x01\x00\x00\x00\x01\x00\x00"))
+	}},
+	// mode 7 MON_GETLIST, the amplification query
+	{"ntp-monlist", func(p []byte) bool {
+		return len(p) >= 4 && p[0]&0x07 == 7 && (p[3] == 0x2a || p[3] == 0x14)
+	}},
+	// name query of "*"
+	{"netbios", func(p []byte) bool {
+		return isDnsQuery(p) && len(p) > 14 && p[12] == 0x20 && string(p[13:15]) == "CK"
+	}},
+	{"dns", isDnsQuery},
+	{"ntp", func(p []byte) bool {
+		return len(p) >= 48 && p[0]&0x07 == 3
+	}},
+	// a ber sequence starting with the version, v1, v2c or v3
+	{"snmp", func(p []byte) bool {
+		return len(p) > 8 && p[0] == 0x30 && bytes.Contains(p[:8], []byte{0x02, 0x01}) &&
+			(bytes.Contains(p, []byte("public")) || bytes.Contains(p[:8], []byte{0x02, 0x01, 0x03}))
+	}},
+	{"ssdp", func(p []byte) bool {
+		return bytes.HasPrefix(p, []byte("M-SEARCH "))
+	}},
+	// stats command, plain or with the udp frame header
+	{"memcached", func(p []byte) bool {
+		return bytes.HasPrefix(p, []byte("stats")) || len(p) > 8 && bytes.HasPrefix(p[8:], []byte("stats"))
+	}},
+}
+
+// a standard query with one question
+func isDnsQuery(p []byte) bool {
+	return len(p) >= 17 && p[2]&0xf8 == 0 && p[4] == 0 && p[5] == 1
+}
+
+// class of a udp probe payload
+func classifyUdpPayload(p []byte) string {
+	if len(p) == 0 {
+		return "empty"
+	}
+	for _, sig := range udpSignatures {
+		if sig.match(p) {
+			return sig.name
+		}
+	}
+	return "crafted"
+}
+
+var udpPayloadActions = make(map[string]string)
+
+// udp_payload_action = class block|alarm|ignore|default
+func parseUdpPayloadAction(lineno int, token string, value string) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		logMain(true, "line %d:%s, invalid value:%s, should be payload class and action", lineno, token, value)
+	}
+	known := fields[0] == "empty" || fields[0] == "crafted"
+	for _, sig := range udpSignatures {
+		known = known || sig.name == fields[0]
+	}
+	if !known {
+		logMain(true, "line %d:%s, unknown payload class:%s", lineno, token, fields[0])
+	}
+	switch fields[1] {
+	case policyBlock, policyAlarm, policyIgnore, policyDefault:
+	default:
+		logMain(true, "line %d:%s, unknown action:%s, should be block, alarm, ignore or default", lineno, token, fields[1])
+	}
+	udpPayloadActions[fields[0]] = fields[1]
+}
+
+// decision of udp_payload_action for ev
+func payloadPolicy(ev *event) string {
+	if action, ok := udpPayloadActions[ev.Payload]; ok && ev.Payload != "" {
+		return action
+	}
+	return policyDefault
+}
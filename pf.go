@@ -0,0 +1,38 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// add ip to pf table, pf.conf should block the table, e.g.
+//
+//	table <portguard> persist
+//	block in quick from <portguard>
+//
+// all ips go in one pfctl run
+func pfTableAdd(ctx context.Context, table string, ips []string) error {
+	if len(ips) == 0 {
+		return nil
+	}
+	return runBatchCmd(ctx, "", "pfctl", append([]string{"-t", table, "-T", "add"}, ips...)...)
+}
+
+// periodically remove table entries added more than expire seconds ago
+func runPfExpire(table string, expire int) {
+	interval := time.Duration(expire) * time.Second
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	for range time.Tick(interval) {
+		if err := exec.Command("pfctl", "-t", table, "-T", "expire", strconv.Itoa(expire)).Run(); err != nil {
+			logMain(false, "expire pf table %s failed:%s", table, err.Error())
+		}
+	}
+}
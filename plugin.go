@@ -0,0 +1,134 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// exec responder plugin
+//
+// the plugin command runs with a json request on stdin:
+//
+//	{"action":"block","time":"...","host":"1.2.3.4","port":23,"proto":"TCP","scan_type":"...","alarm_count":6,"mode":"tcp"}
+//	{"action":"unblock","time":"...","host":"1.2.3.4","mode":"tcp"}
+//
+// and may print a json reply on stdout:
+//
+//	{"status":"ok"}, {"status":"error","message":"..."} or {"status":"unsupported"}
+//
+// a non-zero exit status is a failure too, no reply with exit status 0 is ok
+type pluginResponder struct {
+	name    string
+	command string
+}
+
+type pluginRequest struct {
+	Action     string    `json:"action"`
+	Time       time.Time `json:"time"`
+	Host       string    `json:"host"`
+	Port       int       `json:"port,omitempty"`
+	Proto      string    `json:"proto,omitempty"`
+	ScanType   string    `json:"scan_type,omitempty"`
+	Alarms     int       `json:"alarm_count,omitempty"`
+	ASN        int       `json:"asn,omitempty"`
+	ASOrg      string    `json:"as_org,omitempty"`
+	Country    string    `json:"country,omitempty"`
+	Reputation string    `json:"reputation,omitempty"`
+	Spoof      string    `json:"spoof,omitempty"`
+	Payload    string    `json:"payload,omitempty"`
+	Mode       string    `json:"mode"`
+	Test       bool      `json:"test,omitempty"`
+}
+
+type pluginReply struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// parse "name command args..." of responder_plugin
+func parsePlugin(lineno int, token string, value string) *pluginResponder {
+	fields := strings.SplitN(value, " ", 2)
+	if len(fields) != 2 || strings.TrimSpace(fields[1]) == "" {
+		logMain(true, "line %d:%s, invalid value:%s, should be name and command", lineno, token, value)
+	}
+	return &pluginResponder{name: fields[0], command: strings.TrimSpace(fields[1])}
+}
+
+func (p *pluginResponder) Name() string { return p.name }
+
+func (p *pluginResponder) Describe(ev *event) string {
+	return "run plugin " + p.command
+}
+
+func (p *pluginResponder) Block(ctx context.Context, ev *event) error {
+	return p.call(ctx, &pluginRequest{
+		Action:     "block",
+		Time:       ev.Time,
+		Host:       ev.Host,
+		Port:       ev.Port,
+		Proto:      ev.Proto,
+		ScanType:   ev.ScanType,
+		Alarms:     ev.Alarms,
+		ASN:        ev.ASN,
+		ASOrg:      ev.ASOrg,
+		Country:    ev.Country,
+		Reputation: ev.Reputation,
+		Spoof:      ev.Spoof,
+		Payload:    ev.Payload,
+		Mode:       *mode,
+		Test:       ev.Test,
+	})
+}
+
+func (p *pluginResponder) Unblock(ip string) error {
+	return p.call(context.Background(), &pluginRequest{Action: "unblock", Time: time.Now(), Host: ip, Mode: *mode})
+}
+
+func (p *pluginResponder) call(ctx context.Context, req *pluginRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if err := allowExec("plugin " + req.Action + " " + req.Host); err != nil {
+		return err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := shellCommand(ctx, p.command)
+	cmd.Stdin = bytes.NewReader(append(data, '\n'))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if out := auditOutputOf(ctx); out != nil {
+		out.Write(stdout.Bytes())
+		out.Write(stderr.Bytes())
+	}
+
+	var reply pluginReply
+	if out := bytes.TrimSpace(stdout.Bytes()); len(out) > 0 {
+		if jerr := json.Unmarshal(out, &reply); jerr != nil && err == nil {
+			return fmt.Errorf("invalid reply %q: %s", out, jerr.Error())
+		}
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(reply.Message + " " + stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s", err.Error(), msg)
+		}
+		return err
+	}
+	switch reply.Status {
+	case "", "ok", "unsupported":
+		return nil
+	case "error":
+		return errors.New(reply.Message)
+	}
+	return fmt.Errorf("unknown status %q", reply.Status)
+}
@@ -0,0 +1,211 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// policy hook
+//
+// policy_cmd runs as a co-process, for every probe of a closed port it gets a json line on stdin:
+//	{"host":"1.2.3.4","port":23,"proto":"TCP","flags":41,"ttl":52,"scan_type":"TCP XMAS scan","asn":64496,"as_org":"...","country":"NL","reputation":"malicious","spoof":"ttl",
+//	 "laddr":"0.0.0.0","ports":2,"score":2,"block_score":6}
+// and must reply with a json line on stdout:
+//	{"decision":"default"}  go on as usual
+//	{"decision":"ignore"}   drop the probe
+//	{"decision":"alarm"}    log an alarm, but don't count the probe towards a block
+//	{"decision":"block","responders":["name",...]}  block the host now, with only the named responders if given
+
+const (
+	policyDefault = "default"
+	policyIgnore  = "ignore"
+	policyAlarm   = "alarm"
+	policyBlock   = "block"
+)
+
+type policyRequest struct {
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	Proto      string `json:"proto"`
+	Flags      uint8  `json:"flags,omitempty"`
+	TTL        uint8  `json:"ttl"`
+	Payload    string `json:"payload,omitempty"`
+	ScanType   string `json:"scan_type"`
+	ASN        int    `json:"asn,omitempty"`
+	ASOrg      string `json:"as_org,omitempty"`
+	Country    string `json:"country,omitempty"`
+	Reputation string `json:"reputation,omitempty"`
+	Spoof      string `json:"spoof,omitempty"` // see spoofReasons
+	Laddr      string `json:"laddr"`
+	Ports      int    `json:"ports"` // probed ports of host so far
+	Score      int    `json:"score"` // score of host so far, see scoring
+	BlockScore int    `json:"block_score"`
+}
+
+type policyReply struct {
+	Decision   string   `json:"decision"`
+	Responders []string `json:"responders"`
+}
+
+var (
+	policyLock    sync.Mutex
+	policyCmd     *exec.Cmd
+	policyCancel  context.CancelFunc // kills the process group of the co-process
+	policyDone    chan struct{}      // closed when the co-process is stopped, its replies aren't read anymore
+	policyStdin   io.WriteCloser
+	policyReplies chan []byte
+)
+
+func startPolicy() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := shellCommand(ctx, cfgPolicyCmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return err
+	}
+
+	replies, done := make(chan []byte), make(chan struct{})
+	go func() {
+		defer cmd.Wait()
+		defer close(replies)
+		r := bufio.NewReader(stdout)
+		for {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			// a reply coming after its request timed out has no one waiting for it
+			select {
+			case replies <- line:
+			case <-done:
+				return
+			}
+		}
+	}()
+	policyCmd, policyCancel, policyDone, policyStdin, policyReplies = cmd, cancel, done, stdin, replies
+	return nil
+}
+
+// stop the co-process, it's restarted by the next askPolicy
+func stopPolicy() {
+	if policyCmd == nil {
+		return
+	}
+	close(policyDone)
+	policyStdin.Close()
+	policyCancel()
+	policyCmd = nil
+}
+
+func askPolicyLocked(req *policyRequest) (*policyReply, error) {
+	if policyCmd == nil {
+		if err := startPolicy(); err != nil {
+			return nil, err
+		}
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := policyStdin.Write(append(data, '\n')); err != nil {
+		stopPolicy()
+		return nil, err
+	}
+
+	select {
+	case line, ok := <-policyReplies:
+		if !ok {
+			stopPolicy()
+			return nil, errors.New("policy command exited")
+		}
+		var reply policyReply
+		if err := json.Unmarshal(line, &reply); err != nil {
+			return nil, err
+		}
+		return &reply, nil
+	case <-time.After(time.Duration(cfgPolicyTimeout) * time.Millisecond):
+		stopPolicy()
+		return nil, errors.New("policy command timed out")
+	}
+}
+
+// decision of asn, country and reputation lists, scan_type_action and udp_payload_action,
+// used when policy_cmd has none
+// ignore wins over alarm, never block lists win over block lists
+func listPolicy(ev *event) string {
+	decisions := []string{asnPolicy(ev), countryPolicy(ev), reputationPolicy(ev), scanTypePolicy(ev), payloadPolicy(ev), kvPolicy(ev)}
+	for _, want := range []string{policyIgnore, policyAlarm, policyBlock} {
+		for _, d := range decisions {
+			if d == want {
+				return want
+			}
+		}
+	}
+	return policyDefault
+}
+
+// decision of policy_cmd for a probe, default if there's no policy or it fails
+func askPolicy(ev *event) *policyReply {
+	if cfgPolicyCmd == "" {
+		return &policyReply{Decision: policyDefault}
+	}
+
+	stateLock.Lock()
+	ports := stateEngine[ev.Host]
+	req := &policyRequest{
+		Host:       ev.Host,
+		Port:       ev.Port,
+		Proto:      ev.Proto,
+		Flags:      ev.Flags,
+		TTL:        ev.TTL,
+		Payload:    ev.Payload,
+		ScanType:   ev.ScanType,
+		ASN:        ev.ASN,
+		ASOrg:      ev.ASOrg,
+		Country:    ev.Country,
+		Reputation: ev.Reputation,
+		Spoof:      ev.Spoof,
+		Laddr:      ev.Laddr.String(),
+		Ports:      len(ports),
+		Score:      hostScore(ev.Host),
+		BlockScore: blockThreshold(),
+	}
+	stateLock.Unlock()
+
+	policyLock.Lock()
+	reply, err := askPolicyLocked(req)
+	policyLock.Unlock()
+	if err != nil {
+		logMain(false, "policy_cmd %s, host:%s:%d failed:%s", cfgPolicyCmd, ev.Host, ev.Port, err.Error())
+		return &policyReply{Decision: policyDefault}
+	}
+	switch reply.Decision {
+	case policyDefault, policyIgnore, policyAlarm, policyBlock:
+	case "":
+		reply.Decision = policyDefault
+	default:
+		logMain(false, "policy_cmd %s, host:%s:%d unknown decision:%s", cfgPolicyCmd, ev.Host, ev.Port, reply.Decision)
+		reply.Decision = policyDefault
+	}
+	return reply
+}
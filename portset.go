@@ -0,0 +1,61 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// inclusive port range
+type portRange struct {
+	min int
+	max int
+}
+
+// sorted, non-overlapping port ranges
+// config like "exclude_port = 8000-8100" is kept as one range instead of 101 ports
+type portSet []portRange
+
+func (s *portSet) Add(min, max int) {
+	ranges := append(*s, portRange{min, max})
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].min < ranges[j].min
+	})
+
+	// merge overlapping or adjacent ranges
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.min <= last.max+1 {
+			if r.max > last.max {
+				last.max = r.max
+			}
+		} else {
+			merged = append(merged, r)
+		}
+	}
+	*s = merged
+}
+
+func (s portSet) Contains(port int) bool {
+	i := sort.Search(len(s), func(i int) bool {
+		return s[i].max >= port
+	})
+	return i < len(s) && s[i].min <= port
+}
+
+func (s portSet) String() string {
+	var items []string
+	for _, r := range s {
+		if r.min == r.max {
+			items = append(items, fmt.Sprintf("%d", r.min))
+		} else {
+			items = append(items, fmt.Sprintf("%d-%d", r.min, r.max))
+		}
+	}
+	return strings.Join(items, ",")
+}
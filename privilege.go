@@ -0,0 +1,27 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+var errNotSupported = errors.New("not supported on this platform")
+
+// where portguard is chrooted, empty if not
+var chrootDir string
+
+// path as seen from inside chroot, paths outside chroot are returned unchanged
+func chrootPath(path string) string {
+	if chrootDir == "" {
+		return path
+	}
+	dir := strings.TrimRight(chrootDir, "/")
+	if rel := strings.TrimPrefix(path, dir); rel != path && strings.HasPrefix(rel, "/") {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,89 @@
+//go:build freebsd || openbsd
+
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// uid and gid of username/groupname, groupname defaults to user's primary group
+// lookup reads /etc/passwd, so it must be done before chroot
+func lookupIds(username string, groupname string) (uid int, gid int, err error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return
+	}
+	uid, _ = strconv.Atoi(u.Uid)
+	gid, _ = strconv.Atoi(u.Gid)
+	if groupname != "" {
+		var g *user.Group
+		if g, err = user.LookupGroup(groupname); err != nil {
+			return
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+	return
+}
+
+// bsd has no capabilities, captures can't be reopened after dropping root
+func setPrivsepCaps() {
+}
+
+// switch to uid/gid, bsd has no capabilities, kill_route and pf_table need root
+func dropPrivileges(uid int, gid int) error {
+	if len(cfgKillRoute) > 0 || cfgPfTable != "" {
+		logMain(false, "WARNING kill_route and pf_table may fail without root")
+	}
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("setgroups:%s", err.Error())
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid:%s", err.Error())
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid:%s", err.Error())
+	}
+	return nil
+}
+
+// chroot into dir, files opened before are still usable
+func enterChroot(dir string) error {
+	if err := syscall.Chroot(dir); err != nil {
+		return err
+	}
+	chrootDir = dir
+	return os.Chdir("/")
+}
+
+func applySeccomp(strict bool) error {
+	return errNotSupported
+}
+
+// bpf devices, pfctl and route changes need root
+func checkPrivileges() bool {
+	fmt.Printf("running as uid:%d euid:%d\n", os.Getuid(), os.Geteuid())
+	fd, err := openBpf()
+	if err != nil {
+		fmt.Printf("%-24s %s\n", "bpf capture", err.Error())
+		return false
+	}
+	syscall.Close(fd)
+	fmt.Printf("%-24s %s\n", "bpf capture", "ok")
+	if os.Geteuid() != 0 && (len(cfgKillRoute) > 0 || cfgPfTable != "") {
+		fmt.Printf("%-24s %s\n", "kill_route/pf_table", "MISSING root")
+		return false
+	}
+	return true
+}
+
+// capture open errors are reported by openCapture
+func verifyCaptureCaps() {
+}
@@ -0,0 +1,231 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// linux capabilities, see capability.h
+const (
+	capNetBindService = 10 // smartVerify binds ports below 1024
+	capNetAdmin       = 12 // kill_route, iptables
+	capNetRaw         = 13 // raw sockets
+	capSetgid         = 6
+	capSetuid         = 7
+	capSysChroot      = 18
+	capSysAdmin       = 21 // setns
+
+	linuxCapabilityVersion3 = 0x20080522
+
+	prSetKeepCaps     = 8
+	prCapAmbient      = 47
+	prCapAmbientRaise = 2
+)
+
+// capabilities kept after dropping root, responders inherit them via ambient set
+var keepCaps = []uint{capNetBindService, capNetAdmin, capNetRaw}
+
+// with privsep the helper runs responders and binds ports, the detector only reopens captures
+func setPrivsepCaps() {
+	keepCaps = []uint{capNetRaw}
+}
+
+type capHeader struct {
+	version uint32
+	pid     int32
+}
+
+type capData struct {
+	effective   uint32
+	permitted   uint32
+	inheritable uint32
+}
+
+// uid and gid of username/groupname, groupname defaults to user's primary group
+// lookup reads /etc/passwd, so it must be done before chroot
+func lookupIds(username string, groupname string) (uid int, gid int, err error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return
+	}
+	uid, _ = strconv.Atoi(u.Uid)
+	gid, _ = strconv.Atoi(u.Gid)
+	if groupname != "" {
+		var g *user.Group
+		if g, err = user.LookupGroup(groupname); err != nil {
+			return
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+	return
+}
+
+// switch to uid/gid
+func dropPrivileges(uid int, gid int) error {
+	// keep permitted capabilities across setuid, on all threads
+	keep := true
+	if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prSetKeepCaps, 1, 0); errno != 0 {
+		logMain(false, "WARNING keep capabilities failed:%s, responders may not work", errno.Error())
+		keep = false
+	}
+
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("setgroups:%s", err.Error())
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid:%s", err.Error())
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid:%s", err.Error())
+	}
+
+	if keep {
+		return restoreCaps(keepCaps)
+	}
+	return nil
+}
+
+// setuid clears effective capabilities, raise caps again and make them ambient
+// so external commands run by responders get them too
+func restoreCaps(caps []uint) error {
+	var data [2]capData
+	for _, c := range caps {
+		data[c/32].effective |= 1 << (c % 32)
+	}
+	data[0].permitted = data[0].effective
+	data[0].inheritable = data[0].effective
+	data[1].permitted = data[1].effective
+	data[1].inheritable = data[1].effective
+
+	hdr := capHeader{version: linuxCapabilityVersion3}
+	if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return fmt.Errorf("capset:%s", errno.Error())
+	}
+
+	for _, c := range caps {
+		if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientRaise, uintptr(c)); errno != 0 {
+			return fmt.Errorf("raise ambient capability %d:%s", c, errno.Error())
+		}
+	}
+	return nil
+}
+
+var capNames = map[uint]string{
+	capSetgid:         "CAP_SETGID",
+	capSetuid:         "CAP_SETUID",
+	capSysChroot:      "CAP_SYS_CHROOT",
+	capSysAdmin:       "CAP_SYS_ADMIN",
+	capNetBindService: "CAP_NET_BIND_SERVICE",
+	capNetAdmin:       "CAP_NET_ADMIN",
+	capNetRaw:         "CAP_NET_RAW",
+}
+
+// effective capabilities of this process
+func effectiveCaps() uint64 {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "CapEff:") {
+			caps, _ := strconv.ParseUint(strings.TrimSpace(line[len("CapEff:"):]), 16, 64)
+			return caps
+		}
+	}
+	return 0
+}
+
+func hasCap(c uint) bool {
+	return effectiveCaps()&(1<<c) != 0
+}
+
+// a configured feature and the capability it needs
+type capRequirement struct {
+	feature string
+	cap     uint
+}
+
+func requiredCaps() []capRequirement {
+	reqs := []capRequirement{
+		{"raw socket capture", capNetRaw},
+	}
+	if len(cfgInterfaces) > 0 {
+		reqs = append(reqs, capRequirement{"interface binding", capNetRaw})
+	}
+	if cfgMinPort < 1024 {
+		reqs = append(reqs, capRequirement{"verify ports below 1024", capNetBindService})
+	}
+	if len(cfgKillRoute) > 0 {
+		reqs = append(reqs, capRequirement{"kill_route", capNetAdmin})
+	}
+	if cfgBlackholeRoute != "" {
+		reqs = append(reqs, capRequirement{"blackhole_route", capNetAdmin})
+	}
+	if cfgConntrackFlush {
+		reqs = append(reqs, capRequirement{"conntrack_flush", capNetAdmin})
+	}
+	if cfgNflogGroup >= 0 {
+		reqs = append(reqs, capRequirement{"nflog_group", capNetAdmin})
+	}
+	if cfgConnectScanPorts > 0 {
+		reqs = append(reqs, capRequirement{"connect_scan_ports", capNetAdmin})
+	}
+	if cfgNfqueue >= 0 {
+		reqs = append(reqs, capRequirement{"nfqueue", capNetAdmin})
+	}
+	if len(cfgNetns) > 0 {
+		reqs = append(reqs, capRequirement{"netns", capSysAdmin})
+	}
+	if cfgRunAsUser != "" {
+		reqs = append(reqs, capRequirement{"run_as_user", capSetuid}, capRequirement{"run_as_group", capSetgid})
+	}
+	if cfgChrootDir != "" {
+		reqs = append(reqs, capRequirement{"chroot_dir", capSysChroot})
+	}
+	return reqs
+}
+
+// print what each configured feature needs, return false if anything is missing
+func checkPrivileges() bool {
+	ok := true
+	fmt.Printf("running as uid:%d euid:%d\n", os.Getuid(), os.Geteuid())
+	for _, req := range requiredCaps() {
+		status := "ok"
+		if !hasCap(req.cap) {
+			status = "MISSING"
+			ok = false
+		}
+		fmt.Printf("%-24s %-22s %s\n", req.feature, capNames[req.cap], status)
+	}
+	if len(cfgKillRunCmd) > 0 {
+		fmt.Printf("%-24s %-22s %s\n", "kill_run_cmd", "depends on command", "-")
+	}
+	return ok
+}
+
+// fail early with an actionable message instead of a bare socket error
+func verifyCaptureCaps() {
+	if hasCap(capNetRaw) {
+		return
+	}
+	exe, _ := os.Executable()
+	logMain(true, "portguard needs CAP_NET_RAW to capture packets, run it as root or grant capabilities with: setcap cap_net_raw,cap_net_bind_service,cap_net_admin+ep %s", exe)
+}
+
+// chroot into dir, files opened before are still usable
+func enterChroot(dir string) error {
+	if err := syscall.Chroot(dir); err != nil {
+		return err
+	}
+	chrootDir = dir
+	return os.Chdir("/")
+}
@@ -0,0 +1,39 @@
+//go:build !linux && !freebsd && !openbsd
+
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+)
+
+func lookupIds(username string, groupname string) (int, int, error) {
+	return 0, 0, errNotSupported
+}
+
+func dropPrivileges(uid int, gid int) error {
+	return errNotSupported
+}
+
+func setPrivsepCaps() {
+}
+
+func enterChroot(dir string) error {
+	return errNotSupported
+}
+
+func applySeccomp(strict bool) error {
+	return errNotSupported
+}
+
+func checkPrivileges() bool {
+	fmt.Println("capability check is only supported on linux")
+	return true
+}
+
+// capture open errors are reported by openCapture
+func verifyCaptureCaps() {
+}
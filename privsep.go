@@ -0,0 +1,323 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// split privileges: with privsep, portguard runs as two processes once it drops root to run_as_user,
+// the detector, capturing and parsing packets as run_as_user, keeping only CAP_NET_RAW on linux to
+// reopen captures, and a privileged helper started before, doing only what needs root: running the
+// configured responders for a host and checking ports below 1024 by binding them
+// they talk over a socketpair, a json request per line and a reply per request, in any order:
+//
+//	{"id":1,"op":"block","responder":"kill_route","event":{"host":"1.2.3.4","port":23,...}}
+//	{"id":2,"op":"unblock","responder":"kill_route","host":"1.2.3.4"}
+//	{"id":3,"op":"verify","laddr":"0.0.0.0","port":22}
+//	{"id":1,"error":"...","output":"..."}
+//
+// the helper checks every request against its own config: configured responders, ipv4 hosts it
+// doesn't ignore, so a compromised detector can't get more out of it than blocking scanners
+
+const (
+	privsepBlock   = "block"
+	privsepUnblock = "unblock"
+	privsepVerify  = "verify"
+
+	privsepMaxRequests = 64 // served at once
+)
+
+var (
+	cfgPrivsep bool
+
+	privHelper *privsepClient // detector side, nil without privsep
+)
+
+type privsepRequest struct {
+	Id        uint64       `json:"id"`
+	Op        string       `json:"op"`
+	Responder string       `json:"responder,omitempty"`
+	Event     *eventRecord `json:"event,omitempty"`
+	Host      string       `json:"host,omitempty"`
+	Laddr     string       `json:"laddr,omitempty"`
+	Port      int          `json:"port,omitempty"`
+}
+
+type privsepReply struct {
+	Id     uint64 `json:"id"`
+	InUse  bool   `json:"in_use,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Output string `json:"output,omitempty"`
+}
+
+// the detector's end of the socketpair
+type privsepClient struct {
+	lock    sync.Mutex
+	conn    net.Conn
+	enc     *json.Encoder
+	nextId  uint64
+	pending map[uint64]chan *privsepReply
+	err     error // why the helper is gone
+}
+
+func newPrivsepClient(conn net.Conn) *privsepClient {
+	c := &privsepClient{conn: conn, enc: json.NewEncoder(conn), pending: make(map[uint64]chan *privsepReply)}
+	go c.readReplies()
+	return c
+}
+
+func (c *privsepClient) readReplies() {
+	dec := json.NewDecoder(c.conn)
+	for {
+		var reply privsepReply
+		if err := dec.Decode(&reply); err != nil {
+			if err == io.EOF {
+				err = errors.New("privileged helper is gone")
+			}
+			logMain(false, "privileged helper failed:%s", err.Error())
+			c.lock.Lock()
+			c.err = err
+			for id, ch := range c.pending {
+				delete(c.pending, id)
+				close(ch)
+			}
+			c.lock.Unlock()
+			return
+		}
+		c.lock.Lock()
+		ch := c.pending[reply.Id]
+		delete(c.pending, reply.Id)
+		c.lock.Unlock()
+		if ch != nil {
+			ch <- &reply
+		}
+	}
+}
+
+// send req and wait for its reply, or ctx
+func (c *privsepClient) call(ctx context.Context, req *privsepRequest) (*privsepReply, error) {
+	ch := make(chan *privsepReply, 1)
+	c.lock.Lock()
+	if c.err != nil {
+		c.lock.Unlock()
+		return nil, c.err
+	}
+	c.nextId++
+	req.Id = c.nextId
+	c.pending[req.Id] = ch
+	err := c.enc.Encode(req)
+	if err != nil {
+		delete(c.pending, req.Id)
+	}
+	c.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case reply, ok := <-ch:
+		if !ok {
+			return nil, errors.New("privileged helper is gone")
+		}
+		if reply.Error != "" {
+			return reply, errors.New(reply.Error)
+		}
+		return reply, nil
+	case <-ctx.Done():
+		c.lock.Lock()
+		delete(c.pending, req.Id)
+		c.lock.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// a responder run by the helper, the local one only describes what it would do
+type privsepResponder struct {
+	responder
+}
+
+// runs Unblock in the helper too
+type privsepUnblocker struct {
+	privsepResponder
+}
+
+func newPrivsepResponder(r responder) responder {
+	if _, ok := r.(unblocker); ok {
+		return &privsepUnblocker{privsepResponder{r}}
+	}
+	return &privsepResponder{r}
+}
+
+func (r *privsepResponder) Block(ctx context.Context, ev *event) error {
+	reply, err := privHelper.call(ctx, &privsepRequest{Op: privsepBlock, Responder: r.Name(), Event: ev.record()})
+	if reply != nil && reply.Output != "" {
+		if out := auditOutputOf(ctx); out != nil {
+			out.Write([]byte(reply.Output))
+		}
+	}
+	return err
+}
+
+func (r *privsepUnblocker) Unblock(ip string) error {
+	_, err := privHelper.call(context.Background(), &privsepRequest{Op: privsepUnblock, Responder: r.Name(), Host: ip})
+	return err
+}
+
+// binds ports below 1024 in the helper, others here
+type privsepVerifier struct{}
+
+func (privsepVerifier) PortInUse(laddr net.IP, port int) bool {
+	if port >= 1024 {
+		return smartVerifyPort(laddr, port)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reply, err := privHelper.call(ctx, &privsepRequest{Op: privsepVerify, Laddr: laddr.String(), Port: port})
+	if err != nil {
+		logDebug("verify port %d in privileged helper failed:%s", port, err.Error())
+		// like a failed bind, the port counts as in use
+		return true
+	}
+	return reply.InUse
+}
+
+// hand responders and bind checks to the helper on conn
+func usePrivHelper(conn net.Conn) {
+	privHelper = newPrivsepClient(conn)
+	for i, r := range responders {
+		responders[i] = newPrivsepResponder(r)
+	}
+	verifier = privsepVerifier{}
+	setPrivsepCaps()
+}
+
+// serve the detector on conn until it closes
+func servePrivsep(conn net.Conn) {
+	var lock sync.Mutex
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+	slots := make(chan struct{}, privsepMaxRequests)
+	for {
+		var req privsepRequest
+		if err := dec.Decode(&req); err != nil {
+			if err != io.EOF {
+				logMain(false, "privileged helper, read request failed:%s", err.Error())
+			}
+			return
+		}
+		slots <- struct{}{}
+		go func() {
+			defer func() { <-slots }()
+			reply := handlePrivsep(&req)
+			if reply == nil {
+				reply = privsepFail("%s failed", req.Op)
+			}
+			reply.Id = req.Id
+			lock.Lock()
+			enc.Encode(reply)
+			lock.Unlock()
+		}()
+	}
+}
+
+func privsepFail(format string, a ...interface{}) *privsepReply {
+	return &privsepReply{Error: fmt.Sprintf(format, a...)}
+}
+
+// check and run one request
+func handlePrivsep(req *privsepRequest) *privsepReply {
+	defer recoverPanic("privileged helper")
+	switch req.Op {
+	case privsepVerify:
+		laddr := net.ParseIP(req.Laddr)
+		if laddr == nil || laddr.To4() == nil || req.Port <= 0 || req.Port > 65535 {
+			return privsepFail("invalid verify of %s:%d", req.Laddr, req.Port)
+		}
+		return &privsepReply{InUse: smartVerifyPort(laddr, req.Port)}
+	case privsepBlock, privsepUnblock:
+	default:
+		return privsepFail("invalid op:%q", req.Op)
+	}
+
+	var r responder
+	for _, c := range responders {
+		if c.Name() == req.Responder {
+			r = c
+		}
+	}
+	if r == nil {
+		return privsepFail("responder %q is not configured", req.Responder)
+	}
+	host := req.Host
+	if req.Op == privsepBlock {
+		if req.Event == nil {
+			return privsepFail("block without event")
+		}
+		host = req.Event.Host
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.To4() == nil {
+		return privsepFail("invalid host:%q", host)
+	}
+	host = ip.String()
+
+	if req.Op == privsepUnblock {
+		u, ok := r.(unblocker)
+		if !ok {
+			return privsepFail("responder %s can't unblock", r.Name())
+		}
+		if err := u.Unblock(host); err != nil {
+			return privsepFail("%s", err.Error())
+		}
+		return &privsepReply{}
+	}
+
+	rec := req.Event
+	if isIgnoredIP(ip) {
+		return privsepFail("host %s is ignored", host)
+	}
+	if rec.Port < 0 || rec.Port > 65535 {
+		return privsepFail("invalid port:%d", rec.Port)
+	}
+	ev := &event{
+		Time:       rec.Time,
+		Kind:       eventBlock,
+		Host:       host,
+		Port:       rec.Port,
+		Proto:      rec.Proto,
+		ScanType:   rec.ScanType,
+		Payload:    rec.Payload,
+		Alarms:     rec.Alarms,
+		ASN:        rec.ASN,
+		ASOrg:      rec.ASOrg,
+		Country:    rec.Country,
+		Reputation: rec.Reputation,
+		Spoof:      rec.Spoof,
+		Evidence:   rec.Evidence,
+		Responders: rec.Responders,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout := responderTimeout(r, responderConfFor(r)); timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	}
+	defer cancel()
+	ctx, output := withAuditOutput(ctx)
+	err := r.Block(ctx, ev)
+	reply := &privsepReply{}
+	if output != nil {
+		reply.Output = output.buf.String()
+	}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	return reply
+}
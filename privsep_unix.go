@@ -0,0 +1,75 @@
+//go:build unix
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// set in the environment of the privileged helper, its end of the socketpair is fd 3
+const privHelperEnv = "PORTGUARD_PRIVHELPER"
+
+// start the privileged helper as a copy of portguard with the same config, still as root
+func startPrivHelper() error {
+	// SOCK_CLOEXEC isn't there on darwin, close on exec is set under ForkLock like the runtime does
+	syscall.ForkLock.RLock()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err == nil {
+		syscall.CloseOnExec(fds[0])
+		syscall.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return err
+	}
+	local := os.NewFile(uintptr(fds[0]), "privsep")
+	remote := os.NewFile(uintptr(fds[1]), "privsep-helper")
+	defer local.Close()
+	defer remote.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), privHelperEnv+"=1")
+	if stdinConfigData != nil {
+		cmd.Stdin = strings.NewReader(*stdinConfigData)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{remote}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	conn, err := net.FileConn(local)
+	if err != nil {
+		return err
+	}
+	logMain(false, "privileged helper started, pid:%d", cmd.Process.Pid)
+	usePrivHelper(conn)
+	return nil
+}
+
+func isPrivHelper() bool {
+	return os.Getenv(privHelperEnv) == "1"
+}
+
+// serve the detector on fd 3 and exit once it's gone
+func runPrivHelper() {
+	conn, err := net.FileConn(os.NewFile(3, "privsep"))
+	if err != nil {
+		logMain(true, "privileged helper, open socket failed:%s", err.Error())
+	}
+	servePrivsep(conn)
+	os.Exit(0)
+}
@@ -0,0 +1,16 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+func startPrivHelper() error {
+	return errNotSupported
+}
+
+func isPrivHelper() bool {
+	return false
+}
+
+func runPrivHelper() {
+}
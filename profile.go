@@ -0,0 +1,155 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// interface profiles
+// interface.<name>.<key> lines give the guards of a monitored interface their own settings,
+// e.g. blocking on the wan nic but only alarming on the dmz nic; keys not set use the global ones
+//   scan_trigger, block_score  thresholds of hosts probing this interface, see scoring
+//   exclude_port               repeated, replaces the global exclude_port on this interface
+//   action                     block, or alarm to log alarms that never count toward a block
+//   responders                 comma separated responders that run for blocks made here
+// a host has one score whichever interface it probes, each interface holds it to its own threshold
+
+type ifaceProfile struct {
+	iface        string
+	scanTrigger  int // 0 for the global one
+	blockScore   int
+	excludePorts portSet
+	hasExclude   bool
+	alarmOnly    bool
+	responders   []string
+}
+
+// profiles by interface name, only those with interface.<name> keys
+var cfgIfaceProfiles = make(map[string]*ifaceProfile)
+
+func parseIfaceProfileKey(lineno int, token string, value string) {
+	// names of vlan interfaces like eth0.100 have dots too
+	i := strings.LastIndexByte(token, '.')
+	if i <= len("interface.") {
+		logMain(true, "line %d:%s, invalid key, should be interface.<name>.<key>", lineno, token)
+	}
+	name, key := token[len("interface."):i], token[i+1:]
+	p, ok := cfgIfaceProfiles[name]
+	if !ok {
+		p = &ifaceProfile{iface: name}
+		cfgIfaceProfiles[name] = p
+	}
+	switch key {
+	case "scan_trigger":
+		if p.scanTrigger = parseInt(lineno, token, value); p.scanTrigger <= 0 {
+			logMain(true, "line %d:%s, invalid value:%s, should be positive", lineno, token, value)
+		}
+	case "block_score":
+		if p.blockScore = parseInt(lineno, token, value); p.blockScore <= 0 {
+			logMain(true, "line %d:%s, invalid value:%s, should be positive", lineno, token, value)
+		}
+	case "exclude_port", "exclude_service":
+		parsePorts(lineno, token, value, &p.excludePorts)
+		p.hasExclude = true
+	case "action":
+		if value != "block" && value != policyAlarm {
+			logMain(true, "line %d:%s, invalid value:%s, should be block or alarm", lineno, token, value)
+		}
+		p.alarmOnly = value == policyAlarm
+	case "responders":
+		p.responders = nil
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				p.responders = append(p.responders, name)
+			}
+		}
+	default:
+		logMain(true, "line %d:%s, unknown key %s, should be scan_trigger, block_score, exclude_port, action or responders", lineno, token, key)
+	}
+}
+
+// network namespace of the guard of p, empty for portguard's own
+func (p *ifaceProfile) netns() string {
+	if ns, ok := strings.CutPrefix(p.iface, netnsIfacePrefix); ok {
+		return ns
+	}
+	return ""
+}
+
+// profile of the guards on iface, one without overrides if it has none
+func profileFor(iface string) *ifaceProfile {
+	if p, ok := cfgIfaceProfiles[iface]; ok {
+		return p
+	}
+	return &ifaceProfile{iface: iface}
+}
+
+// profiles must name monitored interfaces and configured responders
+func checkIfaceProfiles() {
+	for _, p := range cfgIfaceProfiles {
+		if !containsString(cfgInterfaces, p.iface) && !isMirrorIface(p.iface) && !isNetnsIface(p.iface) {
+			logMain(true, "interface.%s, interface is not monitored, add interface = %s", p.iface, p.iface)
+		}
+		for _, name := range p.responders {
+			found := false
+			for _, r := range responders {
+				found = found || r.Name() == name
+			}
+			if !found {
+				logMain(false, "WARNING interface.%s, responder %s is not configured", p.iface, name)
+			}
+		}
+	}
+}
+
+// port is out of min_port/max_port or excluded on this interface
+func (p *ifaceProfile) isExcludePort(port int) bool {
+	if !p.hasExclude {
+		return isExlcudePort(port)
+	}
+	return port < cfgMinPort || port > cfgMaxPort || p.excludePorts.Contains(port)
+}
+
+// score at which a host probing this interface is blocked
+func (p *ifaceProfile) blockThreshold() int {
+	switch {
+	case cfgScoring == scoringWeighted && p.blockScore > 0:
+		return p.blockScore
+	case p.scanTrigger > 0:
+		return p.scanTrigger + 1
+	}
+	return blockThreshold()
+}
+
+// settings that differ from the global ones, for configEcho
+func (p *ifaceProfile) String() string {
+	var s []string
+	if p.scanTrigger > 0 || p.blockScore > 0 {
+		s = append(s, "block score:"+strconv.Itoa(p.blockThreshold()))
+	}
+	if p.hasExclude {
+		s = append(s, "exclude ports:"+p.excludePorts.String())
+	}
+	if p.alarmOnly {
+		s = append(s, "action:alarm")
+	}
+	if len(p.responders) > 0 {
+		s = append(s, "responders:"+strings.Join(p.responders, ","))
+	}
+	return strings.Join(s, " ")
+}
+
+// names of interfaces with a profile, sorted
+func ifaceProfileNames() []string {
+	var names []string
+	for name := range cfgIfaceProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,126 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// pcap file magic numbers, microsecond and nanosecond timestamps
+const (
+	pcapMagicMicro = 0xa1b2c3d4
+	pcapMagicNano  = 0xa1b23c4d
+)
+
+// packets read from a classic pcap file, pcapng isn't supported
+type pcapConn struct {
+	f       *os.File
+	r       *bufio.Reader
+	order   binary.ByteOrder
+	dlt     int
+	proto   uint8
+	snaplen uint32
+	hdr     [16]byte
+	vlan    int // of the last packet
+}
+
+func openPcap(file string, network string) (*pcapConn, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	c := &pcapConn{f: f, r: bufio.NewReader(f), proto: networkProto(network)}
+
+	var hdr [24]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read pcap header:%s", err.Error())
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		if magic := order.Uint32(hdr[0:4]); magic == pcapMagicMicro || magic == pcapMagicNano {
+			c.order = order
+			break
+		}
+	}
+	if c.order == nil {
+		f.Close()
+		return nil, errors.New("not a pcap file, pcapng must be converted first")
+	}
+	c.snaplen = c.order.Uint32(hdr[16:20])
+	c.dlt = int(c.order.Uint32(hdr[20:24]) & 0x0fffffff)
+	return c, nil
+}
+
+// next packet of c.proto, return io.EOF at the end of file
+func (c *pcapConn) ReadPacket(b []byte) (int, error) {
+	for {
+		if _, err := io.ReadFull(c.r, c.hdr[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		caplen := c.order.Uint32(c.hdr[8:12])
+		if caplen > 1<<18 || (c.snaplen > 0 && caplen > c.snaplen) {
+			return 0, fmt.Errorf("invalid pcap record length %d", caplen)
+		}
+		frame := make([]byte, caplen)
+		if _, err := io.ReadFull(c.r, frame); err != nil {
+			return 0, io.EOF
+		}
+		packet, vlan, ok := decodeFrame(c.dlt, frame, c.proto, serverIp, 0)
+		if !ok {
+			continue
+		}
+		c.vlan = vlan
+		return copy(b, packet), nil
+	}
+}
+
+func (c *pcapConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *pcapConn) LastVlan() int {
+	return c.vlan
+}
+
+func (c *pcapConn) Close() error {
+	return c.f.Close()
+}
+
+// feed packets of a pcap file through the guard and print alarms and blocks to stdout
+// ports are taken as closed, and responders only log what they would run
+func replay(file string) {
+	conn, err := openPcap(file, "ip4:"+*mode)
+	if err != nil {
+		logMain(true, "open %s failed:%s", file, err.Error())
+	}
+	defer conn.Close()
+
+	verifier = newFakeVerifier()
+	cfgAction = "log_only"
+	alarmLogger = log.New(os.Stdout, "", 0)
+	blockedLogger = log.New(os.Stdout, "", 0)
+
+	if *mode == "tcp" {
+		tcpGuard(conn, serverIp, "")
+	} else {
+		udpGuard(conn, serverIp, "")
+	}
+	flushAlarmWindows(true)
+	closeEvidenceFiles()
+	logMain(false, "%s", statsLine())
+	if cfgDigestInterval > 0 {
+		sendDigest()
+	}
+}
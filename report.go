@@ -0,0 +1,313 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// activity reports
+// at local midnight, or midnight before monday with report_interval weekly, the activity of the day
+// or week is rendered as json and html: top offenders, noisiest ports, scan types and patterns,
+// blocks applied, expired and lifted, and alarms and blocks per hour, or per day, for charts
+// they're written to report_dir as portguard-<start date>.json/.html and latest.json/.html,
+// and the json is posted to report_url
+
+const (
+	reportDaily  = "daily"
+	reportWeekly = "weekly"
+
+	// entries listed in each top list of a report
+	reportTop = 20
+)
+
+var (
+	cfgReportInterval string
+	cfgReportDir      string
+	cfgReportUrl      string
+
+	reportLock  sync.Mutex
+	curActivity = newActivity(time.Now())
+)
+
+// what happened since the last report
+type activity struct {
+	start     time.Time
+	alarms    int
+	blocks    int
+	expired   int
+	lifted    int
+	hosts     map[string]int
+	ports     map[int]int
+	scanTypes map[string]int
+	patterns  map[string]int
+	trend     map[int64]*reportBucket // bucket start, unix seconds -> counts
+}
+
+type reportBucket struct {
+	Time   time.Time `json:"time"`
+	Alarms int       `json:"alarms"`
+	Blocks int       `json:"blocks"`
+}
+
+type activityReport struct {
+	Interval      string         `json:"interval"`
+	Start         time.Time      `json:"start"`
+	End           time.Time      `json:"end"`
+	Alarms        int            `json:"alarms"`
+	Blocks        int            `json:"blocks"`
+	Expired       int            `json:"blocks_expired"`
+	Lifted        int            `json:"blocks_lifted"`
+	Blocked       int            `json:"blocked_now"`
+	Hosts         int            `json:"hosts"`
+	TopOffenders  []digestEntry  `json:"top_offenders"`
+	NoisiestPorts []digestEntry  `json:"noisiest_ports"`
+	ScanTypes     []digestEntry  `json:"scan_types"`
+	Patterns      []digestEntry  `json:"scan_patterns"`
+	Trend         []reportBucket `json:"trend"`
+}
+
+func newActivity(start time.Time) *activity {
+	return &activity{
+		start:     start,
+		hosts:     make(map[string]int),
+		ports:     make(map[int]int),
+		scanTypes: make(map[string]int),
+		patterns:  make(map[string]int),
+		trend:     make(map[int64]*reportBucket),
+	}
+}
+
+func checkReport() {
+	if cfgReportInterval != "" && cfgReportDir == "" && cfgReportUrl == "" {
+		logMain(true, "report_interval needs report_dir or report_url")
+	}
+}
+
+// start of the trend bucket of t, an hour for daily reports and a day for weekly ones
+func reportBucketStart(t time.Time) time.Time {
+	t = logTime(t)
+	if cfgReportInterval == reportWeekly {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
+
+// end of the report period starting at t
+func nextReport(t time.Time) time.Time {
+	t = logTime(t)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if cfgReportInterval == reportWeekly {
+		return day.AddDate(0, 0, 7-(int(t.Weekday())+6)%7)
+	}
+	return day.AddDate(0, 0, 1)
+}
+
+func (a *activity) bucket(t time.Time) *reportBucket {
+	start := reportBucketStart(t)
+	b, ok := a.trend[start.Unix()]
+	if !ok {
+		b = &reportBucket{Time: start}
+		a.trend[start.Unix()] = b
+	}
+	return b
+}
+
+func recordReport(ev *event) {
+	if cfgReportInterval == "" {
+		return
+	}
+	reportLock.Lock()
+	defer reportLock.Unlock()
+	a := curActivity
+	switch ev.Kind {
+	case eventBlock:
+		a.blocks++
+		a.bucket(ev.Time).Blocks++
+	case eventAlarm:
+		a.alarms++
+		a.bucket(ev.Time).Alarms++
+		a.hosts[ev.Host]++
+		a.ports[ev.Port]++
+		a.scanTypes[ev.ScanType]++
+		if ev.Pattern != "" {
+			a.patterns[ev.Pattern]++
+		}
+	}
+}
+
+// count a block that expired, or was lifted before
+func reportUnblock(expired bool) {
+	if cfgReportInterval == "" {
+		return
+	}
+	reportLock.Lock()
+	if expired {
+		curActivity.expired++
+	} else {
+		curActivity.lifted++
+	}
+	reportLock.Unlock()
+}
+
+func (a *activity) report(end time.Time) *activityReport {
+	r := &activityReport{
+		Interval:      cfgReportInterval,
+		Start:         logTime(a.start),
+		End:           logTime(end),
+		Alarms:        a.alarms,
+		Blocks:        a.blocks,
+		Expired:       a.expired,
+		Lifted:        a.lifted,
+		Blocked:       len(blockedIps()),
+		Hosts:         len(a.hosts),
+		TopOffenders:  topCounts(a.hosts, reportTop),
+		NoisiestPorts: topCounts(portCounts(a.ports), reportTop),
+		ScanTypes:     topCounts(a.scanTypes, len(a.scanTypes)),
+		Patterns:      topCounts(a.patterns, len(a.patterns)),
+	}
+	// every bucket of the period, empty ones too, so charts have no gaps
+	for t := reportBucketStart(a.start); t.Before(end); {
+		b := reportBucket{Time: t}
+		if counts, ok := a.trend[t.Unix()]; ok {
+			b = *counts
+		}
+		r.Trend = append(r.Trend, b)
+		if cfgReportInterval == reportWeekly {
+			t = t.AddDate(0, 0, 1)
+		} else {
+			t = t.Add(time.Hour)
+		}
+	}
+	return r
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": func(n int, max int) int {
+		if max == 0 {
+			return 0
+		}
+		return n * 100 / max
+	},
+	"time": formatLogTime,
+	"entries": func(title string, entries []digestEntry) interface{} {
+		return struct {
+			Title   string
+			Entries []digestEntry
+		}{title, entries}
+	},
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>portguard {{.Interval}} report {{time .Start}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+td, th { padding: 2px 8px; text-align: left; }
+.bar { background: #c33; height: 10px; }
+</style></head><body>
+<h1>portguard {{.Interval}} report</h1>
+<p>{{time .Start}} - {{time .End}}</p>
+<table>
+<tr><th>alarms</th><td>{{.Alarms}}</td></tr>
+<tr><th>hosts</th><td>{{.Hosts}}</td></tr>
+<tr><th>blocks applied</th><td>{{.Blocks}}</td></tr>
+<tr><th>blocks expired</th><td>{{.Expired}}</td></tr>
+<tr><th>blocks lifted</th><td>{{.Lifted}}</td></tr>
+<tr><th>blocked now</th><td>{{.Blocked}}</td></tr>
+</table>
+{{define "top"}}<table><tr><th>{{.Title}}</th><th>alarms</th></tr>
+{{range .Entries}}<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}
+{{template "top" (entries "top offenders" .TopOffenders)}}
+{{template "top" (entries "noisiest ports" .NoisiestPorts)}}
+{{template "top" (entries "scan types" .ScanTypes)}}
+{{template "top" (entries "scan patterns" .Patterns)}}
+<h2>trend</h2>
+<table><tr><th>from</th><th>alarms</th><th></th><th>blocks</th></tr>
+{{$max := .TrendMax}}{{range .Trend}}<tr><td>{{time .Time}}</td><td>{{.Alarms}}</td>
+<td style="width:300px"><div class="bar" style="width:{{percent .Alarms $max}}%"></div></td><td>{{.Blocks}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
+
+// most alarms of a trend bucket, the full width of the html bars
+func (r *activityReport) TrendMax() int {
+	max := 0
+	for _, b := range r.Trend {
+		if b.Alarms > max {
+			max = b.Alarms
+		}
+	}
+	return max
+}
+
+// write r to report_dir and post it to report_url
+func deliverReport(r *activityReport) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		logMain(false, "encode report failed:%s", err.Error())
+		return
+	}
+	if cfgReportDir != "" {
+		var page bytes.Buffer
+		if err := reportTemplate.Execute(&page, r); err != nil {
+			logMain(false, "render report failed:%s", err.Error())
+			return
+		}
+		name := "portguard-" + r.Start.Format("2006-01-02")
+		for _, f := range []struct {
+			name string
+			data []byte
+		}{{name + ".json", data}, {name + ".html", page.Bytes()}, {"latest.json", data}, {"latest.html", page.Bytes()}} {
+			file := filepath.Join(cfgReportDir, f.name)
+			if err := writeFileAtomic(chrootPath(file), f.data, 0644); err != nil {
+				logMain(false, "write report %s failed:%s", file, err.Error())
+			}
+		}
+	}
+	if cfgReportUrl != "" {
+		resp, err := http.Post(cfgReportUrl, "application/json", bytes.NewReader(data))
+		if err != nil {
+			logMain(false, "post report to %s failed:%s", cfgReportUrl, err.Error())
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			logMain(false, "post report to %s failed:%s", cfgReportUrl, resp.Status)
+		}
+	}
+}
+
+func runReport() {
+	for {
+		reportLock.Lock()
+		start := curActivity.start
+		reportLock.Unlock()
+		end := nextReport(start)
+		time.Sleep(time.Until(end))
+
+		reportLock.Lock()
+		a := curActivity
+		curActivity = newActivity(end)
+		reportLock.Unlock()
+		r := a.report(end)
+		logMain(false, "%s report %s - %s: %d alarms, %d blocks", cfgReportInterval, formatLogTime(r.Start), formatLogTime(r.End), r.Alarms, r.Blocks)
+		deliverReport(r)
+	}
+}
+
+func reportString() string {
+	if cfgReportInterval == "" {
+		return "off"
+	}
+	return fmt.Sprintf("%s dir:%q url:%q", cfgReportInterval, cfgReportDir, cfgReportUrl)
+}
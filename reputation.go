@@ -0,0 +1,160 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// verdicts of a reputation http api, cached for reputation_ttl seconds
+// lookups run in background, so a verdict is known from a host's next probe on
+
+const reputationUnknown = "unknown"
+
+type reputationEntry struct {
+	verdict string
+	expires int64
+	pending bool
+	added   int64 // unix nanoseconds, see reputation_cache_eviction
+	used    int64
+}
+
+var (
+	reputationClient = &http.Client{Timeout: 10 * time.Second}
+	reputationLock   sync.Mutex
+	reputationCache  = make(map[string]*reputationEntry)
+)
+
+// value at a dot separated path of a json document, e.g. "data.classification"
+func jsonPath(v interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func queryReputation(ip string) (string, error) {
+	req, err := http.NewRequest("GET", expandTokens(cfgReputationUrl, *mode, ip, 0), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	for _, header := range cfgReputationHeaders {
+		if kv := strings.SplitN(header, ":", 2); len(kv) == 2 {
+			req.Header.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+		}
+	}
+	resp, err := reputationClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return reputationUnknown, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s", resp.Status)
+	}
+
+	var doc interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return "", err
+	}
+	v, ok := jsonPath(doc, cfgReputationField)
+	if !ok || v == nil {
+		return reputationUnknown, nil
+	}
+	return strings.ToLower(fmt.Sprint(v)), nil
+}
+
+// cached verdict of ip, empty while it's looked up
+func reputationOf(ip string) string {
+	if cfgReputationUrl == "" {
+		return ""
+	}
+	now := time.Now().Unix()
+	reputationLock.Lock()
+	defer reputationLock.Unlock()
+	e := reputationCache[ip]
+	if e != nil {
+		e.used = time.Now().UnixNano()
+	}
+	if e != nil && (e.pending || e.expires > now) {
+		return e.verdict
+	}
+	if e == nil {
+		evictReputation()
+		e = &reputationEntry{added: time.Now().UnixNano()}
+		e.used = e.added
+		reputationCache[ip] = e
+	}
+	e.pending = true
+
+	go func() {
+		verdict, err := queryReputation(ip)
+		ttl := int64(cfgReputationTtl)
+		if err != nil {
+			logMain(false, "query reputation of host:%s failed:%s", ip, err.Error())
+			// retry a failed lookup soon, but not for every probe
+			verdict, ttl = "", 60
+		}
+		reputationLock.Lock()
+		e.verdict, e.expires, e.pending = verdict, time.Now().Unix()+ttl, false
+		reputationLock.Unlock()
+	}()
+	return e.verdict
+}
+
+// drop expired verdicts
+func expireReputation() {
+	now := time.Now().Unix()
+	reputationLock.Lock()
+	defer reputationLock.Unlock()
+	for ip, e := range reputationCache {
+		if !e.pending && e.expires <= now {
+			delete(reputationCache, ip)
+		}
+	}
+}
+
+func runReputationExpiry() {
+	for range time.Tick(time.Minute) {
+		expireReputation()
+	}
+}
+
+// decision of reputation_benign and reputation_malicious for ev
+func reputationPolicy(ev *event) string {
+	if ev.Reputation == "" {
+		return policyDefault
+	}
+	if cfgReputationBenign[ev.Reputation] {
+		return policyAlarm
+	}
+	if cfgReputationMalicious[ev.Reputation] && cfgReputationBlock {
+		return policyBlock
+	}
+	return policyDefault
+}
+
+// reputation_benign = benign, unknown
+func parseVerdicts(value string, verdicts map[string]bool) {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			verdicts[v] = true
+		}
+	}
+}
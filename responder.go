@@ -0,0 +1,879 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acts on a blocked host
+// ctx ends at the responder's timeout, commands and requests are canceled with it
+type responder interface {
+	Name() string
+	Block(ctx context.Context, ev *event) error
+	// what Block would do, for action = log_only
+	Describe(ev *event) string
+}
+
+// a responder that can undo its block when the block expires
+type unblocker interface {
+	Unblock(ip string) error
+}
+
+// configured responders, in the order they run
+var responders []responder
+
+// runs commands, kill_route, kill_run_cmd and responders of type cmd
+// kill_route and kill_run_cmd may have several, they all run in config order, a failing one doesn't
+// stop the others; the error has every failure
+type cmdResponder struct {
+	name     string
+	commands []string
+}
+
+func (r *cmdResponder) Name() string { return r.name }
+func (r *cmdResponder) Block(ctx context.Context, ev *event) error {
+	var errs []error
+	for _, command := range r.commands {
+		if err := runCmd(ctx, command, ev); err != nil {
+			if len(r.commands) > 1 {
+				err = fmt.Errorf("%s: %w", command, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+func (r *cmdResponder) Describe(ev *event) string {
+	var runs []string
+	for _, command := range r.commands {
+		runs = append(runs, "run "+expandTokens(command, *mode, ev.Host, ev.Port))
+	}
+	return strings.Join(runs, ", then ")
+}
+
+// kill_route and kill_run_cmd with kill_route_undo or kill_run_cmd_undo, the undo commands run
+// when the block expires or is lifted, and when the host is trusted; $PORT$ is 0 in them
+type undoCmdResponder struct {
+	cmdResponder
+	undo []string
+}
+
+func (r *undoCmdResponder) Unblock(ip string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	if cfgCmdTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(cfgCmdTimeout)*time.Second)
+	}
+	defer cancel()
+	ev := &event{Time: time.Now(), Kind: eventBlock, Host: ip, Proto: strings.ToUpper(*mode), ScanType: "unblock"}
+	var errs []error
+	for _, command := range r.undo {
+		if err := runCmd(ctx, command, ev); err != nil {
+			if len(r.undo) > 1 {
+				err = fmt.Errorf("%s: %w", command, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// names of responders that can't undo a block, left to be undone by hand
+func responderNamesWithoutUndo() []string {
+	var names []string
+	for _, r := range responders {
+		if _, ok := r.(unblocker); !ok {
+			names = append(names, r.Name())
+		}
+	}
+	return names
+}
+
+// requests a url, kill_notify_url and responders of type url
+type urlResponder struct {
+	name string
+	url  string
+}
+
+func (r *urlResponder) Name() string { return r.name }
+func (r *urlResponder) Block(ctx context.Context, ev *event) error {
+	return requestUrl(ctx, r.url, *mode, ev.Host, ev.Port)
+}
+func (r *urlResponder) Describe(ev *event) string {
+	return "request " + expandTokens(r.url, *mode, ev.Host, ev.Port)
+}
+
+// built-in responders, set up from config
+type windowsFirewallResponder struct{}
+
+func (windowsFirewallResponder) Name() string { return "windows_firewall" }
+func (windowsFirewallResponder) Block(_ context.Context, ev *event) error {
+	if err := allowExec("netsh for " + ev.Host); err != nil {
+		return err
+	}
+	return windowsFirewallBlock(ev.Host)
+}
+func (windowsFirewallResponder) Describe(ev *event) string {
+	return "add windows firewall rule for " + ev.Host
+}
+
+// pf_table, firewalld, nft_set, fw4 and ipset queue hosts to their fwBatch
+type pfResponder struct{ batch *fwBatch }
+
+func (*pfResponder) Name() string { return "pf_table" }
+func (r *pfResponder) Block(_ context.Context, ev *event) error {
+	r.batch.add(ev.Host, false)
+	return nil
+}
+func (*pfResponder) Describe(ev *event) string {
+	return fmt.Sprintf("add %s to pf table %s", ev.Host, cfgPfTable)
+}
+
+type firewalldResponder struct{ batch *fwBatch }
+
+func (*firewalldResponder) Name() string { return "firewalld" }
+func (r *firewalldResponder) Block(_ context.Context, ev *event) error {
+	r.batch.add(ev.Host, false)
+	return nil
+}
+func (*firewalldResponder) Describe(ev *event) string {
+	return fmt.Sprintf("block %s in firewalld zone:%q ipset:%q", ev.Host, cfgFirewalldZone, cfgFirewalldIPSet)
+}
+
+type nftResponder struct{ batch *fwBatch }
+
+func (*nftResponder) Name() string { return "nft_set" }
+func (r *nftResponder) Block(_ context.Context, ev *event) error {
+	r.batch.add(ev.Host, false)
+	return nil
+}
+func (r *nftResponder) Unblock(ip string) error {
+	r.batch.add(ip, true)
+	return nil
+}
+func (*nftResponder) Describe(ev *event) string {
+	if isThrottle() {
+		return fmt.Sprintf("throttle %s through nft set %s", ev.Host, cfgNftSet)
+	}
+	return fmt.Sprintf("add %s to nft set %s", ev.Host, cfgNftSet)
+}
+
+type fw4Responder struct{ batch *fwBatch }
+
+func (*fw4Responder) Name() string { return "fw4_set" }
+func (r *fw4Responder) Block(_ context.Context, ev *event) error {
+	r.batch.add(ev.Host, false)
+	return nil
+}
+func (r *fw4Responder) Unblock(ip string) error {
+	r.batch.add(ip, true)
+	return nil
+}
+func (*fw4Responder) Describe(ev *event) string {
+	return fmt.Sprintf("add %s to fw4 set %s", ev.Host, cfgFw4Set)
+}
+
+type fail2banResponder struct{}
+
+func (fail2banResponder) Name() string { return "fail2ban" }
+func (fail2banResponder) Block(ctx context.Context, ev *event) error {
+	return fail2banBan(ctx, ev.Host)
+}
+func (fail2banResponder) Unblock(ip string) error {
+	return fail2banUnban(ip)
+}
+func (fail2banResponder) Describe(ev *event) string {
+	return fmt.Sprintf("ban %s in fail2ban jail %s", ev.Host, cfgFail2banJail)
+}
+
+type ipsetResponder struct{ batch *fwBatch }
+
+func (*ipsetResponder) Name() string { return "ipset" }
+func (r *ipsetResponder) Block(_ context.Context, ev *event) error {
+	r.batch.add(ev.Host, false)
+	return nil
+}
+func (r *ipsetResponder) Unblock(ip string) error {
+	r.batch.add(ip, true)
+	return nil
+}
+func (*ipsetResponder) Describe(ev *event) string {
+	if isThrottle() {
+		return fmt.Sprintf("throttle %s through ipset %s", ev.Host, cfgIpset)
+	}
+	return fmt.Sprintf("add %s to ipset %s", ev.Host, cfgIpset)
+}
+
+type kubeResponder struct{ batch *fwBatch }
+
+func (*kubeResponder) Name() string { return "kube_blocklist" }
+func (r *kubeResponder) Block(_ context.Context, ev *event) error {
+	r.batch.add(ev.Host, false)
+	return nil
+}
+func (r *kubeResponder) Unblock(ip string) error {
+	r.batch.add(ip, true)
+	return nil
+}
+func (*kubeResponder) Describe(ev *event) string {
+	return fmt.Sprintf("add %s to %s blocklist %s", ev.Host, cfgKubeBlocklist, cfgKubeBlocklistName)
+}
+
+type xdpResponder struct{}
+
+func (xdpResponder) Name() string { return "xdp" }
+func (xdpResponder) Block(_ context.Context, ev *event) error {
+	return xdpBlock(ev.Host)
+}
+func (xdpResponder) Unblock(ip string) error {
+	return xdpUnblock(ip)
+}
+func (xdpResponder) Describe(ev *event) string {
+	return fmt.Sprintf("add %s to xdp map %s", ev.Host, cfgXdpMapPin)
+}
+
+type blackholeRouteResponder struct{}
+
+func (blackholeRouteResponder) Name() string { return "blackhole_route" }
+func (blackholeRouteResponder) Block(_ context.Context, ev *event) error {
+	return blackholeRouteAdd(ev.Host)
+}
+func (blackholeRouteResponder) Unblock(ip string) error {
+	return blackholeRouteDelete(ip)
+}
+func (blackholeRouteResponder) Describe(ev *event) string {
+	return fmt.Sprintf("add %s route to %s in table %d", cfgBlackholeRoute, ev.Host, cfgBlackholeRouteTable)
+}
+
+type conntrackResponder struct{}
+
+func (conntrackResponder) Name() string { return "conntrack_flush" }
+func (conntrackResponder) Block(ctx context.Context, ev *event) error {
+	n, err := conntrackFlush(ev.Host)
+	if w := auditOutputOf(ctx); w != nil {
+		fmt.Fprintf(w, "deleted %d conntrack entries", n)
+	}
+	if n > 0 {
+		logDebug("deleted %d conntrack entries of %s", n, ev.Host)
+	}
+	return err
+}
+func (conntrackResponder) Describe(ev *event) string {
+	return "delete conntrack entries of " + ev.Host
+}
+
+type awsNaclResponder struct{}
+
+func (awsNaclResponder) Name() string { return "aws_nacl" }
+func (awsNaclResponder) Block(_ context.Context, ev *event) error {
+	return awsNaclBlock(ev.Host)
+}
+func (awsNaclResponder) Unblock(ip string) error {
+	return awsNaclUnblock(ip)
+}
+func (awsNaclResponder) Describe(ev *event) string {
+	return fmt.Sprintf("add %s to aws nacl %s", ev.Host, cfgAwsNaclId)
+}
+
+type cloudflareResponder struct{}
+
+func (cloudflareResponder) Name() string { return "cloudflare" }
+func (cloudflareResponder) Block(_ context.Context, ev *event) error {
+	return cloudflareBlock(ev.Host)
+}
+func (cloudflareResponder) Unblock(ip string) error {
+	return cloudflareUnblock(ip)
+}
+func (cloudflareResponder) Describe(ev *event) string {
+	return fmt.Sprintf("add %s to cloudflare access rules", ev.Host)
+}
+
+// a responder block of config, keys responder.<name>.<key>:
+//
+//	type     cmd, url or plugin; not set for built-in responders like kill_route
+//	command  for cmd and plugin
+//	url      for url
+//	timeout  seconds, 0 means none, or cmd_timeout for commands
+//	when     conditions the event must meet, see parseResponderWhen
+//	enabled  false turns it off
+//	on_failure   continue, abort or retry, see runResponders
+//	retries      extra attempts with on_failure = retry
+//	retry_delay  seconds before the first retry, doubled for each next one
+type responderConf struct {
+	name       string
+	kind       string
+	command    string
+	url        string
+	timeout    int
+	when       responderCond
+	enabled    bool
+	onFailure  string
+	retries    int
+	retryDelay int
+}
+
+const (
+	responderContinue = "continue"
+	responderAbort    = "abort"
+	responderRetry    = "retry"
+
+	responderSequential = "sequential"
+	responderConcurrent = "concurrent"
+)
+
+var (
+	// responder blocks in the order their first key appears
+	cfgResponders    []*responderConf
+	cfgResponderConf = make(map[string]*responderConf)
+
+	// responder_order, names of responders to run first, in this order
+	cfgResponderOrder []string
+	cfgResponderMode  = responderSequential
+
+	// settings of responders without a block
+	defaultResponderConf = &responderConf{enabled: true, onFailure: responderContinue, retries: 3, retryDelay: 1}
+)
+
+// names of built-in responders, their blocks only set timeout, when and enabled
+var builtinResponders = []string{
+	"kill_route", "kill_run_cmd", "windows_firewall", "pf_table",
+	"firewalld", "nft_set", "fw4_set", "ipset", "fail2ban", "xdp", "blackhole_route", "conntrack_flush", "aws_nacl", "cloudflare", "kube_blocklist", "kill_notify_url",
+}
+
+func responderConfOf(name string) *responderConf {
+	conf, ok := cfgResponderConf[name]
+	if !ok {
+		c := *defaultResponderConf
+		conf = &c
+		conf.name = name
+		cfgResponderConf[name] = conf
+		cfgResponders = append(cfgResponders, conf)
+	}
+	return conf
+}
+
+// responder.<name>.<key> = value
+func parseResponderKey(lineno int, token string, value string) {
+	fields := strings.Split(token, ".")
+	if len(fields) != 3 || fields[1] == "" {
+		logMain(true, "line %d:%s, invalid key, should be responder.<name>.<key>", lineno, token)
+	}
+	conf := responderConfOf(fields[1])
+	switch fields[2] {
+	case "type":
+		if value != "cmd" && value != "url" && value != "plugin" {
+			logMain(true, "line %d:%s, invalid value:%s, should be cmd, url or plugin", lineno, token, value)
+		}
+		conf.kind = value
+	case "command":
+		conf.command = value
+	case "url":
+		if _, err := url.Parse(value); err != nil {
+			logMain(true, "line %d:%s, invalid url:%s", lineno, token, value)
+		}
+		conf.url = value
+	case "timeout":
+		conf.timeout = parseInt(lineno, token, value)
+	case "when":
+		conf.when = parseResponderWhen(lineno, token, value)
+	case "enabled":
+		conf.enabled = parseBool(lineno, token, value)
+	case "on_failure":
+		if value != responderContinue && value != responderAbort && value != responderRetry {
+			logMain(true, "line %d:%s, invalid value:%s, should be continue, abort or retry", lineno, token, value)
+		}
+		conf.onFailure = value
+	case "retries":
+		conf.retries = parseInt(lineno, token, value)
+	case "retry_delay":
+		conf.retryDelay = parseInt(lineno, token, value)
+	default:
+		logMain(true, "line %d:%s, unknown key %s, should be type, command, url, timeout, when, enabled, on_failure, retries or retry_delay", lineno, token, fields[2])
+	}
+}
+
+// conditions of a responder, all set ones must hold
+type responderCond struct {
+	protos     []string // tcp, udp
+	scanTypes  []string // syn, null, xmas, udp, amplification, arp, connect, other, see scanTypeKey
+	ports      portSet
+	minAlarms  int
+	severity   string   // least severity of the event, see severity levels
+	countries  []string // iso codes, of the host's country or with notCountry of those it must not be in
+	notCountry bool
+	minScore   int
+}
+
+// parse space separated conditions, e.g. "proto:udp port:22,3389 scan_type:null,xmas alarms:10 severity:critical"
+// alarms is the least number of ports the host probed, score the least score it reached
+// country:DE,AT matches hosts of these countries, country:!DE those not of them, including
+// hosts whose country is unknown
+func parseResponderWhen(lineno int, token string, value string) responderCond {
+	var cond responderCond
+	for _, field := range strings.Fields(value) {
+		kv := strings.SplitN(field, ":", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			logMain(true, "line %d:%s, invalid condition:%s, should be key:value", lineno, token, field)
+		}
+		switch kv[0] {
+		case "proto":
+			for _, p := range strings.Split(kv[1], ",") {
+				if p != "tcp" && p != "udp" && p != "arp" {
+					logMain(true, "line %d:%s, invalid proto:%s, should be tcp, udp or arp", lineno, token, p)
+				}
+				cond.protos = append(cond.protos, p)
+			}
+		case "scan_type":
+			for _, t := range strings.Split(kv[1], ",") {
+				switch t {
+				case "syn", "null", "xmas", "udp", "amplification", "arp", "connect", "other":
+				default:
+					logMain(true, "line %d:%s, unknown scan type:%s, should be syn, null, xmas, udp, amplification, arp, connect or other", lineno, token, t)
+				}
+				cond.scanTypes = append(cond.scanTypes, t)
+			}
+		case "port":
+			parsePorts(lineno, token, kv[1], &cond.ports)
+		case "alarms":
+			cond.minAlarms = parseInt(lineno, token, kv[1])
+		case "severity":
+			cond.severity = parseSeverity(lineno, token, kv[1])
+		case "country":
+			list := kv[1]
+			if strings.HasPrefix(list, "!") {
+				cond.notCountry, list = true, list[1:]
+			}
+			for _, c := range strings.Split(list, ",") {
+				if len(c) != 2 {
+					logMain(true, "line %d:%s, invalid country:%s, should be an iso code like DE", lineno, token, c)
+				}
+				cond.countries = append(cond.countries, strings.ToUpper(c))
+			}
+		case "score":
+			cond.minScore = parseInt(lineno, token, kv[1])
+		default:
+			logMain(true, "line %d:%s, unknown condition:%s, should be proto, port, scan_type, alarms, score, country or severity", lineno, token, kv[0])
+		}
+	}
+	return cond
+}
+
+func (c *responderCond) match(ev *event) bool {
+	if len(c.protos) > 0 && !containsString(c.protos, strings.ToLower(ev.Proto)) {
+		return false
+	}
+	if len(c.scanTypes) > 0 && !containsString(c.scanTypes, scanTypeKey(ev.ScanType)) {
+		return false
+	}
+	if len(c.ports) > 0 && !c.ports.Contains(ev.Port) {
+		return false
+	}
+	if c.severity != "" && severityRanks[ev.severity()] < severityRanks[c.severity] {
+		return false
+	}
+	if len(c.countries) > 0 && containsString(c.countries, ev.Country) == c.notCountry {
+		return false
+	}
+	return ev.Alarms >= c.minAlarms && ev.Score >= c.minScore
+}
+
+func (c *responderCond) String() string {
+	var s []string
+	if len(c.protos) > 0 {
+		s = append(s, "proto:"+strings.Join(c.protos, ","))
+	}
+	if len(c.ports) > 0 {
+		s = append(s, "port:"+c.ports.String())
+	}
+	if len(c.scanTypes) > 0 {
+		s = append(s, "scan_type:"+strings.Join(c.scanTypes, ","))
+	}
+	if c.minAlarms > 0 {
+		s = append(s, "alarms:"+strconv.Itoa(c.minAlarms))
+	}
+	if c.minScore > 0 {
+		s = append(s, "score:"+strconv.Itoa(c.minScore))
+	}
+	if len(c.countries) > 0 {
+		not := ""
+		if c.notCountry {
+			not = "!"
+		}
+		s = append(s, "country:"+not+strings.Join(c.countries, ","))
+	}
+	if c.severity != "" {
+		s = append(s, "severity:"+c.severity)
+	}
+	return strings.Join(s, " ")
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// responder blocks that exec commands, disabled with kill_route and kill_run_cmd in strict seccomp and chroot
+func hasExecResponders() bool {
+	for _, conf := range cfgResponders {
+		if conf.enabled && (conf.kind == "cmd" || conf.kind == "plugin") {
+			return true
+		}
+	}
+	return false
+}
+
+func disableExecResponders() {
+	for _, conf := range cfgResponders {
+		if conf.kind == "cmd" || conf.kind == "plugin" {
+			conf.enabled = false
+		}
+	}
+}
+
+// build responders from config
+// commands, firewalls and cloud apis, then plugins and responder blocks, notify url last
+// kill_route, kill_run_cmd and kill_notify_url are aliases of cmd and url responders with their names
+func setupResponders() {
+	responders = nil
+	for _, conf := range cfgResponders {
+		builtin := containsString(builtinResponders, conf.name)
+		switch {
+		case builtin && conf.kind != "":
+			logMain(true, "responder %s, %s is a built-in responder, it has no type", conf.name, conf.name)
+		case !builtin && conf.kind == "":
+			logMain(true, "responder %s, type is not set", conf.name)
+		case (conf.kind == "cmd" || conf.kind == "plugin") && conf.command == "":
+			logMain(true, "responder %s, command is not set", conf.name)
+		case conf.kind == "url" && conf.url == "":
+			logMain(true, "responder %s, url is not set", conf.name)
+		}
+		if len(conf.when.countries) > 0 && cfgCountryDb == "" {
+			logMain(false, "WARNING responder %s, country conditions need country_db", conf.name)
+		}
+		for _, p := range cfgPlugins {
+			if p.name == conf.name && conf.kind != "" {
+				logMain(true, "responder %s, name is taken by a responder_plugin", conf.name)
+			}
+		}
+	}
+
+	add := func(r responder) {
+		if conf, ok := cfgResponderConf[r.Name()]; !ok || conf.enabled {
+			responders = append(responders, r)
+		}
+	}
+	addCmd := func(name string, commands []string, undo []string) {
+		if len(undo) > 0 {
+			add(&undoCmdResponder{cmdResponder{name, commands}, undo})
+		} else {
+			add(&cmdResponder{name, commands})
+		}
+	}
+	if len(cfgKillRoute) > 0 {
+		addCmd("kill_route", cfgKillRoute, cfgKillRouteUndo)
+	}
+	if len(cfgKillRunCmd) > 0 {
+		addCmd("kill_run_cmd", cfgKillRunCmd, cfgKillRunCmdUndo)
+	}
+	if cfgWindowsFirewall {
+		add(windowsFirewallResponder{})
+	}
+	if cfgPfTable != "" {
+		r := &pfResponder{}
+		r.batch = newFwBatch(r, func(ctx context.Context, ops []fwOp) error {
+			return pfTableAdd(ctx, cfgPfTable, addedIps(ops))
+		})
+		add(r)
+	}
+	if cfgFirewalldZone != "" || cfgFirewalldIPSet != "" {
+		r := &firewalldResponder{}
+		r.batch = newFwBatch(r, func(_ context.Context, ops []fwOp) error {
+			return firewalldBlock(cfgFirewalldZone, cfgFirewalldIPSet, cfgFirewalldPerm, addedIps(ops))
+		})
+		add(r)
+	}
+	if cfgNftSet != "" {
+		r := &nftResponder{}
+		r.batch = newFwBatch(r, nftApply)
+		add(r)
+	}
+	if cfgFw4Set != "" {
+		r := &fw4Responder{}
+		r.batch = newFwBatch(r, fw4Apply)
+		add(r)
+	}
+	if cfgIpset != "" {
+		r := &ipsetResponder{}
+		r.batch = newFwBatch(r, ipsetApply)
+		add(r)
+	}
+	if cfgFail2banJail != "" {
+		add(fail2banResponder{})
+	}
+	if len(cfgXdpInterfaces) > 0 {
+		add(xdpResponder{})
+	}
+	if cfgBlackholeRoute != "" {
+		add(blackholeRouteResponder{})
+	}
+	// after the responders blocking the host, so its flows can't come back
+	if cfgConntrackFlush {
+		add(conntrackResponder{})
+	}
+	if cfgAwsNaclId != "" {
+		add(awsNaclResponder{})
+	}
+	if cfgCloudflareToken != "" {
+		add(cloudflareResponder{})
+	}
+	if cfgKubeBlocklist != "" {
+		r := &kubeResponder{}
+		r.batch = newFwBatch(r, kubeApply)
+		add(r)
+	}
+	for _, p := range cfgPlugins {
+		add(p)
+	}
+	for _, conf := range cfgResponders {
+		switch conf.kind {
+		case "cmd":
+			add(&cmdResponder{conf.name, []string{conf.command}})
+		case "url":
+			add(&urlResponder{conf.name, conf.url})
+		case "plugin":
+			add(&pluginResponder{name: conf.name, command: conf.command})
+		}
+	}
+	if cfgKillNotifyUrl != "" {
+		add(&urlResponder{"kill_notify_url", cfgKillNotifyUrl})
+	}
+	orderResponders()
+}
+
+// move responders of responder_order to the front, in that order
+// names not configured are only warned about, a policy may still name them
+func orderResponders() {
+	var ordered []responder
+	for _, name := range cfgResponderOrder {
+		found := false
+		for i, r := range responders {
+			if r != nil && r.Name() == name {
+				ordered = append(ordered, r)
+				responders[i] = nil
+				found = true
+			}
+		}
+		if !found {
+			logMain(false, "WARNING responder_order, responder %s is not configured", name)
+		}
+	}
+	for _, r := range responders {
+		if r != nil {
+			ordered = append(ordered, r)
+		}
+	}
+	responders = ordered
+}
+
+// block settings of r
+func responderConfFor(r responder) *responderConf {
+	if conf, ok := cfgResponderConf[r.Name()]; ok {
+		return conf
+	}
+	return defaultResponderConf
+}
+
+// if r runs for ev, by policy decision, the active profile and the conditions of its block
+// responders of response stages only run for their stage, or if ev names them
+func responderWants(r responder, ev *event) bool {
+	if len(ev.Responders) == 0 && isStageResponder(r.Name()) {
+		return false
+	}
+	return ev.wants(r.Name()) && profileAllows(r.Name()) && responderConfFor(r).when.match(ev)
+}
+
+// seconds r may run, commands without their own timeout get cmd_timeout
+func responderTimeout(r responder, conf *responderConf) int {
+	if conf.timeout > 0 {
+		return conf.timeout
+	}
+	switch r.(type) {
+	case *cmdResponder, *undoCmdResponder, *pluginResponder:
+		return cfgCmdTimeout
+	}
+	return 0
+}
+
+// run r for ev, again after a growing delay while it fails if on_failure is retry
+func runResponder(r responder, ev *event) error {
+	conf := responderConfFor(r)
+	attempts := 1
+	if conf.onFailure == responderRetry {
+		attempts += conf.retries
+	}
+	delay := time.Duration(conf.retryDelay) * time.Second
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		begin := time.Now()
+		ctx, cancel := context.WithCancel(context.Background())
+		if timeout := responderTimeout(r, conf); timeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+		}
+		ctx, output := withAuditOutput(ctx)
+		err = r.Block(ctx, ev)
+		cancel()
+		auditResponder(r, "block", ev.Host, r.Describe(ev), i+1, begin, err, output)
+		statsdTiming("responder."+r.Name(), time.Since(begin))
+		noteResponderResult(err != nil)
+		if err == nil {
+			return nil
+		}
+		logMain(false, "responder %s, host:%s:%d failed (attempt %d/%d):%s", r.Name(), ev.Host, ev.Port, i+1, attempts, err.Error())
+	}
+	statsAdd(&stats.respFailed)
+	reportError("responder", "", "responder %s failed:%s", r.Name(), err.Error())
+	return err
+}
+
+// names of responders that run for ev
+func wantedResponders(ev *event) []string {
+	var names []string
+	for _, r := range responders {
+		if responderWants(r, ev) {
+			names = append(names, r.Name())
+		}
+	}
+	return names
+}
+
+// run responders for a blocked host in background, false if the responder queue is full
+// sequential mode runs them one after another, a failed responder with on_failure = abort
+// stops the chain; concurrent mode runs them all at once and on_failure = abort has no effect
+func runResponders(ev *event) bool {
+	if len(responders) == 0 {
+		return true
+	}
+	if cfgAction == "log_only" {
+		for _, r := range responders {
+			if !responderWants(r, ev) {
+				continue
+			}
+			logMain(false, "dry run: responder %s would %s", r.Name(), r.Describe(ev))
+		}
+		return true
+	}
+	start := time.Now()
+	return queueResponderJob("block host:"+ev.Host, func() {
+		var wg sync.WaitGroup
+		for _, r := range responders {
+			if !responderWants(r, ev) {
+				continue
+			}
+			if cfgResponderMode == responderConcurrent {
+				wg.Add(1)
+				go func(r responder) {
+					defer wg.Done()
+					runResponder(r, ev)
+				}(r)
+				continue
+			}
+			if err := runResponder(r, ev); err != nil && responderConfFor(r).onFailure == responderAbort {
+				logMain(false, "responder %s failed, responders after it are skipped for host:%s", r.Name(), ev.Host)
+				break
+			}
+		}
+		wg.Wait()
+		statsdTiming("responder_latency", time.Since(start))
+	})
+}
+
+// undo blocks of responders that support it, when a block expires
+func runUnblockers(ip string) {
+	var unblockers []responder
+	for _, r := range responders {
+		if _, ok := r.(unblocker); ok {
+			unblockers = append(unblockers, r)
+		}
+	}
+	if len(unblockers) == 0 {
+		return
+	}
+	if cfgAction == "log_only" {
+		logMain(false, "dry run: would unblock host:%s", ip)
+		return
+	}
+	queueResponderJob("unblock host:"+ip, func() {
+		for _, r := range unblockers {
+			begin := time.Now()
+			err := r.(unblocker).Unblock(ip)
+			auditResponder(r, "unblock", ip, "unblock "+ip, 0, begin, err, nil)
+			if err != nil {
+				logMain(false, "responder %s, unblock host:%s failed:%s", r.Name(), ip, err.Error())
+				statsAdd(&stats.respFailed)
+				reportError("responder", "", "responder %s, unblock failed:%s", r.Name(), err.Error())
+			}
+		}
+	})
+}
+
+// responder chains of blocks and unblocks run on responder_workers workers, so a mass scan
+// can't fork thousands of commands at once; up to responder_queue more wait their turn,
+// jobs beyond that are dropped, logged and counted as responder_dropped; a host whose block
+// is dropped isn't kept as blocked, so its next probe blocks it again
+var (
+	responderJobs     chan func()
+	responderJobsOnce sync.Once
+)
+
+// false if the job was dropped
+func queueResponderJob(what string, job func()) bool {
+	responderJobsOnce.Do(func() {
+		responderJobs = make(chan func(), cfgResponderQueue)
+		workers := cfgResponderWorkers
+		if workers <= 0 {
+			workers = 1
+		}
+		for i := 0; i < workers; i++ {
+			go func() {
+				for job := range responderJobs {
+					runResponderJob(job)
+					responderWg.Done()
+				}
+			}()
+		}
+	})
+
+	responderWg.Add(1)
+	select {
+	case responderJobs <- job:
+		return true
+	default:
+		responderWg.Done()
+		statsAdd(&stats.respDropped)
+		logMain(false, "responder queue is full, %s dropped, raise responder_workers or responder_queue", what)
+		return false
+	}
+}
+
+// a panicking responder fails its job, not the worker
+func runResponderJob(job func()) {
+	defer recoverPanic("responder job")
+	job()
+}
@@ -0,0 +1,145 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// responder test
+// test-responders fires the responder chain for a made up block of ip and port, 192.0.2.1:23 by
+// default, to check kill_route, notify urls and firewalls work before a real scan does; the
+// block isn't recorded, logged as blocked or sent to event sinks, the scan type is "responder
+// test" and plugins get "test":true; responders run one after another whatever responder_mode
+// is, once, firewall batches are applied right away, and responders that can unblock undo their
+// block after, the others leave it to be removed by hand
+// each result is reported back: what the responder did, ok, failed or skipped, and the undo
+// the whole test gets responderTestTimeout, each responder the time left at most; responders whose
+// turn comes after that are skipped, so the result gets back to the caller waiting for it
+
+const (
+	scanTypeResponderTest = "responder test"
+	responderTestTimeout  = 2 * time.Minute
+)
+
+type responderTestResult struct {
+	Responder string `json:"responder"`
+	Action    string `json:"action"`
+	Status    string `json:"status"` // ok, failed or skipped
+	Error     string `json:"error,omitempty"`
+	Millis    int64  `json:"ms"`
+	Undo      string `json:"undo,omitempty"` // ok, failed: <error>, or by hand
+}
+
+// firewall batch of r, nil if it has none
+func responderBatch(r responder) *fwBatch {
+	switch r := r.(type) {
+	case *pfResponder:
+		return r.batch
+	case *firewalldResponder:
+		return r.batch
+	case *nftResponder:
+		return r.batch
+	case *fw4Responder:
+		return r.batch
+	case *ipsetResponder:
+		return r.batch
+	case *kubeResponder:
+		return r.batch
+	}
+	return nil
+}
+
+// test-responders <ip> <port>
+func controlTestResponders(args []string) (interface{}, error) {
+	if len(args) != 2 || net.ParseIP(args[0]) == nil || net.ParseIP(args[0]).To4() == nil {
+		return nil, errors.New("usage: test-responders <ipv4> <port>")
+	}
+	port, err := strconv.Atoi(args[1])
+	if err != nil || port < 0 || port > 65535 {
+		return nil, errors.New("invalid port " + args[1])
+	}
+	ip := net.ParseIP(args[0]).String()
+	if isBlockedIP(ip) {
+		return nil, errors.New(ip + " is blocked, undoing the test would lift its block")
+	}
+	if len(responders) == 0 {
+		return nil, errors.New("no responder is configured")
+	}
+	return testResponders(ip, port), nil
+}
+
+func testResponders(ip string, port int) []*responderTestResult {
+	now := time.Now()
+	ev := &event{Time: now, Kind: eventBlock, Host: ip, Port: port, Proto: strings.ToUpper(*mode),
+		ScanType: scanTypeResponderTest, Alarms: 1, Offense: 1, Ports: []int{port}, FirstSeen: now, LastSeen: now, Test: true}
+	logMain(false, "responder test for host:%s port:%d", ip, port)
+	deadline := now.Add(responderTestTimeout)
+	var results []*responderTestResult
+	for _, r := range responders {
+		res := &responderTestResult{Responder: r.Name(), Action: r.Describe(ev)}
+		results = append(results, res)
+		if !time.Now().Before(deadline) {
+			res.Status, res.Error = "skipped", "out of time"
+			logMain(false, "responder test: %s skipped, the test ran for %s", r.Name(), responderTestTimeout)
+			continue
+		}
+		if !responderWants(r, ev) {
+			res.Status = "skipped"
+			logMain(false, "responder test: %s skipped by its conditions or the profile", r.Name())
+			continue
+		}
+		begin := time.Now()
+		err := testResponder(r, ev, false, deadline)
+		res.Millis = time.Since(begin).Milliseconds()
+		if err != nil {
+			res.Status, res.Error = "failed", err.Error()
+			logMain(false, "responder test: %s failed:%s", r.Name(), err.Error())
+			continue
+		}
+		res.Status = "ok"
+		logMain(false, "responder test: %s ok", r.Name())
+		if _, ok := r.(unblocker); !ok || !time.Now().Before(deadline) {
+			res.Undo = "by hand"
+		} else if err := testResponder(r, ev, true, deadline); err != nil {
+			res.Undo = "failed: " + err.Error()
+		} else {
+			res.Undo = "ok"
+		}
+	}
+	return results
+}
+
+// run r once for test event ev, or undo it, with its timeout up to deadline and audited
+func testResponder(r responder, ev *event, undo bool, deadline time.Time) error {
+	conf := responderConfFor(r)
+	begin := time.Now()
+	if timeout := responderTimeout(r, conf); timeout > 0 && begin.Add(time.Duration(timeout)*time.Second).Before(deadline) {
+		deadline = begin.Add(time.Duration(timeout) * time.Second)
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	ctx, output := withAuditOutput(ctx)
+	action, command := "test", r.Describe(ev)
+	var err error
+	switch b := responderBatch(r); {
+	case b != nil:
+		err = b.apply(ctx, []fwOp{{ip: ev.Host, del: undo}})
+	case undo:
+		err = r.(unblocker).Unblock(ev.Host)
+	default:
+		err = r.Block(ctx, ev)
+	}
+	if undo {
+		action, command = "test undo", "unblock "+ev.Host
+	}
+	auditResponder(r, action, ev.Host, command, 1, begin, err, output)
+	return err
+}
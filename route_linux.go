@@ -0,0 +1,136 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// routes added by portguard carry this protocol, so they're told apart from the others
+// when routes are synced at start; shown as "proto 153" by ip route
+const routeProtoPortguard = 153
+
+var blackholeRouteTypes = map[string]uint8{
+	"blackhole":   syscall.RTN_BLACKHOLE,
+	"unreachable": syscall.RTN_UNREACHABLE,
+	"prohibit":    syscall.RTN_PROHIBIT,
+}
+
+// rtmsg and attributes of the route to ip
+func blackholeRouteMsg(ip net.IP) []byte {
+	table := uint8(cfgBlackholeRouteTable)
+	if cfgBlackholeRouteTable > 255 {
+		table = syscall.RT_TABLE_COMPAT
+	}
+	// family, dst_len, src_len, tos, table, protocol, scope, type, flags
+	body := []byte{syscall.AF_INET, 32, 0, 0, table, routeProtoPortguard, syscall.RT_SCOPE_UNIVERSE,
+		blackholeRouteTypes[cfgBlackholeRoute], 0, 0, 0, 0}
+	body = netlinkAttr(body, syscall.RTA_DST, ip.To4())
+	return netlinkAttr(body, syscall.RTA_TABLE, netlinkUint32(uint32(cfgBlackholeRouteTable)))
+}
+
+// add or replace the route, so blocking a host twice is not an error
+func blackholeRouteAdd(ip string) error {
+	ip4 := net.ParseIP(ip).To4()
+	if ip4 == nil {
+		return errors.New("not an ipv4 address")
+	}
+	return netlinkRequest(syscall.NETLINK_ROUTE, syscall.RTM_NEWROUTE, syscall.NLM_F_CREATE|syscall.NLM_F_REPLACE, blackholeRouteMsg(ip4))
+}
+
+func blackholeRouteDelete(ip string) error {
+	ip4 := net.ParseIP(ip).To4()
+	if ip4 == nil {
+		return errors.New("not an ipv4 address")
+	}
+	err := netlinkRequest(syscall.NETLINK_ROUTE, syscall.RTM_DELROUTE, 0, blackholeRouteMsg(ip4))
+	if err == syscall.ESRCH {
+		return nil
+	}
+	return err
+}
+
+// destinations of routes portguard added to blackhole_route_table
+func blackholeRoutes() ([]string, error) {
+	data, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, syscall.AF_INET)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	for i := range msgs {
+		m := &msgs[i]
+		if m.Header.Type != syscall.RTM_NEWROUTE || len(m.Data) < syscall.SizeofRtMsg {
+			continue
+		}
+		// dst_len and protocol of rtmsg
+		if m.Data[1] != 32 || m.Data[5] != routeProtoPortguard {
+			continue
+		}
+		attrs, err := syscall.ParseNetlinkRouteAttr(m)
+		if err != nil {
+			continue
+		}
+		var dst net.IP
+		table := uint32(m.Data[4])
+		for _, a := range attrs {
+			switch a.Attr.Type {
+			case syscall.RTA_DST:
+				dst = net.IP(a.Value)
+			case syscall.RTA_TABLE:
+				if len(a.Value) == 4 {
+					table = binary.NativeEndian.Uint32(a.Value)
+				}
+			}
+		}
+		if dst != nil && table == uint32(cfgBlackholeRouteTable) {
+			ips = append(ips, dst.String())
+		}
+	}
+	return ips, nil
+}
+
+// routes don't survive a reboot: add routes of blocks restored from state_file and
+// delete routes of blocks that expired while portguard was stopped
+func syncBlackholeRoutes() error {
+	routes, err := blackholeRoutes()
+	if err != nil {
+		return err
+	}
+	stateLock.Lock()
+	blocked := make(map[string]bool, len(blockedAt))
+	for ip := range blockedAt {
+		blocked[ip] = true
+	}
+	stateLock.Unlock()
+
+	removed := 0
+	for _, ip := range routes {
+		if blocked[ip] {
+			delete(blocked, ip)
+			continue
+		}
+		if err := blackholeRouteDelete(ip); err != nil {
+			logMain(false, "delete %s route to %s failed:%s", cfgBlackholeRoute, ip, err.Error())
+			continue
+		}
+		removed++
+	}
+	for ip := range blocked {
+		if err := blackholeRouteAdd(ip); err != nil {
+			logMain(false, "add %s route to %s failed:%s", cfgBlackholeRoute, ip, err.Error())
+		}
+	}
+	if removed > 0 || len(blocked) > 0 {
+		logMain(false, "synced %s routes, %d added, %d removed", cfgBlackholeRoute, len(blocked), removed)
+	}
+	return nil
+}
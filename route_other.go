@@ -0,0 +1,15 @@
+//go:build !linux
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import "errors"
+
+var errNoBlackholeRoute = errors.New("blackhole_route is only supported on linux")
+
+func blackholeRouteAdd(ip string) error    { return errNoBlackholeRoute }
+func blackholeRouteDelete(ip string) error { return errNoBlackholeRoute }
+func syncBlackholeRoutes() error           { return errNoBlackholeRoute }
@@ -0,0 +1,92 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// portguard scan: probe a host running portguard from another machine, to check alarms,
+// the block and responders end to end without nmap
+// tcp probes are sent from a raw socket, so scanning needs root or CAP_NET_RAW
+
+// tcp flags of scan types, udp sends datagrams
+var scanFlags = map[string]uint8{
+	"syn":  SYN,
+	"null": 0,
+	"xmas": FIN | PSH | URG,
+}
+
+const scanPayload = "portguard scan"
+
+func runScan(target string, scanType string, ports string, rate int) error {
+	dst := net.ParseIP(target).To4()
+	if dst == nil {
+		addrs, err := net.LookupIP(target)
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			if dst = addr.To4(); dst != nil {
+				break
+			}
+		}
+		if dst == nil {
+			return fmt.Errorf("%s has no ipv4 address", target)
+		}
+	}
+	flags, tcp := scanFlags[scanType]
+	if !tcp && scanType != "udp" {
+		return fmt.Errorf("unknown scan type %s, should be syn, null, xmas or udp", scanType)
+	}
+	var set portSet
+	parsePorts(0, "ports", ports, &set)
+	if rate <= 0 {
+		return fmt.Errorf("invalid rate %d", rate)
+	}
+	src, err := sourceAddr(dst)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	start := time.Now()
+	tick := time.NewTicker(time.Second / time.Duration(rate))
+	defer tick.Stop()
+	for _, r := range set {
+		for port := r.min; port <= r.max; port++ {
+			if port == 0 {
+				continue
+			}
+			<-tick.C
+			if tcp {
+				err = sendTcpProbe(src, dst, port, flags)
+			} else {
+				err = sendUdpProbe(dst, port, scanPayload)
+			}
+			if err != nil {
+				return fmt.Errorf("probe %s port %d failed:%s", dst, port, err.Error())
+			}
+			count++
+		}
+	}
+	fmt.Printf("sent %d %s probes from %s to %s ports %s in %s\n", count, strings.ToUpper(scanType), src, dst,
+		set.String(), time.Since(start).Truncate(time.Millisecond))
+	fmt.Printf("check the alarm and blocked logs of %s for %s\n", dst, src)
+	return nil
+}
+
+// local address the route to dst goes out from
+func sourceAddr(dst net.IP) (net.IP, error) {
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: dst, Port: 9})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.To4(), nil
+}
@@ -0,0 +1,92 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// reputation oracle
+// other local services, e.g. an ssh rate limiter or a waf, ask portguard about a client before
+// accepting it: GET /score/1.2.3.4 returns what the host command of control_socket does, without
+// the reputation_url lookup, and a verdict; ?days=N adds N days of event_db history
+// it's secured like the other http endpoints, see http api security
+//	ignored     in ignore_host or a local address
+//	trusted     trusted for now
+//	blocked     blocked, or its score reached the block threshold
+//	suspicious  it probed, not enough to block
+//	clean       nothing known about it
+
+const (
+	verdictIgnored    = "ignored"
+	verdictTrusted    = "trusted"
+	verdictBlocked    = "blocked"
+	verdictSuspicious = "suspicious"
+	verdictClean      = "clean"
+
+	// most days of history a query may ask for
+	scoreMaxDays = 365
+)
+
+var cfgScoreAddr string
+
+type scoreReply struct {
+	*hostInfo
+	Verdict string `json:"verdict"`
+}
+
+func hostVerdict(ip net.IP, info *hostInfo) string {
+	switch {
+	case isIgnoredIP(ip):
+		return verdictIgnored
+	case info.TrustedUntil != nil:
+		return verdictTrusted
+	case info.Blocked || (info.Tracked && info.Score >= info.BlockScore):
+		return verdictBlocked
+	case info.Tracked:
+		return verdictSuspicious
+	}
+	return verdictClean
+}
+
+// GET /score/<ipv4>[?days=N]
+func serveScore(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ip := net.ParseIP(strings.TrimPrefix(req.URL.Path, "/score/")).To4()
+	if ip == nil {
+		http.Error(w, "usage: /score/<ipv4>[?days=N]", http.StatusBadRequest)
+		return
+	}
+	days := 0
+	if v := req.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > scoreMaxDays {
+			http.Error(w, "invalid days "+v, http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	info, err := lookupHost(ip.String(), days)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&scoreReply{info, hostVerdict(ip, info)})
+}
+
+// listen before chroot and dropping privileges, like health_addr
+func startScore() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/score/", serveScore)
+	return serveHttpApi(cfgScoreAddr, mux)
+}
@@ -0,0 +1,188 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// scoring models of hosts
+// ports: a host is blocked when the weight of its distinct probed ports exceeds scan_trigger
+// weighted: every new probed port adds port weight times scan type weight, plus rate_weight
+// if it came within rate_interval of the host's previous probe, plus reputation_weight if
+// the host's reputation is malicious; blocked at block_score
+const (
+	scoringPorts    = "ports"
+	scoringWeighted = "weighted"
+)
+
+var (
+	scores     map[string]int   // weighted score of ip, guarded by stateLock
+	lastProbe  map[string]int64 // unix nano of ip's last probe, guarded by stateLock
+	firstProbe map[string]int64 // unix nano of ip's first probe, guarded by stateLock
+
+	scanTypeWeights  = make(map[string]int)
+	scanTypeActions  = map[string]string{"amplification": policyAlarm, "arp": policyAlarm} // the source is often spoofed
+	scanTypeTriggers = make(map[string]int)
+
+	// distinct ports ip probed with a scan type of scan_type_trigger, guarded by stateLock
+	scanTypePorts map[string]map[string]int
+)
+
+func init() {
+	scores = make(map[string]int)
+	lastProbe = make(map[string]int64)
+	firstProbe = make(map[string]int64)
+	scanTypePorts = make(map[string]map[string]int)
+}
+
+// short name of a scan type, used by scan_type_weight
+func scanTypeKey(scanType string) string {
+	switch scanType {
+	case tcpPacketTypeSYN:
+		return "syn"
+	case tcpPacketTypeNull:
+		return "null"
+	case tcpPacketTypeXMAS:
+		return "xmas"
+	case "UDP scan":
+		return "udp"
+	case udpPacketTypeAmplification:
+		return "amplification"
+	case arpPacketTypeSweep:
+		return "arp"
+	case tcpPacketTypeConnect:
+		return "connect"
+	}
+	return "other"
+}
+
+// split "syn|null|xmas|udp|amplification|arp|connect|other arg"
+func parseScanTypeValue(lineno int, token string, value string, what string) (string, string) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		logMain(true, "line %d:%s, invalid value:%s, should be scan type and %s", lineno, token, value, what)
+	}
+	switch fields[0] {
+	case "syn", "null", "xmas", "udp", "amplification", "arp", "connect", "other":
+	default:
+		logMain(true, "line %d:%s, unknown scan type:%s, should be syn, null, xmas, udp, amplification, arp, connect or other", lineno, token, fields[0])
+	}
+	return fields[0], fields[1]
+}
+
+// scan_type_weight = syn|null|xmas|udp|amplification|arp|connect|other weight
+func parseScanTypeWeight(lineno int, token string, value string) {
+	key, weight := parseScanTypeValue(lineno, token, value, "weight")
+	scanTypeWeights[key] = parseInt(lineno, token, weight)
+}
+
+// scan_type_action = syn|null|xmas|udp|amplification|arp|connect|other block|alarm|ignore|default
+func parseScanTypeAction(lineno int, token string, value string) {
+	key, action := parseScanTypeValue(lineno, token, value, "action")
+	switch action {
+	case policyBlock, policyAlarm, policyIgnore, policyDefault:
+	default:
+		logMain(true, "line %d:%s, unknown action:%s, should be block, alarm, ignore or default", lineno, token, action)
+	}
+	scanTypeActions[key] = action
+}
+
+// scan_type_trigger = syn|null|xmas|udp|amplification|arp|connect|other trigger
+func parseScanTypeTrigger(lineno int, token string, value string) {
+	key, trigger := parseScanTypeValue(lineno, token, value, "trigger")
+	scanTypeTriggers[key] = parseInt(lineno, token, trigger)
+}
+
+// decision of scan_type_action for ev
+func scanTypePolicy(ev *event) string {
+	if action, ok := scanTypeActions[scanTypeKey(ev.ScanType)]; ok {
+		return action
+	}
+	return policyDefault
+}
+
+// ip probed more distinct ports with scanType than its scan_type_trigger, stateLock must be held
+func scanTypeTriggered(ip string, scanType string) bool {
+	key := scanTypeKey(scanType)
+	trigger, ok := scanTypeTriggers[key]
+	return ok && scanTypePorts[ip][key] > trigger
+}
+
+func scanTypeWeight(scanType string) int {
+	if w, ok := scanTypeWeights[scanTypeKey(scanType)]; ok {
+		return w
+	}
+	return 1
+}
+
+// score a new probed port adds, without the rate bonus
+func probeScore(port int, scanType string) int {
+	if cfgScoring == scoringWeighted {
+		return portWeight(port) * scanTypeWeight(scanType)
+	}
+	return portWeight(port)
+}
+
+// score at which a host is blocked, by the active profile if it sets one
+func blockThreshold() int {
+	if p := currentProfile(); p != nil {
+		switch {
+		case cfgScoring == scoringWeighted && p.blockScore > 0:
+			return p.blockScore
+		case p.scanTrigger > 0:
+			return p.scanTrigger + 1
+		}
+	}
+	if cfgScoring == scoringWeighted {
+		return cfgBlockScore
+	}
+	return cfgScanTrigger + 1
+}
+
+// current score of ip, stateLock must be held
+func hostScore(ip string) int {
+	if cfgScoring == scoringWeighted {
+		return scores[ip]
+	}
+	return stateWeight(stateEngine[ip])
+}
+
+// add a new probed port of ip to its score, stateLock must be held
+func addScore(ip string, port int, scanType string) {
+	now := time.Now().UnixNano()
+	last, ok := lastProbe[ip]
+	lastProbe[ip] = now
+	if !ok {
+		firstProbe[ip] = now
+	}
+	key := scanTypeKey(scanType)
+	if _, ok := scanTypeTriggers[key]; ok {
+		if scanTypePorts[ip] == nil {
+			scanTypePorts[ip] = make(map[string]int)
+		}
+		scanTypePorts[ip][key]++
+	}
+	if cfgScoring != scoringWeighted {
+		return
+	}
+	score := probeScore(port, scanType)
+	if ok && now-last < int64(cfgRateInterval)*int64(time.Millisecond) {
+		score += cfgRateWeight
+	}
+	if cfgReputationWeight > 0 && cfgReputationMalicious[reputationOf(ip)] {
+		score += cfgReputationWeight
+	}
+	scores[ip] += score
+}
+
+// forget ip's score, stateLock must be held
+func clearScore(ip string) {
+	delete(scores, ip)
+	delete(lastProbe, ip)
+	delete(firstProbe, ip)
+	delete(scanTypePorts, ip)
+}
@@ -0,0 +1,116 @@
+//go:build linux && (amd64 || arm64)
+
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// seccomp filter constants, see linux/seccomp.h
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+	seccompRetKillProcess  = 0x80000000
+	seccompRetErrno        = 0x00050000
+	seccompRetAllow        = 0x7fff0000
+
+	prSetNoNewPrivs = 38
+)
+
+// syscalls needed by go runtime, packet loop, smartVerify, loggers and notify url
+var seccompSyscalls = []uintptr{
+	// runtime
+	syscall.SYS_BRK, syscall.SYS_MMAP, syscall.SYS_MUNMAP, syscall.SYS_MPROTECT, syscall.SYS_MADVISE,
+	syscall.SYS_FUTEX, syscall.SYS_CLONE, syscall.SYS_SCHED_YIELD, syscall.SYS_SCHED_GETAFFINITY,
+	syscall.SYS_NANOSLEEP, syscall.SYS_CLOCK_GETTIME, syscall.SYS_GETTID, syscall.SYS_GETPID,
+	syscall.SYS_TGKILL, syscall.SYS_KILL, syscall.SYS_RT_SIGACTION, syscall.SYS_RT_SIGPROCMASK,
+	syscall.SYS_RT_SIGRETURN, syscall.SYS_SIGALTSTACK, syscall.SYS_EXIT, syscall.SYS_EXIT_GROUP,
+	syscall.SYS_SET_ROBUST_LIST, syscall.SYS_PRLIMIT64, syscall.SYS_GETRLIMIT, syscall.SYS_UNAME,
+	syscall.SYS_GETUID, syscall.SYS_GETEUID, syscall.SYS_GETGID, syscall.SYS_GETEGID, syscall.SYS_GETPPID,
+	syscall.SYS_EPOLL_CREATE1, syscall.SYS_EPOLL_CTL, syscall.SYS_EPOLL_PWAIT, syscall.SYS_EVENTFD2,
+	syscall.SYS_PIPE2, syscall.SYS_PPOLL,
+	// files
+	syscall.SYS_READ, syscall.SYS_WRITE, syscall.SYS_READV, syscall.SYS_WRITEV, syscall.SYS_PREAD64,
+	syscall.SYS_PWRITE64, syscall.SYS_CLOSE, syscall.SYS_OPENAT, syscall.SYS_FSTAT, syscall.SYS_LSEEK,
+	syscall.SYS_FCNTL, syscall.SYS_IOCTL, syscall.SYS_FSYNC, syscall.SYS_FDATASYNC, syscall.SYS_DUP3,
+	syscall.SYS_UNLINKAT, syscall.SYS_RENAMEAT, syscall.SYS_LINKAT, syscall.SYS_READLINKAT,
+	syscall.SYS_FACCESSAT, syscall.SYS_GETDENTS64, syscall.SYS_UMASK, syscall.SYS_UTIMENSAT,
+	// sockets
+	syscall.SYS_SOCKET, syscall.SYS_BIND, syscall.SYS_CONNECT, syscall.SYS_LISTEN, syscall.SYS_ACCEPT4,
+	syscall.SYS_SENDTO, syscall.SYS_RECVFROM, syscall.SYS_SENDMSG, syscall.SYS_RECVMSG,
+	syscall.SYS_SETSOCKOPT, syscall.SYS_GETSOCKOPT, syscall.SYS_GETSOCKNAME, syscall.SYS_GETPEERNAME,
+	syscall.SYS_SHUTDOWN,
+	// exec based responders
+	syscall.SYS_WAIT4, syscall.SYS_WAITID, syscall.SYS_SETPGID, syscall.SYS_SETSID, syscall.SYS_PRCTL,
+	syscall.SYS_CAPGET, syscall.SYS_CHDIR,
+}
+
+// only needed to exec external commands, not allowed in strict mode
+var seccompExecSyscalls = []uintptr{
+	syscall.SYS_EXECVE, sysExecveat,
+}
+
+// syscalls not in package syscall, same number on all architectures
+const (
+	sysPidfdSendSignal = 424
+	sysPidfdOpen       = 434
+	sysClone3          = 435
+	sysFaccessat2      = 439
+	sysEpollPwait2     = 441
+)
+
+// apply seccomp filter to all threads, unlisted syscalls fail with EPERM
+// in strict mode external commands can't be executed
+func applySeccomp(strict bool) error {
+	allowed := append([]uintptr{}, seccompSyscalls...)
+	allowed = append(allowed, archSyscalls...)
+	allowed = append(allowed, sysPidfdSendSignal, sysPidfdOpen, sysClone3, sysFaccessat2, sysEpollPwait2)
+	if !strict {
+		allowed = append(allowed, seccompExecSyscalls...)
+	}
+	if len(cfgXdpInterfaces) > 0 {
+		allowed = append(allowed, sysBpf)
+	}
+
+	filter := []syscall.SockFilter{
+		// kill if not native architecture, syscall numbers would be wrong
+		bpfStmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, 4),
+		bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, auditArch, 1, 0),
+		bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetKillProcess),
+		// syscall number
+		bpfStmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, 0),
+	}
+	for _, nr := range allowed {
+		filter = append(filter,
+			bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, uint32(nr), 0, 1),
+			bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetAllow))
+	}
+	filter = append(filter, bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetErrno|uint32(syscall.EPERM)))
+
+	prog := syscall.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+
+	// required to install a filter without CAP_SYS_ADMIN, tsync copies it to all threads
+	if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return errno
+	}
+	if _, _, errno := syscall.RawSyscall(sysSeccomp, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func bpfStmt(code uint16, k uint32) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, K: k}
+}
+
+func bpfJump(code uint16, k uint32, jt, jf uint8) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
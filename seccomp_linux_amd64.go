@@ -0,0 +1,26 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import "syscall"
+
+const (
+	auditArch   = 0xc000003e // AUDIT_ARCH_X86_64
+	sysSeccomp  = 317
+	sysExecveat = 322
+	sysBpf      = 321
+)
+
+// legacy syscalls still used on amd64
+var archSyscalls = []uintptr{
+	syscall.SYS_ARCH_PRCTL, syscall.SYS_OPEN, syscall.SYS_STAT, syscall.SYS_LSTAT,
+	syscall.SYS_NEWFSTATAT, syscall.SYS_POLL, syscall.SYS_EPOLL_WAIT, syscall.SYS_EPOLL_CREATE,
+	syscall.SYS_DUP2, syscall.SYS_PIPE, syscall.SYS_RENAME, syscall.SYS_UNLINK, syscall.SYS_ACCESS,
+	syscall.SYS_READLINK, syscall.SYS_VFORK, syscall.SYS_GETTIMEOFDAY, syscall.SYS_TIME,
+	syscall.SYS_CLOCK_NANOSLEEP, syscall.SYS_ACCEPT,
+	318, // getrandom
+	332, // statx
+	334, // rseq
+}
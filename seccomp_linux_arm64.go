@@ -0,0 +1,21 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import "syscall"
+
+const (
+	auditArch   = 0xc00000b7 // AUDIT_ARCH_AARCH64
+	sysSeccomp  = syscall.SYS_SECCOMP
+	sysExecveat = syscall.SYS_EXECVEAT
+	sysBpf      = syscall.SYS_BPF
+)
+
+var archSyscalls = []uintptr{
+	syscall.SYS_FSTATAT, syscall.SYS_CLOCK_NANOSLEEP, syscall.SYS_GETTIMEOFDAY,
+	syscall.SYS_GETRANDOM,
+	291, // statx
+	293, // rseq
+}
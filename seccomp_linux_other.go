@@ -0,0 +1,14 @@
+//go:build linux && !amd64 && !arm64
+
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import "errors"
+
+// seccomp is only supported on amd64 and arm64
+func applySeccomp(strict bool) error {
+	return errors.New("seccomp is not supported on this architecture")
+}
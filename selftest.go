@@ -0,0 +1,186 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const selftestTimeout = 5 * time.Second
+
+// collects alarm and blocked log lines while self testing
+type selftestLog struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *selftestLog) Write(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	return l.buf.Write(p)
+}
+
+// s is in the log, not followed by a digit, so port 21 doesn't match port 2121
+func (l *selftestLog) contains(s string) bool {
+	l.Lock()
+	defer l.Unlock()
+	text := l.buf.String()
+	for i := strings.Index(text, s); i >= 0; {
+		end := i + len(s)
+		if end == len(text) || text[end] < '0' || text[end] > '9' {
+			return true
+		}
+		next := strings.Index(text[end:], s)
+		if next < 0 {
+			break
+		}
+		i = end + next
+	}
+	return false
+}
+
+// closed ports, not excluded nor noisy, whose score is enough to block a host
+func selftestPorts(laddr net.IP) []int {
+	scanType := tcpPacketTypeSYN
+	if *mode == "udp" {
+		scanType = "UDP scan"
+	}
+	var ports []int
+	weight := 0
+	start := cfgMinPort + rand.Intn(cfgMaxPort-cfgMinPort+1)
+	for i := 0; i <= cfgMaxPort-cfgMinPort && weight < blockThreshold(); i++ {
+		port := cfgMinPort + (start-cfgMinPort+i)%(cfgMaxPort-cfgMinPort+1)
+		if port == 0 || isExlcudePort(port) || cfgNoisyTcpPorts.Contains(port) || cfgNoisyUdpPorts.Contains(port) {
+			continue
+		}
+		if smartVerifyPort(laddr, port) {
+			continue
+		}
+		ports = append(ports, port)
+		weight += probeScore(port, scanType)
+	}
+	if weight < blockThreshold() {
+		return nil
+	}
+	return ports
+}
+
+// send a tcp segment with flags from src to dst:port
+func sendTcpProbe(src net.IP, dst net.IP, port int, flags uint8) error {
+	conn, err := net.DialIP("ip4:tcp", &net.IPAddr{IP: src}, &net.IPAddr{IP: dst})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	tcp := TCPHeader{
+		Source:      uint16(40000 + rand.Intn(20000)),
+		Destination: uint16(port),
+		SeqNum:      rand.Uint32(),
+		DataOffset:  5,
+		Ctrl:        flags,
+		Window:      1024,
+	}
+	var srcAddr, dstAddr [4]byte
+	copy(srcAddr[:], src.To4())
+	copy(dstAddr[:], dst.To4())
+	tcp.Checksum = csum(tcp.Marshal(), srcAddr, dstAddr)
+	_, err = conn.Write(tcp.Marshal())
+	return err
+}
+
+func sendUdpProbe(dst net.IP, port int, payload string) error {
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: dst, Port: port})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(payload))
+	return err
+}
+
+// wait until line shows up in l
+func selftestWait(l *selftestLog, line string) bool {
+	deadline := time.Now().Add(selftestTimeout)
+	for time.Now().Before(deadline) {
+		if l.contains(line) {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
+
+// probe closed ports on the loopback address, and check that alarms and the block fire
+// tcp mode sends a NULL probe followed by SYN probes, udp mode sends datagrams
+// responders only log what they would run
+func selftest() bool {
+	laddr := net.IPv4(127, 0, 0, 1)
+	ok := true
+	report := func(pass bool, format string, a ...interface{}) {
+		result := "ok"
+		if !pass {
+			result = "FAILED"
+			ok = false
+		}
+		fmt.Printf("selftest: %s ... %s\n", fmt.Sprintf(format, a...), result)
+	}
+
+	ports := selftestPorts(laddr)
+	if ports == nil {
+		report(false, "find closed ports scoring %d in [%d, %d]", blockThreshold(), cfgMinPort, cfgMaxPort)
+		return false
+	}
+
+	// probes come from a local address, which is always ignored
+	cfgIgnoreIps = nil
+	localNets = []*net.IPNet{}
+	cfgAction = "log_only"
+	// probes come in a burst, the rate bonus would block the host before the last one
+	cfgRateWeight = 0
+	var l selftestLog
+	alarmLogger = log.New(&l, "", 0)
+	blockedLogger = log.New(&l, "", 0)
+
+	conn := listenGuard("ip4:"+*mode, "", laddr)
+	if *mode == "tcp" {
+		go tcpGuard(conn, laddr, "")
+	} else {
+		go udpGuard(conn, laddr, "")
+	}
+
+	src := laddr.String()
+	for i, port := range ports {
+		var err error
+		var probe string
+		if *mode == "udp" {
+			probe = "UDP"
+			err = sendUdpProbe(laddr, port, "portguard selftest")
+		} else if i == 0 {
+			probe = "NULL"
+			err = sendTcpProbe(laddr, laddr, port, 0)
+		} else {
+			probe = "SYN"
+			err = sendTcpProbe(laddr, laddr, port, SYN)
+		}
+		if err != nil {
+			report(false, "send %s probe to port %d: %s", probe, port, err.Error())
+			continue
+		}
+		line := fmt.Sprintf("from host: %s to %s port: %d", src, strings.ToUpper(*mode), port)
+		report(selftestWait(&l, line), "alarm for %s probe to port %d", probe, port)
+	}
+	report(selftestWait(&l, fmt.Sprintf("Host: %s Port:", src)), "block of host %s", src)
+
+	stopGuards()
+	return ok
+}
@@ -0,0 +1,120 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// service names
+// port lists, like exclude_port or trap_port, take iana service names and groups besides numbers,
+// e.g. "exclude_port = ssh,https" or "trap_port = telnet,windows"; exclude_service, trap_service,
+// noisy_udp_service, noisy_tcp_service and honeypot_service are the same keys by another name
+// port_group.<name> = <ports, services and groups> defines a group, before it's used
+// include_ports_file = <key> <file> adds the ports of a file to a port list key, one item or a
+// list per line, # starts a comment; the file is read with the config, a change needs a restart
+
+// iana service names, a few common aliases too; tcp and udp share a name unless noted
+var serviceTable = map[string]int{
+	"echo": 7, "discard": 9, "daytime": 13, "chargen": 19, "ftp-data": 20, "ftp": 21, "ssh": 22,
+	"telnet": 23, "smtp": 25, "time": 37, "whois": 43, "tacacs": 49, "domain": 53, "dns": 53,
+	"bootps": 67, "bootpc": 68, "tftp": 69, "gopher": 70, "finger": 79, "http": 80, "www": 80,
+	"kerberos": 88, "pop3": 110, "sunrpc": 111, "auth": 113, "ident": 113, "nntp": 119, "ntp": 123,
+	"epmap": 135, "netbios-ns": 137, "netbios-dgm": 138, "netbios-ssn": 139, "imap": 143, "snmp": 161,
+	"snmptrap": 162, "bgp": 179, "ldap": 389, "https": 443, "microsoft-ds": 445, "smb": 445,
+	"isakmp": 500, "syslog": 514, "printer": 515, "submission": 587, "ipp": 631, "ldaps": 636,
+	"rsync": 873, "imaps": 993, "pop3s": 995, "socks": 1080, "openvpn": 1194, "ms-sql-s": 1433,
+	"ms-sql-m": 1434, "oracle": 1521, "pptp": 1723, "radius": 1812, "radius-acct": 1813, "ssdp": 1900,
+	"nfs": 2049, "docker": 2375, "docker-s": 2376, "etcd-client": 2379, "mysql": 3306,
+	"ms-wbt-server": 3389, "rdp": 3389, "svn": 3690, "sip": 5060, "sips": 5061, "xmpp-client": 5222,
+	"mdns": 5353, "llmnr": 5355, "postgresql": 5432, "amqp": 5672, "rfb": 5900, "vnc": 5900,
+	"wsman": 5985, "wsmans": 5986, "x11": 6000, "redis": 6379, "ircu": 6667, "http-alt": 8080,
+	"https-alt": 8443, "elasticsearch": 9200, "memcache": 11211, "mongodb": 27017,
+}
+
+// groups of services, port_group adds more
+var portGroups = map[string]portSet{
+	"web":       servicePorts("http", "https", "http-alt", "https-alt"),
+	"mail":      servicePorts("smtp", "submission", "pop3", "pop3s", "imap", "imaps"),
+	"windows":   servicePorts("epmap", "netbios-ns", "netbios-dgm", "netbios-ssn", "microsoft-ds", "ms-wbt-server", "wsman", "wsmans"),
+	"databases": servicePorts("ms-sql-s", "oracle", "mysql", "postgresql", "redis", "memcache", "mongodb", "elasticsearch"),
+	"remote":    servicePorts("ssh", "telnet", "ms-wbt-server", "rfb", "x11"),
+	"legacy":    servicePorts("echo", "discard", "daytime", "chargen", "finger", "telnet", "tftp"),
+}
+
+// keys named by service that stand for a port list key
+var serviceKeys = map[string]string{
+	"exclude_service":   "exclude_port",
+	"trap_service":      "trap_port",
+	"noisy_udp_service": "noisy_udp_port",
+	"noisy_tcp_service": "noisy_tcp_port",
+	"honeypot_service":  "honeypot_port",
+}
+
+func servicePorts(names ...string) portSet {
+	var set portSet
+	for _, name := range names {
+		set.Add(serviceTable[name], serviceTable[name])
+	}
+	return set
+}
+
+// ports of a service or group name, false if it's neither
+func lookupService(name string) (portSet, bool) {
+	name = strings.ToLower(name)
+	if port, ok := serviceTable[name]; ok {
+		return portSet{{port, port}}, true
+	}
+	set, ok := portGroups[name]
+	return set, ok
+}
+
+// port_group.<name> = ports, services and groups
+func parsePortGroup(lineno int, token string, value string) {
+	name := strings.ToLower(strings.TrimPrefix(token, "port_group."))
+	if name == "" || strings.Contains(name, ".") {
+		logMain(true, "line %d:%s, invalid key, should be port_group.<name>", lineno, token)
+	}
+	if _, ok := serviceTable[name]; ok {
+		logMain(true, "line %d:%s, %s is a service name", lineno, token, name)
+	}
+	set := portGroups[name]
+	parsePorts(lineno, token, value, &set)
+	portGroups[name] = set
+}
+
+// include_ports_file = <key> <file>, lines of file are values of key
+func includePortsFile(lineno int, token string, value string) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		logMain(true, "line %d:%s, invalid value:%s, should be a port list key and a file", lineno, token, value)
+	}
+	key, file := fields[0], fields[1]
+	if k, ok := serviceKeys[key]; ok {
+		key = k
+	}
+	switch key {
+	case "exclude_port", "trap_port", "noisy_udp_port", "noisy_tcp_port", "honeypot_port":
+	default:
+		logMain(true, "line %d:%s, %s doesn't take a port list", lineno, token, key)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		logMain(true, "line %d:%s, open %s failed:%s", lineno, token, file, err.Error())
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line, _, _ := strings.Cut(s.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			setConfig(n, key, line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		logMain(true, "line %d:%s, read %s failed:%s", lineno, token, file, err.Error())
+	}
+}
@@ -0,0 +1,111 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// severity levels
+// every event has a severity:
+//   info      a probe of a noisy port, see noisy_udp_port and noisy_tcp_port
+//   warning   an alarm, a stage escalation or an ops event
+//   critical  a block, a probe of a trap_port or a fingerprinted scan
+// severity.<sink> = <level> passes only events of at least level to a sink, e.g. everything to
+// event_log but only criticals to chat; sinks are alarm_log, event_log, event_db, journald, otlp,
+// elastic, loki, ipfix, snmp, wazuh, misp, stix, ubus, event_socket, digest and report, each at
+// warning unless set
+// responders, like a webhook or chat plugin, run for blocks and stages only; a severity:critical
+// condition in responder.<name>.when keeps one to blocks
+// noisy probes only become events if some sink is at info, otherwise they are dropped as before
+
+const (
+	severityInfo     = "info"
+	severityWarning  = "warning"
+	severityCritical = "critical"
+
+	eventNoisy = "noisy"
+)
+
+var (
+	severityRanks = map[string]int{severityInfo: 0, severityWarning: 1, severityCritical: 2}
+
+	severitySinks = []string{"alarm_log", "event_log", "event_db", "journald", "otlp", "elastic", "loki", "ipfix", "snmp", "wazuh", "misp", "stix", "ubus", "event_socket", "digest", "report"}
+
+	cfgSinkSeverity = make(map[string]string) // sink -> least severity it takes, warning if not set
+)
+
+func parseSeverity(lineno int, token string, value string) string {
+	if _, ok := severityRanks[value]; !ok {
+		logMain(true, "line %d:%s, invalid value:%s, should be info, warning or critical", lineno, token, value)
+	}
+	return value
+}
+
+// severity.<sink> = level
+func parseSeverityKey(lineno int, token string, value string) {
+	sink := strings.TrimPrefix(token, "severity.")
+	if !containsString(severitySinks, sink) {
+		logMain(true, "line %d:%s, unknown sink %s, should be %s", lineno, token, sink, strings.Join(severitySinks, ", "))
+	}
+	cfgSinkSeverity[sink] = parseSeverity(lineno, token, value)
+}
+
+// severity of ev, see severity levels
+func (ev *event) severity() string {
+	switch {
+	case ev.Kind == eventNoisy:
+		return severityInfo
+	case ev.Kind == eventBlock, ev.Trap, ev.ScanType == tcpPacketTypeFingerprint:
+		return severityCritical
+	}
+	return severityWarning
+}
+
+func sinkSeverity(sink string) string {
+	if level, ok := cfgSinkSeverity[sink]; ok {
+		return level
+	}
+	return severityWarning
+}
+
+// if sink takes events of severity level
+func sinkWants(sink string, level string) bool {
+	return severityRanks[level] >= severityRanks[sinkSeverity(sink)]
+}
+
+// if any sink takes info events, set by checkSeverity
+var noisyEvents bool
+
+func checkSeverity() {
+	for _, sink := range severitySinks {
+		noisyEvents = noisyEvents || sinkWants(sink, severityInfo)
+	}
+}
+
+// make a probe of a noisy port an info event, if a sink takes them
+func noisyProbe(proto string, scanType string, flags uint8, laddr net.IP, hdr *IPv4Header, port int, vlan int, iface string) {
+	if !noisyEvents || isIgnoredIP(hdr.Source) {
+		return
+	}
+	ev := &event{Time: time.Now(), Kind: eventNoisy, Host: hdr.Source.String(), Port: port, Proto: proto, ScanType: scanType, Flags: flags, TTL: hdr.TTL, Laddr: laddr, VLAN: vlan, Iface: iface}
+	emitEvent(ev)
+	logHostAlarm(severityInfo, ev.Host, "attackalert: %s from host: %s to %s noisy port: %d%s", scanType, ev.Host, proto, port, ev.probe())
+}
+
+// sinks not at warning, for configEcho
+func severityString() string {
+	var s []string
+	for sink, level := range cfgSinkSeverity {
+		if level != severityWarning {
+			s = append(s, sink+":"+level)
+		}
+	}
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
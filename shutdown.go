@@ -0,0 +1,116 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	shutdown    = make(chan struct{}) // closed when portguard is stopping
+	guardConns  []packetConn
+	guardLock   sync.Mutex
+	responderWg sync.WaitGroup // queued and running responder jobs
+)
+
+// remember conn so stopGuards can interrupt its reader
+func registerGuard(conn packetConn) {
+	guardLock.Lock()
+	guardConns = append(guardConns, conn)
+	guardLock.Unlock()
+}
+
+func isShutdown() bool {
+	select {
+	case <-shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// close all guard sockets, blocked reads return and guard loops exit
+func stopGuards() {
+	close(shutdown)
+	guardLock.Lock()
+	defer guardLock.Unlock()
+	for _, conn := range guardConns {
+		conn.Close()
+	}
+}
+
+// wait for running external commands, at most timeout
+func waitResponders(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		responderWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func closeLogs() {
+	for _, w := range []io.Writer{cfgAlarmLog, cfgBlockedLog, cfgDigestLog, cfgAuditLog, cfgFail2banLog} {
+		if f, ok := w.(*os.File); ok {
+			f.Sync()
+			f.Close()
+		}
+	}
+	if eventLog != nil {
+		eventLog.Close()
+	}
+	eventDbLock.Lock()
+	if eventDb != nil {
+		eventDb.Sync()
+		eventDb.Close()
+		eventDb = nil
+	}
+	eventDbLock.Unlock()
+}
+
+// block until SIGTERM/SIGINT, then stop guards and clean up
+func waitSignal(guards *sync.WaitGroup) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-sigs
+	logMain(false, "received %s, shutting down", sig)
+	sdNotify("STOPPING=1")
+
+	stopGuards()
+	stopControl()
+	guards.Wait()
+	flushAlarmWindows(true)
+	policyLock.Lock()
+	stopPolicy()
+	policyLock.Unlock()
+	logMain(false, "%s", statsLine())
+
+	if !waitResponders(time.Duration(cfgShutdownTimeout) * time.Second) {
+		logMain(false, "WARNING external commands still running after %ds", cfgShutdownTimeout)
+	}
+	stopXdp()
+	closeEvidenceFiles()
+
+	if cfgStateFile != "" {
+		if err := saveState(chrootPath(cfgStateFile)); err != nil {
+			logMain(false, "save state to %s failed:%s", cfgStateFile, err.Error())
+		}
+	}
+	if cfgPidFile != "" {
+		removePidFile(chrootPath(cfgPidFile))
+	}
+	logMain(false, "+++++++++++++ portguard stopped +++++++++++++")
+	closeLogs()
+}
@@ -0,0 +1,317 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snmp traps of blocks, and of alarms with snmp_trap_alarms, to snmp_trap
+// v2c traps carry snmp_community, v3 traps are sent as snmp_user with the usm security model,
+// authenticated with md5 or sha and encrypted with aes if passwords are set; portguard is the
+// authoritative engine of its traps, receivers need its engine id, see snmp_engine_id
+//
+// trap oids are <snmp_enterprise_oid>.0.1 for blocks and .0.2 for alarms, with varbinds
+// <snmp_enterprise_oid>.1.1 source ip, .1.2 port, .1.3 protocol, .1.4 scan type and .1.5 alarm count
+
+// ber tags
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOid         = 0x06
+	berSequence    = 0x30
+	berIpAddress   = 0x40
+	berTimeTicks   = 0x43
+	berTrapV2      = 0xa7
+)
+
+const (
+	snmpFlagAuth = 1
+	snmpFlagPriv = 2
+	snmpUsm      = 3
+)
+
+var (
+	oidSysUpTime   = "1.3.6.1.2.1.1.3.0"
+	oidSnmpTrapOid = "1.3.6.1.6.3.1.1.4.1.0"
+)
+
+var (
+	snmpLock      sync.Mutex
+	snmpConn      net.Conn
+	snmpRequestId int32
+	snmpStart     = time.Now()
+	snmpEngineId  []byte
+	snmpAuthKey   []byte // localized to snmpEngineId
+	snmpPrivKey   []byte
+)
+
+// dial before chroot and localize v3 keys
+func openSnmp() error {
+	addr := cfgSnmpTrap
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "162")
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	if cfgSnmpVersion == "3" {
+		if err := snmpSetupUsm(); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	snmpConn = conn
+	return nil
+}
+
+func snmpSetupUsm() error {
+	if cfgSnmpEngineId != "" {
+		id, err := hex.DecodeString(strings.TrimPrefix(cfgSnmpEngineId, "0x"))
+		if err != nil || len(id) < 5 || len(id) > 32 {
+			return errors.New("snmp_engine_id should be 5 to 32 bytes of hex")
+		}
+		snmpEngineId = id
+	} else {
+		// rfc 3411 format 4, text: enterprise number with the high bit set, then the host name
+		name, _ := os.Hostname()
+		if len(name) > 27 {
+			name = name[:27]
+		}
+		snmpEngineId = binary.BigEndian.AppendUint32(nil, 0x80000000|32473)
+		snmpEngineId = append(append(snmpEngineId, 4), name...)
+	}
+	if cfgSnmpAuthPassword != "" {
+		snmpAuthKey = snmpLocalizeKey(cfgSnmpAuthPassword)
+	}
+	if cfgSnmpPrivPassword != "" {
+		if cfgSnmpAuthPassword == "" {
+			return errors.New("snmp_priv_password needs snmp_auth_password")
+		}
+		snmpPrivKey = snmpLocalizeKey(cfgSnmpPrivPassword)[:16]
+	}
+	return nil
+}
+
+func snmpHash() func() hash.Hash {
+	if cfgSnmpAuthProtocol == "sha" {
+		return sha1.New
+	}
+	return md5.New
+}
+
+// password to key and key localization, rfc 3414 a.2
+func snmpLocalizeKey(password string) []byte {
+	h := snmpHash()()
+	buf := make([]byte, 64)
+	for i := 0; i < 1048576; i += 64 {
+		for j := range buf {
+			buf[j] = password[(i+j)%len(password)]
+		}
+		h.Write(buf)
+	}
+	ku := h.Sum(nil)
+	h.Reset()
+	h.Write(ku)
+	h.Write(snmpEngineId)
+	h.Write(ku)
+	return h.Sum(nil)
+}
+
+// trap of a block, or an alarm with snmp_trap_alarms
+func snmpEvent(ev *event) {
+	if snmpConn == nil || (ev.Kind != eventBlock && !(ev.Kind == eventAlarm && cfgSnmpTrapAlarms)) {
+		return
+	}
+	trap := cfgSnmpEnterpriseOid + ".0.1"
+	if ev.Kind == eventAlarm {
+		trap = cfgSnmpEnterpriseOid + ".0.2"
+	}
+	uptime := uint32(time.Since(snmpStart) / (10 * time.Millisecond))
+	varbinds := berTlv(berSequence,
+		snmpVarbind(oidSysUpTime, berUint(berTimeTicks, uptime)),
+		snmpVarbind(oidSnmpTrapOid, berOidValue(trap)),
+		snmpVarbind(cfgSnmpEnterpriseOid+".1.1", berTlv(berIpAddress, ipfixAddr(net.ParseIP(ev.Host)))),
+		snmpVarbind(cfgSnmpEnterpriseOid+".1.2", berInt(int64(ev.Port))),
+		snmpVarbind(cfgSnmpEnterpriseOid+".1.3", berString(ev.Proto)),
+		snmpVarbind(cfgSnmpEnterpriseOid+".1.4", berString(ev.ScanType)),
+		snmpVarbind(cfgSnmpEnterpriseOid+".1.5", berInt(int64(ev.Alarms))),
+	)
+
+	snmpLock.Lock()
+	defer snmpLock.Unlock()
+	snmpRequestId++
+	pdu := berTlv(berTrapV2, berInt(int64(snmpRequestId)), berInt(0), berInt(0), varbinds)
+	var msg []byte
+	if cfgSnmpVersion == "3" {
+		var err error
+		if msg, err = snmpV3Message(pdu); err != nil {
+			logDebug("build snmp trap failed:%s", err.Error())
+			return
+		}
+	} else {
+		msg = berTlv(berSequence, berInt(1), berString(cfgSnmpCommunity), pdu)
+	}
+	if _, err := snmpConn.Write(msg); err != nil {
+		logDebug("send snmp trap to %s failed:%s", cfgSnmpTrap, err.Error())
+	}
+}
+
+// rfc 3412 message with usm security parameters, rfc 3414, and aes privacy, rfc 3826
+func snmpV3Message(pdu []byte) ([]byte, error) {
+	flags := byte(0)
+	if snmpAuthKey != nil {
+		flags |= snmpFlagAuth
+	}
+	boots, engineTime := int64(1), int64(time.Since(snmpStart)/time.Second)
+	scoped := berTlv(berSequence, berString(string(snmpEngineId)), berString(""), pdu)
+
+	salt := make([]byte, 8)
+	authParams := make([]byte, 0)
+	if flags&snmpFlagAuth != 0 {
+		authParams = make([]byte, 12)
+	}
+	data := scoped
+	if snmpPrivKey != nil {
+		flags |= snmpFlagPriv
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(snmpPrivKey)
+		if err != nil {
+			return nil, err
+		}
+		iv := binary.BigEndian.AppendUint32(nil, uint32(boots))
+		iv = binary.BigEndian.AppendUint32(iv, uint32(engineTime))
+		iv = append(iv, salt...)
+		encrypted := make([]byte, len(scoped))
+		cipher.NewCFBEncrypter(block, iv).XORKeyStream(encrypted, scoped)
+		data = berTlv(berOctetString, encrypted)
+	} else {
+		salt = salt[:0]
+	}
+
+	usmHead := bytes.Join([][]byte{berString(string(snmpEngineId)), berInt(boots), berInt(engineTime), berString(cfgSnmpUser)}, nil)
+	usmTail := bytes.Join([][]byte{berTlv(berOctetString, authParams), berTlv(berOctetString, salt)}, nil)
+	usm := berTlv(berSequence, usmHead, usmTail)
+	header := berTlv(berSequence, berInt(int64(snmpRequestId)), berInt(65507), berTlv(berOctetString, []byte{flags}), berInt(snmpUsm))
+	securityParams := berTlv(berOctetString, usm)
+	msg := berTlv(berSequence, berInt(3), header, securityParams, data)
+	if flags&snmpFlagAuth != 0 {
+		// authentication parameters are the first 12 bytes of the hmac of the message
+		// with them zeroed; find them past the tlv headers of the message, the security
+		// parameters string and the usm sequence
+		at := len(msg) - len(data) - len(securityParams)
+		at += len(securityParams) - len(usm)
+		at += len(usm) - len(usmHead) - len(usmTail)
+		at += len(usmHead) + 2
+		mac := hmac.New(snmpHash(), snmpAuthKey)
+		mac.Write(msg)
+		copy(msg[at:at+12], mac.Sum(nil)[:12])
+	}
+	return msg, nil
+}
+
+func snmpVarbind(oid string, value []byte) []byte {
+	return berTlv(berSequence, berOidValue(oid), value)
+}
+
+func berTlv(tag byte, contents ...[]byte) []byte {
+	n := 0
+	for _, c := range contents {
+		n += len(c)
+	}
+	b := []byte{tag}
+	switch {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n < 0x100:
+		b = append(b, 0x81, byte(n))
+	default:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	}
+	for _, c := range contents {
+		b = append(b, c...)
+	}
+	return b
+}
+
+func berInt(v int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		if (v < 0x80 && v >= -0x80) || len(b) == 8 {
+			break
+		}
+		v >>= 8
+	}
+	return berTlv(berInteger, b)
+}
+
+// unsigned 32 bit application types, like timeticks
+func berUint(tag byte, v uint32) []byte {
+	b := binary.BigEndian.AppendUint32([]byte{0}, v)
+	for len(b) > 1 && b[0] == 0 && b[1] < 0x80 {
+		b = b[1:]
+	}
+	return berTlv(tag, b)
+}
+
+func berString(s string) []byte {
+	return berTlv(berOctetString, []byte(s))
+}
+
+func berOidValue(oid string) []byte {
+	var ids []uint64
+	for _, s := range strings.Split(oid, ".") {
+		n, _ := strconv.ParseUint(s, 10, 32)
+		ids = append(ids, n)
+	}
+	if len(ids) < 2 {
+		return berTlv(berOid)
+	}
+	b := []byte{byte(ids[0]*40 + ids[1])}
+	for _, id := range ids[2:] {
+		var enc []byte
+		enc = append(enc, byte(id&0x7f))
+		for id >>= 7; id > 0; id >>= 7 {
+			enc = append([]byte{byte(id&0x7f | 0x80)}, enc...)
+		}
+		b = append(b, enc...)
+	}
+	return berTlv(berOid, b)
+}
+
+// if oid is a dotted numeric object identifier
+func validOid(oid string) bool {
+	parts := strings.Split(oid, ".")
+	if len(parts) < 2 {
+		return false
+	}
+	for _, p := range parts {
+		if _, err := strconv.ParseUint(p, 10, 32); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,153 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"strings"
+	"sync"
+)
+
+// sources that look spoofed or impossible are annotated on alarms:
+//
+//	bogon    reserved or unallocated range no packet from a real host comes from, see bogon sources
+//	private  private or shared range, to an address of an external_interface
+//	ttl      hop count far from the one of the host's earlier probes
+//
+// a forged source makes portguard block a victim of the attacker's choosing, block_spoofed = false
+// only raises alarms for these
+
+const (
+	spoofBogon   = "bogon"
+	spoofPrivate = "private"
+	spoofTtl     = "ttl"
+)
+
+var (
+	privateNets = parseNets("10.0.0.0/8", "100.64.0.0/10", "169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16")
+)
+
+// hop count of the first probe of each host in stateEngine, guarded by stateLock
+var hostHops = make(map[string]int)
+
+// addresses of external_interface, re-read with the local networks
+var (
+	externalAddrLock sync.RWMutex
+	externalAddrs    []net.IP
+)
+
+func parseNets(cidrs ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func inNets(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// why the source of hdr looks spoofed, empty if it doesn't
+func spoofReasons(hdr *IPv4Header) string {
+	var reasons []string
+	switch {
+	case isBogon(hdr.Source):
+		reasons = append(reasons, spoofBogon)
+	case inNets(privateNets, hdr.Source) && isExternalAddr(hdr.Destination):
+		reasons = append(reasons, spoofPrivate)
+	}
+	if hopsChanged(hdr.Source.String(), ttlHops(hdr.TTL)) {
+		reasons = append(reasons, spoofTtl)
+	}
+	return strings.Join(reasons, ",")
+}
+
+// routers between a host and us, guessed from the usual initial ttls
+func ttlHops(ttl uint8) int {
+	for _, initial := range []int{32, 64, 128, 255} {
+		if int(ttl) <= initial {
+			return initial - int(ttl)
+		}
+	}
+	return 0
+}
+
+// if hops differs from the first probe of ip by more than spoof_ttl_delta
+func hopsChanged(ip string, hops int) bool {
+	if cfgSpoofTtlDelta <= 0 {
+		return false
+	}
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	first, ok := hostHops[ip]
+	if !ok {
+		return false
+	}
+	d := hops - first
+	return d > cfgSpoofTtlDelta || -d > cfgSpoofTtlDelta
+}
+
+// remember the hops of ip's first probe, once it's tracked by stateEngine
+func noteHops(ip string, ttl uint8) {
+	if cfgSpoofTtlDelta <= 0 {
+		return
+	}
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	if _, tracked := stateEngine[ip]; !tracked {
+		return
+	}
+	if _, ok := hostHops[ip]; !ok {
+		hostHops[ip] = ttlHops(ttl)
+	}
+}
+
+func isExternalAddr(ip net.IP) bool {
+	externalAddrLock.RLock()
+	defer externalAddrLock.RUnlock()
+	for _, addr := range externalAddrs {
+		if addr.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func refreshExternalAddrs() error {
+	if len(cfgExternalInterfaces) == 0 {
+		return nil
+	}
+	var addrs []net.IP
+	for _, name := range cfgExternalInterfaces {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			// may come up later, like a ppp link
+			continue
+		}
+		ifAddrs, err := iface.Addrs()
+		if err != nil {
+			return err
+		}
+		for _, addr := range ifAddrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				addrs = append(addrs, ipNet.IP.To4())
+			}
+		}
+	}
+	externalAddrLock.Lock()
+	externalAddrs = addrs
+	externalAddrLock.Unlock()
+	return nil
+}
@@ -0,0 +1,137 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// escalating response stages before the block
+// response_stage = <score> alarm|<responder>[,<responder>...] escalates a host whose score reaches
+// score: alarm only logs the escalation, responders run for the host, e.g. one redirecting it to a
+// tarpit or decoy; the block at block_score stays the last stage
+// responders of a stage are reserved to it and don't run for blocks, unless a policy names them;
+// unblockers undo them when the block is lifted, or when the host is trusted or forgotten
+
+const (
+	eventStage = "stage"
+	stageAlarm = "alarm"
+)
+
+type responseStage struct {
+	score      int
+	responders []string // empty for alarm
+}
+
+var (
+	cfgResponseStages []*responseStage       // by score
+	hostStage         = make(map[string]int) // stage ip reached, 1 for the first one, guarded by stateLock
+)
+
+// response_stage = <score> alarm|<responder>[,<responder>...]
+func parseResponseStage(lineno int, token string, value string) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		logMain(true, "line %d:%s, invalid value:%s, should be score and alarm or responders", lineno, token, value)
+	}
+	stage := &responseStage{score: parseInt(lineno, token, fields[0])}
+	if stage.score <= 0 {
+		logMain(true, "line %d:%s, invalid score:%s, should be positive", lineno, token, fields[0])
+	}
+	if fields[1] != stageAlarm {
+		for _, name := range strings.Split(fields[1], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				stage.responders = append(stage.responders, name)
+			}
+		}
+	}
+	for _, s := range cfgResponseStages {
+		if s.score == stage.score {
+			logMain(true, "line %d:%s, duplicate stage score:%d", lineno, token, stage.score)
+		}
+	}
+	cfgResponseStages = append(cfgResponseStages, stage)
+	sort.Slice(cfgResponseStages, func(i, j int) bool {
+		return cfgResponseStages[i].score < cfgResponseStages[j].score
+	})
+}
+
+// stages must come before the block and name configured responders
+func checkResponseStages() {
+	for i, stage := range cfgResponseStages {
+		if stage.score >= blockThreshold() {
+			logMain(true, "response_stage %d, score %d should be below the block score %d", i+1, stage.score, blockThreshold())
+		}
+		for _, name := range stage.responders {
+			found := false
+			for _, r := range responders {
+				found = found || r.Name() == name
+			}
+			if !found {
+				logMain(false, "WARNING response_stage %d, responder %s is not configured", i+1, name)
+			}
+		}
+	}
+}
+
+// if name is a responder of a stage
+func isStageResponder(name string) bool {
+	for _, stage := range cfgResponseStages {
+		if containsString(stage.responders, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// the stage ip just reached, 0 if it's still in its stage, stateLock must not be held
+func escalateStage(ip string) int {
+	if len(cfgResponseStages) == 0 {
+		return 0
+	}
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	if _, ok := stateEngine[ip]; !ok {
+		return 0
+	}
+	score := hostScore(ip)
+	stage := 0
+	for i, s := range cfgResponseStages {
+		if score >= s.score {
+			stage = i + 1
+		}
+	}
+	if stage <= hostStage[ip] {
+		return 0
+	}
+	hostStage[ip] = stage
+	return stage
+}
+
+// if ip reached a stage that ran responders, stateLock must be held
+func stagedResponders(ip string) bool {
+	for i := 0; i < hostStage[ip]; i++ {
+		if len(cfgResponseStages[i].responders) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// log the escalation of the host of alarm ev and run the stage's responders
+func reportStage(ev *event, stage int) {
+	s := cfgResponseStages[stage-1]
+	esc := *ev
+	esc.Kind = eventStage
+	esc.Stage = stage
+	esc.fillHistory()
+	esc.Responders = s.responders
+	logBlocked("Host: %s Port: %d %s Stage %d%s%s", ev.Host, ev.Port, ev.Proto, stage, esc.history(), ev.origin())
+	emitEvent(&esc)
+	if len(s.responders) > 0 {
+		runResponders(&esc)
+	}
+}
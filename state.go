@@ -0,0 +1,121 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateEngine, offenses, weighted scores and blocks, with when they were made and the ttl a block
+// request gave them, are saved as json:
+// {"state": {"ip": [port, ...], ...}, "offenses": {"ip": count, ...}, "scores": {"ip": score, ...},
+// "blocks": {"ip": unix time, ...}, "ttls": {"ip": seconds, ...}}
+type savedState struct {
+	State    map[string][]int `json:"state"`
+	Offenses map[string]int   `json:"offenses,omitempty"`
+	Scores   map[string]int   `json:"scores,omitempty"`
+	Blocks   map[string]int64 `json:"blocks"` // nil in state files written before blocks were saved
+	Ttls     map[string]int64 `json:"ttls,omitempty"`
+}
+
+func saveState(file string) error {
+	stateLock.Lock()
+	data, err := json.Marshal(&savedState{State: stateEngine, Offenses: offenses, Scores: scores,
+		Blocks: blockedAt, Ttls: blockTtls})
+	stateLock.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, data, 0600)
+}
+
+// write to temp file then rename, so a crash never leaves a half written file
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), file)
+}
+
+func loadState(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var saved savedState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	state := saved.State
+	if state == nil {
+		// older state files only have stateEngine
+		state = make(map[string][]int)
+		if err := json.Unmarshal(data, &state); err != nil {
+			return err
+		}
+	}
+	now := time.Now().Unix()
+	stateLock.Lock()
+	stateEngine = state
+	for ip, n := range saved.Offenses {
+		offenses[ip] = n
+	}
+	for ip, n := range saved.Scores {
+		scores[ip] = n
+	}
+	if saved.Blocks == nil {
+		// older state files have no block times, blocked hosts expire a full block duration after loading
+		for ip := range state {
+			if hostScore(ip) >= blockThreshold() {
+				blockedAt[ip] = now
+			}
+		}
+	}
+	for ip, at := range saved.Blocks {
+		blockedAt[ip] = at
+		if ttl, ok := saved.Ttls[ip]; ok {
+			blockTtls[ip] = ttl
+		}
+	}
+	for ip := range state {
+		touchTracked(ip)
+	}
+	// blocks that expired while portguard was stopped are dropped, syncing the firewall sets, routes
+	// and xdp map at start removes their hosts
+	expired := 0
+	for ip, at := range blockedAt {
+		if d := hostBlockDuration(ip); d > 0 && at+d <= now {
+			delete(blockedAt, ip)
+			forgetTracked(ip)
+			expired++
+		}
+	}
+	stateLock.Unlock()
+	if expired > 0 {
+		logMain(false, "%d blocks expired while portguard was stopped", expired)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// blocks keep their block time and ttl across a restart, those that expired meanwhile are dropped
+func TestStateKeepsBlocks(t *testing.T) {
+	setupTestGuard(t, "tcp")
+	cfgBlockDuration = 3600
+	defer func() { cfgBlockDuration = 0 }()
+	now := time.Now().Unix()
+	blocks := map[string]int64{
+		"203.0.113.1": now - 60,   // block_duration left
+		"203.0.113.2": now - 7200, // block_duration over
+		"203.0.113.3": now - 7200, // ttl left
+		"203.0.113.4": now - 120,  // ttl over
+	}
+	stateLock.Lock()
+	for ip, at := range blocks {
+		blockedAt[ip] = at
+	}
+	blockTtls["203.0.113.3"] = 86400
+	blockTtls["203.0.113.4"] = 60
+	stateLock.Unlock()
+
+	file := filepath.Join(t.TempDir(), "state.json")
+	if err := saveState(file); err != nil {
+		t.Fatalf("save state: %v", err)
+	}
+	stateLock.Lock()
+	stateEngine, blockedAt, blockTtls = make(map[string][]int), make(map[string]int64), make(map[string]int64)
+	stateLock.Unlock()
+	if err := loadState(file); err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	for _, ip := range []string{"203.0.113.1", "203.0.113.3"} {
+		if at, ok := blockedAt[ip]; !ok || at != blocks[ip] {
+			t.Errorf("%s blocked at %d after loading, want %d", ip, at, blocks[ip])
+		}
+	}
+	if blockTtls["203.0.113.3"] != 86400 {
+		t.Errorf("ttl of 203.0.113.3 is %d after loading, want 86400", blockTtls["203.0.113.3"])
+	}
+	for _, ip := range []string{"203.0.113.2", "203.0.113.4"} {
+		if _, ok := blockedAt[ip]; ok {
+			t.Errorf("%s still blocked, its block expired before loading", ip)
+		}
+	}
+	for ip := range blocks {
+		delete(blockedAt, ip)
+		forgetTracked(ip)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// counters of the detection pipeline, updated atomically
+var stats struct {
+	packets       int64 // packets read by guards
+	malformed     int64 // dropped as bad ipv4 or transport header
+	fragments     int64 // dropped as later fragment without transport header
+	badChecksum   int64 // dropped as wrong tcp or udp checksum
+	noisy         int64 // dropped as noisy port
+	excluded      int64 // dropped as excluded port
+	ignored       int64 // dropped as ignored host
+	blocked       int64 // dropped as already blocked host
+	verifies      int64 // port usage checks
+	cacheHits     int64 // port usage answered by cache
+	closedHits    int64 // closed ports answered by cache
+	cacheMisses   int64 // port usage checked by binding
+	snapshotHits  int64 // port usage answered by the advanced mode snapshot
+	openPorts     int64 // dropped as port in use
+	policyIgnored int64 // dropped by policy_cmd
+	alarms        int64
+	fingerprints  int64 // os fingerprinting attempts, counted in alarms too
+	traps         int64 // probes of trap ports, counted in alarms too
+	honeypots     int64 // connections captured by honeypot ports
+	spoofed       int64 // alarms from sources that look spoofed, counted in alarms too
+	synFloods     int64 // possible syn floods to open ports
+	amplification int64 // udp probes with amplifying queries, counted in alarms too
+	arpSweeps     int64 // macs sweeping the local segment with arp requests
+	connectScans  int64 // hosts connecting to many open ports, see connscan.go
+	mirrorLearned int64 // ports of segment hosts learned on mirror interfaces
+	mirrorOther   int64 // dropped as not to a protected host on a mirror interface
+	decapsulated  int64 // packets taken out of gre, erspan or vxlan tunnels
+	anomalies     int64 // ops alerts of probe volume off the baseline
+	bogons        int64 // probes from bogon sources dropped by bogon_filter
+	blocks        int64
+	blockRequests int64 // blocks requested by other tools, counted in blocks too
+	respFailed    int64 // failed responders
+	respDropped   int64 // responder chains dropped as the queue was full
+	truncated     int64 // reads that may have been cut by capture_buffer
+	captureFails  int64 // guards gone blind, see capture_error_limit
+	captureReopen int64 // captures reopened after going blind
+	macIgnored    int64 // dropped by ignore_mac or gateway_mac
+	vlanIgnored   int64 // dropped as vlan not in vlan
+	captureDrops  int64 // dropped by the kernel as af_packet or nflog sockets were full
+	sampled       int64 // skipped by guards sampling under overload
+	inlineDropped int64 // packets dropped by nfqueue verdicts
+	geoipFailed   int64 // failed geoip database updates
+	evicted       int64 // hosts forgotten by max_tracked_ips
+	idleExpired   int64 // hosts forgotten by track_idle_timeout
+	cacheEvicted  int64 // port cache and reputation entries evicted from full caches
+	eventsDropped int64 // events dropped as an exporter queue was full
+	tracked       int64 // hosts in stateEngine now, a gauge
+
+	activeResponses int64 // probes of blocked hosts answered, see active_response
+	activeLimited   int64 // probes of blocked hosts not answered over active_response_rate
+	execLimited     int64 // commands not launched over exec_rate
+}
+
+func statsAdd(counter *int64) {
+	atomic.AddInt64(counter, 1)
+}
+
+type statsCounter struct {
+	name  string
+	value int64
+}
+
+// current counters, in the order they are logged
+func statsCounters() []statsCounter {
+	updateCaptureStats()
+	load := atomic.LoadInt64
+	return []statsCounter{
+		{"packets", load(&stats.packets)},
+		{"malformed", load(&stats.malformed)},
+		{"fragments", load(&stats.fragments)},
+		{"bad_checksum", load(&stats.badChecksum)},
+		{"noisy", load(&stats.noisy)},
+		{"excluded", load(&stats.excluded)},
+		{"ignored", load(&stats.ignored)},
+		{"blocked", load(&stats.blocked)},
+		{"verify", load(&stats.verifies)},
+		{"cache_hit", load(&stats.cacheHits)},
+		{"closed_cache_hit", load(&stats.closedHits)},
+		{"cache_miss", load(&stats.cacheMisses)},
+		{"snapshot_hit", load(&stats.snapshotHits)},
+		{"open", load(&stats.openPorts)},
+		{"policy_ignored", load(&stats.policyIgnored)},
+		{"alarms", load(&stats.alarms)},
+		{"fingerprints", load(&stats.fingerprints)},
+		{"traps", load(&stats.traps)},
+		{"honeypots", load(&stats.honeypots)},
+		{"spoofed", load(&stats.spoofed)},
+		{"syn_floods", load(&stats.synFloods)},
+		{"amplification_probes", load(&stats.amplification)},
+		{"arp_sweeps", load(&stats.arpSweeps)},
+		{"connect_scans", load(&stats.connectScans)},
+		{"mirror_learned", load(&stats.mirrorLearned)},
+		{"mirror_other", load(&stats.mirrorOther)},
+		{"decapsulated", load(&stats.decapsulated)},
+		{"anomalies", load(&stats.anomalies)},
+		{"bogons", load(&stats.bogons)},
+		{"blocks", load(&stats.blocks)},
+		{"block_requests", load(&stats.blockRequests)},
+		{"responder_failed", load(&stats.respFailed)},
+		{"responder_dropped", load(&stats.respDropped)},
+		{"truncated", load(&stats.truncated)},
+		{"capture_failures", load(&stats.captureFails)},
+		{"capture_reopens", load(&stats.captureReopen)},
+		{"mac_ignored", load(&stats.macIgnored)},
+		{"vlan_ignored", load(&stats.vlanIgnored)},
+		{"capture_drops", load(&stats.captureDrops)},
+		{"sampled", load(&stats.sampled)},
+		{"inline_dropped", load(&stats.inlineDropped)},
+		{"geoip_update_failed", load(&stats.geoipFailed)},
+		{"evicted", load(&stats.evicted)},
+		{"idle_expired", load(&stats.idleExpired)},
+		{"cache_evicted", load(&stats.cacheEvicted)},
+		{"events_dropped", load(&stats.eventsDropped)},
+		{"active_responses", load(&stats.activeResponses)},
+		{"active_limited", load(&stats.activeLimited)},
+		{"exec_limited", load(&stats.execLimited)},
+	}
+}
+
+// current values, like the count of tracked hosts, rather than running counts
+func statsGauges() []statsCounter {
+	return append([]statsCounter{
+		{"tracked", atomic.LoadInt64(&stats.tracked)},
+	}, geoipAges()...)
+}
+
+func statsLine() string {
+	var items []string
+	for _, c := range append(statsCounters(), statsGauges()...) {
+		items = append(items, fmt.Sprintf("%s:%d", c.name, c.value))
+	}
+	return "stats: " + strings.Join(items, " ")
+}
+
+func runStats() {
+	for range time.Tick(time.Duration(cfgStatsInterval) * time.Second) {
+		logMain(false, "%s", statsLine())
+	}
+}
@@ -0,0 +1,78 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// send counters and timings to a statsd or dogstatsd server over udp
+
+var statsdConn net.Conn
+
+// dial before chroot, the address can't be resolved after it
+func openStatsd() error {
+	conn, err := net.Dial("udp", cfgStatsdAddr)
+	if err != nil {
+		return err
+	}
+	statsdConn = conn
+	return nil
+}
+
+// dogstatsd tags suffix, empty if no tags
+func statsdTags() string {
+	if len(cfgStatsdTags) == 0 {
+		return ""
+	}
+	return "|#" + strings.Join(cfgStatsdTags, ",")
+}
+
+func statsdSend(metrics []string) {
+	if statsdConn == nil || len(metrics) == 0 {
+		return
+	}
+	// keep datagrams small enough to avoid fragmentation
+	var b strings.Builder
+	for _, m := range metrics {
+		if b.Len() > 0 && b.Len()+len(m) > 1400 {
+			statsdConn.Write([]byte(b.String()))
+			b.Reset()
+		}
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(m)
+	}
+	statsdConn.Write([]byte(b.String()))
+}
+
+func statsdTiming(name string, d time.Duration) {
+	if statsdConn == nil {
+		return
+	}
+	statsdSend([]string{fmt.Sprintf("%s%s:%d|ms%s", cfgStatsdPrefix, name, d.Milliseconds(), statsdTags())})
+}
+
+// send counter increments every statsd_interval seconds
+func runStatsd() {
+	last := make(map[string]int64)
+	for range time.Tick(time.Duration(cfgStatsdInterval) * time.Second) {
+		var metrics []string
+		for _, c := range statsCounters() {
+			if delta := c.value - last[c.name]; delta > 0 {
+				metrics = append(metrics, fmt.Sprintf("%s%s:%d|c%s", cfgStatsdPrefix, c.name, delta, statsdTags()))
+			}
+			last[c.name] = c.value
+		}
+		for _, c := range statsGauges() {
+			metrics = append(metrics, fmt.Sprintf("%s%s:%d|g%s", cfgStatsdPrefix, c.name, c.value, statsdTags()))
+		}
+		statsdSend(metrics)
+	}
+}
@@ -0,0 +1,218 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// stix 2.1 indicators
+// blocks are rendered as stix 2.1 indicators, [ipv4-addr:value = '1.2.3.4'] valid from the block
+// until it expires, in the reconnaissance phase of mitre att&ck, created by an identity of the host
+// portguard runs on; every stix_interval seconds the blocks since are written to stix_dir as a
+// bundle, portguard-<time>.json, and added to the taxii 2.1 collection at taxii_url
+// blocks from cluster peers are left to the node that made them
+
+const (
+	stixBatch = 500
+
+	stixTaxiiMediaType = "application/taxii+json;version=2.1"
+	stixTimeLayout     = "2006-01-02T15:04:05.000Z"
+)
+
+var (
+	cfgStixDir      string
+	cfgStixInterval = 60
+	cfgTaxiiUrl     string
+	cfgTaxiiHeaders []string
+
+	stixClient   = &http.Client{Timeout: 30 * time.Second}
+	stixEvents   chan *event
+	stixIdentity map[string]interface{}
+
+	// namespace of deterministic ids, the one stix 2.1 gives for cyber observables
+	stixNamespace = [16]byte{0x00, 0xab, 0xed, 0xb4, 0xaa, 0x42, 0x46, 0x6c, 0x9c, 0x01, 0xfe, 0xd2, 0x33, 0x15, 0xa9, 0xb7}
+)
+
+// queue a block for stix, dropped if the exporter falls behind
+func stixEvent(ev *event) {
+	if stixEvents == nil || ev.Kind != eventBlock || ev.Peer != "" {
+		return
+	}
+	queueEvent(stixEvents, ev, "stix")
+}
+
+// a stix id of kind, version 5 of name if given, random otherwise
+func stixId(kind string, name string) string {
+	var u [16]byte
+	if name != "" {
+		h := sha1.New()
+		h.Write(stixNamespace[:])
+		h.Write([]byte(name))
+		copy(u[:], h.Sum(nil))
+		u[6] = u[6]&0x0f | 0x50
+	} else {
+		rand.Read(u[:])
+		u[6] = u[6]&0x0f | 0x40
+	}
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%s--%x-%x-%x-%x-%x", kind, u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+func stixTime(t time.Time) string {
+	return t.UTC().Format(stixTimeLayout)
+}
+
+func stixIndicator(ev *event) map[string]interface{} {
+	now := stixTime(time.Now())
+	desc := fmt.Sprintf("%s of %d ports", ev.ScanType, len(ev.Ports))
+	if ev.Pattern != "" {
+		desc += ", " + ev.Pattern
+	}
+	if !ev.FirstSeen.IsZero() {
+		desc += ", first probe " + stixTime(ev.FirstSeen)
+	}
+	desc += ", blocked by portguard"
+	ind := map[string]interface{}{
+		"type":            "indicator",
+		"spec_version":    "2.1",
+		"id":              stixId("indicator", ""),
+		"created":         now,
+		"modified":        now,
+		"created_by_ref":  stixIdentity["id"],
+		"name":            "port scanner " + ev.Host,
+		"description":     desc,
+		"indicator_types": []string{"malicious-activity"},
+		"pattern":         fmt.Sprintf("[ipv4-addr:value = '%s']", ev.Host),
+		"pattern_type":    "stix",
+		"valid_from":      stixTime(ev.Time),
+		"kill_chain_phases": []map[string]string{
+			{"kill_chain_name": "mitre-attack", "phase_name": "reconnaissance"},
+		},
+	}
+	if d := blockDuration(ev.Offense); d > 0 {
+		ind["valid_until"] = stixTime(ev.Time.Add(time.Duration(d) * time.Second))
+	}
+	return ind
+}
+
+// write objects as a bundle to stix_dir
+func stixWrite(objects []interface{}, t time.Time) error {
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"type":    "bundle",
+		"id":      stixId("bundle", ""),
+		"objects": objects,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(cfgStixDir, "portguard-"+t.UTC().Format("20060102T150405Z")+".json")
+	return writeFileAtomic(chrootPath(file), data, 0644)
+}
+
+// add objects to the taxii collection
+func stixPublish(objects []interface{}) error {
+	data, err := json.Marshal(map[string]interface{}{"objects": objects})
+	if err != nil {
+		return err
+	}
+	url := strings.TrimRight(cfgTaxiiUrl, "/") + "/objects/"
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", stixTaxiiMediaType)
+	req.Header.Set("Content-Type", stixTaxiiMediaType)
+	for _, header := range cfgTaxiiHeaders {
+		if kv := strings.SplitN(header, ":", 2); len(kv) == 2 {
+			req.Header.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+		}
+	}
+	resp, err := stixClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	// the status resource counts objects the server didn't take
+	var status struct {
+		FailureCount int `json:"failure_count"`
+		Failures     []struct {
+			Message string
+		}
+	}
+	if json.NewDecoder(resp.Body).Decode(&status) == nil && status.FailureCount > 0 {
+		msg := ""
+		if len(status.Failures) > 0 {
+			msg = ", " + status.Failures[0].Message
+		}
+		return fmt.Errorf("%s: %d objects failed%s", url, status.FailureCount, msg)
+	}
+	return nil
+}
+
+func startStix() {
+	host, _ := os.Hostname()
+	now := stixTime(time.Now())
+	stixIdentity = map[string]interface{}{
+		"type":           "identity",
+		"spec_version":   "2.1",
+		"id":             stixId("identity", "portguard "+host),
+		"created":        now,
+		"modified":       now,
+		"name":           "portguard on " + host,
+		"identity_class": "system",
+	}
+	stixEvents = make(chan *event, cfgEventQueue)
+	go runStix()
+}
+
+// export blocks every stix_interval seconds
+func runStix() {
+	var batch []*event
+	flush := time.NewTicker(time.Duration(cfgStixInterval) * time.Second)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		objects := []interface{}{stixIdentity}
+		for _, ev := range batch {
+			objects = append(objects, stixIndicator(ev))
+		}
+		if cfgStixDir != "" {
+			if err := stixWrite(objects, time.Now()); err != nil {
+				logMain(false, "write stix bundle of %d blocks failed:%s", len(batch), err.Error())
+			}
+		}
+		if cfgTaxiiUrl != "" {
+			if err := stixPublish(objects); err != nil {
+				logMain(false, "publish %d blocks to taxii failed:%s", len(batch), err.Error())
+			}
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case ev := <-stixEvents:
+			batch = append(batch, ev)
+			if len(batch) >= stixBatch {
+				send()
+			}
+		case <-flush.C:
+			send()
+		}
+	}
+}
@@ -0,0 +1,120 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// alarms of a host and scan type within a suppression window
+type alarmKey struct {
+	ip       string
+	scanType string
+}
+
+type alarmWindow struct {
+	start      int64
+	count      int
+	suppressed int
+}
+
+var (
+	alarmLock     sync.Mutex
+	alarmWindows  = make(map[alarmKey]*alarmWindow)
+	sourceWindows = make(map[string]*alarmWindow) // host -> its alarm lines this minute
+)
+
+// alarm lines of a source are capped at alarm_rate_limit per minute, whatever their port or scan type
+const sourceWindow = 60
+
+// true if the alarm should be logged
+// after cfgAlarmSuppressAfter alarms in a window, alarms are only counted
+func allowAlarm(ip string, scanType string) bool {
+	if cfgAlarmSuppressAfter <= 0 {
+		return true
+	}
+	now := time.Now().Unix()
+	key := alarmKey{ip, scanType}
+
+	alarmLock.Lock()
+	defer alarmLock.Unlock()
+	w := alarmWindows[key]
+	if w == nil || now >= w.start+int64(cfgAlarmSuppressWindow) {
+		if w != nil {
+			logSuppressed(key, w)
+		}
+		w = &alarmWindow{start: now}
+		alarmWindows[key] = w
+	}
+	w.count++
+	if w.count <= cfgAlarmSuppressAfter {
+		return true
+	}
+	w.suppressed++
+	return false
+}
+
+// true if another alarm line of ip fits in alarm_rate_limit
+func allowSourceAlarm(ip string) bool {
+	if cfgAlarmRateLimit <= 0 {
+		return true
+	}
+	now := time.Now().Unix()
+
+	alarmLock.Lock()
+	defer alarmLock.Unlock()
+	w := sourceWindows[ip]
+	if w == nil || now >= w.start+sourceWindow {
+		if w != nil {
+			logSourceSuppressed(ip, w)
+		}
+		w = &alarmWindow{start: now}
+		sourceWindows[ip] = w
+	}
+	w.count++
+	if w.count <= cfgAlarmRateLimit {
+		return true
+	}
+	w.suppressed++
+	return false
+}
+
+func logSourceSuppressed(ip string, w *alarmWindow) {
+	if w.suppressed > 0 {
+		logAlarm("attackalert: suppressed %d further alarms from host: %s in %ds", w.suppressed, ip, sourceWindow)
+	}
+}
+
+func logSuppressed(key alarmKey, w *alarmWindow) {
+	if w.suppressed > 0 {
+		logAlarm("attackalert: %s from host: %s, %d more alarms suppressed in %ds", key.scanType, key.ip, w.suppressed, cfgAlarmSuppressWindow)
+	}
+}
+
+// log summaries of closed windows, or of all windows if all is true
+func flushAlarmWindows(all bool) {
+	now := time.Now().Unix()
+	alarmLock.Lock()
+	defer alarmLock.Unlock()
+	for key, w := range alarmWindows {
+		if all || now >= w.start+int64(cfgAlarmSuppressWindow) {
+			logSuppressed(key, w)
+			delete(alarmWindows, key)
+		}
+	}
+	for ip, w := range sourceWindows {
+		if all || now >= w.start+sourceWindow {
+			logSourceSuppressed(ip, w)
+			delete(sourceWindows, ip)
+		}
+	}
+}
+
+func runAlarmSuppress() {
+	for range time.Tick(time.Second) {
+		flushAlarmWindows(false)
+	}
+}
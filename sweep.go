@@ -0,0 +1,137 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// scan patterns
+// every alarm is labeled with what its host is doing, in the alarm log, events and digests:
+//   vertical  the host probed more than two ports here
+//   sweep     one or two ports, probed on several of our addresses, reported by a cluster peer, or
+//             probed by at least sweep_sources hosts within sweep_window seconds; a horizontal scan
+//             of many hosts for one service
+//   targeted  one or two ports otherwise, a probe of specific services
+
+const (
+	patternVertical = "vertical"
+	patternSweep    = "sweep"
+	patternTargeted = "targeted"
+
+	// most ports probed by a targeted probe or sweep
+	patternPorts = 2
+)
+
+var (
+	cfgSweepSources = 10
+	cfgSweepWindow  = 300 // seconds
+
+	sweepLock   sync.Mutex
+	portSources = make(map[int]map[string]int64) // port -> host -> last probe, unix seconds
+	sweepHosts  = make(map[string]*sweepHost)    // host -> our addresses it probed
+)
+
+type sweepHost struct {
+	dsts []string // up to two, enough to tell a sweep
+	seen int64
+}
+
+// note a probe of port on our address dst, and tell if port is swept, or host probes several of our addresses
+func noteSweep(host string, dst string, port int, now int64) bool {
+	sweepLock.Lock()
+	defer sweepLock.Unlock()
+	sources, ok := portSources[port]
+	if !ok {
+		sources = make(map[string]int64)
+		portSources[port] = sources
+	}
+	if len(sources) >= cfgSweepSources*2 {
+		expireSources(sources, now)
+	}
+	// twice sweep_sources recent hosts already tell a sweep, more needn't be kept
+	if _, ok := sources[host]; ok || len(sources) < cfgSweepSources*2 {
+		sources[host] = now
+	}
+
+	h, ok := sweepHosts[host]
+	if !ok {
+		h = &sweepHost{}
+		sweepHosts[host] = h
+	}
+	h.seen = now
+	if dst != "" && len(h.dsts) < 2 && !containsString(h.dsts, dst) {
+		h.dsts = append(h.dsts, dst)
+	}
+	if len(h.dsts) > 1 {
+		return true
+	}
+	n := 0
+	for _, at := range sources {
+		if now-at < int64(cfgSweepWindow) {
+			n++
+		}
+	}
+	return n >= cfgSweepSources
+}
+
+// sweepLock must be held
+func expireSources(sources map[string]int64, now int64) {
+	for host, at := range sources {
+		if now-at >= int64(cfgSweepWindow) {
+			delete(sources, host)
+		}
+	}
+}
+
+// pattern of alarm ev of a probe to our address dst, nil if unknown; see scan patterns
+func scanPattern(ev *event, dst net.IP) string {
+	addr := ""
+	if dst != nil {
+		addr = dst.String()
+	}
+	swept := noteSweep(ev.Host, addr, ev.Port, ev.Time.Unix())
+	if probedPorts(ev.Host, ev.Port) > patternPorts {
+		return patternVertical
+	}
+	if swept || ev.Peer != "" {
+		return patternSweep
+	}
+	return patternTargeted
+}
+
+// distinct ports host probed, port included
+func probedPorts(host string, port int) int {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	ports := stateEngine[host]
+	for _, p := range ports {
+		if p == port {
+			return len(ports)
+		}
+	}
+	return len(ports) + 1
+}
+
+// forget probes older than sweep_window
+func runSweepExpiry() {
+	for range time.Tick(time.Duration(cfgSweepWindow) * time.Second) {
+		now := time.Now().Unix()
+		sweepLock.Lock()
+		for port, sources := range portSources {
+			if expireSources(sources, now); len(sources) == 0 {
+				delete(portSources, port)
+			}
+		}
+		for host, h := range sweepHosts {
+			if now-h.seen >= int64(cfgSweepWindow) {
+				delete(sweepHosts, host)
+			}
+		}
+		sweepLock.Unlock()
+	}
+}
@@ -0,0 +1,90 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// SYNs to ports in use are skipped by smartVerify, so floods against real services would go unseen
+// they're counted per second, per host and for all hosts together, and alarmed at most once
+// per synflood_cooldown seconds; spoofed floods only show up in the total rate
+type synCounter struct {
+	second  int64
+	count   int
+	alarmed int64
+}
+
+var (
+	synLock    sync.Mutex
+	synSources = make(map[string]*synCounter)
+	synTotal   synCounter
+)
+
+// count c up for now, true if it went over rate and may alarm again
+func (c *synCounter) add(now int64, rate int) bool {
+	if c.second != now {
+		c.second, c.count = now, 0
+	}
+	c.count++
+	if rate <= 0 || c.count <= rate || now-c.alarmed < int64(cfgSynFloodCooldown) {
+		return false
+	}
+	c.alarmed = now
+	return true
+}
+
+// count a SYN of host hdr.Source to an open port
+func countSyn(hdr *IPv4Header, laddr net.IP, port int) {
+	if cfgSynFloodSourceRate <= 0 && cfgSynFloodTotalRate <= 0 {
+		return
+	}
+	host := hdr.Source.String()
+	now := time.Now().Unix()
+
+	synLock.Lock()
+	c := synSources[host]
+	if c == nil {
+		// forget hosts quiet for longer than the cooldown
+		if len(synSources) >= 4096 {
+			for h, old := range synSources {
+				if now-old.second > int64(cfgSynFloodCooldown) {
+					delete(synSources, h)
+				}
+			}
+		}
+		c = &synCounter{}
+		synSources[host] = c
+	}
+	sourceFlood := c.add(now, cfgSynFloodSourceRate)
+	sourceRate := c.count
+	totalFlood := synTotal.add(now, cfgSynFloodTotalRate)
+	totalRate := synTotal.count
+	synLock.Unlock()
+
+	if totalFlood {
+		statsAdd(&stats.synFloods)
+		logAlarm("attackalert: %s from all hosts to TCP port: %d, rate: %d/s", tcpPacketTypeSynFlood, port, totalRate)
+	}
+	if !sourceFlood {
+		return
+	}
+
+	ev := &event{Time: time.Now(), Kind: eventAlarm, Host: host, Port: port, Proto: "TCP",
+		ScanType: tcpPacketTypeSynFlood, Flags: SYN, TTL: hdr.TTL, Laddr: laddr}
+	ev.ASN, ev.ASOrg = lookupAsn(hdr.Source)
+	ev.Country = lookupCountry(hdr.Source)
+	statsAdd(&stats.alarms)
+	statsAdd(&stats.synFloods)
+	emitEvent(ev)
+	logHostAlarm(severityWarning, host, "attackalert: %s from host: %s to TCP port: %d, rate: %d/s%s", tcpPacketTypeSynFlood, host, port, sourceRate, ev.origin())
+
+	// a flood source is easily spoofed, never blocked unless asked
+	if cfgSynFloodBlock && forceBlock(host, port, tcpPacketTypeSynFlood) {
+		reportBlock(ev)
+	}
+}
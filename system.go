@@ -5,29 +5,87 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"net/http"
-	"os/exec"
 	"strconv"
 	"strings"
 )
 
-func runCmd(script string, mode string, target string, port int) error {
-	script = strings.Replace(script, "$MODE$", mode, -1)
-	script = strings.Replace(script, "$TARGET$", target, -1)
-	script = strings.Replace(script, "$PORT$", strconv.Itoa(port), -1)
-	var cmd *exec.Cmd
-	cmd = exec.Command("/bin/sh", "-c", script)
-	return cmd.Run()
+// replace $MODE$, $TARGET$ and $PORT$ in a command or url
+func expandTokens(s string, mode string, target string, port int) string {
+	s = strings.Replace(s, "$MODE$", mode, -1)
+	s = strings.Replace(s, "$TARGET$", target, -1)
+	s = strings.Replace(s, "$PORT$", strconv.Itoa(port), -1)
+	return s
 }
 
-func requestUrl(url string, mode string, target string, port int) error {
-	url = strings.Replace(url, "$MODE$", mode, -1)
-	url = strings.Replace(url, "$TARGET$", target, -1)
-	url = strings.Replace(url, "$PORT$", strconv.Itoa(port), -1)
-	resp, err := http.Get(url)
+// run script for a blocked host, with the event in PG_* environment variables
+func runCmd(ctx context.Context, script string, ev *event) error {
+	if err := allowExec("command for " + ev.Host); err != nil {
+		return err
+	}
+	cmd := shellCommand(ctx, expandTokens(script, *mode, ev.Host, ev.Port))
+	cmd.Env = append(cmd.Env,
+		"PG_IP="+ev.Host,
+		"PG_PORT="+strconv.Itoa(ev.Port),
+		"PG_PROTO="+ev.Proto,
+		"PG_SCAN_TYPE="+ev.ScanType,
+		"PG_ALARM_COUNT="+strconv.Itoa(ev.Alarms),
+		"PG_TIMESTAMP="+strconv.FormatInt(ev.Time.Unix(), 10),
+		"PG_MODE="+*mode,
+		"PG_EVIDENCE="+ev.Evidence,
+	)
+	stderr := &capWriter{max: 4096}
+	cmd.Stderr = stderr
+	if out := auditOutputOf(ctx); out != nil {
+		cmd.Stdout = out
+		cmd.Stderr = io.MultiWriter(stderr, out)
+	}
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out, process group killed (%w)", err)
+	}
+	if msg := strings.TrimSpace(stderr.buf.String()); msg != "" {
+		return fmt.Errorf("%w, stderr: %s", err, msg)
+	}
+	return err
+}
+
+// keeps the first max bytes written to it, for stderr of commands
+type capWriter struct {
+	buf bytes.Buffer
+	max int
+}
+
+func (w *capWriter) Write(p []byte) (int, error) {
+	if n := w.max - w.buf.Len(); n > 0 {
+		if len(p) < n {
+			n = len(p)
+		}
+		w.buf.Write(p[:n])
+	}
+	return len(p), nil
+}
+
+func requestUrl(ctx context.Context, url string, mode string, target string, port int) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", expandTokens(url, mode, target, port), nil)
 	if err != nil {
 		return err
 	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	if out := auditOutputOf(ctx); out != nil {
+		fmt.Fprintf(out, "%s ", resp.Status)
+		io.Copy(out, io.LimitReader(resp.Body, int64(out.max)))
+	}
 	resp.Body.Close()
 	return nil
 }
@@ -0,0 +1,33 @@
+//go:build unix
+
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// the shell runs in its own process group, which is killed as a whole when ctx ends,
+// so children of a hanging command don't outlive it
+func shellCommand(ctx context.Context, script string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// children holding stdout or stderr open don't block Wait forever
+	cmd.WaitDelay = time.Second
+	cmd.Env = childEnv()
+	return cmd
+}
+
+func windowsFirewallBlock(ip string) error {
+	return errors.New("windows firewall is only supported on windows")
+}
@@ -0,0 +1,31 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// the whole process tree is killed when ctx ends
+func shellCommand(ctx context.Context, script string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "cmd", "/C", script)
+	cmd.Cancel = func() error {
+		return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+	}
+	cmd.WaitDelay = time.Second
+	cmd.Env = childEnv()
+	return cmd
+}
+
+// add an inbound block rule for ip to windows firewall, replacing a rule of an earlier block of
+// ip so they don't pile up; delete fails if there's none
+func windowsFirewallBlock(ip string) error {
+	exec.Command("netsh", "advfirewall", "firewall", "delete", "rule", "name=portguard block "+ip).Run()
+	return exec.Command("netsh", "advfirewall", "firewall", "add", "rule",
+		"name=portguard block "+ip, "dir=in", "action=block", "remoteip="+ip).Run()
+}
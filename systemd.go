@@ -0,0 +1,101 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	watchdogInterval time.Duration // how often to ping systemd, 0 if watchdog is disabled
+	heartbeats       []*int64      // last time each guard loop was alive
+	heartbeatLock    sync.Mutex
+)
+
+// send state to systemd, do nothing if not started by systemd with Type=notify
+func sdNotify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+	// abstract socket
+	if name[0] == '@' {
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// enable watchdog if systemd asks for it with WatchdogSec=
+func setupWatchdog() {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	// ping twice per watchdog period
+	watchdogInterval = time.Duration(usec) * time.Microsecond / 2
+	logMain(false, "systemd watchdog enabled, interval:%v", watchdogInterval)
+}
+
+func newHeartbeat() *int64 {
+	hb := new(int64)
+	*hb = time.Now().UnixNano()
+	heartbeatLock.Lock()
+	heartbeats = append(heartbeats, hb)
+	heartbeatLock.Unlock()
+	return hb
+}
+
+// called from guard loop, the read deadline wakes up an idle loop in time
+func keepAlive(conn packetConn, hb *int64) {
+	if watchdogInterval <= 0 {
+		return
+	}
+	now := time.Now()
+	atomic.StoreInt64(hb, now.UnixNano())
+	conn.SetReadDeadline(now.Add(watchdogInterval))
+}
+
+func isTimeout(err error) bool {
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return true
+	}
+	return false
+}
+
+// ping systemd only if every guard loop is alive, so a hung guard gets restarted
+func runWatchdog() {
+	if watchdogInterval <= 0 {
+		return
+	}
+	for range time.Tick(watchdogInterval) {
+		deadline := time.Now().Add(-2 * watchdogInterval).UnixNano()
+		alive := true
+		heartbeatLock.Lock()
+		for _, hb := range heartbeats {
+			if atomic.LoadInt64(hb) < deadline {
+				alive = false
+				break
+			}
+		}
+		heartbeatLock.Unlock()
+		if alive {
+			sdNotify("WATCHDOG=1")
+		}
+	}
+}
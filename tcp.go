@@ -24,6 +24,7 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 )
 
 const (
@@ -56,26 +57,34 @@ type TCPOption struct {
 	Data   []byte
 }
 
+var errTCPHeader = errors.New("invalid tcp header")
+
 // Parse packet into TCPHeader structure
-func NewTCPHeader(data []byte, tcp *TCPHeader) *TCPHeader {
-	r := bytes.NewReader(data)
-	binary.Read(r, binary.BigEndian, &tcp.Source)
-	binary.Read(r, binary.BigEndian, &tcp.Destination)
-	binary.Read(r, binary.BigEndian, &tcp.SeqNum)
-	binary.Read(r, binary.BigEndian, &tcp.AckNum)
+// a segment shorter than 20 bytes or than its data offset is rejected, options are skipped
+func NewTCPHeader(data []byte, tcp *TCPHeader) error {
+	if len(data) < 20 {
+		return errTCPHeader
+	}
+	tcp.Source = binary.BigEndian.Uint16(data[0:2])
+	tcp.Destination = binary.BigEndian.Uint16(data[2:4])
+	tcp.SeqNum = binary.BigEndian.Uint32(data[4:8])
+	tcp.AckNum = binary.BigEndian.Uint32(data[8:12])
 
-	var mix uint16
-	binary.Read(r, binary.BigEndian, &mix)
+	mix := binary.BigEndian.Uint16(data[12:14])
 	tcp.DataOffset = byte(mix >> 12)  // top 4 bits
 	tcp.Reserved = byte(mix >> 9 & 7) // 3 bits
 	tcp.ECN = byte(mix >> 6 & 7)      // 3 bits
 	tcp.Ctrl = byte(mix & 0x3f)       // bottom 6 bits
 
-	binary.Read(r, binary.BigEndian, &tcp.Window)
-	binary.Read(r, binary.BigEndian, &tcp.Checksum)
-	binary.Read(r, binary.BigEndian, &tcp.Urgent)
+	tcp.Window = binary.BigEndian.Uint16(data[14:16])
+	tcp.Checksum = binary.BigEndian.Uint16(data[16:18])
+	tcp.Urgent = binary.BigEndian.Uint16(data[18:20])
+	tcp.Options = nil
 
-	return tcp
+	if tcp.DataOffset < 5 || int(tcp.DataOffset)*4 > len(data) {
+		return errTCPHeader
+	}
+	return nil
 }
 
 func (tcp *TCPHeader) HasFlag(flagBit byte) bool {
@@ -126,9 +135,9 @@ func csum(data []byte, srcip, dstip [4]byte) uint16 {
 	pseudoHeader := []byte{
 		srcip[0], srcip[1], srcip[2], srcip[3],
 		dstip[0], dstip[1], dstip[2], dstip[3],
-		0,                  // zero
-		6,                  // protocol number (6 == TCP)
-		0, byte(len(data)), // TCP length (16 bits), not inc pseudo header
+		0,                                     // zero
+		6,                                     // protocol number (6 == TCP)
+		byte(len(data) >> 8), byte(len(data)), // TCP length (16 bits), not inc pseudo header
 	}
 
 	sumThis := make([]byte, 0, len(pseudoHeader)+len(data))
@@ -0,0 +1,33 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import "testing"
+
+// a syn to port 23, a header with options, and runt and truncated segments
+var tcpSeeds = [][]byte{
+	{0xc3, 0x50, 0x00, 0x17, 0, 0, 0, 1, 0, 0, 0, 0, 0x50, SYN, 0xff, 0xff, 0, 0, 0, 0},
+	{0xc3, 0x50, 0x00, 0x17, 0, 0, 0, 1, 0, 0, 0, 0, 0x60, SYN, 0xff, 0xff, 0, 0, 0, 0, 2, 4, 5, 0xb4},
+	{0xc3, 0x50, 0x00, 0x17, 0, 0, 0, 1, 0, 0, 0, 0, 0xf0, SYN, 0xff, 0xff, 0, 0, 0, 0},
+	{0xc3, 0x50, 0x00, 0x17, 0, 0, 0, 1, 0, 0, 0, 0, 0x00, 0, 0, 0, 0, 0, 0, 0},
+	{0xc3, 0x50, 0x00, 0x17, 0, 0, 0, 1},
+	{},
+}
+
+func FuzzNewTCPHeader(f *testing.F) {
+	for _, seed := range tcpSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var tcp TCPHeader
+		if err := NewTCPHeader(data, &tcp); err != nil {
+			return
+		}
+		if tcp.DataOffset < 5 || int(tcp.DataOffset)*4 > len(data) {
+			t.Fatalf("data offset %d accepted for a %d byte segment", tcp.DataOffset, len(data))
+		}
+		tcp.Marshal()
+	})
+}
@@ -0,0 +1,76 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// throttle action
+// hosts in nft_set or ipset go through chain <set>_throttle, which drops what a host sends beyond
+// throttle_rate and returns the rest to the chain that jumped there; the chain is (re)created with
+// the first batch, so a changed throttle_rate applies after a restart
+
+const (
+	fwActionDrop     = "drop"
+	fwActionThrottle = "throttle"
+
+	// how long nft keeps the rate of a host after its last packet
+	throttleMeterTimeout = "10m"
+)
+
+var (
+	cfgFirewallAction = fwActionDrop
+	cfgThrottleRate   = "10/minute"
+
+	// the throttle chains are set up, only touched by the batch of nft_set or ipset
+	nftThrottleReady   bool
+	ipsetThrottleReady bool
+)
+
+// N/second, N/minute, N/hour or N/day, understood by both nft limit and iptables hashlimit
+func parseThrottleRate(lineno int, token string, value string) string {
+	n, unit, _ := strings.Cut(value, "/")
+	if i, err := strconv.Atoi(n); err != nil || i < 1 || (unit != "second" && unit != "minute" && unit != "hour" && unit != "day") {
+		logMain(true, "line %d:%s, invalid value:%s, should be <n>/second, minute, hour or day", lineno, token, value)
+	}
+	return value
+}
+
+func isThrottle() bool {
+	return cfgFirewallAction == fwActionThrottle
+}
+
+func checkThrottle() {
+	if isThrottle() && cfgNftSet == "" && cfgIpset == "" {
+		logMain(false, "WARNING firewall_action throttle only applies to nft_set and ipset")
+	}
+}
+
+// statements creating the throttle chain of nft_set, for the first nft transaction
+func nftThrottleSetup() string {
+	f := strings.Fields(cfgNftSet) // family, table, set
+	table := f[0] + " " + f[1]
+	chain := f[2] + "_throttle"
+	var b strings.Builder
+	fmt.Fprintf(&b, "add chain %s %s\n", table, chain)
+	fmt.Fprintf(&b, "flush chain %s %s\n", table, chain)
+	fmt.Fprintf(&b, "add set %s %s { type ipv4_addr; flags dynamic,timeout; timeout %s; }\n", table, chain, throttleMeterTimeout)
+	fmt.Fprintf(&b, "add rule %s %s update @%s { ip saddr limit rate over %s } drop\n", table, chain, chain, cfgThrottleRate)
+	return b.String()
+}
+
+// create or flush the throttle chain of ipset, other chains are kept
+func ipsetThrottleSetup(ctx context.Context) error {
+	chain := cfgIpset + "_throttle"
+	var b strings.Builder
+	fmt.Fprintf(&b, "*filter\n:%s - [0:0]\n", chain)
+	fmt.Fprintf(&b, "-A %s -m hashlimit --hashlimit-above %s --hashlimit-mode srcip --hashlimit-name portguard -j DROP\n", chain, cfgThrottleRate)
+	b.WriteString("COMMIT\n")
+	return runBatchCmd(ctx, b.String(), "iptables-restore", "--noflush")
+}
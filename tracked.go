@@ -0,0 +1,116 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"container/list"
+	"sync/atomic"
+	"time"
+)
+
+// hosts of stateEngine in lru order, bounded by max_tracked_ips
+// a busy public ip sees probes from a huge number of hosts, most of them probe a port or two
+// and never come back, so the least recently seen hosts are forgotten first, or by
+// tracked_eviction = oldest the hosts seen first
+// hosts that haven't probed for track_idle_timeout seconds are forgotten too, so a single probe
+// months later doesn't complete a block
+
+var cfgTrackIdleTimeout int // seconds, 0 keeps hosts until evicted
+
+type trackedHost struct {
+	ip   string
+	seen int64 // last probe, unix seconds
+}
+
+var (
+	trackedOrder = list.New() // *trackedHost, most recently probed or added first, guarded by stateLock
+	trackedElems = make(map[string]*list.Element)
+)
+
+// mark ip as just probed and evict the least recently probed hosts beyond max_tracked_ips
+// blocked hosts stay until their block expires, stateLock must be held
+func touchTracked(ip string) {
+	now := time.Now().Unix()
+	if e, ok := trackedElems[ip]; ok {
+		e.Value.(*trackedHost).seen = now
+		if cfgTrackedEviction == evictLru {
+			trackedOrder.MoveToFront(e)
+		}
+	} else {
+		trackedElems[ip] = trackedOrder.PushFront(&trackedHost{ip, now})
+	}
+	if cfgMaxTrackedIps > 0 && len(trackedElems) > cfgMaxTrackedIps {
+		warnLimit("tracked hosts", cfgMaxTrackedIps, evictAction(cfgTrackedEviction))
+	}
+	for e := trackedOrder.Back(); e != nil && cfgMaxTrackedIps > 0 && len(trackedElems) > cfgMaxTrackedIps; {
+		prev := e.Prev()
+		old := e.Value.(*trackedHost).ip
+		if _, blocked := blockedAt[old]; !blocked && old != ip {
+			if stagedResponders(old) {
+				go runUnblockers(old)
+			}
+			forgetTracked(old)
+			statsAdd(&stats.evicted)
+		}
+		e = prev
+	}
+	atomic.StoreInt64(&stats.tracked, int64(len(trackedElems)))
+}
+
+// forget everything known about ip, stateLock must be held
+func forgetTracked(ip string) {
+	if e, ok := trackedElems[ip]; ok {
+		trackedOrder.Remove(e)
+		delete(trackedElems, ip)
+	}
+	delete(stateEngine, ip)
+	delete(hostHops, ip)
+	delete(hostStage, ip)
+	delete(blockTtls, ip)
+	clearScore(ip)
+	atomic.StoreInt64(&stats.tracked, int64(len(trackedElems)))
+}
+
+// forget hosts that last probed track_idle_timeout seconds ago or earlier, blocked ones stay
+// until their block expires
+func expireIdleTracked() {
+	cutoff := time.Now().Unix() - int64(cfgTrackIdleTimeout)
+	var staged []string
+	stateLock.Lock()
+	for e := trackedOrder.Back(); e != nil; {
+		prev := e.Prev()
+		h := e.Value.(*trackedHost)
+		if h.seen > cutoff {
+			// hosts come in order of their last probe, unless they are in order of their first
+			if cfgTrackedEviction == evictLru {
+				break
+			}
+			e = prev
+			continue
+		}
+		if _, blocked := blockedAt[h.ip]; !blocked {
+			if stagedResponders(h.ip) {
+				staged = append(staged, h.ip)
+			}
+			forgetTracked(h.ip)
+			statsAdd(&stats.idleExpired)
+		}
+		e = prev
+	}
+	stateLock.Unlock()
+	for _, ip := range staged {
+		runUnblockers(ip)
+	}
+}
+
+func runIdleExpiry() {
+	interval := time.Duration(cfgTrackIdleTimeout) * time.Second
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	for range time.Tick(interval) {
+		expireIdleTracked()
+	}
+}
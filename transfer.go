@@ -0,0 +1,288 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// portguard export [-format json|csv|cidr] and portguard import <file> move the blocklist and
+// tracked hosts between guards over control_socket, to migrate hosts, seed blocks from another
+// tool or back them up before maintenance
+//
+//	json  [{"host":"1.2.3.4","blocked":true,"ports":[22,23],"score":6,"offenses":1,
+//	        "blocked_at":"...","blocked_until":"..."}, ...]
+//	csv   host,blocked,ports,score,offenses,blocked_at,blocked_until with ports separated by spaces
+//	cidr  a /32 prefix per blocked host, tracked hosts are left out
+//
+// import reads any of them, and plain ip lists; imported blocks run responders like a scan,
+// keep their block time and are skipped if already expired, ignored or blocked here
+
+const importScanType = "imported"
+
+// a tracked or blocked host as exported
+type hostEntry struct {
+	Host         string     `json:"host"`
+	Blocked      bool       `json:"blocked"`
+	Ports        []int      `json:"ports,omitempty"`
+	Score        int        `json:"score,omitempty"`
+	Offenses     int        `json:"offenses,omitempty"`
+	BlockedAt    *time.Time `json:"blocked_at,omitempty"`
+	BlockedUntil *time.Time `json:"blocked_until,omitempty"`
+}
+
+var exportFormats = map[string]func(w io.Writer, entries []*hostEntry) error{
+	"json": func(w io.Writer, entries []*hostEntry) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	},
+	"csv": func(w io.Writer, entries []*hostEntry) error {
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"host", "blocked", "ports", "score", "offenses", "blocked_at", "blocked_until"})
+		for _, e := range entries {
+			ports := make([]string, len(e.Ports))
+			for i, port := range e.Ports {
+				ports[i] = strconv.Itoa(port)
+			}
+			cw.Write([]string{e.Host, strconv.FormatBool(e.Blocked), strings.Join(ports, " "), strconv.Itoa(e.Score),
+				strconv.Itoa(e.Offenses), formatEntryTime(e.BlockedAt), formatEntryTime(e.BlockedUntil)})
+		}
+		cw.Flush()
+		return cw.Error()
+	},
+	"cidr": func(w io.Writer, entries []*hostEntry) error {
+		for _, e := range entries {
+			if e.Blocked {
+				if _, err := fmt.Fprintf(w, "%s/32\n", e.Host); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+}
+
+func formatEntryTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// export, tracked and blocked hosts in address order
+func controlExport(args []string) (interface{}, error) {
+	stateLock.Lock()
+	entries := make([]*hostEntry, 0, len(stateEngine)+len(blockedAt))
+	add := func(ip string) {
+		e := &hostEntry{Host: ip, Ports: append([]int(nil), stateEngine[ip]...), Offenses: offenses[ip]}
+		if _, ok := stateEngine[ip]; ok {
+			e.Score = hostScore(ip)
+		}
+		if at, ok := blockedAt[ip]; ok {
+			e.Blocked = true
+			t := time.Unix(at, 0)
+			e.BlockedAt = &t
+			if d := hostBlockDuration(ip); d > 0 {
+				until := time.Unix(at+d, 0)
+				e.BlockedUntil = &until
+			}
+		}
+		entries = append(entries, e)
+	}
+	for ip := range stateEngine {
+		add(ip)
+	}
+	for ip := range blockedAt {
+		if _, ok := stateEngine[ip]; !ok {
+			add(ip)
+		}
+	}
+	stateLock.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(entries[i].Host).To16(), net.ParseIP(entries[j].Host).To16()) < 0
+	})
+	return entries, nil
+}
+
+// result of import
+type importReport struct {
+	Tracked int      `json:"tracked"`
+	Blocked int      `json:"blocked"`
+	Skipped []string `json:"skipped,omitempty"` // host: reason
+}
+
+// import <json entries>, merge hosts into the state and block the blocked ones
+func controlImport(args []string) (interface{}, error) {
+	var entries []*hostEntry
+	if len(args) == 0 || json.Unmarshal([]byte(strings.Join(args, " ")), &entries) != nil {
+		return nil, errors.New("usage: import <json entries>")
+	}
+	report := &importReport{}
+	now := time.Now()
+	for _, e := range entries {
+		ip := net.ParseIP(e.Host)
+		switch {
+		case ip == nil || ip.To4() == nil:
+			report.Skipped = append(report.Skipped, e.Host+": not an ipv4 address")
+			continue
+		case isIgnoredIP(ip):
+			report.Skipped = append(report.Skipped, e.Host+": ignored")
+			continue
+		case e.Blocked && e.BlockedUntil != nil && !e.BlockedUntil.After(now):
+			report.Skipped = append(report.Skipped, e.Host+": block expired")
+			continue
+		}
+		host := ip.String()
+		if !importEntry(host, e) {
+			report.Skipped = append(report.Skipped, host+": already blocked")
+			continue
+		}
+		if !e.Blocked {
+			report.Tracked++
+			continue
+		}
+		report.Blocked++
+		port := 0
+		if len(e.Ports) > 0 {
+			port = e.Ports[len(e.Ports)-1]
+		}
+		ev := &event{Time: now, Kind: eventAlarm, Host: host, Port: port, Proto: strings.ToUpper(*mode), ScanType: importScanType}
+		ev.ASN, ev.ASOrg = lookupAsn(ip)
+		ev.Country = lookupCountry(ip)
+		reportBlock(ev)
+	}
+	logMain(false, "imported %d tracked and %d blocked hosts, skipped %d", report.Tracked, report.Blocked, len(report.Skipped))
+	return report, nil
+}
+
+// merge e into the state of host, false if host is blocked already
+func importEntry(host string, e *hostEntry) bool {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	if _, ok := blockedAt[host]; ok {
+		return false
+	}
+	ports := stateEngine[host]
+	for _, port := range e.Ports {
+		known := false
+		for _, v := range ports {
+			known = known || v == port
+		}
+		if !known && port >= 0 && port <= 65535 {
+			ports = append(ports, port)
+		}
+	}
+	stateEngine[host] = ports
+	touchTracked(host)
+	if cfgScoring == scoringWeighted && e.Score > scores[host] {
+		scores[host] = e.Score
+	}
+	if e.Offenses > offenses[host] {
+		offenses[host] = e.Offenses
+	}
+	if e.Blocked {
+		// the import is an offense only if the export counted none
+		if e.Offenses == 0 {
+			offenses[host]++
+		}
+		blockedAt[host] = time.Now().Unix()
+		if e.BlockedAt != nil && e.BlockedAt.Before(time.Now()) {
+			blockedAt[host] = e.BlockedAt.Unix()
+		}
+	}
+	return true
+}
+
+// hosts of an export in any format, or a list of ips or /32 prefixes
+func parseHostEntries(data []byte) ([]*hostEntry, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		var entries []*hostEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+		return entries, nil
+	}
+	if bytes.HasPrefix(data, []byte("host,")) {
+		return parseHostCsv(data)
+	}
+
+	var entries []*hostEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		host := strings.TrimSuffix(line, "/32")
+		if ip := net.ParseIP(host); ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("line %d: %s isn't an ipv4 address or /32 prefix", lineno, line)
+		}
+		entries = append(entries, &hostEntry{Host: host, Blocked: true})
+	}
+	return entries, scanner.Err()
+}
+
+func parseHostCsv(data []byte) ([]*hostEntry, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var entries []*hostEntry
+	for i, r := range records[1:] {
+		if len(r) != 7 {
+			return nil, fmt.Errorf("line %d: %d fields, should be 7", i+2, len(r))
+		}
+		e := &hostEntry{Host: r[0]}
+		e.Blocked, err = strconv.ParseBool(r[1])
+		for _, s := range strings.Fields(r[2]) {
+			port, perr := strconv.Atoi(s)
+			if perr != nil && err == nil {
+				err = perr
+			}
+			e.Ports = append(e.Ports, port)
+		}
+		if err == nil && r[3] != "" {
+			e.Score, err = strconv.Atoi(r[3])
+		}
+		if err == nil && r[4] != "" {
+			e.Offenses, err = strconv.Atoi(r[4])
+		}
+		if err == nil {
+			e.BlockedAt, err = parseEntryTime(r[5])
+		}
+		if err == nil {
+			e.BlockedUntil, err = parseEntryTime(r[6])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+2, err.Error())
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func parseEntryTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,105 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// temporarily trusted hosts, ignored like ignore_ip until their trust expires
+// portguard trust [-for 30m] <ip> rescues a user who tripped the trigger: a blocked host is
+// unblocked and its responders undone, and what portguard knew about it is forgotten; the reply
+// lists responders that can't undo a block, like kill_route without kill_route_undo, in undo_by_hand
+
+const defaultTrustDuration = 30 * time.Minute
+
+var (
+	trustLock sync.Mutex
+	trusted   = make(map[string]time.Time) // ip to end of its trust
+)
+
+func isTrusted(ip net.IP) bool {
+	trustLock.Lock()
+	defer trustLock.Unlock()
+	if len(trusted) == 0 {
+		return false
+	}
+	key := ip.String()
+	until, ok := trusted[key]
+	if ok && !time.Now().Before(until) {
+		delete(trusted, key)
+		logMain(false, "Host: %s trust expired", key)
+		return false
+	}
+	return ok
+}
+
+// end of ip's trust, zero if it isn't trusted
+func trustedUntil(ip string) time.Time {
+	trustLock.Lock()
+	defer trustLock.Unlock()
+	if until, ok := trusted[ip]; ok && time.Now().Before(until) {
+		return until
+	}
+	return time.Time{}
+}
+
+// trust <ip> [duration], 30m by default, or trust <ip> off to end it
+func controlTrust(args []string) (interface{}, error) {
+	if len(args) == 0 || len(args) > 2 || net.ParseIP(args[0]) == nil || net.ParseIP(args[0]).To4() == nil {
+		return nil, errors.New("usage: trust <ipv4> [duration|off]")
+	}
+	ip := net.ParseIP(args[0]).String()
+	d := defaultTrustDuration
+	if len(args) > 1 && args[1] == "off" {
+		trustLock.Lock()
+		_, ok := trusted[ip]
+		delete(trusted, ip)
+		trustLock.Unlock()
+		if !ok {
+			return nil, errors.New(ip + " is not trusted")
+		}
+		logMain(false, "Host: %s trust ended by control socket", ip)
+		return map[string]interface{}{"host": ip, "trusted": false}, nil
+	}
+	if len(args) > 1 {
+		var err error
+		if d, err = time.ParseDuration(args[1]); err != nil || d <= 0 {
+			return nil, errors.New("invalid duration " + args[1])
+		}
+	}
+
+	until := time.Now().Add(d)
+	trustLock.Lock()
+	trusted[ip] = until
+	trustLock.Unlock()
+	logMain(false, "Host: %s trusted for %s", ip, d)
+
+	unblocked := unblockHost(ip, "trusted by control socket")
+	staged := false
+	if unblocked {
+		kvExpire(ip)
+	} else {
+		stateLock.Lock()
+		staged = stagedResponders(ip)
+		forgetTracked(ip)
+		stateLock.Unlock()
+		if staged {
+			runUnblockers(ip)
+		}
+	}
+	reply := map[string]interface{}{"host": ip, "trusted": true, "until": until, "unblocked": unblocked}
+	if unblocked || staged {
+		if names := responderNamesWithoutUndo(); len(names) > 0 {
+			reply["undo_by_hand"] = names
+			logMain(false, "Host: %s trusted, undo %s by hand", ip, strings.Join(names, ","))
+		}
+	}
+	return reply, nil
+}
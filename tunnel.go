@@ -0,0 +1,173 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// tunnel decapsulation
+// switches and cloud traffic mirroring send mirrored frames to a sensor in a tunnel: gre with the
+// ip packet or the ethernet frame, erspan type i, ii or iii over gre, or vxlan over udp; with
+// mirror_decap the tunnels listed are taken apart before tcp and udp parsing, on mirror interfaces
+// and in replay, nested tunnels too; vxlan is told by its udp port, mirror_vxlan_port
+// the vlan of an erspan header is the vlan of the frame, vlans in the frame itself come first
+
+const (
+	decapGre = 1 << iota
+	decapErspan
+	decapVxlan
+)
+
+var (
+	cfgMirrorDecap     int
+	cfgMirrorVxlanPort = portSet{{4789, 4789}}
+)
+
+const (
+	protoGRE = 47
+
+	greProtoIPv4     = 0x0800
+	greProtoEther    = 0x6558 // transparent ethernet bridging
+	greProtoErspan   = 0x88be // type i, or type ii if a sequence number is present
+	greProtoErspan3  = 0x22eb
+	greFlagChecksum  = 0x8000
+	greFlagKey       = 0x2000
+	greFlagSequence  = 0x1000
+	greVersionMask   = 0x0007
+	greUnknownFlags  = 0x4ff8 // routing, recursion and reserved bits of rfc 1701, not sent by mirrors
+	erspan2HeaderLen = 8
+	erspan3HeaderLen = 12
+	erspan3SubHeader = 8 // platform specific, if the o bit is set
+	vxlanHeaderLen   = 8
+	vxlanFlagVni     = 0x08
+)
+
+// mirror_decap = gre, erspan, vxlan or off
+func parseMirrorDecap(lineno int, token, value string) int {
+	decap := 0
+	for _, item := range strings.Split(value, ",") {
+		switch strings.TrimSpace(item) {
+		case "gre":
+			decap |= decapGre
+		case "erspan":
+			decap |= decapErspan
+		case "vxlan":
+			decap |= decapVxlan
+		case "off":
+		default:
+			logMain(true, "line %d:%s, invalid value:%s, should be a list of gre, erspan and vxlan, or off", lineno, token, value)
+		}
+	}
+	return decap
+}
+
+func mirrorDecapString() string {
+	var names []string
+	for _, d := range []struct {
+		bit  int
+		name string
+	}{{decapGre, "gre"}, {decapErspan, "erspan"}, {decapVxlan, "vxlan"}} {
+		if cfgMirrorDecap&d.bit != 0 {
+			names = append(names, d.name)
+		}
+	}
+	if len(names) == 0 {
+		return "off"
+	}
+	return strings.Join(names, ",")
+}
+
+// the inner packet of a tunneled ipv4 packet, with its link type and the vlan an erspan header
+// carries, false if packet isn't a tunnel of mirror_decap
+func decapTunnel(packet []byte) (dlt int, inner []byte, vlan int, ok bool) {
+	if len(packet) < 20 || packet[0]>>4 != 4 {
+		return 0, nil, 0, false
+	}
+	hlen := int(packet[0]&0x0f) * 4
+	// fragmented tunnels aren't reassembled
+	if hlen < 20 || len(packet) < hlen || binary.BigEndian.Uint16(packet[6:8])&0x3fff != 0 {
+		return 0, nil, 0, false
+	}
+	payload := packet[hlen:]
+	switch packet[9] {
+	case protoGRE:
+		if cfgMirrorDecap&(decapGre|decapErspan) != 0 {
+			return decapGRE(payload)
+		}
+	case protoUDP:
+		if cfgMirrorDecap&decapVxlan != 0 && len(payload) >= 8+vxlanHeaderLen &&
+			cfgMirrorVxlanPort.Contains(int(binary.BigEndian.Uint16(payload[2:4]))) &&
+			payload[8]&vxlanFlagVni != 0 {
+			statsAdd(&stats.decapsulated)
+			return dltEn10mb, payload[8+vxlanHeaderLen:], 0, true
+		}
+	}
+	return 0, nil, 0, false
+}
+
+func decapGRE(gre []byte) (dlt int, inner []byte, vlan int, ok bool) {
+	if len(gre) < 4 {
+		return 0, nil, 0, false
+	}
+	flags := binary.BigEndian.Uint16(gre[0:2])
+	if flags&(greVersionMask|greUnknownFlags) != 0 {
+		return 0, nil, 0, false
+	}
+	proto := binary.BigEndian.Uint16(gre[2:4])
+	n := 4
+	for _, f := range []uint16{greFlagChecksum, greFlagKey, greFlagSequence} {
+		if flags&f != 0 {
+			n += 4
+		}
+	}
+	if len(gre) < n {
+		return 0, nil, 0, false
+	}
+	payload := gre[n:]
+	switch {
+	case proto == greProtoIPv4 && cfgMirrorDecap&decapGre != 0:
+		dlt = dltRaw
+	case proto == greProtoEther && cfgMirrorDecap&decapGre != 0:
+		dlt = dltEn10mb
+	case proto == greProtoErspan && cfgMirrorDecap&decapErspan != 0:
+		dlt = dltEn10mb
+		// type ii has a sequence number and its own header, type i has neither
+		if flags&greFlagSequence != 0 {
+			if len(payload) < erspan2HeaderLen {
+				return 0, nil, 0, false
+			}
+			vlan = int(binary.BigEndian.Uint16(payload[0:2]) & 0x0fff)
+			payload = payload[erspan2HeaderLen:]
+		}
+	case proto == greProtoErspan3 && cfgMirrorDecap&decapErspan != 0:
+		if len(payload) < erspan3HeaderLen {
+			return 0, nil, 0, false
+		}
+		// frame type 0 is an ethernet frame, 2 an ip packet
+		switch payload[10] >> 2 & 0x1f {
+		case 0:
+			dlt = dltEn10mb
+		case 2:
+			dlt = dltRaw
+		default:
+			return 0, nil, 0, false
+		}
+		vlan = int(binary.BigEndian.Uint16(payload[0:2]) & 0x0fff)
+		skip := erspan3HeaderLen
+		if payload[11]&0x01 != 0 {
+			skip += erspan3SubHeader
+		}
+		if len(payload) < skip {
+			return 0, nil, 0, false
+		}
+		payload = payload[skip:]
+	default:
+		return 0, nil, 0, false
+	}
+	statsAdd(&stats.decapsulated)
+	return dlt, payload, vlan, true
+}
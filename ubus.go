@@ -0,0 +1,66 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ubus events
+// with ubus_events on, events are sent on the openwrt bus as portguard.<event>, e.g. portguard.alarm
+// and portguard.block, with the event_log record as data, for luci apps and scripts:
+//
+//	ubus listen portguard.block
+//
+// they're sent with the ubus tool, one run per event, so the sink is best kept to blocks on a busy
+// router with severity.ubus = critical
+
+const ubusTimeout = 5 * time.Second
+
+var (
+	cfgUbusEvents bool
+
+	ubusEvents chan *event
+)
+
+// queue event for ubus, dropped if the sender falls behind
+func ubusEvent(ev *event) {
+	if ubusEvents == nil {
+		return
+	}
+	queueEvent(ubusEvents, ev, "ubus")
+}
+
+func ubusSend(ev *event) error {
+	data, err := json.Marshal(ev.record())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ubusTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "ubus", "send", "portguard."+ev.Kind, string(data)).CombinedOutput()
+	if err != nil && len(out) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return err
+}
+
+func startUbus() {
+	ubusEvents = make(chan *event, cfgEventQueue)
+	go runUbus()
+}
+
+func runUbus() {
+	for ev := range ubusEvents {
+		if err := ubusSend(ev); err != nil {
+			logDebug("send event to ubus failed:%s", err.Error())
+		}
+	}
+}
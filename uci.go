@@ -0,0 +1,149 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// uci config
+// on openwrt the config may be a uci file, like /etc/config/portguard, told from a config of
+// key = value lines by its first statement, config or package; options and lists of a section
+// map to keys by the section type:
+//
+//	config portguard 'main'      option scan_trigger '3'   scan_trigger = 3
+//	                             list exclude_port '22'    exclude_port = 22, once per list item
+//	config severity              option journald 'info'    severity.journald = info
+//	config responder 'chat'      option url 'https://..'   responder.chat.url = https://..
+//
+// options enabled and mode of a portguard section are left to the init script
+
+type uciKey struct {
+	lineno int
+	token  string
+	value  string
+}
+
+// if data is a uci file
+func isUciConfig(data string) bool {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		return fields[0] == "config" || fields[0] == "package"
+	}
+	return false
+}
+
+// words of a uci line, unquoted; '...' is taken literally, "..." and bare words take \ escapes,
+// and quoted parts next to each other are one word, as in 'it'\”s'
+func uciWords(line string) ([]string, bool) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '#' && !inWord:
+			return words, true
+		case c == ' ' || c == '\t' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, false
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+				}
+				word.WriteByte(line[i])
+			}
+			if i == len(line) {
+				return nil, false
+			}
+			inWord = true
+		case c == '\\' && i+1 < len(line):
+			i++
+			word.WriteByte(line[i])
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, true
+}
+
+// keys of a uci file, in order
+func uciKeys(data string) ([]uciKey, error) {
+	var keys []uciKey
+	var section string // key prefix of the current section, "" for a portguard section
+	var inSection, isMain bool
+	for i, line := range strings.Split(data, "\n") {
+		lineno := i + 1
+		words, ok := uciWords(line)
+		if !ok {
+			return nil, fmt.Errorf("line %d, unterminated quote", lineno)
+		}
+		if len(words) == 0 {
+			continue
+		}
+		switch words[0] {
+		case "package":
+		case "config":
+			if len(words) < 2 || len(words) > 3 {
+				return nil, fmt.Errorf("line %d, should be config <type> [name]", lineno)
+			}
+			inSection, isMain, section = true, words[1] == "portguard", ""
+			if !isMain {
+				section = words[1] + "."
+				if len(words) == 3 {
+					section += words[2] + "."
+				}
+			}
+		case "option", "list":
+			if len(words) != 3 {
+				return nil, fmt.Errorf("line %d, should be %s <name> <value>", lineno, words[0])
+			}
+			if !inSection {
+				return nil, fmt.Errorf("line %d, %s outside of a config section", lineno, words[0])
+			}
+			if isMain && (words[1] == "enabled" || words[1] == "mode") {
+				continue
+			}
+			if words[2] != "" {
+				keys = append(keys, uciKey{lineno, strings.ToLower(section + words[1]), expandConfigEnv(words[2])})
+			}
+		default:
+			return nil, fmt.Errorf("line %d, unknown statement %s", lineno, words[0])
+		}
+	}
+	return keys, nil
+}
+
+func readUciConfig(file string, data string) {
+	keys, err := uciKeys(data)
+	if err != nil {
+		logMain(true, "read uci config %s failed:%s", file, err.Error())
+	}
+	for _, k := range keys {
+		setConfig(k.lineno, k.token, k.value)
+	}
+}
@@ -5,8 +5,8 @@
 package main
 
 import (
-	"bytes"
 	"encoding/binary"
+	"errors"
 )
 
 type UDPHeader struct {
@@ -16,11 +16,31 @@ type UDPHeader struct {
 	Checksum    uint16
 }
 
-func NewUDPHeader(data []byte, udp *UDPHeader) *UDPHeader {
-	r := bytes.NewReader(data)
-	binary.Read(r, binary.BigEndian, &udp.Source)
-	binary.Read(r, binary.BigEndian, &udp.Destination)
-	binary.Read(r, binary.BigEndian, &udp.Length)
-	binary.Read(r, binary.BigEndian, &udp.Checksum)
-	return udp
+var errUDPHeader = errors.New("invalid udp header")
+
+// a datagram shorter than 8 bytes, or whose length field is below the header size, is rejected
+func NewUDPHeader(data []byte, udp *UDPHeader) error {
+	if len(data) < 8 {
+		return errUDPHeader
+	}
+	udp.Source = binary.BigEndian.Uint16(data[0:2])
+	udp.Destination = binary.BigEndian.Uint16(data[2:4])
+	udp.Length = binary.BigEndian.Uint16(data[4:6])
+	udp.Checksum = binary.BigEndian.Uint16(data[6:8])
+	if udp.Length < 8 {
+		return errUDPHeader
+	}
+	return nil
+}
+
+// payload of datagram data, bounded by the length field unless the read was cut short
+func (udp *UDPHeader) Payload(data []byte) []byte {
+	end := int(udp.Length)
+	if end > len(data) {
+		end = len(data)
+	}
+	if end < 8 {
+		return nil
+	}
+	return data[8:end]
 }
@@ -0,0 +1,24 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import "testing"
+
+func FuzzNewUDPHeader(f *testing.F) {
+	f.Add([]byte{0x13, 0x89, 0x00, 0x35, 0x00, 0x0c, 0, 0, 1, 2, 3, 4})
+	f.Add([]byte{0x13, 0x89, 0x00, 0x35, 0xff, 0xff, 0, 0, 1, 2})
+	f.Add([]byte{0x13, 0x89, 0x00, 0x35, 0x00, 0x04, 0, 0})
+	f.Add([]byte{0x13, 0x89, 0x00})
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var udp UDPHeader
+		if err := NewUDPHeader(data, &udp); err != nil {
+			return
+		}
+		if payload := udp.Payload(data); len(payload) > len(data) {
+			t.Fatalf("payload of %d bytes out of a %d byte datagram", len(payload), len(data))
+		}
+	})
+}
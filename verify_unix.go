@@ -0,0 +1,33 @@
+//go:build unix
+
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// if port is in used on laddr
+// net.Listen will auto set SO_REUSEADDR when listen a port
+func smartVerifyPort(laddr net.IP, port int) bool {
+	stype := syscall.SOCK_STREAM
+	if *mode == "udp" {
+		stype = syscall.SOCK_DGRAM
+	}
+	fd, err := syscall.Socket(syscall.AF_INET, stype, 0)
+	if err != nil {
+		return false
+	}
+	addr := syscall.SockaddrInet4{Port: port}
+	copy(addr.Addr[:], laddr.To4())
+	err = syscall.Bind(fd, &addr)
+	syscall.Close(fd)
+	if err != nil {
+		return true
+	}
+	return false
+}
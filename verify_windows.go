@@ -0,0 +1,30 @@
+/*
+	date: 2026-10-15
+	author: xjdrew
+*/
+package main
+
+import (
+	"net"
+	"strconv"
+)
+
+// if port is in used on laddr
+// windows doesn't set SO_REUSEADDR, a listen fails if port is in use
+func smartVerifyPort(laddr net.IP, port int) bool {
+	addr := net.JoinHostPort(laddr.String(), strconv.Itoa(port))
+	if *mode == "udp" {
+		conn, err := net.ListenPacket("udp4", addr)
+		if err != nil {
+			return true
+		}
+		conn.Close()
+		return false
+	}
+	ln, err := net.Listen("tcp4", addr)
+	if err != nil {
+		return true
+	}
+	ln.Close()
+	return false
+}
@@ -0,0 +1,86 @@
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// alarms and blocks for wazuh or ossec, written to the analysisd queue socket wazuh_socket
+// as local log lines, so existing rules keep working after a move from portsentry:
+//
+//	portsentry  syslog lines of program portsentry, as wazuh's portsentry decoders expect:
+//	            attackalert: SYN/Normal scan from host: 1.2.3.4/1.2.3.4 to TCP port: 23
+//	            attackalert: Host 1.2.3.4 has been blocked via portguard
+//	json        event_log records, for wazuh's json decoder
+//
+// the socket is connected before chroot
+
+const (
+	wazuhPortsentry = "portsentry"
+	wazuhJson       = "json"
+
+	wazuhLocalfileQueue = '1' // queue of local log files
+)
+
+var (
+	cfgWazuhOutput string
+	cfgWazuhSocket = "/var/ossec/queue/sockets/queue"
+
+	wazuhLock sync.Mutex
+	wazuhConn net.Conn
+	wazuhHost string
+)
+
+func openWazuh() error {
+	conn, err := net.Dial("unixgram", cfgWazuhSocket)
+	if err != nil {
+		return err
+	}
+	wazuhConn = conn
+	wazuhHost, _ = os.Hostname()
+	return nil
+}
+
+func wazuhEvent(ev *event) {
+	if wazuhConn == nil || (ev.Kind != eventAlarm && ev.Kind != eventBlock) {
+		return
+	}
+	var msg string
+	if cfgWazuhOutput == wazuhJson {
+		data, err := json.Marshal(ev.record())
+		if err != nil {
+			return
+		}
+		msg = fmt.Sprintf("%c:portguard:%s", wazuhLocalfileQueue, data)
+	} else {
+		line := fmt.Sprintf("attackalert: %s from host: %s/%s to %s port: %d", portsentryScanType(ev.ScanType), ev.Host, ev.Host, ev.Proto, ev.Port)
+		if ev.Kind == eventBlock {
+			line = fmt.Sprintf("attackalert: Host %s has been blocked via portguard", ev.Host)
+		}
+		msg = fmt.Sprintf("%c:portguard:%s %s portsentry[%d]: %s", wazuhLocalfileQueue,
+			time.Now().Format(time.Stamp), wazuhHost, os.Getpid(), line)
+	}
+	wazuhLock.Lock()
+	defer wazuhLock.Unlock()
+	if _, err := wazuhConn.Write([]byte(msg)); err != nil {
+		logDebug("write event to wazuh socket %s failed:%s", cfgWazuhSocket, err.Error())
+	}
+}
+
+// scan type as portsentry names it, without the protocol portguard puts first
+func portsentryScanType(scanType string) string {
+	for _, prefix := range []string{"TCP ", "UDP "} {
+		if len(scanType) > len(prefix) && scanType[:len(prefix)] == prefix {
+			return scanType[len(prefix):]
+		}
+	}
+	return scanType
+}
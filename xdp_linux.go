@@ -0,0 +1,349 @@
+//go:build linux && (amd64 || arm64)
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// bpf constants, see linux/bpf.h
+const (
+	bpfMapCreate     = 0
+	bpfMapUpdateElem = 2
+	bpfMapDeleteElem = 3
+	bpfMapGetNextKey = 4
+	bpfProgLoad      = 5
+	bpfObjPin        = 6
+	bpfObjGet        = 7
+
+	bpfMapTypeHash = 1
+	bpfProgTypeXdp = 6
+	bpfPseudoMapFd = 1
+
+	iflaXdp      = 43
+	iflaXdpFd    = 1
+	iflaXdpFlags = 3
+
+	xdpFlagsSkbMode = 2
+	xdpFlagsDrvMode = 4
+)
+
+// map value: when the host was blocked and packets dropped since, read with
+// bpftool map dump pinned <xdp_map_pin>
+const xdpValueSize = 16
+
+var (
+	xdpMapFd  = -1
+	xdpProgFd = -1
+	xdpLinks  []int // ifindex the program is attached to
+)
+
+type bpfMapAttr struct {
+	mapType    uint32
+	keySize    uint32
+	valueSize  uint32
+	maxEntries uint32
+	mapFlags   uint32
+	innerMapFd uint32
+	numaNode   uint32
+	mapName    [16]byte
+}
+
+type bpfElemAttr struct {
+	mapFd uint32
+	_     uint32
+	key   uint64
+	value uint64 // next key for bpfMapGetNextKey
+	flags uint64
+}
+
+type bpfProgAttr struct {
+	progType    uint32
+	insnCnt     uint32
+	insns       uint64
+	license     uint64
+	logLevel    uint32
+	logSize     uint32
+	logBuf      uint64
+	kernVersion uint32
+	progFlags   uint32
+	progName    [16]byte
+}
+
+type bpfObjAttr struct {
+	pathname  uint64
+	bpfFd     uint32
+	fileFlags uint32
+}
+
+func bpfCall(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	r, _, errno := syscall.Syscall(sysBpf, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(r), nil
+}
+
+// the xdp program: drop ipv4 packets whose source is a key of the map, and count them
+//
+//	r2 = ctx->data; r3 = ctx->data_end
+//	if data + 34 > data_end or ethertype != ipv4 goto pass
+//	key = saddr; r0 = map_lookup_elem(map, &key)
+//	if r0 == 0 goto pass
+//	r0->drops += 1; return XDP_DROP
+//	pass: return XDP_PASS
+func xdpProgram(mapFd int) []byte {
+	type insn struct {
+		code uint8
+		regs uint8 // src<<4 | dst
+		off  int16
+		imm  int32
+	}
+	prog := []insn{
+		{0x61, 1<<4 | 2, 0, 0},                         // r2 = *(u32 *)(r1 + 0)
+		{0x61, 1<<4 | 3, 4, 0},                         // r3 = *(u32 *)(r1 + 4)
+		{0xbf, 2<<4 | 4, 0, 0},                         // r4 = r2
+		{0x07, 4, 0, 34},                               // r4 += 34
+		{0x2d, 3<<4 | 4, 14, 0},                        // if r4 > r3 goto pass
+		{0x69, 2<<4 | 5, 12, 0},                        // r5 = *(u16 *)(r2 + 12)
+		{0x55, 5, 12, 0x0008},                          // if r5 != htons(0x0800) goto pass
+		{0x61, 2<<4 | 5, 26, 0},                        // r5 = *(u32 *)(r2 + 26)
+		{0x63, 5<<4 | 10, -4, 0},                       // *(u32 *)(r10 - 4) = r5
+		{0x18, bpfPseudoMapFd<<4 | 1, 0, int32(mapFd)}, // r1 = map
+		{0, 0, 0, 0},
+		{0xbf, 10<<4 | 2, 0, 0}, // r2 = r10
+		{0x07, 2, 0, -4},        // r2 += -4
+		{0x85, 0, 0, 1},         // call map_lookup_elem
+		{0x15, 0, 4, 0},         // if r0 == 0 goto pass
+		{0xb7, 1, 0, 1},         // r1 = 1
+		{0xdb, 1<<4 | 0, 8, 0},  // lock *(u64 *)(r0 + 8) += r1
+		{0xb7, 0, 0, 1},         // r0 = XDP_DROP
+		{0x95, 0, 0, 0},         // exit
+		{0xb7, 0, 0, 2},         // pass: r0 = XDP_PASS
+		{0x95, 0, 0, 0},         // exit
+	}
+	b := make([]byte, 0, len(prog)*8)
+	for _, i := range prog {
+		b = append(b, i.code, i.regs)
+		b = binary.LittleEndian.AppendUint16(b, uint16(i.off))
+		b = binary.LittleEndian.AppendUint32(b, uint32(i.imm))
+	}
+	return b
+}
+
+// open the pinned map, or create and pin it
+func xdpOpenMap() (int, error) {
+	path, _ := syscall.BytePtrFromString(cfgXdpMapPin)
+	obj := bpfObjAttr{pathname: uint64(uintptr(unsafe.Pointer(path)))}
+	fd, err := bpfCall(bpfObjGet, unsafe.Pointer(&obj), unsafe.Sizeof(obj))
+	if err == nil {
+		return fd, nil
+	}
+	if err != syscall.ENOENT {
+		logMain(false, "WARNING open pinned xdp map %s failed:%s, creating a new one", cfgXdpMapPin, err.Error())
+	}
+
+	attr := bpfMapAttr{mapType: bpfMapTypeHash, keySize: 4, valueSize: xdpValueSize, maxEntries: uint32(cfgXdpMaxEntries)}
+	copy(attr.mapName[:], "portguard")
+	fd, err = bpfCall(bpfMapCreate, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err != nil {
+		return -1, fmt.Errorf("create map:%w", err)
+	}
+	obj.bpfFd = uint32(fd)
+	if _, err := bpfCall(bpfObjPin, unsafe.Pointer(&obj), unsafe.Sizeof(obj)); err != nil {
+		logMain(false, "WARNING pin xdp map to %s failed:%s, blocks won't survive a restart", cfgXdpMapPin, err.Error())
+	}
+	return fd, nil
+}
+
+func xdpLoadProgram(mapFd int) (int, error) {
+	insns := xdpProgram(mapFd)
+	license := []byte("GPL\x00")
+	logBuf := make([]byte, 65536)
+	attr := bpfProgAttr{
+		progType: bpfProgTypeXdp,
+		insnCnt:  uint32(len(insns) / 8),
+		insns:    uint64(uintptr(unsafe.Pointer(&insns[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+		logLevel: 1,
+		logSize:  uint32(len(logBuf)),
+		logBuf:   uint64(uintptr(unsafe.Pointer(&logBuf[0]))),
+	}
+	copy(attr.progName[:], "portguard")
+	fd, err := bpfCall(bpfProgLoad, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err != nil {
+		if n := clen(logBuf); n > 0 {
+			return -1, fmt.Errorf("%w: %s", err, logBuf[:n])
+		}
+		return -1, err
+	}
+	return fd, nil
+}
+
+func clen(b []byte) int {
+	for i, c := range b {
+		if c == 0 {
+			return i
+		}
+	}
+	return len(b)
+}
+
+// attach progFd to ifindex with rtnetlink, -1 detaches
+func xdpAttach(ifindex int, progFd int, flags uint32) error {
+	xdp := netlinkAttr(nil, iflaXdpFd, netlinkUint32(uint32(int32(progFd))))
+	if flags != 0 {
+		xdp = netlinkAttr(xdp, iflaXdpFlags, netlinkUint32(flags))
+	}
+	// ifinfomsg: family, pad, type, index, flags, change
+	body := make([]byte, syscall.SizeofIfInfomsg)
+	binary.NativeEndian.PutUint32(body[4:], uint32(ifindex))
+	body = netlinkAttr(body, iflaXdp|syscall.NLA_F_NESTED, xdp)
+	return netlinkRequest(syscall.NETLINK_ROUTE, syscall.RTM_SETLINK, 0, body)
+}
+
+// load the program and map, sync the map with blocks restored from state_file and
+// attach to every xdp_interface
+func startXdp() error {
+	var err error
+	if xdpMapFd, err = xdpOpenMap(); err != nil {
+		return err
+	}
+	if xdpProgFd, err = xdpLoadProgram(xdpMapFd); err != nil {
+		return fmt.Errorf("load program:%w", err)
+	}
+	xdpSyncMap()
+
+	for _, name := range cfgXdpInterfaces {
+		ifi, err := net.InterfaceByName(name)
+		if err != nil {
+			return err
+		}
+		switch cfgXdpMode {
+		case "native":
+			err = xdpAttach(ifi.Index, xdpProgFd, xdpFlagsDrvMode)
+		case "generic":
+			err = xdpAttach(ifi.Index, xdpProgFd, xdpFlagsSkbMode)
+		default:
+			if err = xdpAttach(ifi.Index, xdpProgFd, xdpFlagsDrvMode); err != nil {
+				logMain(false, "driver of %s has no native xdp (%s), using generic mode", name, err.Error())
+				err = xdpAttach(ifi.Index, xdpProgFd, xdpFlagsSkbMode)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("attach to %s:%w", name, err)
+		}
+		xdpLinks = append(xdpLinks, ifi.Index)
+	}
+	return nil
+}
+
+// detach from interfaces, the pinned map keeps its entries for the next start
+func stopXdp() {
+	for _, ifindex := range xdpLinks {
+		if err := xdpAttach(ifindex, -1, 0); err != nil {
+			logMain(false, "detach xdp program from interface %d failed:%s", ifindex, err.Error())
+		}
+	}
+	xdpLinks = nil
+}
+
+// delete map entries not blocked any more, add blocks missing from the map
+func xdpSyncMap() {
+	stateLock.Lock()
+	blocked := make(map[string]int64, len(blockedAt))
+	for ip, at := range blockedAt {
+		blocked[ip] = at
+	}
+	stateLock.Unlock()
+
+	var stale []net.IP
+	var key, next [4]byte
+	attr := bpfElemAttr{mapFd: uint32(xdpMapFd), value: uint64(uintptr(unsafe.Pointer(&next)))}
+	for {
+		if _, err := bpfCall(bpfMapGetNextKey, unsafe.Pointer(&attr), unsafe.Sizeof(attr)); err != nil {
+			break
+		}
+		ip := net.IPv4(next[0], next[1], next[2], next[3])
+		if _, ok := blocked[ip.String()]; ok {
+			delete(blocked, ip.String())
+		} else {
+			stale = append(stale, ip)
+		}
+		key = next
+		attr.key = uint64(uintptr(unsafe.Pointer(&key)))
+	}
+	for _, ip := range stale {
+		xdpDelete(ip.String())
+	}
+	for ip, at := range blocked {
+		if err := xdpUpdate(ip, at); err != nil {
+			logMain(false, "add %s to xdp map failed:%s", ip, err.Error())
+		}
+	}
+	if len(stale) > 0 {
+		logMain(false, "removed %d expired hosts from xdp map %s", len(stale), cfgXdpMapPin)
+	}
+}
+
+func xdpKey(ip string) ([4]byte, error) {
+	var key [4]byte
+	ip4 := net.ParseIP(ip).To4()
+	if ip4 == nil {
+		return key, errors.New("not an ipv4 address")
+	}
+	copy(key[:], ip4)
+	return key, nil
+}
+
+func xdpUpdate(ip string, at int64) error {
+	key, err := xdpKey(ip)
+	if err != nil {
+		return err
+	}
+	var value [xdpValueSize]byte
+	binary.LittleEndian.PutUint64(value[:], uint64(at))
+	attr := bpfElemAttr{
+		mapFd: uint32(xdpMapFd),
+		key:   uint64(uintptr(unsafe.Pointer(&key))),
+		value: uint64(uintptr(unsafe.Pointer(&value))),
+	}
+	_, err = bpfCall(bpfMapUpdateElem, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	return err
+}
+
+func xdpDelete(ip string) error {
+	key, err := xdpKey(ip)
+	if err != nil {
+		return err
+	}
+	attr := bpfElemAttr{mapFd: uint32(xdpMapFd), key: uint64(uintptr(unsafe.Pointer(&key)))}
+	if _, err = bpfCall(bpfMapDeleteElem, unsafe.Pointer(&attr), unsafe.Sizeof(attr)); err == syscall.ENOENT {
+		return nil
+	}
+	return err
+}
+
+func xdpBlock(ip string) error {
+	if xdpMapFd < 0 {
+		return errors.New("xdp is not started")
+	}
+	return xdpUpdate(ip, time.Now().Unix())
+}
+
+func xdpUnblock(ip string) error {
+	if xdpMapFd < 0 {
+		return errors.New("xdp is not started")
+	}
+	return xdpDelete(ip)
+}
@@ -0,0 +1,16 @@
+//go:build !linux || (!amd64 && !arm64)
+
+/*
+	date: 2026-10-16
+	author: xjdrew
+*/
+package main
+
+import "errors"
+
+var errNoXdp = errors.New("xdp is only supported on linux amd64 and arm64")
+
+func startXdp() error            { return errNoXdp }
+func stopXdp()                   {}
+func xdpBlock(ip string) error   { return errNoXdp }
+func xdpUnblock(ip string) error { return errNoXdp }